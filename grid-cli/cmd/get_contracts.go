@@ -10,7 +10,6 @@ import (
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-cli/internal/config"
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/deployer"
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/graphql"
-	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
 )
 
 // getContractsCmd represents the get contracts command
@@ -31,7 +30,7 @@ var getContractsCmd = &cobra.Command{
 		if err != nil {
 			log.Fatal().Err(err).Send()
 		}
-		printContractTables(contracts, cmd.OutOrStdout())
+		printContractTables(t.ContractsGetter, contracts, cmd.OutOrStdout())
 	},
 }
 
@@ -39,7 +38,7 @@ func init() {
 	getCmd.AddCommand(getContractsCmd)
 }
 
-func printContractTables(contracts graphql.Contracts, writer io.Writer) {
+func printContractTables(contractsGetter graphql.ContractsGetter, contracts graphql.Contracts, writer io.Writer) {
 	fmt.Fprintln(writer, "Node contracts:")
 
 	nodeTable := tabwriter.NewWriter(writer, 0, 0, 4, ' ', 0)
@@ -47,7 +46,7 @@ func printContractTables(contracts graphql.Contracts, writer io.Writer) {
 	for _, contract := range contracts.NodeContracts {
 		// ignoring the error because deployment data does not have a standard structure throughout the grid
 		// it will be displayed as empty columns in case it failed
-		data, _ := workloads.ParseDeploymentData(contract.DeploymentData)
+		data, _ := contractsGetter.ParseDeploymentData(contract)
 		fmt.Fprintf(nodeTable, "%s\t%d\t%s\t%s\t%s\n", contract.ContractID, contract.NodeID, data.Type, data.Name, data.ProjectName)
 	}
 	nodeTable.Flush()
@@ -0,0 +1,238 @@
+// Package billing for contracts billing history and spend forecasting
+package billing
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/graphql"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/subi"
+	proxy "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/client"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+)
+
+// billsPageSize is the number of bills requested from the grid proxy at once
+const billsPageSize = 100
+
+// ContractType is the type of a billed contract
+type ContractType string
+
+const (
+	// NodeContract is the type of node contracts
+	NodeContract ContractType = "node"
+	// NameContract is the type of name contracts
+	NameContract ContractType = "name"
+	// RentContract is the type of rent contracts
+	RentContract ContractType = "rent"
+)
+
+// Bill is a contract bill
+type Bill struct {
+	// Amount is the billed amount in TFT
+	Amount    float64
+	Timestamp time.Time
+}
+
+// ContractSpend is the spend of a contract in a period
+type ContractSpend struct {
+	ContractID uint64
+	Type       ContractType
+	State      string
+	// NodeID is the node of node and rent contracts
+	NodeID uint32
+	// Name is the deployment name of node contracts and the gateway name of name contracts
+	Name string
+	// DeploymentType and ProjectName are parsed from node contracts deployment data
+	DeploymentType string
+	ProjectName    string
+	Bills          []Bill
+	// Total is the total billed amount in TFT
+	Total float64
+}
+
+// Report is the spend of the twin contracts in a period
+type Report struct {
+	From      time.Time
+	To        time.Time
+	Contracts []ContractSpend
+	// Total is the total billed amount in TFT
+	Total float64
+
+	// spend in TFT aggregated by project name, deployment type (or contract type) and node
+	ByProject map[string]float64
+	ByType    map[string]float64
+	ByNode    map[uint32]float64
+}
+
+// Forecast is the forecast of the twin balance at the report burn rate
+type Forecast struct {
+	// Balance is the free twin balance in TFT
+	Balance float64
+	// BurnRate is the spend in TFT per hour
+	BurnRate float64
+	// Remaining is the time until the balance runs out, it is zero if nothing is spent
+	Remaining time.Duration
+	// RunOut is the time the balance runs out at, it is zero if nothing is spent
+	RunOut time.Time
+}
+
+// Billing gets the bills of the twin contracts
+type Billing struct {
+	identity        substrate.Identity
+	substrateConn   subi.SubstrateExt
+	gridProxyClient proxy.Client
+	contractsGetter graphql.ContractsGetter
+}
+
+// NewBilling creates a new Billing
+func NewBilling(identity substrate.Identity, substrateConn subi.SubstrateExt, gridProxyClient proxy.Client, contractsGetter graphql.ContractsGetter) Billing {
+	return Billing{
+		identity:        identity,
+		substrateConn:   substrateConn,
+		gridProxyClient: gridProxyClient,
+		contractsGetter: contractsGetter,
+	}
+}
+
+// Report gets the bills of the twin active contracts since the given time and aggregates their spend
+func (b *Billing) Report(ctx context.Context, since time.Time) (Report, error) {
+	contracts, err := b.contractsGetter.ListContractsByTwinID([]string{"Created", "GracePeriod"})
+	if err != nil {
+		return Report{}, errors.Wrap(err, "could not list twin contracts")
+	}
+
+	report := Report{
+		From:      since,
+		To:        time.Now(),
+		ByProject: make(map[string]float64),
+		ByType:    make(map[string]float64),
+		ByNode:    make(map[uint32]float64),
+	}
+
+	// contracts are processed in a fixed order so the aggregated totals are the same between runs
+	contractTypes := []ContractType{NodeContract, NameContract, RentContract}
+	for i, list := range [][]graphql.Contract{contracts.NodeContracts, contracts.NameContracts, contracts.RentContracts} {
+		for _, contract := range list {
+			spend, err := b.newContractSpend(contractTypes[i], contract)
+			if err != nil {
+				return Report{}, err
+			}
+
+			spend.Bills, err = b.ContractBills(ctx, spend.ContractID, since)
+			if err != nil {
+				return Report{}, err
+			}
+
+			for _, bill := range spend.Bills {
+				spend.Total += bill.Amount
+			}
+			report.add(spend)
+		}
+	}
+
+	slices.SortFunc(report.Contracts, func(a, b ContractSpend) int {
+		return cmp.Compare(a.ContractID, b.ContractID)
+	})
+	return report, nil
+}
+
+// ContractBills gets the bills of a contract since the given time, newest first
+func (b *Billing) ContractBills(ctx context.Context, contractID uint64, since time.Time) ([]Bill, error) {
+	var bills []Bill
+	for page := uint64(1); ; page++ {
+		res, _, err := b.gridProxyClient.ContractBills(ctx, uint32(contractID), proxyTypes.Limit{Size: billsPageSize, Page: page})
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not get contract %d bills", contractID)
+		}
+
+		// bills are sorted by their timestamp in descending order
+		for _, bill := range res {
+			timestamp := time.Unix(int64(bill.Timestamp), 0)
+			if timestamp.Before(since) {
+				return bills, nil
+			}
+			bills = append(bills, Bill{Amount: tft(bill.AmountBilled), Timestamp: timestamp})
+		}
+
+		if len(res) < billsPageSize {
+			return bills, nil
+		}
+	}
+}
+
+// Forecast forecasts when the twin free balance runs out at the burn rate of the given report
+func (b *Billing) Forecast(report Report) (Forecast, error) {
+	balance, err := b.substrateConn.GetBalance(b.identity)
+	if err != nil {
+		return Forecast{}, errors.Wrap(err, "could not get twin balance")
+	}
+
+	forecast := Forecast{Balance: tft(balance.Free.Uint64())}
+	hours := report.To.Sub(report.From).Hours()
+	if hours <= 0 || report.Total == 0 {
+		return forecast, nil
+	}
+
+	forecast.BurnRate = report.Total / hours
+	forecast.Remaining = time.Duration(forecast.Balance / forecast.BurnRate * float64(time.Hour))
+	forecast.RunOut = report.To.Add(forecast.Remaining)
+	return forecast, nil
+}
+
+func (b *Billing) newContractSpend(contractType ContractType, contract graphql.Contract) (ContractSpend, error) {
+	contractID, err := strconv.ParseUint(contract.ContractID, 10, 64)
+	if err != nil {
+		return ContractSpend{}, errors.Wrapf(err, "could not parse contract id %s", contract.ContractID)
+	}
+
+	spend := ContractSpend{
+		ContractID: contractID,
+		Type:       contractType,
+		State:      contract.State,
+		NodeID:     contract.NodeID,
+		Name:       contract.Name,
+	}
+	if contractType != NodeContract {
+		return spend, nil
+	}
+
+	deploymentData, err := b.contractsGetter.ParseDeploymentData(contract)
+	if err != nil {
+		log.Warn().Err(err).Str("id", contract.ContractID).Msg("got contract with invalid metadata")
+		return spend, nil
+	}
+	spend.Name = deploymentData.Name
+	spend.DeploymentType = deploymentData.Type
+	spend.ProjectName = deploymentData.ProjectName
+	return spend, nil
+}
+
+func (r *Report) add(spend ContractSpend) {
+	r.Contracts = append(r.Contracts, spend)
+	r.Total += spend.Total
+
+	if spend.ProjectName != "" {
+		r.ByProject[spend.ProjectName] += spend.Total
+	}
+
+	spendType := spend.DeploymentType
+	if spendType == "" {
+		spendType = string(spend.Type)
+	}
+	r.ByType[spendType] += spend.Total
+
+	if spend.NodeID != 0 {
+		r.ByNode[spend.NodeID] += spend.Total
+	}
+}
+
+// tft converts an amount in the chain units to TFT
+func tft(amount uint64) float64 {
+	return float64(amount) / 1e7
+}
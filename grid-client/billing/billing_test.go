@@ -0,0 +1,118 @@
+package billing
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/graphql"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/mocks"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+)
+
+func newTestContractsGetter(t *testing.T, contracts graphql.Contracts) graphql.ContractsGetter {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Query string `json:"query"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+
+		var data interface{} = contracts
+		if strings.Contains(body.Query, "Connection") {
+			data = map[string]interface{}{"items": map[string]interface{}{"count": 10}}
+		}
+		assert.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{"data": data}))
+	}))
+	t.Cleanup(server.Close)
+
+	gql, err := graphql.NewGraphQl(server.URL)
+	require.NoError(t, err)
+
+	return graphql.NewContractsGetter(1, gql, nil, nil)
+}
+
+func TestBilling(t *testing.T) {
+	identity, err := substrate.NewIdentityFromSr25519Phrase("//Alice")
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sub := mocks.NewMockSubstrateExt(ctrl)
+	proxyCl := mocks.NewMockClient(ctrl)
+
+	contractsGetter := newTestContractsGetter(t, graphql.Contracts{
+		NodeContracts: []graphql.Contract{
+			{ContractID: "1", NodeID: 10, State: "Created", DeploymentData: `{"type":"vm","name":"vm1","projectName":"project"}`},
+			{ContractID: "2", NodeID: 11, State: "GracePeriod", DeploymentData: `{"type":"network","name":"net","projectName":"project"}`},
+		},
+		NameContracts: []graphql.Contract{{ContractID: "3", Name: "gw", State: "Created"}},
+		RentContracts: []graphql.Contract{},
+	})
+	billing := NewBilling(identity, sub, proxyCl, contractsGetter)
+
+	now := time.Now()
+	since := now.Add(-10 * time.Hour)
+	bill := func(amount uint64, age time.Duration) proxyTypes.ContractBilling {
+		return proxyTypes.ContractBilling{AmountBilled: amount, Timestamp: uint64(now.Add(-age).Unix())}
+	}
+
+	// the old bill is not in the report period
+	proxyCl.EXPECT().ContractBills(gomock.Any(), uint32(1), proxyTypes.Limit{Size: billsPageSize, Page: 1}).
+		Return([]proxyTypes.ContractBilling{bill(3e7, time.Hour), bill(2e7, 2*time.Hour), bill(1e7, 20*time.Hour)}, uint(0), nil)
+	proxyCl.EXPECT().ContractBills(gomock.Any(), uint32(2), proxyTypes.Limit{Size: billsPageSize, Page: 1}).
+		Return([]proxyTypes.ContractBilling{bill(1e7, time.Hour)}, uint(0), nil)
+	proxyCl.EXPECT().ContractBills(gomock.Any(), uint32(3), proxyTypes.Limit{Size: billsPageSize, Page: 1}).
+		Return([]proxyTypes.ContractBilling{bill(4e7, time.Hour)}, uint(0), nil)
+
+	report, err := billing.Report(context.Background(), since)
+	require.NoError(t, err)
+
+	require.Len(t, report.Contracts, 3)
+	assert.Equal(t, uint64(1), report.Contracts[0].ContractID)
+	assert.Equal(t, "vm1", report.Contracts[0].Name)
+	assert.Len(t, report.Contracts[0].Bills, 2)
+	assert.Equal(t, 5.0, report.Contracts[0].Total)
+	assert.Equal(t, NameContract, report.Contracts[2].Type)
+
+	assert.Equal(t, 10.0, report.Total)
+	assert.Equal(t, map[string]float64{"project": 6}, report.ByProject)
+	assert.Equal(t, map[string]float64{"vm": 5, "network": 1, "name": 4}, report.ByType)
+	assert.Equal(t, map[uint32]float64{10: 5, 11: 1}, report.ByNode)
+
+	t.Run("forecast", func(t *testing.T) {
+		report := Report{From: since, To: now, Total: 10}
+		sub.EXPECT().GetBalance(identity).Return(substrate.Balance{
+			Free: types.U128{Int: big.NewInt(20e7)},
+		}, nil)
+
+		forecast, err := billing.Forecast(report)
+		require.NoError(t, err)
+
+		assert.Equal(t, 20.0, forecast.Balance)
+		assert.Equal(t, 1.0, forecast.BurnRate)
+		assert.Equal(t, 20*time.Hour, forecast.Remaining)
+		assert.Equal(t, now.Add(20*time.Hour), forecast.RunOut)
+	})
+
+	t.Run("forecast without spend", func(t *testing.T) {
+		sub.EXPECT().GetBalance(identity).Return(substrate.Balance{
+			Free: types.U128{Int: big.NewInt(20e7)},
+		}, nil)
+
+		forecast, err := billing.Forecast(Report{From: since, To: now})
+		require.NoError(t, err)
+		assert.Zero(t, forecast.BurnRate)
+		assert.True(t, forecast.RunOut.IsZero())
+	})
+}
@@ -1,18 +1,70 @@
 package calculator
 
 import (
+	"cmp"
+	"errors"
+	"fmt"
 	"math"
+	"slices"
 
 	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/subi"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
 )
 
 const defaultPricingPolicyID = uint32(1)
 
+// Usage is the resources used on a node and the node properties affecting their price
+type Usage struct {
+	Capacity  gridtypes.Capacity
+	PublicIPs uint32
+	// Certified nodes resources cost 25% more
+	Certified bool
+	// Dedicated nodes resources get the pricing policy dedicated nodes discount
+	Dedicated bool
+	// ExtraFee is the node extra fee, it uses the same unit as the pricing policy values
+	ExtraFee uint64
+}
+
+// Cost is a monthly cost in USD and TFT
+type Cost struct {
+	USD float64
+	TFT float64
+}
+
+// DiscountPackage is a discount for twins with a balance covering their cost for a duration
+type DiscountPackage struct {
+	Name string
+	// Duration is the number of months the balance needs to cover
+	Duration float64
+	// Discount is the discount percentage
+	Discount float64
+}
+
+// DefaultDiscountPackages are the tfchain discount packages sorted by duration
+var DefaultDiscountPackages = []DiscountPackage{
+	{Name: "none", Duration: 0, Discount: 0},
+	{Name: "default", Duration: 1.5, Discount: 20},
+	{Name: "bronze", Duration: 3, Discount: 30},
+	{Name: "silver", Duration: 6, Discount: 40},
+	{Name: "gold", Duration: 18, Discount: 60},
+}
+
+// Discount is a discounted price with its discount package
+type Discount struct {
+	Price   float64
+	Package DiscountPackage
+	// NextPackage is the package with the next longer duration, it is nil if the best package is selected
+	NextPackage *DiscountPackage
+	// NextThreshold is the balance in TFT needed to get the next package
+	NextThreshold float64
+}
+
 // Calculator struct for calculating the cost of resources
 type Calculator struct {
-	substrateConn subi.SubstrateExt
-	identity      substrate.Identity
+	substrateConn    subi.SubstrateExt
+	identity         substrate.Identity
+	discountPackages []DiscountPackage
 }
 
 // NewCalculator creates a new Calculator
@@ -51,69 +103,153 @@ func (c *Calculator) CalculateCost(cru, mru, hru, sru int64, publicIP, certified
 
 // CalculateDiscount calculates the discount of a given cost
 func (c *Calculator) CalculateDiscount(cost float64) (dedicatedPrice, sharedPrice float64, err error) {
+	dedicated, shared, err := c.CalculateDiscountDetails(cost)
+	if err != nil {
+		return
+	}
+	return dedicated.Price, shared.Price, nil
+}
+
+// CalculateDiscountDetails calculates the discount of a given cost for dedicated and shared nodes
+// with the selected discount packages and the balance needed for the next ones
+func (c *Calculator) CalculateDiscountDetails(cost float64) (dedicated, shared Discount, err error) {
 	tftPrice, err := c.substrateConn.GetTFTPrice()
 	if err != nil {
 		return
 	}
 
+	if tftPrice == 0 {
+		err = errors.New("tft price is zero")
+		return
+	}
+
 	pricingPolicy, err := c.substrateConn.GetPricingPolicy(defaultPricingPolicyID)
 	if err != nil {
 		return
 	}
 
-	// discount for shared Nodes
-	sharedPrice = cost
-
 	// discount for Dedicated Nodes
 	discount := float64(pricingPolicy.DedicatedNodesDiscount)
-	dedicatedPrice = cost - cost*(discount/100)
+	dedicatedCost := cost - cost*(discount/100)
 
 	// discount for Twin Balance in TFT
 	accountBalance, err := c.substrateConn.GetBalance(c.identity)
 	if err != nil {
 		return
 	}
-	balance := float64(tftPrice) / 1000 * float64(accountBalance.Free.Int64()) * 10000000
-
-	discountPackages := map[string]map[string]float64{
-		"none": {
-			"duration": 0,
-			"discount": 0,
-		},
-		"default": {
-			"duration": 1.5,
-			"discount": 20,
-		},
-		"bronze": {
-			"duration": 3,
-			"discount": 30,
-		},
-		"silver": {
-			"duration": 6,
-			"discount": 40,
-		},
-		"gold": {
-			"duration": 18,
-			"discount": 60,
-		},
-	}
-
-	// check which package will be used according to the balance
-	dedicatedPackage := "none"
-	sharedPackage := "none"
-	for pkg := range discountPackages {
-		if balance > dedicatedPrice*discountPackages[pkg]["duration"] {
-			dedicatedPackage = pkg
+	// balance is compared to the cost, it is converted back to TFT for the next package thresholds
+	tftRate := float64(tftPrice) / 1000 * 10000000
+	balance := tftRate * float64(accountBalance.Free.Int64())
+
+	packages := c.discountPackages
+	if len(packages) == 0 {
+		packages = DefaultDiscountPackages
+	}
+
+	dedicated = selectDiscount(packages, dedicatedCost, balance, tftRate)
+	shared = selectDiscount(packages, cost, balance, tftRate)
+	return
+}
+
+// SetDiscountPackages sets the discount packages used instead of the default ones.
+// packages are evaluated by their duration whatever their order is.
+func (c *Calculator) SetDiscountPackages(packages []DiscountPackage) error {
+	names := make(map[string]bool)
+	for _, pkg := range packages {
+		if names[pkg.Name] {
+			return fmt.Errorf("duplicated discount package %q", pkg.Name)
+		}
+		names[pkg.Name] = true
+
+		if pkg.Duration < 0 {
+			return fmt.Errorf("discount package %q duration %v is negative", pkg.Name, pkg.Duration)
+		}
+		if pkg.Discount < 0 || pkg.Discount > 100 {
+			return fmt.Errorf("discount package %q discount %v is not a percentage", pkg.Name, pkg.Discount)
 		}
-		if balance > sharedPrice*discountPackages[pkg]["duration"] {
-			sharedPackage = pkg
+	}
+
+	sorted := slices.Clone(packages)
+	slices.SortStableFunc(sorted, func(a, b DiscountPackage) int {
+		return cmp.Compare(a.Duration, b.Duration)
+	})
+	c.discountPackages = sorted
+	return nil
+}
+
+// selectDiscount selects the package with the longest duration covered by the balance, packages are sorted by duration
+func selectDiscount(packages []DiscountPackage, cost, balance, tftRate float64) Discount {
+	selected := DiscountPackage{Name: "none"}
+	next := -1
+	for i, pkg := range packages {
+		if balance > cost*pkg.Duration {
+			selected = pkg
+			continue
 		}
+		next = i
+		break
+	}
+
+	res := Discount{
+		Price:   (cost - cost*(selected.Discount/100)) / 1e7,
+		Package: selected,
+	}
+	if next != -1 {
+		nextPackage := packages[next]
+		res.NextPackage = &nextPackage
+		res.NextThreshold = cost * nextPackage.Duration / tftRate / 1e7
 	}
+	return res
+}
 
-	dedicatedPrice = (dedicatedPrice - dedicatedPrice*(discountPackages[dedicatedPackage]["discount"]/100)) / 1e7
-	sharedPrice = (sharedPrice - sharedPrice*(discountPackages[sharedPackage]["discount"]/100)) / 1e7
+// CalculateUsageCost calculates the monthly cost of the given usage in USD and TFT the same way the grid proxy prices nodes.
+// unlike CalculateCost, the capacity is not rounded down to whole GBs.
+func (c *Calculator) CalculateUsageCost(usage Usage) (Cost, error) {
+	tftPrice, err := c.substrateConn.GetTFTPrice()
+	if err != nil {
+		return Cost{}, err
+	}
 
-	return
+	if tftPrice == 0 {
+		return Cost{}, errors.New("tft price is zero")
+	}
+
+	pricingPolicy, err := c.substrateConn.GetPricingPolicy(defaultPricingPolicyID)
+	if err != nil {
+		return Cost{}, err
+	}
+
+	cu := calculateUnitsCU(float64(usage.Capacity.CRU), float64(usage.Capacity.MRU)/float64(gridtypes.Gigabyte))
+	su := calculateUnitsSU(float64(usage.Capacity.HRU)/float64(gridtypes.Gigabyte), float64(usage.Capacity.SRU)/float64(gridtypes.Gigabyte))
+
+	cost := cu*float64(pricingPolicy.CU.Value) + su*float64(pricingPolicy.SU.Value) + float64(usage.PublicIPs)*float64(pricingPolicy.IPU.Value)
+	if usage.Dedicated {
+		cost -= cost * float64(pricingPolicy.DedicatedNodesDiscount) / 100
+	}
+	cost += float64(usage.ExtraFee)
+
+	if usage.Certified {
+		cost *= 1.25
+	}
+
+	// pricing policy values are in 1e-7 USD per hour and the tft price is in mUSD
+	usd := cost * 24 * 30 / 1e7
+	return Cost{
+		USD: usd,
+		TFT: usd * 1000 / float64(tftPrice),
+	}, nil
+}
+
+func calculateUnitsSU(hru, sru float64) float64 {
+	return hru/1200 + sru/200
+}
+
+func calculateUnitsCU(cru, mru float64) float64 {
+	cu1 := math.Max(mru/4, cru/2)
+	cu2 := math.Max(mru/8, cru)
+	cu3 := math.Max(mru/2, cru/4)
+
+	return math.Min(cu1, math.Min(cu2, cu3))
 }
 
 func calculateSU(hru, sru int64) float64 {
@@ -51,6 +51,68 @@ func TestCalculator(t *testing.T) {
 	assert.Equal(t, dedicatedPrice, sharedPrice)
 }
 
+func TestCalculateDiscountDetails(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sub := mocks.NewMockSubstrateExt(ctrl)
+	identity, err := substrate.NewIdentityFromSr25519Phrase("//Alice")
+	assert.NoError(t, err)
+
+	calculator := NewCalculator(sub, identity)
+
+	sub.EXPECT().GetTFTPrice().Return(types.U32(1), nil).AnyTimes()
+	sub.EXPECT().GetPricingPolicy(1).Return(substrate.PricingPolicy{
+		ID:                     1,
+		DedicatedNodesDiscount: 50,
+	}, nil).AnyTimes()
+	sub.EXPECT().GetBalance(identity).Return(substrate.Balance{
+		Free: types.U128{
+			Int: big.NewInt(400),
+		},
+	}, nil).AnyTimes()
+
+	t.Run("default packages", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			dedicated, shared, err := calculator.CalculateDiscountDetails(1e6)
+			assert.NoError(t, err)
+
+			assert.Equal(t, "bronze", shared.Package.Name)
+			assert.InDelta(t, 0.07, shared.Price, 1e-9)
+			assert.Equal(t, "silver", shared.NextPackage.Name)
+			assert.InDelta(t, 6e-5, shared.NextThreshold, 1e-12)
+
+			assert.Equal(t, "silver", dedicated.Package.Name)
+			assert.InDelta(t, 0.03, dedicated.Price, 1e-9)
+			assert.Equal(t, "gold", dedicated.NextPackage.Name)
+			assert.InDelta(t, 9e-5, dedicated.NextThreshold, 1e-12)
+		}
+	})
+
+	t.Run("custom packages", func(t *testing.T) {
+		err := calculator.SetDiscountPackages([]DiscountPackage{
+			{Name: "long", Duration: 2, Discount: 50},
+			{Name: "short", Duration: 1, Discount: 10},
+		})
+		assert.NoError(t, err)
+
+		dedicated, shared, err := calculator.CalculateDiscountDetails(1e6)
+		assert.NoError(t, err)
+
+		assert.Equal(t, "long", shared.Package.Name)
+		assert.Nil(t, shared.NextPackage)
+		assert.Equal(t, "long", dedicated.Package.Name)
+	})
+
+	t.Run("invalid packages", func(t *testing.T) {
+		err := calculator.SetDiscountPackages([]DiscountPackage{{Name: "pkg"}, {Name: "pkg"}})
+		assert.Error(t, err)
+
+		err = calculator.SetDiscountPackages([]DiscountPackage{{Name: "pkg", Discount: 120}})
+		assert.Error(t, err)
+	})
+}
+
 func TestSubstrateErrors(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
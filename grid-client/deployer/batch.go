@@ -0,0 +1,189 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+	"golang.org/x/exp/maps"
+)
+
+// BatchDeployError is returned by atomic batch deploys if some nodes failed, the batch is rolled back before it is returned
+type BatchDeployError struct {
+	// Nodes are the deployment errors of the failed nodes
+	Nodes map[uint32]error
+	// Rollback is the error of rolling back the batch, some contracts are left on the grid if it is set
+	Rollback error
+}
+
+// Error returns the errors of the failed nodes sorted by node ID
+func (e *BatchDeployError) Error() string {
+	nodes := maps.Keys(e.Nodes)
+	slices.Sort(nodes)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "batch deploy failed on %d nodes", len(nodes))
+	if e.Rollback != nil {
+		fmt.Fprintf(&b, " and could not be rolled back: %s", e.Rollback)
+	}
+	for _, node := range nodes {
+		fmt.Fprintf(&b, "; node %d: %s", node, e.Nodes[node])
+	}
+	return b.String()
+}
+
+// Unwrap returns the nodes and rollback errors
+func (e *BatchDeployError) Unwrap() []error {
+	errs := maps.Values(e.Nodes)
+	if e.Rollback != nil {
+		errs = append(errs, e.Rollback)
+	}
+	return errs
+}
+
+// batchUpdate is an update of a deployed deployment in an atomic batch
+type batchUpdate struct {
+	node uint32
+	dl   gridtypes.Deployment
+	old  gridtypes.Deployment
+}
+
+// atomicBatchDeploy deploys all the batch deployments or none of them.
+// deployments with contract IDs are updated, and if any node fails the batch contracts are canceled and the updated deployments are reverted.
+func (d *Deployer) atomicBatchDeploy(ctx context.Context, deployments map[uint32][]gridtypes.Deployment, deploymentsSolutionProvider map[uint32][]*uint64) (map[uint32][]gridtypes.Deployment, error) {
+	creations := make(map[uint32][]gridtypes.Deployment)
+	creationsSolutionProvider := make(map[uint32][]*uint64)
+	var updates []batchUpdate
+	for node, dls := range deployments {
+		for i, dl := range dls {
+			if dl.ContractID != 0 {
+				updates = append(updates, batchUpdate{node: node, dl: dl})
+				continue
+			}
+
+			var solutionProviderID *uint64
+			if len(deploymentsSolutionProvider[node]) > i {
+				solutionProviderID = deploymentsSolutionProvider[node][i]
+			}
+			creations[node] = append(creations[node], dl)
+			creationsSolutionProvider[node] = append(creationsSolutionProvider[node], solutionProviderID)
+		}
+	}
+
+	// the old deployments are needed to revert the updates
+	for i, update := range updates {
+		oldDls, err := d.GetDeployments(ctx, map[uint32]uint64{update.node: update.dl.ContractID})
+		if err != nil {
+			return map[uint32][]gridtypes.Deployment{}, errors.Wrapf(err, "failed to get deployment %d to update it", update.dl.ContractID)
+		}
+		updates[i].old = oldDls[update.node]
+	}
+
+	contractsData, deploymentsSlice, err := d.prepareBatchContracts(ctx, creations, creationsSolutionProvider)
+	if err != nil {
+		return map[uint32][]gridtypes.Deployment{}, err
+	}
+
+	var contracts []uint64
+	if len(contractsData) != 0 && d.dryRunReport == nil {
+		contracts, err = d.substrateConn.BatchAllCreateContract(d.identity, contractsData)
+		if err != nil {
+			return map[uint32][]gridtypes.Deployment{}, &ContractCreationError{Err: err}
+		}
+	}
+
+	batchErr := &BatchDeployError{Nodes: make(map[uint32]error)}
+	var mu sync.Mutex
+	fail := func(node uint32, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		batchErr.Nodes[node] = multierror.Append(batchErr.Nodes[node], err)
+	}
+
+	var wg sync.WaitGroup
+	if d.dryRunReport != nil {
+		if _, err := d.dryRunBatchDeploy(contractsData, deploymentsSlice); err != nil {
+			return map[uint32][]gridtypes.Deployment{}, err
+		}
+	} else {
+		for i := range deploymentsSlice {
+			deploymentsSlice[i].ContractID = contracts[i]
+			node, dl := contractsData[i].Node, deploymentsSlice[i]
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := d.deployContract(ctx, node, dl); err != nil {
+					fail(node, err)
+				}
+			}()
+		}
+	}
+
+	for _, update := range updates {
+		update := update
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := d.deploy(ctx, map[uint32]uint64{update.node: update.dl.ContractID}, map[uint32]gridtypes.Deployment{update.node: update.dl}, nil, false)
+			if err != nil {
+				fail(update.node, errors.Wrapf(err, "failed to update deployment %d", update.dl.ContractID))
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(batchErr.Nodes) == 0 {
+		return batchDeployments(contractsData, deploymentsSlice, updates, false), nil
+	}
+
+	batchErr.Rollback = d.rollbackBatch(ctx, contracts, updates)
+	if batchErr.Rollback == nil {
+		for i := range deploymentsSlice {
+			deploymentsSlice[i].ContractID = 0
+		}
+	}
+
+	return batchDeployments(contractsData, deploymentsSlice, updates, true), batchErr
+}
+
+// rollbackBatch cancels the batch created contracts and deploys the old versions of the updated deployments
+func (d *Deployer) rollbackBatch(ctx context.Context, contracts []uint64, updates []batchUpdate) error {
+	var errs error
+	if len(contracts) != 0 {
+		if err := d.substrateConn.BatchCancelContract(d.identity, contracts); err != nil {
+			errs = multierror.Append(errs, errors.Wrapf(err, "failed to cancel created contracts %v", contracts))
+		}
+	}
+
+	for _, update := range updates {
+		_, err := d.deploy(ctx, map[uint32]uint64{update.node: update.dl.ContractID}, map[uint32]gridtypes.Deployment{update.node: update.old}, nil, false)
+		if err != nil {
+			errs = multierror.Append(errs, errors.Wrapf(err, "failed to revert deployment %d on node %d", update.dl.ContractID, update.node))
+		}
+	}
+	return errs
+}
+
+// batchDeployments groups the created and updated deployments of a batch by node, the old deployments are used for reverted updates
+func batchDeployments(contractsData []substrate.BatchCreateContractData, created []gridtypes.Deployment, updates []batchUpdate, reverted bool) map[uint32][]gridtypes.Deployment {
+	res := make(map[uint32][]gridtypes.Deployment)
+	for i, dl := range created {
+		res[contractsData[i].Node] = append(res[contractsData[i].Node], dl)
+	}
+	for _, update := range updates {
+		if reverted {
+			res[update.node] = append(res[update.node], update.old)
+			continue
+		}
+		res[update.node] = append(res[update.node], update.dl)
+	}
+	return res
+}
@@ -0,0 +1,71 @@
+package deployer
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
+)
+
+func TestFakeGridAtomicBatchDeploy(t *testing.T) {
+	tfPluginClient, grid := newFakeGridClient(t)
+	ctx := context.Background()
+
+	atomic, err := NewTFPluginClient(tfPluginClient.mnemonicOrSeed, WithBackend(grid), WithAtomicBatchDeploy())
+	require.NoError(t, err)
+	t.Cleanup(atomic.Close)
+
+	zdbDl := workloads.NewDeployment("zdb", 12, "", nil, "", nil, []workloads.ZDB{{Name: "zdb", Password: "password", Size: 10, Mode: "user"}}, nil, nil)
+	require.NoError(t, atomic.DeploymentDeployer.BatchDeploy(ctx, []*workloads.Deployment{&zdbDl}))
+	require.NotZero(t, zdbDl.ContractID)
+
+	grid.FailWorkloads(zos.ZMountType, "no space")
+
+	t.Run("created contracts are canceled", func(t *testing.T) {
+		diskDl := workloads.NewDeployment("disk", 11, "", nil, "", []workloads.Disk{{Name: "disk", SizeGB: 10}}, nil, nil, nil)
+		zdbDl2 := workloads.NewDeployment("zdb2", 12, "", nil, "", nil, []workloads.ZDB{{Name: "zdb2", Password: "password", Size: 10, Mode: "user"}}, nil, nil)
+
+		err := atomic.DeploymentDeployer.BatchDeploy(ctx, []*workloads.Deployment{&diskDl, &zdbDl2})
+		var batchErr *BatchDeployError
+		require.ErrorAs(t, err, &batchErr)
+		assert.NoError(t, batchErr.Rollback)
+		assert.Contains(t, batchErr.Nodes, uint32(11))
+		assert.NotContains(t, batchErr.Nodes, uint32(12))
+
+		assert.Zero(t, diskDl.ContractID)
+		assert.Zero(t, zdbDl2.ContractID)
+		assert.Equal(t, []uint64{zdbDl.ContractID}, grid.ActiveContracts())
+	})
+
+	t.Run("updated deployments are reverted", func(t *testing.T) {
+		deployer := NewDeployer(atomic, true)
+		oldDl := grid.NodeDeployments(12)[0]
+
+		zdb := workloads.ZDB{Name: "zdb", Password: "password", Size: 20, Mode: "user"}
+		updated := oldDl
+		updated.Workloads = []gridtypes.Workload{zdb.ZosWorkload()}
+		diskWl := workloads.Disk{Name: "disk", SizeGB: 10}
+		disk := workloads.NewGridDeployment(atomic.TwinID, []gridtypes.Workload{diskWl.ZosWorkload()})
+		disk.Metadata = `{"type":"vm","name":"disk","projectName":"disk"}`
+
+		dls, err := deployer.BatchDeploy(ctx, map[uint32][]gridtypes.Deployment{11: {disk}, 12: {updated}}, nil)
+		var batchErr *BatchDeployError
+		require.ErrorAs(t, err, &batchErr)
+		assert.NoError(t, batchErr.Rollback)
+		assert.Zero(t, dls[11][0].ContractID)
+		assert.Equal(t, oldDl.ContractID, dls[12][0].ContractID)
+
+		// the deployment was updated then reverted
+		current := grid.NodeDeployments(12)[0]
+		assert.Greater(t, current.Version, oldDl.Version)
+		var zdbData zos.ZDB
+		require.NoError(t, json.Unmarshal(current.Workloads[0].Data, &zdbData))
+		assert.Equal(t, 10*gridtypes.Gigabyte, zdbData.Size)
+		assert.Equal(t, []uint64{zdbDl.ContractID}, grid.ActiveContracts())
+	})
+}
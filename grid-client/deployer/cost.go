@@ -0,0 +1,92 @@
+package deployer
+
+import (
+	"context"
+	"slices"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/calculator"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+)
+
+// NodeCost is the estimated monthly cost of the deployments on a node
+type NodeCost struct {
+	NodeID uint32
+	calculator.Usage
+	calculator.Cost
+}
+
+// CostEstimate is the estimated monthly cost of a set of deployments
+type CostEstimate struct {
+	// Nodes are the costs per node sorted by node ID
+	Nodes []NodeCost
+	Total calculator.Cost
+}
+
+// EstimateCost estimates the monthly cost of the given grid deployments per node.
+// nodes that are rented by the twin, in a dedicated farm or with an extra fee get the dedicated nodes discount and pay the node extra fee.
+func (t *TFPluginClient) EstimateCost(ctx context.Context, deployments map[uint32][]gridtypes.Deployment) (CostEstimate, error) {
+	nodeIDs := make([]uint32, 0, len(deployments))
+	for nodeID := range deployments {
+		nodeIDs = append(nodeIDs, nodeID)
+	}
+	slices.Sort(nodeIDs)
+
+	var estimate CostEstimate
+	for _, nodeID := range nodeIDs {
+		usage, err := t.nodeUsage(ctx, nodeID, deployments[nodeID])
+		if err != nil {
+			return CostEstimate{}, err
+		}
+
+		cost, err := t.Calculator.CalculateUsageCost(usage)
+		if err != nil {
+			return CostEstimate{}, errors.Wrapf(err, "could not calculate node %d cost", nodeID)
+		}
+
+		estimate.Nodes = append(estimate.Nodes, NodeCost{NodeID: nodeID, Usage: usage, Cost: cost})
+		estimate.Total.USD += cost.USD
+		estimate.Total.TFT += cost.TFT
+	}
+
+	return estimate, nil
+}
+
+func (t *TFPluginClient) nodeUsage(ctx context.Context, nodeID uint32, deployments []gridtypes.Deployment) (calculator.Usage, error) {
+	var usage calculator.Usage
+	for _, dl := range deployments {
+		capacity, err := Capacity(dl)
+		if err != nil {
+			return calculator.Usage{}, errors.Wrapf(err, "could not calculate deployment capacity on node %d", nodeID)
+		}
+		usage.Capacity.Add(&capacity)
+
+		publicIPs, err := CountDeploymentPublicIPs(dl)
+		if err != nil {
+			return calculator.Usage{}, errors.Wrapf(err, "could not count deployment public ips on node %d", nodeID)
+		}
+		usage.PublicIPs += publicIPs
+	}
+
+	node, err := t.GridProxyClient.Node(ctx, nodeID)
+	if err != nil {
+		return calculator.Usage{}, errors.Wrapf(err, "could not get node %d", nodeID)
+	}
+
+	usage.Certified = node.CertificationType == "Certified"
+	usage.Dedicated = node.RentedByTwinID == uint(t.TwinID) || node.InDedicatedFarm || node.ExtraFee > 0
+	if usage.Dedicated {
+		usage.ExtraFee = node.ExtraFee
+	}
+
+	return usage, nil
+}
+
+// singleDeployments converts a deployment per node to the deployments per node EstimateCost expects
+func singleDeployments(deployments map[uint32]gridtypes.Deployment) map[uint32][]gridtypes.Deployment {
+	res := make(map[uint32][]gridtypes.Deployment, len(deployments))
+	for nodeID, dl := range deployments {
+		res[nodeID] = []gridtypes.Deployment{dl}
+	}
+	return res
+}
@@ -0,0 +1,91 @@
+package deployer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/calculator"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/mocks"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+)
+
+func TestEstimateCost(t *testing.T) {
+	identity, err := substrate.NewIdentityFromSr25519Phrase("//Alice")
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sub := mocks.NewMockSubstrateExt(ctrl)
+	proxyCl := mocks.NewMockClient(ctrl)
+
+	tfPluginClient := TFPluginClient{
+		TwinID:          1,
+		GridProxyClient: proxyCl,
+		Calculator:      calculator.NewCalculator(sub, identity),
+	}
+
+	sub.EXPECT().GetTFTPrice().Return(types.U32(50), nil).AnyTimes()
+	sub.EXPECT().GetPricingPolicy(uint32(1)).Return(substrate.PricingPolicy{
+		CU:                     substrate.Policy{Value: 100000},
+		SU:                     substrate.Policy{Value: 50000},
+		IPU:                    substrate.Policy{Value: 40000},
+		DedicatedNodesDiscount: 50,
+	}, nil).AnyTimes()
+
+	proxyCl.EXPECT().Node(gomock.Any(), uint32(1)).Return(proxyTypes.NodeWithNestedCapacity{
+		CertificationType: "Certified",
+	}, nil)
+	proxyCl.EXPECT().Node(gomock.Any(), uint32(2)).Return(proxyTypes.NodeWithNestedCapacity{
+		RentedByTwinID: 1,
+		ExtraFee:       20000,
+	}, nil)
+
+	vm := workloads.VM{
+		Name:        "vm",
+		Flist:       "https://hub.grid.tf/tf-official-apps/base:latest.flist",
+		CPU:         2,
+		Memory:      4096,
+		RootfsSize:  200 * 1024,
+		PublicIP:    true,
+		NetworkName: "network",
+	}
+	disk := workloads.Disk{Name: "disk", SizeGB: 200}
+
+	deployments := map[uint32][]gridtypes.Deployment{
+		1: {workloads.NewGridDeployment(1, vm.ZosWorkload())},
+		2: {workloads.NewGridDeployment(1, []gridtypes.Workload{disk.ZosWorkload()})},
+	}
+
+	estimate, err := tfPluginClient.EstimateCost(context.Background(), deployments)
+	require.NoError(t, err)
+	require.Len(t, estimate.Nodes, 2)
+
+	// 1 cu, 1 su and 1 public ip on a certified node
+	node1 := estimate.Nodes[0]
+	assert.Equal(t, uint32(1), node1.NodeID)
+	assert.Equal(t, uint64(2), node1.Capacity.CRU)
+	assert.Equal(t, uint32(1), node1.PublicIPs)
+	assert.True(t, node1.Certified)
+	assert.False(t, node1.Dedicated)
+	assert.InDelta(t, 17.1, node1.USD, 1e-9)
+	assert.InDelta(t, 342, node1.TFT, 1e-9)
+
+	// 1 su with the dedicated discount and the extra fee on a rented node
+	node2 := estimate.Nodes[1]
+	assert.Equal(t, uint32(2), node2.NodeID)
+	assert.True(t, node2.Dedicated)
+	assert.Equal(t, uint64(20000), node2.ExtraFee)
+	assert.InDelta(t, 3.24, node2.USD, 1e-9)
+	assert.InDelta(t, 64.8, node2.TFT, 1e-9)
+
+	assert.InDelta(t, 20.34, estimate.Total.USD, 1e-9)
+	assert.InDelta(t, 406.8, estimate.Total.TFT, 1e-9)
+}
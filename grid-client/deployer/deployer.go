@@ -16,6 +16,7 @@ import (
 	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
 	client "github.com/threefoldtech/tfgrid-sdk-go/grid-client/node"
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/subi"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
 	proxy "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/client"
 	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
 	"github.com/threefoldtech/zos/pkg/gridtypes"
@@ -50,6 +51,14 @@ type Deployer struct {
 	ncPool          client.NodeClientGetter
 	revertOnFailure bool
 	substrateConn   subi.SubstrateExt
+	// dryRunReport collects the contracts and deployments instead of creating them if set
+	dryRunReport *DryRunReport
+	// progressHandler is called with the workloads state transitions while waiting for deployments if set
+	progressHandler ProgressHandler
+	// metadataKey encrypts the deployments and workloads metadata if set
+	metadataKey []byte
+	// atomicBatch rolls back batch deployments if any of their nodes fails
+	atomicBatch bool
 }
 
 // NewDeployer returns a new deployer
@@ -57,6 +66,11 @@ func NewDeployer(
 	tfPluginClient TFPluginClient,
 	revertOnFailure bool,
 ) Deployer {
+	var metadataKey []byte
+	if tfPluginClient.encryptMetadata {
+		metadataKey = tfPluginClient.metadataKey
+	}
+
 	return Deployer{
 		tfPluginClient.Identity,
 		tfPluginClient.TwinID,
@@ -64,6 +78,10 @@ func NewDeployer(
 		tfPluginClient.NcPool,
 		revertOnFailure,
 		tfPluginClient.SubstrateConn,
+		tfPluginClient.DryRunReport,
+		tfPluginClient.progressHandler,
+		metadataKey,
+		tfPluginClient.atomicBatchDeploy,
 	}
 }
 
@@ -112,9 +130,20 @@ func (d *Deployer) deploy(
 	for nodeID, contractID := range oldDeployments {
 		currentDeployments[nodeID] = contractID
 	}
+
+	newDeployments, err = d.encryptDeployments(newDeployments)
+	if err != nil {
+		return currentDeployments, err
+	}
 	// deletions
 	for node, contractID := range oldDeployments {
 		if _, ok := newDeployments[node]; !ok {
+			if d.dryRunReport != nil {
+				d.dryRunReport.addContract(DryRunContract{Action: PlanCancel, Type: NodeContractType, ContractID: contractID, NodeID: node})
+				delete(currentDeployments, node)
+				continue
+			}
+
 			err = d.substrateConn.EnsureContractCanceled(d.identity, contractID)
 			if err != nil && !strings.Contains(err.Error(), "ContractNotExists") {
 				return currentDeployments, errors.Wrap(err, "failed to delete deployment")
@@ -154,10 +183,26 @@ func (d *Deployer) deploy(
 			}
 			log.Debug().Uint32("Number of public ips", publicIPCount)
 
+			if d.dryRunReport != nil {
+				d.dryRunReport.addContract(DryRunContract{
+					Action:             PlanCreate,
+					Type:               NodeContractType,
+					NodeID:             node,
+					Metadata:           dl.Metadata,
+					Hash:               hashHex,
+					PublicIPs:          publicIPCount,
+					SolutionProviderID: newDeploymentSolutionProvider[node],
+				})
+				if err := d.dryRunReport.addDeployment(PlanCreate, node, dl); err != nil {
+					return currentDeployments, errors.Wrap(err, "failed to compute deployment capacity")
+				}
+				continue
+			}
+
 			contractID, err := d.substrateConn.CreateNodeContract(d.identity, node, dl.Metadata, hashHex, publicIPCount, newDeploymentSolutionProvider[node])
 			log.Debug().Uint64("CreateNodeContract returned id", contractID)
 			if err != nil {
-				return currentDeployments, errors.Wrapf(err, "failed to create contract on node %d", node)
+				return currentDeployments, &ContractCreationError{NodeID: node, Err: err}
 			}
 
 			dl.ContractID = contractID
@@ -176,7 +221,7 @@ func (d *Deployer) deploy(
 			for _, w := range dl.Workloads {
 				newWorkloadVersions[w.Name.String()] = 0
 			}
-			err = d.Wait(ctx, client, dl.ContractID, newWorkloadVersions)
+			err = d.WaitOnNode(ctx, node, client, dl.ContractID, newWorkloadVersions)
 
 			if err != nil {
 				return currentDeployments, errors.Wrap(err, "error waiting deployment")
@@ -236,6 +281,20 @@ func (d *Deployer) deploy(
 			hashHex := hex.EncodeToString(hash)
 			log.Debug().Str("HASH", hashHex)
 
+			if d.dryRunReport != nil {
+				d.dryRunReport.addContract(DryRunContract{
+					Action:     PlanUpdate,
+					Type:       NodeContractType,
+					ContractID: dl.ContractID,
+					NodeID:     node,
+					Hash:       hashHex,
+				})
+				if err := d.dryRunReport.addDeployment(PlanUpdate, node, dl); err != nil {
+					return currentDeployments, errors.Wrap(err, "failed to compute deployment capacity")
+				}
+				continue
+			}
+
 			// TODO: Destroy and create if publicIPCount is changed
 			// publicIPCount, err := countDeploymentPublicIPs(dl)
 			contractID, err := d.substrateConn.UpdateNodeContract(d.identity, dl.ContractID, "", hashHex)
@@ -250,7 +309,7 @@ func (d *Deployer) deploy(
 			}
 			currentDeployments[node] = dl.ContractID
 
-			err = d.Wait(ctx, client, dl.ContractID, newWorkloadsVersions)
+			err = d.WaitOnNode(ctx, node, client, dl.ContractID, newWorkloadsVersions)
 			if err != nil {
 				return currentDeployments, errors.Wrap(err, "error waiting deployment")
 			}
@@ -264,6 +323,11 @@ func (d *Deployer) deploy(
 func (d *Deployer) Cancel(ctx context.Context,
 	contractID uint64,
 ) error {
+	if d.dryRunReport != nil {
+		d.dryRunReport.addContract(DryRunContract{Action: PlanCancel, Type: NodeContractType, ContractID: contractID})
+		return nil
+	}
+
 	err := d.substrateConn.EnsureContractCanceled(d.identity, contractID)
 	if err != nil {
 		return errors.Wrapf(err, "failed to delete deployment: %d", contractID)
@@ -307,15 +371,28 @@ func getExponentialBackoff(initialInterval time.Duration, multiplier float64, ma
 	return b
 }
 
-// Wait waits for a deployment to be deployed on node
+// Wait waits for a deployment to be deployed on node, the workloads state transitions are sent to the progress handler if set.
+// the progress events and errors don't have the node ID, use WaitOnNode to set it.
 func (d *Deployer) Wait(
 	ctx context.Context,
 	nodeClient *client.NodeClient,
 	deploymentID uint64,
 	workloadVersions map[string]uint32,
+) error {
+	return d.WaitOnNode(ctx, 0, nodeClient, deploymentID, workloadVersions)
+}
+
+// WaitOnNode is like Wait but the progress events and errors have the deployment node ID
+func (d *Deployer) WaitOnNode(
+	ctx context.Context,
+	nodeID uint32,
+	nodeClient *client.NodeClient,
+	deploymentID uint64,
+	workloadVersions map[string]uint32,
 ) error {
 	lastProgress := Progress{time.Now(), 0}
 	numberOfWorkloads := len(workloadVersions)
+	states := make(map[string]gridtypes.ResultState)
 
 	deploymentError := backoff.Retry(func() error {
 		stateOk := 0
@@ -327,21 +404,22 @@ func (d *Deployer) Wait(
 
 		for _, wl := range deploymentChanges {
 			if _, ok := workloadVersions[wl.Name.String()]; ok && wl.Version == workloadVersions[wl.Name.String()] {
-				var errString string
+				if states[wl.Name.String()] != wl.Result.State {
+					states[wl.Name.String()] = wl.Result.State
+					d.emitProgress(nodeID, deploymentID, wl)
+				}
+
 				switch wl.Result.State {
 				case gridtypes.StateOk:
 					stateOk++
-				case gridtypes.StateError:
-					errString = fmt.Sprintf("workload %s within deployment %d failed with error: %s", wl.Name, deploymentID, wl.Result.Error)
-				case gridtypes.StateDeleted:
-					errString = fmt.Sprintf("workload %s state within deployment %d is deleted: %s", wl.Name, deploymentID, wl.Result.Error)
-				case gridtypes.StatePaused:
-					errString = fmt.Sprintf("workload %s state within deployment %d is paused: %s", wl.Name, deploymentID, wl.Result.Error)
-				case gridtypes.StateUnChanged:
-					errString = fmt.Sprintf("workload %s within deployment %d was not updated: %s", wl.Name, deploymentID, wl.Result.Error)
-				}
-				if errString != "" {
-					return backoff.Permanent(errors.New(errString))
+				case gridtypes.StateError, gridtypes.StateDeleted, gridtypes.StatePaused, gridtypes.StateUnChanged:
+					return backoff.Permanent(&WorkloadError{
+						NodeID:     nodeID,
+						ContractID: deploymentID,
+						Workload:   wl.Name.String(),
+						State:      wl.Result.State,
+						Message:    wl.Result.Error,
+					})
 				}
 			}
 		}
@@ -354,8 +432,7 @@ func (d *Deployer) Wait(
 		if lastProgress.stateOk < currentProgress.stateOk {
 			lastProgress = currentProgress
 		} else if currentProgress.time.Sub(lastProgress.time) > 4*time.Minute {
-			timeoutError := errors.Errorf("waiting for deployment %d timed out", deploymentID)
-			return backoff.Permanent(timeoutError)
+			return backoff.Permanent(&DeploymentTimeoutError{NodeID: nodeID, ContractID: deploymentID})
 		}
 
 		return errors.New("deployment in progress")
@@ -365,8 +442,91 @@ func (d *Deployer) Wait(
 	return deploymentError
 }
 
-// BatchDeploy deploys a batch of deployments, successful deployments should have ContractID fields set
+// BatchDeploy deploys a batch of deployments, successful deployments should have ContractID fields set.
+// in atomic mode deployments with contract IDs are updated, and the whole batch is rolled back if any node fails.
 func (d *Deployer) BatchDeploy(ctx context.Context, deployments map[uint32][]gridtypes.Deployment, deploymentsSolutionProvider map[uint32][]*uint64) (map[uint32][]gridtypes.Deployment, error) {
+	if d.metadataKey != nil {
+		encrypted := make(map[uint32][]gridtypes.Deployment, len(deployments))
+		for node, dls := range deployments {
+			for _, dl := range dls {
+				if err := d.encryptMetadata(&dl); err != nil {
+					return map[uint32][]gridtypes.Deployment{}, err
+				}
+				encrypted[node] = append(encrypted[node], dl)
+			}
+		}
+		deployments = encrypted
+	}
+
+	if d.atomicBatch {
+		return d.atomicBatchDeploy(ctx, deployments, deploymentsSolutionProvider)
+	}
+
+	contractsData, deploymentsSlice, err := d.prepareBatchContracts(ctx, deployments, deploymentsSolutionProvider)
+	if err != nil {
+		return map[uint32][]gridtypes.Deployment{}, err
+	}
+
+	if d.dryRunReport != nil {
+		return d.dryRunBatchDeploy(contractsData, deploymentsSlice)
+	}
+
+	contracts, index, err := d.substrateConn.BatchCreateContract(d.identity, contractsData)
+	if err != nil && index == nil {
+		return map[uint32][]gridtypes.Deployment{}, &ContractCreationError{Err: err}
+	}
+
+	var multiErr error
+	if err != nil {
+		multiErr = multierror.Append(multiErr, &ContractCreationError{NodeID: contractsData[*index].Node, Err: err})
+	}
+
+	var mu sync.Mutex
+	failedContracts := make([]uint64, 0)
+	var wg sync.WaitGroup
+	for i, dl := range deploymentsSlice {
+		if index != nil && *index == i {
+			break
+		}
+		node := contractsData[i].Node
+		dl := dl
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dl.ContractID = contracts[i]
+			if err := d.deployContract(ctx, node, dl); err != nil {
+				mu.Lock()
+				multiErr = multierror.Append(multiErr, err)
+				failedContracts = append(failedContracts, dl.ContractID)
+				mu.Unlock()
+				return
+			}
+
+			mu.Lock()
+			deploymentsSlice[i].ContractID = contracts[i]
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	resDeployments := make(map[uint32][]gridtypes.Deployment, len(deployments))
+	for i, dl := range deploymentsSlice {
+		resDeployments[contractsData[i].Node] = append(resDeployments[contractsData[i].Node], dl)
+	}
+
+	if len(failedContracts) != 0 {
+		err := d.substrateConn.BatchCancelContract(d.identity, failedContracts)
+		if err != nil {
+			multiErr = multierror.Append(multiErr, errors.Wrapf(err, "failed to cancel failed contracts %v", failedContracts))
+		}
+	}
+
+	return resDeployments, multiErr
+}
+
+// prepareBatchContracts signs the batch deployments and generates the data of their contracts
+func (d *Deployer) prepareBatchContracts(ctx context.Context, deployments map[uint32][]gridtypes.Deployment, deploymentsSolutionProvider map[uint32][]*uint64) ([]substrate.BatchCreateContractData, []gridtypes.Deployment, error) {
 	deploymentsSlice := make([]gridtypes.Deployment, 0)
 	contractsData := make([]substrate.BatchCreateContractData, 0)
 
@@ -377,7 +537,7 @@ func (d *Deployer) BatchDeploy(ctx context.Context, deployments map[uint32][]gri
 		// loading node clients first before creating any contract and caching the clients
 		_, err := d.ncPool.GetNodeClient(d.substrateConn, node)
 		if err != nil {
-			return map[uint32][]gridtypes.Deployment{}, errors.Wrap(err, "failed to get node client")
+			return nil, nil, errors.Wrap(err, "failed to get node client")
 		}
 		for i, dl := range dls {
 			i := i
@@ -434,80 +594,92 @@ func (d *Deployer) BatchDeploy(ctx context.Context, deployments map[uint32][]gri
 	}
 
 	if err := group.Wait(); err != nil {
-		return map[uint32][]gridtypes.Deployment{}, err
+		return nil, nil, err
 	}
 
-	contracts, index, err := d.substrateConn.BatchCreateContract(d.identity, contractsData)
-	if err != nil && index == nil {
-		return map[uint32][]gridtypes.Deployment{}, errors.Wrap(err, "failed to create contracts")
-	}
+	return contractsData, deploymentsSlice, nil
+}
 
-	var multiErr error
+// deployContract sends a new deployment with a created contract to its node and waits for it
+func (d *Deployer) deployContract(ctx context.Context, node uint32, dl gridtypes.Deployment) error {
+	client, err := d.ncPool.GetNodeClient(d.substrateConn, node)
 	if err != nil {
-		multiErr = multierror.Append(multiErr, err)
+		return errors.Wrapf(err, "failed to get node %d client", node)
 	}
 
-	failedContracts := make([]uint64, 0)
-	var wg sync.WaitGroup
+	if err := client.DeploymentDeploy(ctx, dl); err != nil {
+		return errors.Wrapf(err, "error sending deployment with contract id %d to node %d", dl.ContractID, node)
+	}
+
+	newWorkloadVersions := make(map[string]uint32)
+	for _, w := range dl.Workloads {
+		newWorkloadVersions[w.Name.String()] = 0
+	}
+	if err := d.WaitOnNode(ctx, node, client, dl.ContractID, newWorkloadVersions); err != nil {
+		return errors.Wrapf(err, "error waiting deployment on node %d", node)
+	}
+	return nil
+}
+
+// dryRunBatchDeploy reports the batch contracts and deployments, the returned deployments have no contract IDs
+func (d *Deployer) dryRunBatchDeploy(contractsData []substrate.BatchCreateContractData, deploymentsSlice []gridtypes.Deployment) (map[uint32][]gridtypes.Deployment, error) {
+	resDeployments := make(map[uint32][]gridtypes.Deployment)
 	for i, dl := range deploymentsSlice {
-		if index != nil && *index == i {
-			break
+		data := contractsData[i]
+		d.dryRunReport.addContract(DryRunContract{
+			Action:             PlanCreate,
+			Type:               NodeContractType,
+			NodeID:             data.Node,
+			Metadata:           data.Body,
+			Hash:               data.Hash,
+			PublicIPs:          data.PublicIPs,
+			SolutionProviderID: data.SolutionProviderID,
+		})
+		if err := d.dryRunReport.addDeployment(PlanCreate, data.Node, dl); err != nil {
+			return map[uint32][]gridtypes.Deployment{}, errors.Wrap(err, "failed to compute deployment capacity")
 		}
-		node := contractsData[i].Node
-		dl := dl
-		i := i
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			client, err := d.ncPool.GetNodeClient(d.substrateConn, node)
-			if err != nil {
-				mu.Lock()
-				multiErr = multierror.Append(multiErr, errors.Wrapf(err, "failed to get node %d client", node))
-				failedContracts = append(failedContracts, dl.ContractID)
-				mu.Unlock()
-				return
-			}
-			dl.ContractID = contracts[i]
+		resDeployments[data.Node] = append(resDeployments[data.Node], dl)
+	}
+	return resDeployments, nil
+}
 
-			err = client.DeploymentDeploy(ctx, dl)
+// encryptDeployments returns a copy of the deployments with encrypted metadata
+func (d *Deployer) encryptDeployments(deployments map[uint32]gridtypes.Deployment) (map[uint32]gridtypes.Deployment, error) {
+	if d.metadataKey == nil {
+		return deployments, nil
+	}
 
-			if err != nil {
-				mu.Lock()
-				multiErr = multierror.Append(multiErr, errors.Wrapf(err, "error sending deployment with contract id %d to node %d", dl.ContractID, node))
-				failedContracts = append(failedContracts, dl.ContractID)
-				mu.Unlock()
-				return
-			}
-			newWorkloadVersions := make(map[string]uint32)
-			for _, w := range dl.Workloads {
-				newWorkloadVersions[w.Name.String()] = 0
-			}
-			err = d.Wait(ctx, client, dl.ContractID, newWorkloadVersions)
-			mu.Lock()
-			defer mu.Unlock()
-			if err != nil {
-				multiErr = multierror.Append(multiErr, errors.Wrapf(err, "error waiting deployment on node %d", node))
-				failedContracts = append(failedContracts, dl.ContractID)
-				return
-			}
-			deploymentsSlice[i].ContractID = contracts[i]
-		}()
+	encrypted := make(map[uint32]gridtypes.Deployment, len(deployments))
+	for node, dl := range deployments {
+		if err := d.encryptMetadata(&dl); err != nil {
+			return nil, err
+		}
+		encrypted[node] = dl
 	}
-	wg.Wait()
+	return encrypted, nil
+}
 
-	resDeployments := make(map[uint32][]gridtypes.Deployment, len(deployments))
-	for i, dl := range deploymentsSlice {
-		resDeployments[contractsData[i].Node] = append(resDeployments[contractsData[i].Node], dl)
+// encryptMetadata encrypts the deployment metadata and its workloads metadata if the deployer has a metadata key
+func (d *Deployer) encryptMetadata(dl *gridtypes.Deployment) (err error) {
+	if d.metadataKey == nil {
+		return nil
 	}
 
-	if len(failedContracts) != 0 {
-		err := d.substrateConn.BatchCancelContract(d.identity, failedContracts)
+	dl.Metadata, err = workloads.EncryptMetadata(d.metadataKey, dl.Metadata)
+	if err != nil {
+		return errors.Wrap(err, "failed to encrypt deployment metadata")
+	}
+
+	workloadsList := make([]gridtypes.Workload, len(dl.Workloads))
+	for i, wl := range dl.Workloads {
+		wl.Metadata, err = workloads.EncryptMetadata(d.metadataKey, wl.Metadata)
 		if err != nil {
-			multiErr = multierror.Append(multiErr, errors.Wrapf(err, "failed to cancel failed contracts %v", failedContracts))
+			return errors.Wrapf(err, "failed to encrypt workload %s metadata", wl.Name)
 		}
+		workloadsList[i] = wl
 	}
-
-	return resDeployments, multiErr
+	dl.Workloads = workloadsList
+	return nil
 }
 
 // matchOldVersions assigns deployment and workloads versions of the new versionless deployment to the ones of the old deployment
@@ -680,7 +852,7 @@ func (d *Deployer) Validate(ctx context.Context, oldDeployments map[uint32]gridt
 				MRU: mru,
 				SRU: sru,
 			}
-			return errors.Errorf("node %d does not have enough resources. needed: %v, free: %v", node, capacityPrettyPrint(needed), capacityPrettyPrint(free))
+			return &InsufficientCapacityError{NodeID: node, Needed: needed, Free: free}
 		}
 	}
 	return nil
@@ -50,6 +50,9 @@ func (d *DeploymentDeployer) Validate(ctx context.Context, dls []*workloads.Depl
 				errs = multierror.Append(errs, err)
 				return
 			}
+			for _, warning := range d.flistWarnings(ctx, dl) {
+				log.Warn().Str("deployment", dl.Name).Msg(warning)
+			}
 		}(dl)
 	}
 
@@ -57,6 +60,17 @@ func (d *DeploymentDeployer) Validate(ctx context.Context, dls []*workloads.Depl
 	return errs
 }
 
+// flistWarnings inspects the flists of the deployment vms if the client inspects flists
+// and returns the problems of the vms with their flists
+func (d *DeploymentDeployer) flistWarnings(ctx context.Context, dl *workloads.Deployment) []string {
+	var warnings []string
+	for i := range dl.Vms {
+		vm := &dl.Vms[i]
+		warnings = append(warnings, d.tfPluginClient.flistWarnings(ctx, vm.Name, vm.Flist, vm)...)
+	}
+	return warnings
+}
+
 // GenerateVersionlessDeployments generates a new deployment without a version
 func (d *DeploymentDeployer) GenerateVersionlessDeployments(ctx context.Context, dls []*workloads.Deployment) (map[uint32][]gridtypes.Deployment, error) {
 	gridDlsPerNodes := make(map[uint32][]gridtypes.Deployment)
@@ -81,9 +95,7 @@ func (d *DeploymentDeployer) GenerateVersionlessDeployments(ctx context.Context,
 			for _, zdb := range dl.Zdbs {
 				newDl.Workloads = append(newDl.Workloads, zdb.ZosWorkload())
 			}
-			for _, vm := range dl.Vms {
-				newDl.Workloads = append(newDl.Workloads, vm.ZosWorkload()...)
-			}
+			newDl.Workloads = append(newDl.Workloads, dl.VMsZosWorkloads()...)
 
 			for idx, q := range dl.QSFS {
 				qsfsWorkload, err := q.ZosWorkload()
@@ -112,11 +124,24 @@ func (d *DeploymentDeployer) GenerateVersionlessDeployments(ctx context.Context,
 	return gridDlsPerNodes, errs
 }
 
+// EstimateCost estimates the monthly cost of a deployment before deploying it
+func (d *DeploymentDeployer) EstimateCost(ctx context.Context, dl *workloads.Deployment) (CostEstimate, error) {
+	dlsPerNodes, err := d.GenerateVersionlessDeployments(ctx, []*workloads.Deployment{dl})
+	if err != nil {
+		return CostEstimate{}, errors.Wrap(err, "could not generate deployments data")
+	}
+	return d.tfPluginClient.EstimateCost(ctx, dlsPerNodes)
+}
+
 // Deploy deploys a new deployment
 func (d *DeploymentDeployer) Deploy(ctx context.Context, dl *workloads.Deployment) error {
 	if err := d.Validate(ctx, []*workloads.Deployment{dl}); err != nil {
 		return fmt.Errorf("invalid deployment: %w", err)
 	}
+	if err := d.validatePinnedIPs(ctx, dl); err != nil {
+		return fmt.Errorf("invalid deployment: %w", err)
+	}
+	newContract := dl.ContractID == 0
 
 	dlsPerNodes, err := d.GenerateVersionlessDeployments(ctx, []*workloads.Deployment{dl})
 	if err != nil {
@@ -139,8 +164,11 @@ func (d *DeploymentDeployer) Deploy(ctx context.Context, dl *workloads.Deploymen
 		dl.ContractID = contractID
 		d.tfPluginClient.State.StoreContractIDs(dl.NodeID, dl.ContractID)
 	}
+	if err == nil {
+		err = d.syncPublicIPs(ctx, dl, newContract)
+	}
 
-	return err
+	return d.tfPluginClient.saveState(err)
 }
 
 // BatchDeploy deploys multiple deployments using the deployer
@@ -151,8 +179,19 @@ func (d *DeploymentDeployer) BatchDeploy(ctx context.Context, dls []*workloads.D
 	if err := d.Validate(ctx, dls); err != nil {
 		multiErr = multierror.Append(multiErr, fmt.Errorf("invalid deployments: %w", err))
 	}
+	// deployments with invalid pinned ips are not deployed
+	newContracts := make(map[*workloads.Deployment]bool)
+	pinnable := make([]*workloads.Deployment, 0, len(dls))
+	for _, dl := range dls {
+		if err := d.validatePinnedIPs(ctx, dl); err != nil {
+			multiErr = multierror.Append(multiErr, fmt.Errorf("invalid deployment %s: %w", dl.Name, err))
+			continue
+		}
+		newContracts[dl] = dl.ContractID == 0
+		pinnable = append(pinnable, dl)
+	}
 
-	newDeployments, err := d.GenerateVersionlessDeployments(ctx, dls)
+	newDeployments, err := d.GenerateVersionlessDeployments(ctx, pinnable)
 	if err != nil {
 		multiErr = multierror.Append(multiErr, fmt.Errorf("could not generate grid deployments: %w", err))
 	}
@@ -168,13 +207,17 @@ func (d *DeploymentDeployer) BatchDeploy(ctx context.Context, dls []*workloads.D
 
 	// update deployment and plugin state
 	// error is not returned immediately before updating state because of untracked failed deployments
-	for _, dl := range dls {
+	for _, dl := range pinnable {
 		if err := d.updateStateFromDeployments(ctx, dl, newDls); err != nil {
 			multiErr = multierror.Append(multiErr, errors.Wrapf(err, "failed to update deployment '%s' state", dl.Name))
+			continue
+		}
+		if err := d.syncPublicIPs(ctx, dl, newContracts[dl]); err != nil {
+			multiErr = multierror.Append(multiErr, errors.Wrapf(err, "deployment '%s' public ips", dl.Name))
 		}
 	}
 
-	return multiErr
+	return d.tfPluginClient.saveState(multiErr)
 }
 
 // Cancel cancels deployments
@@ -193,14 +236,14 @@ func (d *DeploymentDeployer) Cancel(ctx context.Context, dl *workloads.Deploymen
 	d.tfPluginClient.State.RemoveContractIDs(dl.NodeID, dl.ContractID)
 	dl.ContractID = 0
 
-	return nil
+	return d.tfPluginClient.State.Save()
 }
 
 func (d *DeploymentDeployer) updateStateFromDeployments(ctx context.Context, dl *workloads.Deployment, newDls map[uint32][]gridtypes.Deployment) error {
 	dl.NodeDeploymentID = map[uint32]uint64{}
 
 	for _, newDl := range newDls[dl.NodeID] {
-		dlData, err := workloads.ParseDeploymentData(newDl.Metadata)
+		dlData, err := workloads.ParseDeploymentData(newDl.Metadata, d.tfPluginClient.metadataKey)
 		if err != nil {
 			return errors.Wrapf(err, "could not get deployment %d data", newDl.ContractID)
 		}
@@ -461,12 +504,18 @@ func (d *DeploymentDeployer) Sync(ctx context.Context, dl *workloads.Deployment)
 		}
 	}
 
+	reservedIPs, err := workloads.ReservedIPsFromZosDeployment(&deployment)
+	if err != nil {
+		return errors.Wrap(err, "failed to get reserved ips")
+	}
+
 	dl.Match(disks, qsfs, zdbs, vms)
 
 	dl.Disks = disks
 	dl.QSFS = qsfs
 	dl.Zdbs = zdbs
 	dl.Vms = vms
+	dl.ReservedIPs = reservedIPs
 
 	return nil
 }
@@ -8,12 +8,16 @@ import (
 	"log"
 	"math/big"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/flist"
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/mocks"
 	client "github.com/threefoldtech/tfgrid-sdk-go/grid-client/node"
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/state"
@@ -320,6 +324,31 @@ func TestDeploymentDeployerValidate(t *testing.T) {
 	})
 }
 
+func TestDeploymentDeployerFlistWarnings(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/flist/user/base.flist", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(flist.Contents{Content: []flist.File{{Path: "/sbin/zinit", Type: flist.RegularFile}}})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	dl := workloads.Deployment{Name: "dl", Vms: []workloads.VM{
+		{Name: "vm", Flist: server.URL + "/user/base.flist", Entrypoint: "/sbin/zinit init"},
+		{Name: "broken", Flist: server.URL + "/user/base.flist", Entrypoint: "/init.sh"},
+		{Name: "missing", Flist: server.URL + "/user/missing.flist"},
+	}}
+
+	d := DeploymentDeployer{tfPluginClient: &TFPluginClient{}}
+	assert.Empty(t, d.flistWarnings(context.Background(), &dl))
+
+	d.tfPluginClient.flistInspector = flist.NewInspector()
+	warnings := d.flistWarnings(context.Background(), &dl)
+	assert.Len(t, warnings, 2)
+	assert.Equal(t, "vm broken: entrypoint /init.sh doesn't exist in the flist, found /sbin/zinit", warnings[0])
+	assert.Contains(t, warnings[1], "vm missing: ")
+	assert.Contains(t, warnings[1], "404")
+}
+
 func TestDeploymentDeployerDeploy(t *testing.T) {
 	tfPluginClient, err := setup()
 	assert.NoError(t, err)
@@ -815,3 +844,50 @@ func ExampleDeploymentDeployer_Cancel() {
 	}
 	fmt.Println("deployment is canceled successfully")
 }
+
+func TestFakeGridEncryptedMetadata(t *testing.T) {
+	tfPluginClient, grid := newFakeGridClient(t)
+	ctx := context.Background()
+
+	encrypting, err := NewTFPluginClient(tfPluginClient.mnemonicOrSeed, WithBackend(grid), WithEncryptedMetadata())
+	require.NoError(t, err)
+	t.Cleanup(encrypting.Close)
+
+	network := workloads.ZNet{
+		Name:        "net",
+		Nodes:       []uint32{11},
+		IPRange:     gridtypes.NewIPNet(net.IPNet{IP: net.IPv4(10, 20, 0, 0), Mask: net.CIDRMask(16, 32)}),
+		AddWGAccess: true,
+	}
+	require.NoError(t, encrypting.NetworkDeployer.Deploy(ctx, &network))
+
+	dls := grid.NodeDeployments(11)
+	require.Len(t, dls, 1)
+	assert.True(t, workloads.IsEncryptedMetadata(dls[0].Metadata))
+	assert.True(t, workloads.IsEncryptedMetadata(dls[0].Workloads[0].Metadata))
+	assert.NotContains(t, dls[0].Workloads[0].Metadata, network.ExternalSK.String())
+
+	contracts, err := tfPluginClient.ContractsGetter.ListContractsOfProjectName(network.SolutionType)
+	require.NoError(t, err)
+	require.Len(t, contracts.NodeContracts, 1)
+	assert.True(t, workloads.IsEncryptedMetadata(contracts.NodeContracts[0].DeploymentData))
+
+	// updating the network keeps the same encrypted metadata
+	require.NoError(t, encrypting.NetworkDeployer.Deploy(ctx, &network))
+	assert.Equal(t, dls[0].Workloads[0].Metadata, grid.NodeDeployments(11)[0].Workloads[0].Metadata)
+
+	// the metadata key is not shared between states
+	keyless := state.NewState(tfPluginClient.NcPool, tfPluginClient.SubstrateConn)
+	keyless.StoreContractIDs(11, network.NodeDeploymentID[11])
+	_, err = keyless.LoadNetworkFromGrid(ctx, network.Name)
+	assert.ErrorIs(t, err, workloads.ErrMetadataKeyNotFound)
+
+	tfPluginClient.State.StoreContractIDs(11, network.NodeDeploymentID[11])
+	loaded, err := tfPluginClient.State.LoadNetworkFromGrid(ctx, network.Name)
+	require.NoError(t, err)
+	assert.Equal(t, network.ExternalSK, loaded.ExternalSK)
+	assert.Equal(t, network.AccessWGConfig, loaded.AccessWGConfig)
+
+	require.NoError(t, tfPluginClient.NetworkDeployer.Cancel(ctx, &loaded))
+	assert.Empty(t, grid.ActiveContracts())
+}
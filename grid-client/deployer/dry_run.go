@@ -0,0 +1,136 @@
+package deployer
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+)
+
+// ContractType is the type of a tfchain contract
+type ContractType string
+
+const (
+	// NodeContractType is the type of node contracts
+	NodeContractType ContractType = "node"
+	// NameContractType is the type of name contracts
+	NameContractType ContractType = "name"
+	// RentContractType is the type of rent contracts
+	RentContractType ContractType = "rent"
+)
+
+// DryRunContract is a contract a dry run would create, update or cancel
+type DryRunContract struct {
+	Action PlanAction
+	Type   ContractType
+	// ContractID is the contract to update or cancel
+	ContractID uint64
+	NodeID     uint32
+	// Name is the name of a name contract
+	Name               string
+	Metadata           string
+	Hash               string
+	PublicIPs          uint32
+	SolutionProviderID *uint64
+}
+
+// DryRunDeployment is a deployment a dry run would send to a node
+type DryRunDeployment struct {
+	Action     PlanAction
+	NodeID     uint32
+	Deployment gridtypes.Deployment
+	Capacity   gridtypes.Capacity
+}
+
+// DryRunReport collects the contracts and deployments a dry run would create, update or cancel
+type DryRunReport struct {
+	Contracts   []DryRunContract
+	Deployments []DryRunDeployment
+
+	lock sync.Mutex
+}
+
+// NewDryRunReport generates a new empty dry run report
+func NewDryRunReport() *DryRunReport {
+	return &DryRunReport{}
+}
+
+// Reset clears the report
+func (r *DryRunReport) Reset() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.Contracts = nil
+	r.Deployments = nil
+}
+
+// String returns a human readable description of the report
+func (r *DryRunReport) String() string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if len(r.Contracts) == 0 && len(r.Deployments) == 0 {
+		return "Dry run: nothing to do"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Dry run: %d contracts, %d deployments\n", len(r.Contracts), len(r.Deployments))
+	for _, contract := range r.Contracts {
+		fmt.Fprintf(&b, "  %s", contract.Action)
+		if contract.Type != "" {
+			fmt.Fprintf(&b, " %s", contract.Type)
+		}
+		b.WriteString(" contract")
+		if contract.ContractID != 0 {
+			fmt.Fprintf(&b, " %d", contract.ContractID)
+		}
+		switch contract.Type {
+		case NodeContractType, RentContractType:
+			if contract.NodeID != 0 {
+				fmt.Fprintf(&b, " on node %d", contract.NodeID)
+			}
+		case NameContractType:
+			fmt.Fprintf(&b, " for name %s", contract.Name)
+		}
+		if contract.PublicIPs != 0 {
+			fmt.Fprintf(&b, " with %d public ips", contract.PublicIPs)
+		}
+		b.WriteString("\n")
+	}
+	for _, dl := range r.Deployments {
+		fmt.Fprintf(&b, "  %s deployment on node %d with %d workloads (%s)\n", dl.Action, dl.NodeID, len(dl.Deployment.Workloads), capacityPrettyPrint(dl.Capacity))
+	}
+	return b.String()
+}
+
+func (r *DryRunReport) addContract(contract DryRunContract) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.Contracts = append(r.Contracts, contract)
+}
+
+func (r *DryRunReport) addDeployment(action PlanAction, nodeID uint32, dl gridtypes.Deployment) error {
+	capacity, err := Capacity(dl)
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.Deployments = append(r.Deployments, DryRunDeployment{
+		Action:     action,
+		NodeID:     nodeID,
+		Deployment: dl,
+		Capacity:   capacity,
+	})
+	return nil
+}
+
+func (r *DryRunReport) cancelContracts(contractIDs ...uint64) {
+	for _, contractID := range contractIDs {
+		r.addContract(DryRunContract{Action: PlanCancel, ContractID: contractID})
+	}
+}
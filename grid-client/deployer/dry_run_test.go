@@ -0,0 +1,68 @@
+package deployer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/mocks"
+	client "github.com/threefoldtech/tfgrid-sdk-go/grid-client/node"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+)
+
+func TestDeployerDryRun(t *testing.T) {
+	identity, err := substrate.NewIdentityFromSr25519Phrase("//Alice")
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// no substrate or rmb calls are expected in a dry run
+	cl := mocks.NewRMBMockClient(ctrl)
+	sub := mocks.NewMockSubstrateExt(ctrl)
+	ncPool := mocks.NewMockNodeClientGetter(ctrl)
+
+	report := NewDryRunReport()
+	deployer := Deployer{
+		identity:      identity,
+		twinID:        1,
+		ncPool:        ncPool,
+		substrateConn: sub,
+		dryRunReport:  report,
+	}
+
+	t.Run("create", func(t *testing.T) {
+		dl, err := deploymentWithFQDN(identity, 1, 0)
+		require.NoError(t, err)
+
+		mockDeployerValidator(&deployer, ctrl, []uint32{10})
+		ncPool.EXPECT().
+			GetNodeClient(sub, uint32(10)).
+			Return(client.NewNodeClient(13, cl, 10), nil)
+
+		contracts, err := deployer.Deploy(context.Background(), nil, map[uint32]gridtypes.Deployment{10: dl}, map[uint32]*uint64{10: nil})
+		assert.NoError(t, err)
+		assert.Empty(t, contracts)
+
+		assert.Len(t, report.Contracts, 1)
+		assert.Equal(t, PlanCreate, report.Contracts[0].Action)
+		assert.Equal(t, NodeContractType, report.Contracts[0].Type)
+		assert.Equal(t, uint32(10), report.Contracts[0].NodeID)
+		assert.NotEmpty(t, report.Contracts[0].Hash)
+
+		assert.Len(t, report.Deployments, 1)
+		assert.Equal(t, uint32(10), report.Deployments[0].NodeID)
+		assert.Len(t, report.Deployments[0].Deployment.Workloads, 1)
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		report.Reset()
+
+		assert.NoError(t, deployer.Cancel(context.Background(), 100))
+		assert.Equal(t, []DryRunContract{{Action: PlanCancel, Type: NodeContractType, ContractID: 100}}, report.Contracts)
+		assert.Equal(t, "Dry run: 1 contracts, 0 deployments\n  cancel node contract 100\n", report.String())
+	})
+}
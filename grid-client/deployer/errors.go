@@ -0,0 +1,91 @@
+package deployer
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+)
+
+// ErrRecreateRequired is returned if zos can't update a vm in place, the vm has to be recreated with its root filesystem wiped
+var ErrRecreateRequired = errors.New("zos can't update the vm in place, it has to be recreated")
+
+// WorkloadError is returned if a workload didn't reach the ok state on its node
+type WorkloadError struct {
+	NodeID     uint32
+	ContractID uint64
+	Workload   string
+	State      gridtypes.ResultState
+	// Message is the error message reported by zos
+	Message string
+}
+
+// Error returns the workload state and zos message
+func (e *WorkloadError) Error() string {
+	switch e.State {
+	case gridtypes.StateDeleted:
+		return fmt.Sprintf("workload %s state within deployment %d is deleted: %s", e.Workload, e.ContractID, e.Message)
+	case gridtypes.StatePaused:
+		return fmt.Sprintf("workload %s state within deployment %d is paused: %s", e.Workload, e.ContractID, e.Message)
+	case gridtypes.StateUnChanged:
+		return fmt.Sprintf("workload %s within deployment %d was not updated: %s", e.Workload, e.ContractID, e.Message)
+	default:
+		return fmt.Sprintf("workload %s within deployment %d failed with error: %s", e.Workload, e.ContractID, e.Message)
+	}
+}
+
+// DeploymentTimeoutError is returned if the workloads of a deployment made no progress for too long
+type DeploymentTimeoutError struct {
+	NodeID     uint32
+	ContractID uint64
+}
+
+// Error returns the timed out deployment
+func (e *DeploymentTimeoutError) Error() string {
+	return fmt.Sprintf("waiting for deployment %d timed out", e.ContractID)
+}
+
+// ContractCreationError is returned if the chain refused to create a node contract
+type ContractCreationError struct {
+	// NodeID is the contract node, it is zero if a batch of contracts on different nodes failed as a whole
+	NodeID uint32
+	Err    error
+}
+
+// Error returns the contract node and the chain error
+func (e *ContractCreationError) Error() string {
+	if e.NodeID == 0 {
+		return fmt.Sprintf("failed to create contracts: %s", e.Err)
+	}
+	return fmt.Sprintf("failed to create contract on node %d: %s", e.NodeID, e.Err)
+}
+
+// Unwrap returns the chain error
+func (e *ContractCreationError) Unwrap() error {
+	return e.Err
+}
+
+// InsufficientBalanceError is returned if the account can't pay the extrinsics fees
+type InsufficientBalanceError struct {
+	// Balance is the free balance in TFT
+	Balance float64
+	// Required is the minimum balance in TFT
+	Required float64
+}
+
+// Error returns the account balance
+func (e *InsufficientBalanceError) Error() string {
+	return fmt.Sprintf("account contains %f tft, min fee is %g tft", e.Balance, e.Required)
+}
+
+// InsufficientCapacityError is returned if a node doesn't have enough free resources for a deployment
+type InsufficientCapacityError struct {
+	NodeID uint32
+	Needed gridtypes.Capacity
+	Free   gridtypes.Capacity
+}
+
+// Error returns the needed and free capacity of the node
+func (e *InsufficientCapacityError) Error() string {
+	return fmt.Sprintf("node %d does not have enough resources. needed: %v, free: %v", e.NodeID, capacityPrettyPrint(e.Needed), capacityPrettyPrint(e.Free))
+}
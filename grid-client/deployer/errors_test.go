@@ -0,0 +1,74 @@
+package deployer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	client "github.com/threefoldtech/tfgrid-sdk-go/grid-client/node"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/subi"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
+)
+
+func TestFakeGridTypedErrors(t *testing.T) {
+	tfPluginClient, grid := newFakeGridClient(t)
+	ctx := context.Background()
+
+	t.Run("insufficient capacity", func(t *testing.T) {
+		dl := workloads.NewDeployment("big", 12, "", nil, "", []workloads.Disk{{Name: "big", SizeGB: 2000}}, nil, nil, nil)
+		err := tfPluginClient.DeploymentDeployer.Deploy(ctx, &dl)
+
+		var capacityErr *InsufficientCapacityError
+		require.ErrorAs(t, err, &capacityErr)
+		assert.Equal(t, uint32(12), capacityErr.NodeID)
+		assert.Equal(t, 2000*gridtypes.Gigabyte, capacityErr.Needed.SRU)
+	})
+
+	t.Run("contract creation failed", func(t *testing.T) {
+		disk := workloads.Disk{Name: "disk", SizeGB: 10}
+		dl := workloads.NewGridDeployment(tfPluginClient.TwinID, []gridtypes.Workload{disk.ZosWorkload()})
+		deployer := NewDeployer(tfPluginClient, true)
+
+		_, err := deployer.Deploy(ctx, nil, map[uint32]gridtypes.Deployment{11: dl}, nil)
+		require.NoError(t, err)
+
+		// the chain refuses a contract with the same hash on the node
+		_, err = deployer.Deploy(ctx, nil, map[uint32]gridtypes.Deployment{11: dl}, nil)
+		var contractErr *ContractCreationError
+		require.ErrorAs(t, err, &contractErr)
+		assert.Equal(t, uint32(11), contractErr.NodeID)
+
+		var chainErr *subi.ChainError
+		require.ErrorAs(t, err, &chainErr)
+		assert.Equal(t, "CreateNodeContract", chainErr.Call)
+	})
+
+	t.Run("workload failed", func(t *testing.T) {
+		grid.FailWorkloads(zos.ZMountType, "no space")
+
+		dl := workloads.NewDeployment("failing", 12, "", nil, "", []workloads.Disk{{Name: "failing", SizeGB: 10}}, nil, nil, nil)
+		err := tfPluginClient.DeploymentDeployer.Deploy(ctx, &dl)
+
+		var workloadErr *WorkloadError
+		require.ErrorAs(t, err, &workloadErr)
+		assert.Equal(t, uint32(12), workloadErr.NodeID)
+		assert.NotZero(t, workloadErr.ContractID)
+		assert.Equal(t, "failing", workloadErr.Workload)
+		assert.Equal(t, gridtypes.StateError, workloadErr.State)
+		assert.Equal(t, "no space", workloadErr.Message)
+	})
+
+	t.Run("node unreachable", func(t *testing.T) {
+		require.NoError(t, grid.SetNodeStatus(11, "down"))
+
+		gw := workloads.GatewayNameProxy{NodeID: 11, Name: "down", Backends: []zos.Backend{"http://185.206.122.33:8080"}}
+		err := tfPluginClient.GatewayNameDeployer.Deploy(ctx, &gw)
+
+		var unreachableErr *client.NodeUnreachableError
+		require.ErrorAs(t, err, &unreachableErr)
+		assert.Equal(t, uint32(11), unreachableErr.NodeID)
+	})
+}
@@ -0,0 +1,431 @@
+package deployer
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
+)
+
+// DefaultFailoverInterval is the time between two checks of the nodes status if the failover config doesn't set it
+const DefaultFailoverInterval = time.Minute
+
+// FailoverConfig configures the failover reconciler
+type FailoverConfig struct {
+	// Interval is the time between two checks of the nodes status, it defaults to DefaultFailoverInterval
+	Interval time.Duration
+	// DownThreshold is how long a node stays down before its deployments are moved
+	DownThreshold time.Duration
+	// Constraints are used to pick the new nodes, down nodes are always excluded
+	Constraints PlacementConstraints
+}
+
+// FailoverProject is the set of objects watched by the failover reconciler
+type FailoverProject struct {
+	Deployments []*workloads.Deployment
+	// Networks are the deployments networks by name
+	Networks     map[string]*workloads.ZNet
+	GatewayNames []*workloads.GatewayNameProxy
+	GatewayFQDNs []*workloads.GatewayFQDNProxy
+}
+
+// Failover is a deployment moved from a down node
+type Failover struct {
+	Name          string
+	OldNodeID     uint32
+	NewNodeID     uint32
+	OldContractID uint64
+	NewContractID uint64
+}
+
+// Reconciler moves the deployments of a project from down nodes to new ones
+type Reconciler struct {
+	tfPluginClient *TFPluginClient
+	cfg            FailoverConfig
+	project        FailoverProject
+	downSince      map[uint32]time.Time
+	now            func() time.Time
+}
+
+// NewReconciler creates a new failover reconciler for the project objects
+func NewReconciler(tfPluginClient *TFPluginClient, project FailoverProject, cfg FailoverConfig) *Reconciler {
+	if project.Networks == nil {
+		project.Networks = make(map[string]*workloads.ZNet)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultFailoverInterval
+	}
+	return &Reconciler{
+		tfPluginClient: tfPluginClient,
+		cfg:            cfg,
+		project:        project,
+		downSince:      make(map[uint32]time.Time),
+		now:            time.Now,
+	}
+}
+
+// LoadFailoverProject loads the project deployments, their networks and the project gateways from the grid.
+// it has to be called while the project nodes are up.
+func (t *TFPluginClient) LoadFailoverProject(ctx context.Context, projectName string) (FailoverProject, error) {
+	contracts, err := t.ContractsGetter.ListContractsByTwinID([]string{"Created", "GracePeriod"})
+	if err != nil {
+		return FailoverProject{}, errors.Wrap(err, "could not list twin contracts")
+	}
+
+	deployed := t.groupContracts(contracts.NodeContracts)
+	for key, nodeContracts := range deployed {
+		if key.projectName != projectName && key.deploymentType != workloads.NetworkType {
+			continue
+		}
+		for nodeID, contractID := range nodeContracts {
+			t.State.StoreContractIDs(nodeID, contractID)
+		}
+	}
+
+	project := FailoverProject{Networks: make(map[string]*workloads.ZNet)}
+	for key, nodeContracts := range deployed {
+		if key.projectName != projectName {
+			continue
+		}
+
+		for nodeID := range nodeContracts {
+			switch key.deploymentType {
+			case workloads.VMType:
+				dl, err := t.State.LoadDeploymentFromGrid(ctx, nodeID, key.name)
+				if err != nil {
+					return FailoverProject{}, errors.Wrapf(err, "could not load deployment %s", key.name)
+				}
+				project.Deployments = append(project.Deployments, &dl)
+			case workloads.GatewayNameType:
+				gw, err := t.State.LoadGatewayNameFromGrid(ctx, nodeID, key.name, key.name)
+				if err != nil {
+					return FailoverProject{}, errors.Wrapf(err, "could not load gateway name %s", key.name)
+				}
+				project.GatewayNames = append(project.GatewayNames, &gw)
+			case workloads.GatewayFQDNType:
+				gw, err := t.State.LoadGatewayFQDNFromGrid(ctx, nodeID, key.name, key.name)
+				if err != nil {
+					return FailoverProject{}, errors.Wrapf(err, "could not load gateway fqdn %s", key.name)
+				}
+				project.GatewayFQDNs = append(project.GatewayFQDNs, &gw)
+			}
+		}
+	}
+
+	for _, dl := range project.Deployments {
+		if dl.NetworkName == "" || project.Networks[dl.NetworkName] != nil {
+			continue
+		}
+		znet, err := t.State.LoadNetworkFromGrid(ctx, dl.NetworkName)
+		if err != nil {
+			return FailoverProject{}, errors.Wrapf(err, "could not load network %s", dl.NetworkName)
+		}
+		project.Networks[dl.NetworkName] = &znet
+	}
+
+	return project, nil
+}
+
+// Run checks the project nodes every interval and moves the deployments of the nodes down for more than the threshold.
+// it stops when the context is done.
+func (r *Reconciler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		failovers, err := r.Reconcile(ctx)
+		for _, failover := range failovers {
+			log.Info().Str("name", failover.Name).Uint32("old node", failover.OldNodeID).Uint32("new node", failover.NewNodeID).Msg("deployment moved from down node")
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("failed to reconcile project deployments")
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reconcile checks the status of the project nodes once and moves the deployments of the nodes down for more than the threshold.
+// it returns the moved deployments even if some of them failed to move.
+func (r *Reconciler) Reconcile(ctx context.Context) ([]Failover, error) {
+	var nodes []uint32
+	for _, dl := range r.project.Deployments {
+		if !slices.Contains(nodes, dl.NodeID) {
+			nodes = append(nodes, dl.NodeID)
+		}
+	}
+	slices.Sort(nodes)
+
+	var failovers []Failover
+	var errs error
+	for _, nodeID := range nodes {
+		node, err := r.tfPluginClient.GridProxyClient.Node(ctx, nodeID)
+		if err != nil {
+			errs = multierror.Append(errs, errors.Wrapf(err, "could not get node %d status", nodeID))
+			continue
+		}
+
+		if node.Status != "down" {
+			delete(r.downSince, nodeID)
+			continue
+		}
+
+		since, ok := r.downSince[nodeID]
+		if !ok {
+			since = r.now()
+			r.downSince[nodeID] = since
+		}
+		if r.now().Sub(since) < r.cfg.DownThreshold {
+			continue
+		}
+
+		moved, err := r.failoverNode(ctx, nodeID)
+		failovers = append(failovers, moved...)
+		if err != nil {
+			errs = multierror.Append(errs, errors.Wrapf(err, "could not move deployments from node %d", nodeID))
+			continue
+		}
+		delete(r.downSince, nodeID)
+	}
+
+	return failovers, errs
+}
+
+// failoverNode deploys the deployments of a down node on new nodes with the same names and networks,
+// moves the gateways backends to the new ips and cancels the old contracts.
+// disks and zdbs data are not moved.
+func (r *Reconciler) failoverNode(ctx context.Context, nodeID uint32) ([]Failover, error) {
+	var oldDls, newDls []*workloads.Deployment
+	for _, dl := range r.project.Deployments {
+		if dl.NodeID != nodeID {
+			continue
+		}
+		newDl := failoverCopy(dl)
+		oldDls = append(oldDls, dl)
+		newDls = append(newDls, &newDl)
+	}
+
+	constraints := r.cfg.Constraints
+	constraints.Filter.Excluded = append(slices.Clone(constraints.Filter.Excluded), uint64(nodeID))
+	if err := r.tfPluginClient.DeploymentDeployer.Schedule(ctx, newDls, constraints); err != nil {
+		return nil, errors.Wrap(err, "could not find new nodes")
+	}
+
+	if err := r.moveNetworks(ctx, nodeID, newDls); err != nil {
+		return nil, err
+	}
+
+	var failovers []Failover
+	var oldContracts []uint64
+	ips := make(map[string]string)
+	var errs error
+	for i, newDl := range newDls {
+		oldDl := oldDls[i]
+		if err := r.tfPluginClient.DeploymentDeployer.Deploy(ctx, newDl); err != nil {
+			errs = multierror.Append(errs, errors.Wrapf(err, "could not deploy %s on node %d", newDl.Name, newDl.NodeID))
+			continue
+		}
+
+		for _, vm := range oldDl.Vms {
+			idx := slices.IndexFunc(newDl.Vms, func(newVM workloads.VM) bool { return newVM.Name == vm.Name })
+			if idx != -1 {
+				addMovedIPs(ips, vm, newDl.Vms[idx])
+			}
+		}
+
+		failovers = append(failovers, Failover{
+			Name:          newDl.Name,
+			OldNodeID:     nodeID,
+			NewNodeID:     newDl.NodeID,
+			OldContractID: oldDl.ContractID,
+			NewContractID: newDl.ContractID,
+		})
+		oldContracts = append(oldContracts, oldDl.ContractID)
+		*oldDl = *newDl
+	}
+
+	if err := r.moveGateways(ctx, ips); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	if len(oldContracts) != 0 {
+		if err := r.tfPluginClient.BatchCancelContract(oldContracts); err != nil {
+			return failovers, multierror.Append(errs, errors.Wrapf(err, "could not cancel old contracts %v", oldContracts))
+		}
+		r.tfPluginClient.State.RemoveContractIDs(nodeID, oldContracts...)
+		if err := r.tfPluginClient.State.Save(); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+
+	return failovers, errs
+}
+
+// moveNetworks replaces the down node with the new nodes in the deployments networks
+func (r *Reconciler) moveNetworks(ctx context.Context, nodeID uint32, dls []*workloads.Deployment) error {
+	var names []string
+	for _, dl := range dls {
+		if dl.NetworkName != "" && !slices.Contains(names, dl.NetworkName) {
+			names = append(names, dl.NetworkName)
+		}
+	}
+
+	for _, name := range names {
+		znet, ok := r.project.Networks[name]
+		if !ok {
+			return errors.Errorf("network %s is not loaded", name)
+		}
+
+		znet.Nodes = slices.DeleteFunc(znet.Nodes, func(id uint32) bool { return id == nodeID })
+		for _, dl := range dls {
+			if dl.NetworkName != name || slices.Contains(znet.Nodes, dl.NodeID) {
+				continue
+			}
+			znet.Nodes = append(znet.Nodes, dl.NodeID)
+
+			if len(znet.MyceliumKeys) != 0 && len(znet.MyceliumKeys[dl.NodeID]) == 0 {
+				key, err := workloads.RandomMyceliumKey()
+				if err != nil {
+					return errors.Wrapf(err, "could not generate mycelium key for node %d", dl.NodeID)
+				}
+				znet.MyceliumKeys[dl.NodeID] = key
+			}
+		}
+		delete(znet.MyceliumKeys, nodeID)
+
+		if err := r.tfPluginClient.NetworkDeployer.Deploy(ctx, znet); err != nil {
+			return errors.Wrapf(err, "could not deploy network %s", name)
+		}
+	}
+	return nil
+}
+
+// moveGateways replaces the moved ips in the gateways backends and redeploys the changed gateways
+func (r *Reconciler) moveGateways(ctx context.Context, ips map[string]string) error {
+	var errs error
+	for _, gw := range r.project.GatewayNames {
+		if !replaceBackends(gw.Backends, ips) {
+			continue
+		}
+		if err := r.tfPluginClient.GatewayNameDeployer.Deploy(ctx, gw); err != nil {
+			errs = multierror.Append(errs, errors.Wrapf(err, "could not update gateway name %s backends", gw.Name))
+		}
+	}
+	for _, gw := range r.project.GatewayFQDNs {
+		if !replaceBackends(gw.Backends, ips) {
+			continue
+		}
+		if err := r.tfPluginClient.GatewayFQDNDeployer.Deploy(ctx, gw); err != nil {
+			errs = multierror.Append(errs, errors.Wrapf(err, "could not update gateway fqdn %s backends", gw.Name))
+		}
+	}
+	return errs
+}
+
+// failoverCopy copies the deployment without its node, contracts and computed ips
+func failoverCopy(dl *workloads.Deployment) workloads.Deployment {
+	res := copyDeployment(dl)
+	res.NodeID = 0
+	res.ContractID = 0
+	res.NodeDeploymentID = nil
+	res.IPrange = ""
+
+	// pinned ips belong to the old node farm and contract, vms pinned to reserved ips get their own public ips instead
+	res.ReservedIPs = nil
+	for _, ip := range dl.ReservedIPs {
+		if !slices.ContainsFunc(dl.Vms, func(vm workloads.VM) bool { return workloads.SameIPAddress(vm.PublicIPAddress, ip.IP) }) {
+			res.ReservedIPs = append(res.ReservedIPs, workloads.ReservedIP{Name: ip.Name})
+		}
+	}
+	for i := range res.Vms {
+		res.Vms[i].PublicIPAddress = ""
+		res.Vms[i].IP = ""
+		res.Vms[i].ComputedIP = ""
+		res.Vms[i].ComputedIP6 = ""
+		res.Vms[i].PlanetaryIP = ""
+		res.Vms[i].MyceliumIP = ""
+	}
+	res.Zdbs = slices.Clone(dl.Zdbs)
+	for i := range res.Zdbs {
+		res.Zdbs[i].IPs = nil
+		res.Zdbs[i].Port = 0
+	}
+	return res
+}
+
+// addMovedIPs maps the old vm ips to the new vm ips
+func addMovedIPs(ips map[string]string, oldVM, newVM workloads.VM) {
+	pairs := [][2]string{
+		{oldVM.IP, newVM.IP},
+		{ipWithoutMask(oldVM.ComputedIP), ipWithoutMask(newVM.ComputedIP)},
+		{ipWithoutMask(oldVM.ComputedIP6), ipWithoutMask(newVM.ComputedIP6)},
+		{oldVM.PlanetaryIP, newVM.PlanetaryIP},
+		{oldVM.MyceliumIP, newVM.MyceliumIP},
+	}
+	for _, pair := range pairs {
+		if pair[0] != "" && pair[1] != "" {
+			ips[pair[0]] = pair[1]
+		}
+	}
+}
+
+func ipWithoutMask(ip string) string {
+	ip, _, _ = strings.Cut(ip, "/")
+	return ip
+}
+
+// replaceBackends replaces the backends hosts using the ips map, it returns true if any backend is changed
+func replaceBackends(backends []zos.Backend, ips map[string]string) bool {
+	changed := false
+	for i, backend := range backends {
+		if newBackend, ok := replaceBackendHost(string(backend), ips); ok {
+			backends[i] = zos.Backend(newBackend)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// replaceBackendHost replaces the host of a backend like http://ip:port or ip:port
+func replaceBackendHost(backend string, ips map[string]string) (string, bool) {
+	scheme, hostPort, ok := strings.Cut(backend, "://")
+	if !ok {
+		scheme, hostPort = "", backend
+	}
+
+	path := ""
+	if idx := strings.Index(hostPort, "/"); idx != -1 {
+		hostPort, path = hostPort[:idx], hostPort[idx:]
+	}
+
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		host, port = strings.Trim(hostPort, "[]"), ""
+	}
+
+	newHost, ok := ips[host]
+	if !ok {
+		return backend, false
+	}
+
+	if port != "" {
+		newHost = net.JoinHostPort(newHost, port)
+	} else if strings.Contains(newHost, ":") {
+		newHost = "[" + newHost + "]"
+	}
+	if scheme != "" {
+		scheme += "://"
+	}
+	return scheme + newHost + path, true
+}
@@ -0,0 +1,124 @@
+package deployer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/mocks"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
+)
+
+func TestReconcile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	proxyCl := mocks.NewMockClient(ctrl)
+	tfPluginClient := TFPluginClient{TwinID: twinID, GridProxyClient: proxyCl}
+	tfPluginClient.DeploymentDeployer = DeploymentDeployer{tfPluginClient: &tfPluginClient}
+
+	dl := &workloads.Deployment{Name: "dl", NodeID: nodeID, ContractID: contractID, Vms: []workloads.VM{{Name: "vm", CPU: 1, Memory: 1024}}}
+	r := NewReconciler(&tfPluginClient, FailoverProject{Deployments: []*workloads.Deployment{dl}}, FailoverConfig{DownThreshold: 10 * time.Minute})
+	assert.Equal(t, DefaultFailoverInterval, r.cfg.Interval)
+
+	now := time.Now()
+	r.now = func() time.Time { return now }
+	status := func(status string) {
+		proxyCl.EXPECT().Node(gomock.Any(), nodeID).Return(types.NodeWithNestedCapacity{Status: status}, nil)
+	}
+
+	// the node is down for less than the threshold
+	status("down")
+	failovers, err := r.Reconcile(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, failovers)
+	assert.Equal(t, now, r.downSince[nodeID])
+
+	// the node is up again
+	status("up")
+	_, err = r.Reconcile(context.Background())
+	require.NoError(t, err)
+	assert.NotContains(t, r.downSince, nodeID)
+
+	// the node is down for more than the threshold but no node can take its deployments
+	status("down")
+	_, err = r.Reconcile(context.Background())
+	require.NoError(t, err)
+
+	now = now.Add(time.Hour)
+	status("down")
+	proxyCl.EXPECT().Nodes(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, filter types.NodeFilter, limit types.Limit) ([]types.Node, int, error) {
+			assert.Contains(t, filter.Excluded, uint64(nodeID))
+			return nil, 0, nil
+		})
+	failovers, err = r.Reconcile(context.Background())
+	assert.ErrorContains(t, err, "could not find new nodes")
+	assert.Empty(t, failovers)
+	assert.Contains(t, r.downSince, nodeID)
+	assert.Equal(t, uint32(nodeID), dl.NodeID)
+}
+
+func TestFailoverCopy(t *testing.T) {
+	dl := workloads.Deployment{
+		Name:             "dl",
+		NodeID:           nodeID,
+		ContractID:       contractID,
+		NodeDeploymentID: map[uint32]uint64{nodeID: contractID},
+		IPrange:          "10.1.2.0/24",
+		Vms: []workloads.VM{
+			{Name: "vm", IP: "10.1.2.2", ComputedIP: "1.1.1.1/24", MyceliumIPSeed: []byte{1}},
+			{Name: "pinned", PublicIP: true, PublicIPAddress: "1.1.1.2", ComputedIP: "1.1.1.2/24"},
+		},
+		Zdbs:        []workloads.ZDB{{Name: "zdb", IPs: []string{"::1"}, Port: 9900}},
+		ReservedIPs: []workloads.ReservedIP{{Name: "ip", IP: "1.1.1.2/24"}, {Name: "spare", IP: "1.1.1.3/24"}},
+	}
+
+	res := failoverCopy(&dl)
+	assert.Zero(t, res.NodeID)
+	assert.Zero(t, res.ContractID)
+	assert.Nil(t, res.NodeDeploymentID)
+	assert.Empty(t, res.IPrange)
+	assert.Empty(t, res.Vms[0].IP)
+	assert.Empty(t, res.Vms[0].ComputedIP)
+	assert.Equal(t, []byte{1}, res.Vms[0].MyceliumIPSeed)
+	assert.Nil(t, res.Zdbs[0].IPs)
+
+	// pinned ips are not moved, the vm pinned to a reserved ip gets its own public ip
+	assert.Equal(t, []workloads.ReservedIP{{Name: "spare"}}, res.ReservedIPs)
+	assert.Empty(t, res.Vms[1].PublicIPAddress)
+	assert.True(t, res.Vms[1].PublicIP)
+
+	// the original deployment is not changed
+	assert.Equal(t, "10.1.2.2", dl.Vms[0].IP)
+	assert.Equal(t, uint32(9900), dl.Zdbs[0].Port)
+}
+
+func TestReplaceBackends(t *testing.T) {
+	ips := make(map[string]string)
+	addMovedIPs(ips,
+		workloads.VM{IP: "10.1.2.2", ComputedIP: "1.1.1.1/24", ComputedIP6: "2a02::1/64"},
+		workloads.VM{IP: "10.1.3.2", ComputedIP: "2.2.2.2/24", ComputedIP6: "2a02::2/64"},
+	)
+
+	backends := []zos.Backend{
+		"http://1.1.1.1:8080",
+		"http://[2a02::1]:8080/path",
+		"10.1.2.2:443",
+		"http://10.1.2.20:8080",
+	}
+	assert.True(t, replaceBackends(backends, ips))
+	assert.Equal(t, []zos.Backend{
+		"http://2.2.2.2:8080",
+		"http://[2a02::2]:8080/path",
+		"10.1.3.2:443",
+		"http://10.1.2.20:8080",
+	}, backends)
+
+	assert.False(t, replaceBackends([]zos.Backend{"http://3.3.3.3"}, ips))
+}
@@ -0,0 +1,141 @@
+package deployer
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/fakegrid"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
+	"github.com/vedhavyas/go-subkey"
+)
+
+func newFakeGridClient(t *testing.T) (TFPluginClient, *fakegrid.Grid) {
+	grid := fakegrid.NewGrid()
+	t.Cleanup(grid.Close)
+
+	require.NoError(t, grid.AddFarm(fakegrid.Farm{
+		FarmID:    1,
+		PublicIPs: []fakegrid.PublicIP{{IP: "185.206.122.33/24", Gateway: "185.206.122.1"}},
+	}))
+	capacity := gridtypes.Capacity{CRU: 8, MRU: 16 * gridtypes.Gigabyte, SRU: 512 * gridtypes.Gigabyte, HRU: 1024 * gridtypes.Gigabyte}
+	require.NoError(t, grid.AddNode(fakegrid.Node{
+		NodeID:         11,
+		FarmID:         1,
+		TotalResources: capacity,
+		PublicIPv4:     "185.206.122.10/24",
+		Domain:         "gent01.fake.grid.tf",
+	}))
+	require.NoError(t, grid.AddNode(fakegrid.Node{NodeID: 12, FarmID: 1, TotalResources: capacity}))
+
+	identity, err := substrate.NewIdentityFromSr25519Phrase("//Alice")
+	require.NoError(t, err)
+	keyPair, err := identity.KeyPair()
+	require.NoError(t, err)
+
+	tfPluginClient, err := NewTFPluginClient(subkey.EncodeHex(keyPair.Seed()), WithBackend(grid))
+	require.NoError(t, err)
+	t.Cleanup(tfPluginClient.Close)
+
+	return tfPluginClient, grid
+}
+
+func TestFakeGridDeployments(t *testing.T) {
+	tfPluginClient, grid := newFakeGridClient(t)
+	ctx := context.Background()
+
+	network := workloads.ZNet{
+		Name:    "net",
+		Nodes:   []uint32{11, 12},
+		IPRange: gridtypes.NewIPNet(net.IPNet{IP: net.IPv4(10, 20, 0, 0), Mask: net.CIDRMask(16, 32)}),
+	}
+	require.NoError(t, tfPluginClient.NetworkDeployer.Deploy(ctx, &network))
+	assert.Len(t, network.NodeDeploymentID, 2)
+
+	vm := workloads.VM{
+		Name:        "vm",
+		NetworkName: network.Name,
+		CPU:         1,
+		Memory:      1024,
+		RootfsSize:  1024,
+		PublicIP:    true,
+		Planetary:   true,
+		Flist:       grid.FlistURL("base"),
+		Entrypoint:  "/sbin/zinit init",
+	}
+	dl := workloads.NewDeployment("vm", 11, "", nil, network.Name, nil, nil, []workloads.VM{vm}, nil)
+	require.NoError(t, tfPluginClient.DeploymentDeployer.Deploy(ctx, &dl))
+
+	loadedVM, err := tfPluginClient.State.LoadVMFromGrid(ctx, 11, vm.Name, dl.Name)
+	require.NoError(t, err)
+	assert.Equal(t, "185.206.122.33/24", loadedVM.ComputedIP)
+	assert.NotEmpty(t, loadedVM.PlanetaryIP)
+	assert.NotEmpty(t, loadedVM.IP)
+
+	// the farm has a single public ip
+	farms, _, err := tfPluginClient.GridProxyClient.Farms(ctx, types.FarmFilter{}, types.Limit{})
+	require.NoError(t, err)
+	assert.Equal(t, int(dl.ContractID), farms[0].PublicIps[0].ContractID)
+
+	ipDl := workloads.NewDeployment("ip", 12, "", nil, network.Name, nil, nil, []workloads.VM{{
+		Name: "vm2", NetworkName: network.Name, CPU: 1, Memory: 1024, PublicIP: true, Flist: grid.FlistURL("base"),
+	}}, nil)
+	assert.ErrorContains(t, tfPluginClient.DeploymentDeployer.Deploy(ctx, &ipDl), "enough public ips")
+
+	cluster := workloads.K8sCluster{
+		Master:      &workloads.K8sNode{Name: "master", Node: 11, CPU: 1, Memory: 1024, DiskSize: 1, Flist: grid.FlistURL("k3s")},
+		Workers:     []workloads.K8sNode{{Name: "worker", Node: 12, CPU: 1, Memory: 1024, DiskSize: 1, Flist: grid.FlistURL("k3s")}},
+		Token:       "tokens",
+		NetworkName: network.Name,
+	}
+	require.NoError(t, tfPluginClient.K8sDeployer.Deploy(ctx, &cluster))
+
+	loadedCluster, err := tfPluginClient.State.LoadK8sFromGrid(ctx, []uint32{11, 12}, cluster.Master.Name)
+	require.NoError(t, err)
+	assert.Len(t, loadedCluster.Workers, 1)
+	assert.Equal(t, cluster.Master.IP, loadedCluster.Master.IP)
+
+	gwName := workloads.GatewayNameProxy{
+		NodeID:   11,
+		Name:     "example",
+		Backends: []zos.Backend{"http://185.206.122.33:8080"},
+	}
+	require.NoError(t, tfPluginClient.GatewayNameDeployer.Deploy(ctx, &gwName))
+
+	gwFQDN := workloads.GatewayFQDNProxy{
+		NodeID:   11,
+		Name:     "fqdn",
+		FQDN:     "example.com",
+		Backends: []zos.Backend{"http://185.206.122.33:8080"},
+	}
+	require.NoError(t, tfPluginClient.GatewayFQDNDeployer.Deploy(ctx, &gwFQDN))
+
+	loadedGW, err := tfPluginClient.State.LoadGatewayNameFromGrid(ctx, 11, gwName.Name, gwName.Name)
+	require.NoError(t, err)
+	assert.Equal(t, "example.gent01.fake.grid.tf", loadedGW.FQDN)
+
+	contracts, err := tfPluginClient.ContractsGetter.ListContractsOfProjectName(gwName.Name)
+	require.NoError(t, err)
+	assert.Len(t, contracts.NodeContracts, 1)
+	assert.Len(t, contracts.NameContracts, 1)
+
+	require.NoError(t, tfPluginClient.GatewayFQDNDeployer.Cancel(ctx, &gwFQDN))
+	require.NoError(t, tfPluginClient.GatewayNameDeployer.Cancel(ctx, &gwName))
+	require.NoError(t, tfPluginClient.K8sDeployer.Cancel(ctx, &cluster))
+	require.NoError(t, tfPluginClient.DeploymentDeployer.Cancel(ctx, &dl))
+	require.NoError(t, tfPluginClient.NetworkDeployer.Cancel(ctx, &network))
+
+	assert.Empty(t, grid.ActiveContracts())
+	assert.Empty(t, grid.NodeDeployments(11))
+	assert.Empty(t, grid.NodeDeployments(12))
+
+	farms, _, err = tfPluginClient.GridProxyClient.Farms(ctx, types.FarmFilter{}, types.Limit{})
+	require.NoError(t, err)
+	assert.Zero(t, farms[0].PublicIps[0].ContractID)
+}
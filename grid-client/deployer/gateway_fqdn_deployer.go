@@ -70,6 +70,15 @@ func (d *GatewayFQDNDeployer) GenerateVersionlessDeployments(ctx context.Context
 	return deployments, nil
 }
 
+// EstimateCost estimates the monthly cost of a gateway fqdn deployment before deploying it
+func (d *GatewayFQDNDeployer) EstimateCost(ctx context.Context, gw *workloads.GatewayFQDNProxy) (CostEstimate, error) {
+	newDeployments, err := d.GenerateVersionlessDeployments(ctx, gw)
+	if err != nil {
+		return CostEstimate{}, errors.Wrap(err, "could not generate deployments data")
+	}
+	return d.tfPluginClient.EstimateCost(ctx, singleDeployments(newDeployments))
+}
+
 // Deploy deploys the GatewayFQDN deployments using the deployer
 func (d *GatewayFQDNDeployer) Deploy(ctx context.Context, gw *workloads.GatewayFQDNProxy) error {
 	if err := d.Validate(ctx, gw); err != nil {
@@ -96,7 +105,7 @@ func (d *GatewayFQDNDeployer) Deploy(ctx context.Context, gw *workloads.GatewayF
 		}
 	}
 
-	return err
+	return d.tfPluginClient.saveState(err)
 }
 
 // BatchDeploy deploys multiple deployments using the deployer
@@ -132,11 +141,11 @@ func (d *GatewayFQDNDeployer) BatchDeploy(ctx context.Context, gws []*workloads.
 	// error is not returned immediately before updating state because of untracked failed deployments
 	for _, gw := range gws {
 		if err := d.updateStateFromDeployments(ctx, gw, newDls); err != nil {
-			return errors.Wrapf(err, "failed to update gateway fqdn '%s' state", gw.Name)
+			return d.tfPluginClient.saveState(errors.Wrapf(err, "failed to update gateway fqdn '%s' state", gw.Name))
 		}
 	}
 
-	return err
+	return d.tfPluginClient.saveState(err)
 }
 
 // Cancel cancels a gateway deployment
@@ -156,14 +165,14 @@ func (d *GatewayFQDNDeployer) Cancel(ctx context.Context, gw *workloads.GatewayF
 	delete(gw.NodeDeploymentID, gw.NodeID)
 	d.tfPluginClient.State.CurrentNodeDeployments[gw.NodeID] = workloads.Delete(d.tfPluginClient.State.CurrentNodeDeployments[gw.NodeID], contractID)
 
-	return nil
+	return d.tfPluginClient.State.Save()
 }
 
 func (d *GatewayFQDNDeployer) updateStateFromDeployments(ctx context.Context, gw *workloads.GatewayFQDNProxy, newDls map[uint32][]gridtypes.Deployment) error {
 	gw.NodeDeploymentID = map[uint32]uint64{}
 
 	for _, newDl := range newDls[gw.NodeID] {
-		dlData, err := workloads.ParseDeploymentData(newDl.Metadata)
+		dlData, err := workloads.ParseDeploymentData(newDl.Metadata, d.tfPluginClient.metadataKey)
 		if err != nil {
 			return errors.Wrapf(err, "could not get deployment %d data", newDl.ContractID)
 		}
@@ -53,6 +53,15 @@ func (d *GatewayNameDeployer) GenerateVersionlessDeployments(ctx context.Context
 	return deployments, nil
 }
 
+// EstimateCost estimates the monthly cost of a gateway name deployment before deploying it, the name contract cost is not included
+func (d *GatewayNameDeployer) EstimateCost(ctx context.Context, gw *workloads.GatewayNameProxy) (CostEstimate, error) {
+	newDeployments, err := d.GenerateVersionlessDeployments(ctx, gw)
+	if err != nil {
+		return CostEstimate{}, errors.Wrap(err, "could not generate deployments data")
+	}
+	return d.tfPluginClient.EstimateCost(ctx, singleDeployments(newDeployments))
+}
+
 // Deploy deploys the GatewayName deployments using the deployer
 func (d *GatewayNameDeployer) Deploy(ctx context.Context, gw *workloads.GatewayNameProxy) error {
 	if err := d.Validate(ctx, gw); err != nil {
@@ -69,14 +78,14 @@ func (d *GatewayNameDeployer) Deploy(ctx context.Context, gw *workloads.GatewayN
 	if err := d.InvalidateNameContract(ctx, gw); err != nil {
 		return err
 	}
-	if gw.NameContractID == 0 {
-		gw.NameContractID, err = d.tfPluginClient.SubstrateConn.CreateNameContract(d.tfPluginClient.Identity, gw.Name)
-		if err != nil {
-			return err
-		}
+	if err := d.createNameContract(gw); err != nil {
+		return err
 	}
 
 	gw.NodeDeploymentID, err = d.deployer.Deploy(ctx, gw.NodeDeploymentID, newDeployments, newDeploymentsSolutionProvider)
+	if err != nil && d.tfPluginClient.DryRunReport != nil {
+		return errors.Wrapf(err, "failed to deploy gateway name Id: %d", gw.NodeDeploymentID)
+	}
 	if err != nil {
 		cancelErr := d.tfPluginClient.SubstrateConn.CancelContract(d.tfPluginClient.Identity, gw.NameContractID)
 		if cancelErr != nil {
@@ -93,7 +102,7 @@ func (d *GatewayNameDeployer) Deploy(ctx context.Context, gw *workloads.GatewayN
 		}
 	}
 
-	return err
+	return d.tfPluginClient.saveState(err)
 }
 
 // BatchDeploy deploys multiple deployments using the deployer
@@ -114,11 +123,8 @@ func (d *GatewayNameDeployer) BatchDeploy(ctx context.Context, gws []*workloads.
 		if err := d.InvalidateNameContract(ctx, gw); err != nil {
 			return err
 		}
-		if gw.NameContractID == 0 {
-			gw.NameContractID, err = d.tfPluginClient.SubstrateConn.CreateNameContract(d.tfPluginClient.Identity, gw.Name)
-			if err != nil {
-				return err
-			}
+		if err := d.createNameContract(gw); err != nil {
+			return err
 		}
 
 		for nodeID, dl := range dls {
@@ -139,11 +145,11 @@ func (d *GatewayNameDeployer) BatchDeploy(ctx context.Context, gws []*workloads.
 	// error is not returned immediately before updating state because of untracked failed deployments
 	for _, gw := range gws {
 		if err := d.updateStateFromDeployments(ctx, gw, newDls); err != nil {
-			return errors.Wrapf(err, "failed to update gateway fqdn '%s' state", gw.Name)
+			return d.tfPluginClient.saveState(errors.Wrapf(err, "failed to update gateway fqdn '%s' state", gw.Name))
 		}
 	}
 
-	return err
+	return d.tfPluginClient.saveState(err)
 }
 
 // Cancel cancels the gatewayName deployment
@@ -157,9 +163,14 @@ func (d *GatewayNameDeployer) Cancel(ctx context.Context, gw *workloads.GatewayN
 	gw.ContractID = 0
 	delete(gw.NodeDeploymentID, gw.NodeID)
 	d.tfPluginClient.State.CurrentNodeDeployments[gw.NodeID] = workloads.Delete(d.tfPluginClient.State.CurrentNodeDeployments[gw.NodeID], contractID)
+	if err := d.tfPluginClient.State.Save(); err != nil {
+		return err
+	}
 
 	if gw.NameContractID != 0 {
-		if err := d.tfPluginClient.SubstrateConn.EnsureContractCanceled(d.tfPluginClient.Identity, gw.NameContractID); err != nil {
+		if d.tfPluginClient.DryRunReport != nil {
+			d.tfPluginClient.DryRunReport.addContract(DryRunContract{Action: PlanCancel, Type: NameContractType, ContractID: gw.NameContractID, Name: gw.Name})
+		} else if err := d.tfPluginClient.SubstrateConn.EnsureContractCanceled(d.tfPluginClient.Identity, gw.NameContractID); err != nil {
 			return err
 		}
 		gw.NameContractID = 0
@@ -168,11 +179,26 @@ func (d *GatewayNameDeployer) Cancel(ctx context.Context, gw *workloads.GatewayN
 	return nil
 }
 
+// createNameContract creates the gateway name contract if it doesn't exist, it is only reported in dry run mode
+func (d *GatewayNameDeployer) createNameContract(gw *workloads.GatewayNameProxy) (err error) {
+	if gw.NameContractID != 0 {
+		return nil
+	}
+
+	if d.tfPluginClient.DryRunReport != nil {
+		d.tfPluginClient.DryRunReport.addContract(DryRunContract{Action: PlanCreate, Type: NameContractType, Name: gw.Name})
+		return nil
+	}
+
+	gw.NameContractID, err = d.tfPluginClient.SubstrateConn.CreateNameContract(d.tfPluginClient.Identity, gw.Name)
+	return err
+}
+
 func (d *GatewayNameDeployer) updateStateFromDeployments(ctx context.Context, gw *workloads.GatewayNameProxy, newDls map[uint32][]gridtypes.Deployment) error {
 	gw.NodeDeploymentID = map[uint32]uint64{}
 
 	for _, newDl := range newDls[gw.NodeID] {
-		dlData, err := workloads.ParseDeploymentData(newDl.Metadata)
+		dlData, err := workloads.ParseDeploymentData(newDl.Metadata, d.tfPluginClient.metadataKey)
 		if err != nil {
 			return errors.Wrapf(err, "could not get deployment %d data", newDl.ContractID)
 		}
@@ -0,0 +1,110 @@
+package deployer
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+)
+
+// ImportedProject is the set of objects of a project reconstructed from the twin contracts
+type ImportedProject struct {
+	Name         string
+	Deployments  []*workloads.Deployment
+	Networks     []*workloads.ZNet
+	K8sClusters  []*workloads.K8sCluster
+	GatewayNames []*workloads.GatewayNameProxy
+	GatewayFQDNs []*workloads.GatewayFQDNProxy
+}
+
+// ImportTwinDeployments loads all the deployments of the twin active contracts from the grid into the state
+// and returns them grouped by project name.
+// objects that fail to load are skipped and their errors are returned along with the imported projects.
+func (t *TFPluginClient) ImportTwinDeployments(ctx context.Context) (map[string]*ImportedProject, error) {
+	contracts, err := t.ContractsGetter.ListContractsByTwinID([]string{"Created", "GracePeriod"})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not list twin contracts")
+	}
+
+	deployed := t.groupContracts(contracts.NodeContracts)
+	keys := make([]objectKey, 0, len(deployed))
+	for key, nodeContracts := range deployed {
+		for nodeID, contractID := range nodeContracts {
+			t.State.StoreContractIDs(nodeID, contractID)
+		}
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b objectKey) int {
+		return strings.Compare(a.projectName+a.deploymentType+a.name, b.projectName+b.deploymentType+b.name)
+	})
+
+	projects := make(map[string]*ImportedProject)
+	var errs error
+	for _, key := range keys {
+		project, ok := projects[key.projectName]
+		if !ok {
+			project = &ImportedProject{Name: key.projectName}
+			projects[key.projectName] = project
+		}
+
+		nodeIDs := make([]uint32, 0, len(deployed[key]))
+		for nodeID := range deployed[key] {
+			nodeIDs = append(nodeIDs, nodeID)
+		}
+		slices.Sort(nodeIDs)
+
+		if err := t.importObject(ctx, project, key, nodeIDs); err != nil {
+			errs = multierror.Append(errs, errors.Wrapf(err, "could not import %s %s of project %s", key.deploymentType, key.name, key.projectName))
+		}
+	}
+
+	return projects, errs
+}
+
+// importObject loads the object deployed on the nodes with the key name and type and adds it to the project
+func (t *TFPluginClient) importObject(ctx context.Context, project *ImportedProject, key objectKey, nodeIDs []uint32) error {
+	switch key.deploymentType {
+	case workloads.NetworkType:
+		znet, err := t.State.LoadNetworkFromGrid(ctx, key.name)
+		if err != nil {
+			return err
+		}
+		project.Networks = append(project.Networks, &znet)
+	case workloads.K8sType:
+		cluster, err := t.State.LoadK8sFromGrid(ctx, nodeIDs, key.name)
+		if err != nil {
+			return err
+		}
+		project.K8sClusters = append(project.K8sClusters, &cluster)
+	case workloads.VMType:
+		for _, nodeID := range nodeIDs {
+			dl, err := t.State.LoadDeploymentFromGrid(ctx, nodeID, key.name)
+			if err != nil {
+				return err
+			}
+			project.Deployments = append(project.Deployments, &dl)
+		}
+	case workloads.GatewayNameType:
+		for _, nodeID := range nodeIDs {
+			gw, err := t.State.LoadGatewayNameFromGrid(ctx, nodeID, key.name, key.name)
+			if err != nil {
+				return err
+			}
+			project.GatewayNames = append(project.GatewayNames, &gw)
+		}
+	case workloads.GatewayFQDNType:
+		for _, nodeID := range nodeIDs {
+			gw, err := t.State.LoadGatewayFQDNFromGrid(ctx, nodeID, key.name, key.name)
+			if err != nil {
+				return err
+			}
+			project.GatewayFQDNs = append(project.GatewayFQDNs, &gw)
+		}
+	default:
+		return errors.Errorf("unsupported deployment type %q", key.deploymentType)
+	}
+	return nil
+}
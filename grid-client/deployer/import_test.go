@@ -0,0 +1,77 @@
+package deployer
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
+)
+
+func TestImportTwinDeployments(t *testing.T) {
+	tfPluginClient, grid := newFakeGridClient(t)
+	ctx := context.Background()
+
+	network := workloads.ZNet{
+		Name:         "net",
+		Nodes:        []uint32{11, 12},
+		IPRange:      gridtypes.NewIPNet(net.IPNet{IP: net.IPv4(10, 20, 0, 0), Mask: net.CIDRMask(16, 32)}),
+		SolutionType: "app",
+	}
+	require.NoError(t, tfPluginClient.NetworkDeployer.Deploy(ctx, &network))
+
+	dl := workloads.NewDeployment("vm", 12, "app", nil, network.Name, nil, nil, []workloads.VM{{
+		Name: "vm", NetworkName: network.Name, CPU: 1, Memory: 1024, Flist: grid.FlistURL("base"),
+	}}, nil)
+	require.NoError(t, tfPluginClient.DeploymentDeployer.Deploy(ctx, &dl))
+
+	gw := workloads.GatewayNameProxy{
+		NodeID:       11,
+		Name:         "example",
+		Backends:     []zos.Backend{"http://10.20.2.2:8080"},
+		SolutionType: "app",
+	}
+	require.NoError(t, tfPluginClient.GatewayNameDeployer.Deploy(ctx, &gw))
+
+	cluster := workloads.K8sCluster{
+		Master:      &workloads.K8sNode{Name: "master", Node: 11, CPU: 1, Memory: 1024, DiskSize: 1, Flist: grid.FlistURL("k3s")},
+		Token:       "tokens",
+		NetworkName: network.Name,
+	}
+	require.NoError(t, tfPluginClient.K8sDeployer.Deploy(ctx, &cluster))
+
+	// a new client of the same twin takes over the deployments
+	importer, err := NewTFPluginClient(tfPluginClient.mnemonicOrSeed, WithBackend(grid))
+	require.NoError(t, err)
+	t.Cleanup(importer.Close)
+
+	projects, err := importer.ImportTwinDeployments(ctx)
+	require.NoError(t, err)
+	require.Len(t, projects, 2)
+
+	app := projects["app"]
+	require.NotNil(t, app)
+	require.Len(t, app.Networks, 1)
+	assert.Equal(t, network.NodeDeploymentID, app.Networks[0].NodeDeploymentID)
+	require.Len(t, app.Deployments, 1)
+	assert.Equal(t, dl.ContractID, app.Deployments[0].ContractID)
+	assert.Equal(t, dl.Vms[0].IP, app.Deployments[0].Vms[0].IP)
+	require.Len(t, app.GatewayNames, 1)
+	assert.Equal(t, gw.NameContractID, app.GatewayNames[0].NameContractID)
+
+	k8s := projects[cluster.SolutionType]
+	require.NotNil(t, k8s)
+	require.Len(t, k8s.K8sClusters, 1)
+	assert.Equal(t, cluster.Master.IP, k8s.K8sClusters[0].Master.IP)
+
+	// the imported objects can be managed by the new client
+	require.NoError(t, importer.GatewayNameDeployer.Cancel(ctx, app.GatewayNames[0]))
+	require.NoError(t, importer.K8sDeployer.Cancel(ctx, k8s.K8sClusters[0]))
+	require.NoError(t, importer.DeploymentDeployer.Cancel(ctx, app.Deployments[0]))
+	require.NoError(t, importer.NetworkDeployer.Cancel(ctx, app.Networks[0]))
+	assert.Empty(t, grid.ActiveContracts())
+}
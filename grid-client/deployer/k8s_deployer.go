@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"maps"
 	"net"
+	"slices"
 
 	"github.com/pkg/errors"
 	zerolog "github.com/rs/zerolog/log"
@@ -62,6 +64,9 @@ func (d *K8sDeployer) Validate(ctx context.Context, k8sCluster *workloads.K8sClu
 	if err := k8sCluster.ValidateMyceliumSeed(); err != nil {
 		return err
 	}
+	for _, warning := range d.flistWarnings(ctx, k8sCluster) {
+		zerolog.Warn().Str("cluster", k8sCluster.Master.Name).Msg(warning)
+	}
 
 	// validate cluster nodes
 	var nodes []uint32
@@ -74,6 +79,17 @@ func (d *K8sDeployer) Validate(ctx context.Context, k8sCluster *workloads.K8sClu
 	return client.AreNodesUp(ctx, sub, nodes, d.tfPluginClient.NcPool)
 }
 
+// flistWarnings inspects the flists of the cluster nodes if the client inspects flists
+// and returns the problems of the nodes with their flists
+func (d *K8sDeployer) flistWarnings(ctx context.Context, k8sCluster *workloads.K8sCluster) []string {
+	warnings := d.tfPluginClient.flistWarnings(ctx, k8sCluster.Master.Name, k8sCluster.Master.Flist, k8sCluster.Master)
+	for i := range k8sCluster.Workers {
+		worker := &k8sCluster.Workers[i]
+		warnings = append(warnings, d.tfPluginClient.flistWarnings(ctx, worker.Name, worker.Flist, worker)...)
+	}
+	return warnings
+}
+
 // GenerateVersionlessDeployments generates a new deployment without a version
 func (d *K8sDeployer) GenerateVersionlessDeployments(ctx context.Context, k8sCluster *workloads.K8sCluster) (map[uint32]gridtypes.Deployment, error) {
 	err := d.assignNodesIPs(k8sCluster)
@@ -102,6 +118,19 @@ func (d *K8sDeployer) GenerateVersionlessDeployments(ctx context.Context, k8sClu
 	return deployments, nil
 }
 
+// EstimateCost estimates the monthly cost of a k8s cluster before deploying it
+func (d *K8sDeployer) EstimateCost(ctx context.Context, k8sCluster *workloads.K8sCluster) (CostEstimate, error) {
+	if err := d.tfPluginClient.State.AssignNodesIPRange(k8sCluster); err != nil {
+		return CostEstimate{}, err
+	}
+
+	newDeployments, err := d.GenerateVersionlessDeployments(ctx, k8sCluster)
+	if err != nil {
+		return CostEstimate{}, errors.Wrap(err, "could not generate k8s grid deployments")
+	}
+	return d.tfPluginClient.EstimateCost(ctx, singleDeployments(newDeployments))
+}
+
 // Deploy deploys a k8s cluster deployment
 func (d *K8sDeployer) Deploy(ctx context.Context, k8sCluster *workloads.K8sCluster) error {
 	if err := d.tfPluginClient.State.AssignNodesIPRange(k8sCluster); err != nil {
@@ -136,7 +165,7 @@ func (d *K8sDeployer) Deploy(ctx context.Context, k8sCluster *workloads.K8sClust
 		}
 	}
 
-	return err
+	return d.tfPluginClient.saveState(err)
 }
 
 // BatchDeploy deploys multiple clusters using the deployer
@@ -181,11 +210,96 @@ func (d *K8sDeployer) BatchDeploy(ctx context.Context, k8sClusters []*workloads.
 	// error is not returned immediately before updating state because of untracked failed deployments
 	for _, k8sCluster := range k8sClusters {
 		if err := d.updateStateFromDeployments(ctx, k8sCluster, newDls); err != nil {
-			return errors.Wrapf(err, "failed to update cluster with master name '%s' state", k8sCluster.Master.Name)
+			return d.tfPluginClient.saveState(errors.Wrapf(err, "failed to update cluster with master name '%s' state", k8sCluster.Master.Name))
+		}
+	}
+
+	return d.tfPluginClient.saveState(err)
+}
+
+// AddWorkers adds workers to a deployed cluster, the cluster network is extended to the new nodes and only the changed deployments are deployed
+func (d *K8sDeployer) AddWorkers(ctx context.Context, k8sCluster *workloads.K8sCluster, workers []workloads.K8sNode) error {
+	if len(workers) == 0 {
+		return nil
+	}
+
+	clusterNodes := k8sClusterNodes(k8sCluster)
+	var newNodes []uint32
+	for _, worker := range workers {
+		if !workloads.Contains(clusterNodes, worker.Node) && !workloads.Contains(newNodes, worker.Node) {
+			newNodes = append(newNodes, worker.Node)
 		}
 	}
 
-	return err
+	if err := d.extendNetwork(ctx, k8sCluster.NetworkName, newNodes); err != nil {
+		return err
+	}
+
+	oldWorkers := k8sCluster.Workers
+	k8sCluster.Workers = append(slices.Clone(oldWorkers), workers...)
+	if err := d.Deploy(ctx, k8sCluster); err != nil {
+		k8sCluster.Workers = oldWorkers
+		return errors.Wrapf(err, "failed to add workers to cluster %s", k8sCluster.Master.Name)
+	}
+	return nil
+}
+
+// RemoveWorkers removes workers from a deployed cluster by name, the contracts of the nodes left without workers are canceled
+func (d *K8sDeployer) RemoveWorkers(ctx context.Context, k8sCluster *workloads.K8sCluster, names []string) error {
+	workers := make([]workloads.K8sNode, 0, len(k8sCluster.Workers))
+	for _, worker := range k8sCluster.Workers {
+		if !slices.Contains(names, worker.Name) {
+			workers = append(workers, worker)
+		}
+	}
+	for _, name := range names {
+		if !slices.ContainsFunc(k8sCluster.Workers, func(worker workloads.K8sNode) bool { return worker.Name == name }) {
+			return errors.Errorf("worker %s is not in cluster %s", name, k8sCluster.Master.Name)
+		}
+	}
+
+	oldWorkers := k8sCluster.Workers
+	oldDeployments := maps.Clone(k8sCluster.NodeDeploymentID)
+
+	k8sCluster.Workers = workers
+	err := d.Deploy(ctx, k8sCluster)
+
+	for nodeID, contractID := range oldDeployments {
+		if k8sCluster.NodeDeploymentID[nodeID] != contractID {
+			d.tfPluginClient.State.RemoveContractIDs(nodeID, contractID)
+		}
+	}
+
+	if err != nil {
+		k8sCluster.Workers = oldWorkers
+		return d.tfPluginClient.saveState(errors.Wrapf(err, "failed to remove workers from cluster %s", k8sCluster.Master.Name))
+	}
+	return d.tfPluginClient.saveState(nil)
+}
+
+// extendNetwork deploys the network on the nodes that it is not deployed on
+func (d *K8sDeployer) extendNetwork(ctx context.Context, networkName string, nodes []uint32) error {
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	znet, err := d.tfPluginClient.State.LoadNetworkFromGrid(ctx, networkName)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load network %s", networkName)
+	}
+
+	return d.tfPluginClient.NetworkDeployer.AddNodes(ctx, &znet, nodes)
+}
+
+// k8sClusterNodes returns the nodes of the cluster master and workers
+func k8sClusterNodes(k8sCluster *workloads.K8sCluster) []uint32 {
+	nodes := []uint32{k8sCluster.Master.Node}
+	for _, worker := range k8sCluster.Workers {
+		if !workloads.Contains(nodes, worker.Node) {
+			nodes = append(nodes, worker.Node)
+		}
+	}
+	return nodes
 }
 
 // Cancel cancels a k8s cluster deployment
@@ -194,7 +308,7 @@ func (d *K8sDeployer) Cancel(ctx context.Context, k8sCluster *workloads.K8sClust
 		if k8sCluster.Master.Node == nodeID {
 			err = d.deployer.Cancel(ctx, contractID)
 			if err != nil {
-				return errors.Wrapf(err, "could not cancel master %s, contract %d", k8sCluster.Master.Name, contractID)
+				return d.tfPluginClient.saveState(errors.Wrapf(err, "could not cancel master %s, contract %d", k8sCluster.Master.Name, contractID))
 			}
 			d.tfPluginClient.State.CurrentNodeDeployments[nodeID] = workloads.Delete(d.tfPluginClient.State.CurrentNodeDeployments[nodeID], contractID)
 			delete(k8sCluster.NodeDeploymentID, nodeID)
@@ -204,7 +318,7 @@ func (d *K8sDeployer) Cancel(ctx context.Context, k8sCluster *workloads.K8sClust
 			if worker.Node == nodeID {
 				err = d.deployer.Cancel(ctx, contractID)
 				if err != nil {
-					return errors.Wrapf(err, "could not cancel worker %s, contract %d", worker.Name, contractID)
+					return d.tfPluginClient.saveState(errors.Wrapf(err, "could not cancel worker %s, contract %d", worker.Name, contractID))
 				}
 				d.tfPluginClient.State.CurrentNodeDeployments[nodeID] = workloads.Delete(d.tfPluginClient.State.CurrentNodeDeployments[nodeID], contractID)
 				delete(k8sCluster.NodeDeploymentID, nodeID)
@@ -213,7 +327,7 @@ func (d *K8sDeployer) Cancel(ctx context.Context, k8sCluster *workloads.K8sClust
 		}
 	}
 
-	return nil
+	return d.tfPluginClient.State.Save()
 }
 
 func (d *K8sDeployer) updateStateFromDeployments(ctx context.Context, k8sCluster *workloads.K8sCluster, newDl map[uint32][]gridtypes.Deployment) error {
@@ -226,7 +340,7 @@ func (d *K8sDeployer) updateStateFromDeployments(ctx context.Context, k8sCluster
 
 	for _, k8sNode := range k8sNodes {
 		for _, newDl := range newDl[k8sNode] {
-			dlData, err := workloads.ParseDeploymentData(newDl.Metadata)
+			dlData, err := workloads.ParseDeploymentData(newDl.Metadata, d.tfPluginClient.metadataKey)
 			if err != nil {
 				return errors.Wrapf(err, "could not get deployment %d data", newDl.ContractID)
 			}
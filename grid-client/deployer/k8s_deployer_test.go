@@ -2,16 +2,21 @@ package deployer
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"math/big"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
 	"github.com/golang/mock/gomock"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/flist"
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/mocks"
 	client "github.com/threefoldtech/tfgrid-sdk-go/grid-client/node"
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/state"
@@ -495,3 +500,82 @@ func ExampleK8sDeployer_Cancel() {
 	}
 	fmt.Println("deployment is canceled successfully")
 }
+
+func TestFakeGridK8sScaling(t *testing.T) {
+	tfPluginClient, grid := newFakeGridClient(t)
+	ctx := context.Background()
+
+	network := workloads.ZNet{
+		Name:    "k8snet",
+		Nodes:   []uint32{11},
+		IPRange: gridtypes.NewIPNet(net.IPNet{IP: net.IPv4(10, 20, 0, 0), Mask: net.CIDRMask(16, 32)}),
+	}
+	require.NoError(t, tfPluginClient.NetworkDeployer.Deploy(ctx, &network))
+
+	cluster := workloads.K8sCluster{
+		Master:      &workloads.K8sNode{Name: "master", Node: 11, CPU: 1, Memory: 1024, DiskSize: 1, Flist: grid.FlistURL("k3s")},
+		Token:       "tokens",
+		NetworkName: network.Name,
+	}
+	require.NoError(t, tfPluginClient.K8sDeployer.Deploy(ctx, &cluster))
+	masterContract := cluster.NodeDeploymentID[11]
+
+	workers := []workloads.K8sNode{
+		{Name: "worker1", Node: 11, CPU: 1, Memory: 1024, DiskSize: 1, Flist: grid.FlistURL("k3s")},
+		{Name: "worker2", Node: 12, CPU: 1, Memory: 1024, DiskSize: 1, Flist: grid.FlistURL("k3s")},
+	}
+	require.NoError(t, tfPluginClient.K8sDeployer.AddWorkers(ctx, &cluster, workers))
+	assert.Len(t, cluster.Workers, 2)
+	assert.Equal(t, masterContract, cluster.NodeDeploymentID[11])
+	require.Contains(t, cluster.NodeDeploymentID, uint32(12))
+	workerContract := cluster.NodeDeploymentID[12]
+
+	// the network is extended to the worker node
+	znet, err := tfPluginClient.State.LoadNetworkFromGrid(ctx, network.Name)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []uint32{11, 12}, znet.Nodes)
+	assert.Len(t, grid.NodeDeployments(12), 2)
+
+	loaded, err := tfPluginClient.State.LoadK8sFromGrid(ctx, []uint32{11, 12}, cluster.Master.Name)
+	require.NoError(t, err)
+	assert.Len(t, loaded.Workers, 2)
+
+	assert.Error(t, tfPluginClient.K8sDeployer.RemoveWorkers(ctx, &cluster, []string{"missing"}))
+
+	require.NoError(t, tfPluginClient.K8sDeployer.RemoveWorkers(ctx, &cluster, []string{"worker2"}))
+	assert.Len(t, cluster.Workers, 1)
+	assert.NotContains(t, cluster.NodeDeploymentID, uint32(12))
+	assert.NotContains(t, tfPluginClient.State.CurrentNodeDeployments[12], workerContract)
+	assert.NotContains(t, grid.ActiveContracts(), workerContract)
+
+	// only the network is left on the removed worker node
+	assert.Len(t, grid.NodeDeployments(12), 1)
+}
+
+func TestK8sDeployerFlistWarnings(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/flist/user/k3s.flist", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(flist.Contents{Content: []flist.File{{Path: "/sbin/zinit", Type: flist.RegularFile}}})
+	})
+	mux.HandleFunc("/api/flist/user/ubuntu.flist", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(flist.Contents{Content: []flist.File{{Path: "/image.raw", Size: 1 << 30, Type: flist.RegularFile}}})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	cluster := workloads.K8sCluster{
+		Master: &workloads.K8sNode{Name: "master", Flist: server.URL + "/user/k3s.flist"},
+		Workers: []workloads.K8sNode{
+			{Name: "worker", Flist: server.URL + "/user/k3s.flist"},
+			{Name: "image", Flist: server.URL + "/user/ubuntu.flist"},
+		},
+	}
+
+	d := K8sDeployer{tfPluginClient: &TFPluginClient{}}
+	assert.Empty(t, d.flistWarnings(context.Background(), &cluster))
+
+	d.tfPluginClient.flistInspector = flist.NewInspector()
+	warnings := d.flistWarnings(context.Background(), &cluster)
+	assert.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0], "vm image: the flist is a full vm image")
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"math/rand"
 	"net"
 	"slices"
@@ -68,6 +69,10 @@ func (d *NetworkDeployer) GenerateVersionlessDeployments(ctx context.Context, zn
 	var multiErr error
 
 	for _, znet := range znets {
+		// mycelium only networks don't need the nodes endpoints or wireguard ports
+		if znet.MyceliumOnly {
+			continue
+		}
 		for _, node := range znet.Nodes {
 			allNodes[node] = struct{}{}
 		}
@@ -173,11 +178,14 @@ func (d *NetworkDeployer) getNodeEndpointAndPorts(ctx context.Context, nodeID ui
 func needPublicNode(znets []*workloads.ZNet) bool {
 	// entering here means all nodes for all networks are either hidden or ipv6 only
 	// we need an extra public node in two cases:
-	// - the user asked for WireGuard access
+	// - the user asked for WireGuard access or named user accesses
 	// - there are multiple nodes in the network and none of them have ipv4.
 	//   because networks must communicate through ipv4
 	for _, znet := range znets {
-		if znet.AddWGAccess {
+		if znet.MyceliumOnly {
+			continue
+		}
+		if znet.AddWGAccess || len(znet.UserAccesses) != 0 {
 			return true
 		}
 		if len(znet.Nodes) > 1 {
@@ -188,6 +196,9 @@ func needPublicNode(znets []*workloads.ZNet) bool {
 }
 
 func (d *NetworkDeployer) generateDeployments(znet *workloads.ZNet, endpointIPs map[uint32]net.IP, usedPorts map[uint32][]uint16, publicNode uint32) (map[uint32]gridtypes.Deployment, error) {
+	if znet.MyceliumOnly {
+		return d.generateMyceliumDeployments(znet)
+	}
 	deployments := make(map[uint32]gridtypes.Deployment)
 
 	log.Debug().Msgf("nodes: %v", znet.Nodes)
@@ -215,12 +226,13 @@ func (d *NetworkDeployer) generateDeployments(znet *workloads.ZNet, endpointIPs
 		}
 	}
 
-	needsIPv4Access := znet.AddWGAccess || (len(hiddenNodes) != 0 && len(hiddenNodes)+len(accessibleNodes) > 1)
+	needsIPv4Access := znet.AddWGAccess || len(znet.UserAccesses) != 0 || (len(hiddenNodes) != 0 && len(hiddenNodes)+len(accessibleNodes) > 1)
 	if needsIPv4Access {
 		if znet.PublicNodeID != 0 { // it's set
 			// if public node id is already set, it should be added to accessible nodes
 			if !workloads.Contains(accessibleNodes, znet.PublicNodeID) {
 				accessibleNodes = append(accessibleNodes, znet.PublicNodeID)
+				endpoints[znet.PublicNodeID] = endpointIPs[znet.PublicNodeID].String()
 			}
 		} else if ipv4Node != 0 { // there's one in the network original nodes
 			znet.PublicNodeID = ipv4Node
@@ -245,9 +257,18 @@ func (d *NetworkDeployer) generateDeployments(znet *workloads.ZNet, endpointIPs
 	if znet.WGPort == nil {
 		znet.WGPort = make(map[uint32]int)
 	}
+	if znet.Endpoints == nil {
+		znet.Endpoints = make(map[uint32]net.IP)
+	}
+	for _, nodeID := range allNodes {
+		znet.Endpoints[nodeID] = endpointIPs[nodeID]
+	}
 
-	// assign WireGuard ports
+	// assign WireGuard ports, nodes the network is already deployed on keep their ports
 	for _, nodeID := range allNodes {
+		if znet.WGPort[nodeID] != 0 && znet.NodeDeploymentID[nodeID] != 0 {
+			continue
+		}
 		nodeUsedPorts := usedPorts[nodeID]
 		p := uint16(rand.Intn(32768-1024) + 1024)
 		for slices.Contains(nodeUsedPorts, p) {
@@ -269,6 +290,24 @@ func (d *NetworkDeployer) generateDeployments(znet *workloads.ZNet, endpointIPs
 		nonAccessibleIPRanges = append(nonAccessibleIPRanges, *r)
 		nonAccessibleIPRanges = append(nonAccessibleIPRanges, workloads.WgIP(*r))
 	}
+	userAccessPeers := make([]zos.Peer, 0, len(znet.UserAccesses))
+	for i, access := range znet.UserAccesses {
+		r, err := gridtypes.ParseIPNet(access.Subnet)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse user access %s subnet", access.Name)
+		}
+		key, err := wgtypes.ParseKey(access.PrivateKey)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse user access %s private key", access.Name)
+		}
+		znet.UserAccesses[i].NodeID = znet.PublicNodeID
+		nonAccessibleIPRanges = append(nonAccessibleIPRanges, r, workloads.WgIP(r))
+		userAccessPeers = append(userAccessPeers, zos.Peer{
+			Subnet:      r,
+			WGPublicKey: key.PublicKey().String(),
+			AllowedIPs:  []gridtypes.IPNet{r, workloads.WgIP(r)},
+		})
+	}
 
 	log.Debug().Msgf("hidden nodes: %v", hiddenNodes)
 	log.Debug().Uint32("public node", znet.PublicNodeID)
@@ -294,6 +333,15 @@ func (d *NetworkDeployer) generateDeployments(znet *workloads.ZNet, endpointIPs
 		)
 	}
 
+	znet.UserAccessWGConfigs = make(map[string]string)
+	for _, access := range znet.UserAccesses {
+		config, err := znet.UserAccessWGConfig(access, fmt.Sprintf("%s:%d", endpoints[znet.PublicNodeID], znet.WGPort[znet.PublicNodeID]))
+		if err != nil {
+			return nil, err
+		}
+		znet.UserAccessWGConfigs[access.Name] = config
+	}
+
 	externalIP := ""
 	if znet.ExternalIP != nil {
 		externalIP = znet.ExternalIP.String()
@@ -308,6 +356,7 @@ func (d *NetworkDeployer) generateDeployments(znet *workloads.ZNet, endpointIPs
 			},
 		},
 	}
+	metadata.UserAccesses = append(metadata.UserAccesses, znet.UserAccesses...)
 
 	metadataBytes, err := json.Marshal(metadata)
 	if err != nil {
@@ -349,6 +398,7 @@ func (d *NetworkDeployer) generateDeployments(znet *workloads.ZNet, endpointIPs
 					AllowedIPs:  []gridtypes.IPNet{*znet.ExternalIP, workloads.WgIP(*znet.ExternalIP)},
 				})
 			}
+			peers = append(peers, userAccessPeers...)
 
 			// hidden nodes
 			for _, peerNodeID := range hiddenNodes {
@@ -405,6 +455,66 @@ func (d *NetworkDeployer) generateDeployments(znet *workloads.ZNet, endpointIPs
 	return deployments, nil
 }
 
+// generateMyceliumDeployments generates the deployments of a mycelium only network.
+// nodes get subnets and mycelium keys, but no wireguard ports or peers so hidden nodes don't need a public node.
+func (d *NetworkDeployer) generateMyceliumDeployments(znet *workloads.ZNet) (map[uint32]gridtypes.Deployment, error) {
+	deployments := make(map[uint32]gridtypes.Deployment)
+
+	if err := znet.AssignNodesIPs(znet.Nodes); err != nil {
+		return nil, errors.Wrap(err, "could not assign node ips")
+	}
+	// zos requires a wireguard key even if it is never used
+	if err := znet.AssignNodesWGKey(znet.Nodes); err != nil {
+		return nil, errors.Wrap(err, "could not assign node wg keys")
+	}
+	if znet.MyceliumKeys == nil {
+		znet.MyceliumKeys = make(map[uint32][]byte)
+	}
+	for _, nodeID := range znet.Nodes {
+		if len(znet.MyceliumKeys[nodeID]) != 0 {
+			continue
+		}
+		key, err := workloads.RandomMyceliumKey()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to generate mycelium key for node %d", nodeID)
+		}
+		znet.MyceliumKeys[nodeID] = key
+	}
+	znet.PublicNodeID = 0
+	znet.AccessWGConfig = ""
+	znet.WGPort = make(map[uint32]int)
+
+	metadataBytes, err := json.Marshal(workloads.NetworkMetaData{
+		Version:      workloads.Version,
+		MyceliumOnly: true,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to marshal network metadata")
+	}
+
+	for _, nodeID := range znet.Nodes {
+		workload := znet.ZosWorkload(znet.NodesIPRange[nodeID], znet.Keys[nodeID].String(), 0, []zos.Peer{}, string(metadataBytes), znet.MyceliumKeys[nodeID])
+		deployment := workloads.NewGridDeployment(d.tfPluginClient.TwinID, []gridtypes.Workload{workload})
+
+		deployment.Metadata, err = znet.GenerateMetadata()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to generate deployment %s metadata", znet.Name)
+		}
+		deployments[nodeID] = deployment
+	}
+	return deployments, nil
+}
+
+// EstimateCost estimates the monthly cost of a network before deploying it.
+// network workloads don't reserve capacity, so only the extra fees of dedicated nodes are paid.
+func (d *NetworkDeployer) EstimateCost(ctx context.Context, znet *workloads.ZNet) (CostEstimate, error) {
+	nodeDeployments, err := d.GenerateVersionlessDeployments(ctx, []*workloads.ZNet{znet})
+	if err != nil {
+		return CostEstimate{}, errors.Wrap(err, "could not generate deployments data")
+	}
+	return d.tfPluginClient.EstimateCost(ctx, nodeDeployments)
+}
+
 // Deploy deploys the network deployments using the deployer
 func (d *NetworkDeployer) Deploy(ctx context.Context, znet *workloads.ZNet) error {
 	znets, err := d.Validate(ctx, []*workloads.ZNet{znet})
@@ -457,7 +567,17 @@ func (d *NetworkDeployer) Deploy(ctx context.Context, znet *workloads.ZNet) erro
 	}
 
 	if err != nil {
-		return errors.Wrapf(err, "could not deploy network %s", znet.Name)
+		return d.tfPluginClient.saveState(errors.Wrapf(err, "could not deploy network %s", znet.Name))
+	}
+
+	if err := d.tfPluginClient.State.Save(); err != nil {
+		return err
+	}
+
+	// keep the assigned subnets in a dry run so deployments on the network can be generated
+	if d.tfPluginClient.DryRunReport != nil {
+		d.tfPluginClient.State.Networks.UpdateNetworkSubnets(znet.Name, znet.NodesIPRange)
+		return nil
 	}
 
 	if err := d.ReadNodesConfig(ctx, znet); err != nil {
@@ -467,6 +587,279 @@ func (d *NetworkDeployer) Deploy(ctx context.Context, znet *workloads.ZNet) erro
 	return nil
 }
 
+// AddNodes extends a deployed network to new nodes.
+// only the new nodes are queried for their endpoints and wireguard ports, the existing nodes keep their stored
+// subnets, ports and keys and only get their peers updated.
+func (d *NetworkDeployer) AddNodes(ctx context.Context, znet *workloads.ZNet, nodes []uint32) error {
+	var added []uint32
+	for _, node := range nodes {
+		if !workloads.Contains(znet.Nodes, node) && !workloads.Contains(added, node) {
+			added = append(added, node)
+		}
+	}
+	if len(added) == 0 {
+		return nil
+	}
+
+	previous := cloneNetwork(znet)
+	znet.Nodes = append(znet.Nodes, added...)
+
+	// mycelium is enabled on the new nodes if the network uses it
+	if len(znet.MyceliumKeys) != 0 {
+		for _, node := range added {
+			key, err := workloads.RandomMyceliumKey()
+			if err != nil {
+				*znet = previous
+				return errors.Wrapf(err, "failed to generate mycelium key for node %d", node)
+			}
+			znet.MyceliumKeys[node] = key
+		}
+	}
+
+	// a network that isn't deployed yet is deployed as a whole
+	var err error
+	if len(znet.NodeDeploymentID) == 0 {
+		err = d.Deploy(ctx, znet)
+	} else {
+		err = d.updateMembers(ctx, znet, previous)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to add nodes %v to network %s", added, znet.Name)
+	}
+	return nil
+}
+
+// RemoveNodes removes nodes from a deployed network and cancels their network deployments.
+// a node is not removed if it still hosts vms in the network, the remaining nodes only get their peers updated.
+func (d *NetworkDeployer) RemoveNodes(ctx context.Context, znet *workloads.ZNet, nodes []uint32) error {
+	var remaining []uint32
+	for _, node := range znet.Nodes {
+		if !slices.Contains(nodes, node) {
+			remaining = append(remaining, node)
+		}
+	}
+	if len(remaining) == len(znet.Nodes) {
+		return nil
+	}
+	if len(remaining) == 0 {
+		return errors.Errorf("could not remove all nodes of network %s, cancel the network instead", znet.Name)
+	}
+
+	for _, node := range nodes {
+		if !workloads.Contains(znet.Nodes, node) {
+			continue
+		}
+		cl, err := d.tfPluginClient.NcPool.GetNodeClient(d.tfPluginClient.SubstrateConn, node)
+		if err != nil {
+			return errors.Wrapf(err, "could not get node %d client", node)
+		}
+		ips, err := cl.NetworkListPrivateIPs(ctx, znet.Name)
+		if err != nil {
+			return errors.Wrapf(err, "could not list private ips of network %s on node %d", znet.Name, node)
+		}
+		if len(ips) != 0 {
+			return errors.Errorf("node %d still hosts vms in network %s with ips %v", node, znet.Name, ips)
+		}
+	}
+
+	previous := cloneNetwork(znet)
+	znet.Nodes = remaining
+	for _, node := range nodes {
+		delete(znet.NodesIPRange, node)
+		delete(znet.Keys, node)
+		delete(znet.WGPort, node)
+		delete(znet.MyceliumKeys, node)
+		delete(znet.Endpoints, node)
+		// a new access node is picked if needed
+		if znet.PublicNodeID == node {
+			znet.PublicNodeID = 0
+		}
+	}
+
+	if err := d.updateMembers(ctx, znet, previous); err != nil {
+		return errors.Wrapf(err, "failed to remove nodes %v from network %s", nodes, znet.Name)
+	}
+	return nil
+}
+
+// updateMembers deploys a network on its new nodes, cancels it on the nodes it no longer uses and updates the peers of the other nodes.
+// the endpoints, ports and keys of the deployed nodes are reused so only the new nodes are queried.
+// failing to update the peers of a deployed node doesn't fail the update, the node gets them on the next network deployment.
+// the network is restored to its previous state if its new nodes can't be deployed.
+func (d *NetworkDeployer) updateMembers(ctx context.Context, znet *workloads.ZNet, previous workloads.ZNet) error {
+	dls, endpoints, err := d.generateMembersDeployments(ctx, znet)
+	if err != nil {
+		*znet = previous
+		return err
+	}
+
+	created := make(map[uint32]gridtypes.Deployment)
+	for node, dl := range dls {
+		if _, ok := znet.NodeDeploymentID[node]; !ok {
+			created[node] = dl
+		}
+	}
+	if len(created) != 0 {
+		solutionProviders := make(map[uint32]*uint64)
+		for node := range created {
+			solutionProviders[node] = nil
+		}
+		contracts, err := d.deployer.Deploy(ctx, map[uint32]uint64{}, created, solutionProviders)
+		if err != nil {
+			*znet = previous
+		}
+		// contracts left by a failed revert are tracked to be canceled with the network
+		for node, contractID := range contracts {
+			znet.NodeDeploymentID[node] = contractID
+			d.tfPluginClient.State.StoreContractIDs(node, contractID)
+		}
+		if err != nil {
+			return d.tfPluginClient.saveState(err)
+		}
+	}
+
+	for node, contractID := range znet.NodeDeploymentID {
+		if _, ok := dls[node]; ok {
+			continue
+		}
+		if err := d.deployer.Cancel(ctx, contractID); err != nil {
+			return d.tfPluginClient.saveState(errors.Wrapf(err, "could not cancel network contract %d on node %d", contractID, node))
+		}
+		delete(znet.NodeDeploymentID, node)
+		d.tfPluginClient.State.RemoveContractIDs(node, contractID)
+	}
+	d.tfPluginClient.State.Networks.UpdateNetworkSubnets(znet.Name, znet.NodesIPRange)
+
+	for node, dl := range dls {
+		if _, ok := created[node]; ok {
+			continue
+		}
+		// hidden nodes only peer with the public node
+		if endpoints[node] == nil && znet.PublicNodeID == previous.PublicNodeID {
+			continue
+		}
+		contractID := znet.NodeDeploymentID[node]
+		_, err := d.deployer.Deploy(ctx, map[uint32]uint64{node: contractID}, map[uint32]gridtypes.Deployment{node: dl}, map[uint32]*uint64{node: nil})
+		if err != nil {
+			log.Warn().Err(err).Uint32("node id", node).Str("network", znet.Name).Msg("could not update the node network peers, they are updated on the next network deployment")
+		}
+	}
+
+	return d.tfPluginClient.saveState(nil)
+}
+
+// generateMembersDeployments generates the deployments of the network nodes and returns them with the nodes endpoints
+func (d *NetworkDeployer) generateMembersDeployments(ctx context.Context, znet *workloads.ZNet) (map[uint32]gridtypes.Deployment, map[uint32]net.IP, error) {
+	if err := validateAccountBalanceForExtrinsics(d.tfPluginClient.SubstrateConn, d.tfPluginClient.Identity); err != nil {
+		return nil, nil, err
+	}
+	if err := znet.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	endpoints, usedPorts, err := d.membersEndpointsAndPorts(ctx, znet)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var publicNode uint32
+	hasIPv4Node := slices.ContainsFunc(znet.Nodes, func(node uint32) bool { return endpoints[node].To4() != nil })
+	if !znet.MyceliumOnly && znet.PublicNodeID == 0 && !hasIPv4Node && needPublicNode([]*workloads.ZNet{znet}) {
+		publicNode, err = GetPublicNode(ctx, *d.tfPluginClient, nil)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to get public node")
+		}
+		endpoints[publicNode], usedPorts[publicNode], err = d.getNodeEndpointAndPorts(ctx, publicNode)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	dls, err := d.generateDeployments(znet, endpoints, usedPorts, publicNode)
+	return dls, endpoints, err
+}
+
+// membersEndpointsAndPorts returns the endpoints of the network nodes and the used wireguard ports of its new nodes.
+// nodes with a stored endpoint and wireguard port are not queried.
+func (d *NetworkDeployer) membersEndpointsAndPorts(ctx context.Context, znet *workloads.ZNet) (map[uint32]net.IP, map[uint32][]uint16, error) {
+	endpoints := make(map[uint32]net.IP)
+	usedPorts := make(map[uint32][]uint16)
+	if znet.MyceliumOnly {
+		return endpoints, usedPorts, nil
+	}
+
+	nodes := slices.Clone(znet.Nodes)
+	if znet.PublicNodeID != 0 && !slices.Contains(nodes, znet.PublicNodeID) {
+		nodes = append(nodes, znet.PublicNodeID)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var multiErr error
+	for _, nodeID := range nodes {
+		if endpoint, ok := znet.Endpoints[nodeID]; ok && znet.NodeDeploymentID[nodeID] != 0 && znet.WGPort[nodeID] != 0 {
+			endpoints[nodeID] = endpoint
+			continue
+		}
+
+		wg.Add(1)
+		go func(nodeID uint32) {
+			defer wg.Done()
+			endpoint, ports, err := d.getNodeEndpointAndPorts(ctx, nodeID)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				multiErr = multierror.Append(multiErr, err)
+				return
+			}
+			endpoints[nodeID] = endpoint
+			usedPorts[nodeID] = ports
+		}(nodeID)
+	}
+	wg.Wait()
+
+	return endpoints, usedPorts, multiErr
+}
+
+// cloneNetwork copies a network so changes to its nodes can be reverted
+func cloneNetwork(znet *workloads.ZNet) workloads.ZNet {
+	clone := *znet
+	clone.Nodes = slices.Clone(znet.Nodes)
+	clone.UserAccesses = slices.Clone(znet.UserAccesses)
+	clone.NodesIPRange = maps.Clone(znet.NodesIPRange)
+	clone.NodeDeploymentID = maps.Clone(znet.NodeDeploymentID)
+	clone.WGPort = maps.Clone(znet.WGPort)
+	clone.Keys = maps.Clone(znet.Keys)
+	clone.MyceliumKeys = maps.Clone(znet.MyceliumKeys)
+	clone.Endpoints = maps.Clone(znet.Endpoints)
+	clone.UserAccessWGConfigs = maps.Clone(znet.UserAccessWGConfigs)
+	return clone
+}
+
+// AddUserAccess adds a named wireguard access to a network and returns its wireguard config
+func (d *NetworkDeployer) AddUserAccess(ctx context.Context, znet *workloads.ZNet, name string) (string, error) {
+	if err := znet.AddUserAccess(name); err != nil {
+		return "", err
+	}
+
+	if err := d.Deploy(ctx, znet); err != nil {
+		return "", errors.Wrapf(err, "failed to add user access %s to network %s", name, znet.Name)
+	}
+	return znet.UserAccessWGConfigs[name], nil
+}
+
+// RevokeUserAccess removes the peer of a named wireguard access from a network, the other accesses keep working
+func (d *NetworkDeployer) RevokeUserAccess(ctx context.Context, znet *workloads.ZNet, name string) error {
+	if err := znet.RemoveUserAccess(name); err != nil {
+		return err
+	}
+
+	if err := d.Deploy(ctx, znet); err != nil {
+		return errors.Wrapf(err, "failed to revoke user access %s from network %s", name, znet.Name)
+	}
+	return nil
+}
+
 // BatchDeploy deploys multiple network deployments using the deployer
 func (d *NetworkDeployer) BatchDeploy(ctx context.Context, znets []*workloads.ZNet, updateMetadata ...bool) error {
 	var multiErr error
@@ -500,11 +893,11 @@ func (d *NetworkDeployer) BatchDeploy(ctx context.Context, znets []*workloads.ZN
 	// error is not returned immediately before updating state because of untracked failed deployments
 	for _, znet := range znets {
 		if err := d.updateStateFromDeployments(ctx, znet, newDls, update); err != nil {
-			return errors.Wrapf(err, "failed to update network '%s' state", znet.Name)
+			return d.tfPluginClient.saveState(errors.Wrapf(err, "failed to update network '%s' state", znet.Name))
 		}
 	}
 
-	return multiErr
+	return d.tfPluginClient.saveState(multiErr)
 }
 
 // Cancel cancels all the deployments
@@ -517,7 +910,7 @@ func (d *NetworkDeployer) Cancel(ctx context.Context, znet *workloads.ZNet) erro
 	for nodeID, contractID := range znet.NodeDeploymentID {
 		err = d.deployer.Cancel(ctx, contractID)
 		if err != nil {
-			return errors.Wrapf(err, "could not cancel network %s, contract %d", znet.Name, contractID)
+			return d.tfPluginClient.saveState(errors.Wrapf(err, "could not cancel network %s, contract %d", znet.Name, contractID))
 		}
 		delete(znet.NodeDeploymentID, nodeID)
 		d.tfPluginClient.State.CurrentNodeDeployments[nodeID] = workloads.Delete(d.tfPluginClient.State.CurrentNodeDeployments[nodeID], contractID)
@@ -526,6 +919,10 @@ func (d *NetworkDeployer) Cancel(ctx context.Context, znet *workloads.ZNet) erro
 	// delete network from state if all contracts was deleted
 	d.tfPluginClient.State.Networks.DeleteNetwork(znet.Name)
 
+	if err := d.tfPluginClient.State.Save(); err != nil {
+		return err
+	}
+
 	if err := d.ReadNodesConfig(ctx, znet); err != nil {
 		return errors.Wrap(err, "could not read node's data")
 	}
@@ -558,9 +955,11 @@ func (d *NetworkDeployer) BatchCancel(ctx context.Context, znets []*workloads.ZN
 		znet.Keys = make(map[uint32]wgtypes.Key)
 		znet.WGPort = make(map[uint32]int)
 		znet.NodesIPRange = make(map[uint32]gridtypes.IPNet)
+		znet.Endpoints = make(map[uint32]net.IP)
 		znet.AccessWGConfig = ""
+		znet.UserAccessWGConfigs = nil
 	}
-	return nil
+	return d.tfPluginClient.State.Save()
 }
 
 func (d *NetworkDeployer) updateStateFromDeployments(ctx context.Context, znet *workloads.ZNet, dls map[uint32][]gridtypes.Deployment, updateMetadata bool) error {
@@ -574,7 +973,7 @@ func (d *NetworkDeployer) updateStateFromDeployments(ctx context.Context, znet *
 	for _, nodeID := range nodesUsed {
 		// assign NodeDeploymentIDs
 		for _, dl := range dls[nodeID] {
-			dlData, err := workloads.ParseDeploymentData(dl.Metadata)
+			dlData, err := workloads.ParseDeploymentData(dl.Metadata, d.tfPluginClient.metadataKey)
 			if err != nil {
 				return errors.Wrapf(err, "could not get deployment %d data", dl.ContractID)
 			}
@@ -589,6 +988,12 @@ func (d *NetworkDeployer) updateStateFromDeployments(ctx context.Context, znet *
 		}
 	}
 
+	// keep the assigned subnets in a dry run so deployments on the network can be generated
+	if d.tfPluginClient.DryRunReport != nil {
+		d.tfPluginClient.State.Networks.UpdateNetworkSubnets(znet.Name, znet.NodesIPRange)
+		return nil
+	}
+
 	if !updateMetadata {
 		return nil
 	}
@@ -608,6 +1013,7 @@ func (d *NetworkDeployer) InvalidateBrokenAttributes(znet *workloads.ZNet) error
 			delete(znet.NodesIPRange, node)
 			delete(znet.Keys, node)
 			delete(znet.WGPort, node)
+			delete(znet.Endpoints, node)
 		} else if err != nil {
 			return errors.Wrapf(err, "could not get node %d contract %d", node, contractID)
 		}
@@ -620,6 +1026,11 @@ func (d *NetworkDeployer) InvalidateBrokenAttributes(znet *workloads.ZNet) error
 			delete(znet.NodesIPRange, node)
 		}
 	}
+	for i, access := range znet.UserAccesses {
+		if ip, err := gridtypes.ParseIPNet(access.Subnet); err != nil || !znet.IPRange.Contains(ip.IP) {
+			znet.UserAccesses[i].Subnet = ""
+		}
+	}
 	if znet.PublicNodeID != 0 {
 		// TODO: add a check that the node is still public
 		cl, err := d.tfPluginClient.NcPool.GetNodeClient(d.tfPluginClient.SubstrateConn, znet.PublicNodeID)
@@ -638,6 +1049,13 @@ func (d *NetworkDeployer) InvalidateBrokenAttributes(znet *workloads.ZNet) error
 	return nil
 }
 
+// isUserAccessSubnet checks if a peer subnet belongs to one of the network named user accesses
+func isUserAccessSubnet(znet *workloads.ZNet, subnet gridtypes.IPNet) bool {
+	return slices.ContainsFunc(znet.UserAccesses, func(access workloads.UserAccess) bool {
+		return access.Subnet == subnet.String()
+	})
+}
+
 // ReadNodesConfig reads the configuration of a network
 func (d *NetworkDeployer) ReadNodesConfig(ctx context.Context, znet *workloads.ZNet) error {
 	keys := make(map[uint32]wgtypes.Key)
@@ -649,7 +1067,7 @@ func (d *NetworkDeployer) ReadNodesConfig(ctx context.Context, znet *workloads.Z
 		return errors.Wrap(err, "failed to get deployment objects")
 	}
 
-	WGAccess := false
+	var endpointlessPeers []gridtypes.IPNet
 	for node, dl := range nodeDeployments {
 		for _, wl := range dl.Workloads {
 			if wl.Type != zos.NetworkType {
@@ -667,14 +1085,25 @@ func (d *NetworkDeployer) ReadNodesConfig(ctx context.Context, znet *workloads.Z
 				return errors.Wrap(err, "could not parse wg private key from workload object")
 			}
 			nodesIPRange[node] = d.Subnet
-			// this will fail when hidden node is supported
 			for _, peer := range d.Peers {
 				if peer.Endpoint == "" {
-					WGAccess = true
+					endpointlessPeers = append(endpointlessPeers, peer.Subnet)
 				}
 			}
 		}
 	}
+
+	// peers without endpoints are hidden nodes, named user accesses or the network wireguard access
+	nodeSubnets := make(map[string]bool)
+	for _, subnet := range nodesIPRange {
+		nodeSubnets[subnet.String()] = true
+	}
+	WGAccess := false
+	for _, subnet := range endpointlessPeers {
+		if !nodeSubnets[subnet.String()] && !isUserAccessSubnet(znet, subnet) {
+			WGAccess = true
+		}
+	}
 	znet.Keys = keys
 	znet.WGPort = WGPort
 	znet.NodesIPRange = nodesIPRange
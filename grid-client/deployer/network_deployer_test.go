@@ -9,12 +9,15 @@ import (
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/fakegrid"
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/mocks"
 	client "github.com/threefoldtech/tfgrid-sdk-go/grid-client/node"
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/state"
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
 	"github.com/threefoldtech/zos/pkg/gridtypes"
 	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
 func constructTestNetwork() workloads.ZNet {
@@ -257,3 +260,197 @@ func ExampleNetworkDeployer_Cancel() {
 	}
 	fmt.Println("deployment is canceled successfully")
 }
+
+func TestFakeGridNetworkMembership(t *testing.T) {
+	tfPluginClient, grid := newFakeGridClient(t)
+	ctx := context.Background()
+
+	network := workloads.ZNet{
+		Name:    "membernet",
+		Nodes:   []uint32{11},
+		IPRange: gridtypes.NewIPNet(net.IPNet{IP: net.IPv4(10, 20, 0, 0), Mask: net.CIDRMask(16, 32)}),
+	}
+	require.NoError(t, tfPluginClient.NetworkDeployer.Deploy(ctx, &network))
+	contract, port, key, subnet := network.NodeDeploymentID[11], network.WGPort[11], network.Keys[11], network.NodesIPRange[11]
+
+	require.NoError(t, tfPluginClient.NetworkDeployer.AddNodes(ctx, &network, []uint32{12}))
+	assert.Equal(t, []uint32{11, 12}, network.Nodes)
+	require.Contains(t, network.NodeDeploymentID, uint32(12))
+
+	// the existing node keeps its network config
+	assert.Equal(t, contract, network.NodeDeploymentID[11])
+	assert.Equal(t, port, network.WGPort[11])
+	assert.Equal(t, key, network.Keys[11])
+	assert.Equal(t, subnet, network.NodesIPRange[11])
+	assert.NotEqual(t, subnet, network.NodesIPRange[12])
+
+	dl := workloads.NewDeployment("vm", 12, "", nil, network.Name, nil, nil, []workloads.VM{{
+		Name: "vm", NetworkName: network.Name, CPU: 1, Memory: 1024, Flist: grid.FlistURL("base"), Entrypoint: "/sbin/zinit init",
+	}}, nil)
+	require.NoError(t, tfPluginClient.DeploymentDeployer.Deploy(ctx, &dl))
+
+	assert.ErrorContains(t, tfPluginClient.NetworkDeployer.RemoveNodes(ctx, &network, []uint32{12}), "still hosts vms")
+	assert.Equal(t, []uint32{11, 12}, network.Nodes)
+	assert.Error(t, tfPluginClient.NetworkDeployer.RemoveNodes(ctx, &network, []uint32{11, 12}))
+
+	require.NoError(t, tfPluginClient.DeploymentDeployer.Cancel(ctx, &dl))
+	removedContract := network.NodeDeploymentID[12]
+	require.NoError(t, tfPluginClient.NetworkDeployer.RemoveNodes(ctx, &network, []uint32{12}))
+	assert.Equal(t, []uint32{11}, network.Nodes)
+	assert.NotContains(t, network.NodeDeploymentID, uint32(12))
+	assert.NotContains(t, grid.ActiveContracts(), removedContract)
+	assert.NotContains(t, tfPluginClient.State.CurrentNodeDeployments[12], removedContract)
+	assert.Equal(t, port, network.WGPort[11])
+	assert.Empty(t, grid.NodeDeployments(12))
+}
+
+func TestFakeGridNetworkMembershipUnreachableNode(t *testing.T) {
+	tfPluginClient, grid := newFakeGridClient(t)
+	ctx := context.Background()
+
+	capacity := gridtypes.Capacity{CRU: 8, MRU: 16 * gridtypes.Gigabyte, SRU: 512 * gridtypes.Gigabyte}
+	require.NoError(t, grid.AddNode(fakegrid.Node{NodeID: 13, FarmID: 1, TotalResources: capacity, PublicIPv4: "185.206.122.11/24"}))
+
+	network := workloads.ZNet{
+		Name:    "membernet",
+		Nodes:   []uint32{13, 11},
+		IPRange: gridtypes.NewIPNet(net.IPNet{IP: net.IPv4(10, 20, 0, 0), Mask: net.CIDRMask(16, 32)}),
+	}
+	require.NoError(t, tfPluginClient.NetworkDeployer.Deploy(ctx, &network))
+	unreachable := grid.NodeDeployments(13)[0]
+
+	// the existing nodes are not queried, and the unreachable one keeps its old peers
+	require.NoError(t, grid.SetNodeStatus(13, "down"))
+	require.NoError(t, tfPluginClient.NetworkDeployer.AddNodes(ctx, &network, []uint32{12}))
+	assert.Equal(t, []uint32{13, 11, 12}, network.Nodes)
+	assert.Equal(t, uint32(11), network.PublicNodeID)
+	require.Contains(t, network.NodeDeploymentID, uint32(12))
+	assert.Equal(t, unreachable.Version, grid.NodeDeployments(13)[0].Version)
+
+	peerSubnets := func(nodeID uint32) []gridtypes.IPNet {
+		data, err := grid.NodeDeployments(nodeID)[0].Workloads[0].WorkloadData()
+		require.NoError(t, err)
+		var subnets []gridtypes.IPNet
+		for _, peer := range data.(*zos.Network).Peers {
+			subnets = append(subnets, peer.Subnet)
+		}
+		return subnets
+	}
+	assert.Contains(t, peerSubnets(11), network.NodesIPRange[12])
+	assert.NotContains(t, peerSubnets(13), network.NodesIPRange[12])
+
+	require.NoError(t, tfPluginClient.NetworkDeployer.RemoveNodes(ctx, &network, []uint32{12}))
+	assert.Equal(t, []uint32{13, 11}, network.Nodes)
+	assert.NotContains(t, peerSubnets(11), network.NodesIPRange[12])
+	assert.Empty(t, grid.NodeDeployments(12))
+}
+
+func TestFakeGridUserAccesses(t *testing.T) {
+	tfPluginClient, grid := newFakeGridClient(t)
+	ctx := context.Background()
+
+	network := workloads.ZNet{
+		Name:    "accessnet",
+		Nodes:   []uint32{12},
+		IPRange: gridtypes.NewIPNet(net.IPNet{IP: net.IPv4(10, 20, 0, 0), Mask: net.CIDRMask(16, 32)}),
+	}
+	require.NoError(t, tfPluginClient.NetworkDeployer.Deploy(ctx, &network))
+
+	aliceConfig, err := tfPluginClient.NetworkDeployer.AddUserAccess(ctx, &network, "alice")
+	require.NoError(t, err)
+	ciConfig, err := tfPluginClient.NetworkDeployer.AddUserAccess(ctx, &network, "ci")
+	require.NoError(t, err)
+	assert.NotEqual(t, aliceConfig, ciConfig)
+	assert.Contains(t, aliceConfig, "Endpoint = 185.206.122.10:")
+	assert.False(t, network.AddWGAccess)
+	require.Equal(t, uint32(11), network.PublicNodeID)
+
+	_, err = tfPluginClient.NetworkDeployer.AddUserAccess(ctx, &network, "alice")
+	assert.Error(t, err)
+
+	peerKeys := func() []string {
+		var keys []string
+		for _, dl := range grid.NodeDeployments(network.PublicNodeID) {
+			data, err := dl.Workloads[0].WorkloadData()
+			require.NoError(t, err)
+			for _, peer := range data.(*zos.Network).Peers {
+				keys = append(keys, peer.WGPublicKey)
+			}
+		}
+		return keys
+	}
+	publicKey := func(access workloads.UserAccess) string {
+		key, err := wgtypes.ParseKey(access.PrivateKey)
+		require.NoError(t, err)
+		return key.PublicKey().String()
+	}
+	alice, ci := network.UserAccesses[0], network.UserAccesses[1]
+	assert.Contains(t, peerKeys(), publicKey(alice))
+	assert.Contains(t, peerKeys(), publicKey(ci))
+
+	loaded, err := tfPluginClient.State.LoadNetworkFromGrid(ctx, network.Name)
+	require.NoError(t, err)
+	assert.Equal(t, network.UserAccesses, loaded.UserAccesses)
+	assert.Equal(t, network.Endpoints, loaded.Endpoints)
+	assert.Equal(t, ciConfig, loaded.UserAccessWGConfigs["ci"])
+	assert.False(t, loaded.AddWGAccess)
+
+	require.NoError(t, tfPluginClient.NetworkDeployer.RevokeUserAccess(ctx, &loaded, "alice"))
+	assert.Error(t, tfPluginClient.NetworkDeployer.RevokeUserAccess(ctx, &loaded, "alice"))
+	assert.NotContains(t, peerKeys(), publicKey(alice))
+	assert.Contains(t, peerKeys(), publicKey(ci))
+	assert.Equal(t, []workloads.UserAccess{ci}, loaded.UserAccesses)
+	assert.Equal(t, ciConfig, loaded.UserAccessWGConfigs["ci"])
+}
+
+func TestFakeGridMyceliumOnlyNetwork(t *testing.T) {
+	tfPluginClient, grid := newFakeGridClient(t)
+	ctx := context.Background()
+
+	// both nodes are hidden, so a wireguard network would need node 11 as a public node
+	capacity := gridtypes.Capacity{CRU: 8, MRU: 16 * gridtypes.Gigabyte, SRU: 512 * gridtypes.Gigabyte}
+	require.NoError(t, grid.AddNode(fakegrid.Node{NodeID: 13, FarmID: 1, TotalResources: capacity}))
+
+	network := workloads.ZNet{
+		Name:         "myceliumnet",
+		Nodes:        []uint32{12, 13},
+		IPRange:      gridtypes.NewIPNet(net.IPNet{IP: net.IPv4(10, 20, 0, 0), Mask: net.CIDRMask(16, 32)}),
+		MyceliumOnly: true,
+		AddWGAccess:  true,
+	}
+	assert.ErrorContains(t, tfPluginClient.NetworkDeployer.Deploy(ctx, &network), "wireguard accesses")
+
+	network.AddWGAccess = false
+	require.NoError(t, tfPluginClient.NetworkDeployer.Deploy(ctx, &network))
+	assert.Len(t, network.NodeDeploymentID, 2)
+	assert.Zero(t, network.PublicNodeID)
+	assert.Empty(t, grid.NodeDeployments(11))
+
+	for _, node := range network.Nodes {
+		dls := grid.NodeDeployments(node)
+		require.Len(t, dls, 1)
+		data, err := dls[0].Workloads[0].WorkloadData()
+		require.NoError(t, err)
+		znet := data.(*zos.Network)
+		assert.Zero(t, znet.WGListenPort)
+		assert.Empty(t, znet.Peers)
+		require.NotNil(t, znet.Mycelium)
+		assert.Equal(t, network.MyceliumKeys[node], []byte(znet.Mycelium.Key))
+	}
+
+	seed, err := workloads.RandomMyceliumIPSeed()
+	require.NoError(t, err)
+	dl := workloads.NewDeployment("vm", 12, "", nil, network.Name, nil, nil, []workloads.VM{{
+		Name: "vm", NetworkName: network.Name, CPU: 1, Memory: 1024, Flist: grid.FlistURL("base"), Entrypoint: "/sbin/zinit init", MyceliumIPSeed: seed,
+	}}, nil)
+	require.NoError(t, tfPluginClient.DeploymentDeployer.Deploy(ctx, &dl))
+
+	vm, err := tfPluginClient.State.LoadVMFromGrid(ctx, 12, "vm", dl.Name)
+	require.NoError(t, err)
+	assert.NotEmpty(t, vm.MyceliumIP)
+
+	loaded, err := tfPluginClient.State.LoadNetworkFromGrid(ctx, network.Name)
+	require.NoError(t, err)
+	assert.True(t, loaded.MyceliumOnly)
+	assert.ElementsMatch(t, network.Nodes, loaded.Nodes)
+}
@@ -0,0 +1,314 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/graphql"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+)
+
+// PlanAction is the action a plan takes on a grid object
+type PlanAction string
+
+const (
+	// PlanCreate is used for desired objects that are not deployed
+	PlanCreate PlanAction = "create"
+	// PlanUpdate is used for deployed objects that differ from the desired ones
+	PlanUpdate PlanAction = "update"
+	// PlanCancel is used for deployed objects that are not desired anymore
+	PlanCancel PlanAction = "cancel"
+)
+
+// deployOrder is the order objects are deployed in, cancellations are done in the reverse order
+var deployOrder = []string{
+	workloads.NetworkType,
+	workloads.VMType,
+	workloads.K8sType,
+	workloads.GatewayNameType,
+	workloads.GatewayFQDNType,
+}
+
+// DesiredState is the set of grid objects a plan converges to
+type DesiredState struct {
+	Networks     []*workloads.ZNet
+	Deployments  []*workloads.Deployment
+	K8sClusters  []*workloads.K8sCluster
+	GatewayNames []*workloads.GatewayNameProxy
+	GatewayFQDNs []*workloads.GatewayFQDNProxy
+
+	// Projects are extra project names owned by the desired state.
+	// deployed objects of these projects and of the desired objects projects are canceled if they are not desired.
+	Projects []string
+}
+
+// PlanChange is a single change of a plan
+type PlanChange struct {
+	Action      PlanAction
+	Type        string
+	Name        string
+	ProjectName string
+	// Fields are the changed fields of an updated object
+	Fields []string
+	// NodeContracts are the deployed node contracts of the object
+	NodeContracts map[uint32]uint64
+	// NameContractID is the name contract of a canceled gateway name
+	NameContractID uint64
+
+	object interface{}
+}
+
+// String returns a one line description of the change
+func (c PlanChange) String() string {
+	var sign string
+	switch c.Action {
+	case PlanCreate:
+		sign = "+"
+	case PlanUpdate:
+		sign = "~"
+	case PlanCancel:
+		sign = "-"
+	}
+
+	line := fmt.Sprintf("%s %s %s %q (project: %s)", sign, c.Action, c.Type, c.Name, c.ProjectName)
+	switch c.Action {
+	case PlanUpdate:
+		line += fmt.Sprintf(" changed: %s", strings.Join(c.Fields, ", "))
+	case PlanCancel:
+		line += fmt.Sprintf(" contracts: %s", formatContractIDs(c.contractIDs()))
+	}
+	return line
+}
+
+// contractIDs returns all contracts of the change sorted
+func (c PlanChange) contractIDs() []uint64 {
+	var contractIDs []uint64
+	for _, contractID := range c.NodeContracts {
+		contractIDs = append(contractIDs, contractID)
+	}
+	if c.NameContractID != 0 {
+		contractIDs = append(contractIDs, c.NameContractID)
+	}
+	slices.Sort(contractIDs)
+	return contractIDs
+}
+
+// Plan is the set of changes needed to reach a desired state
+type Plan struct {
+	Changes []PlanChange
+}
+
+// Empty returns true if the plan has no changes
+func (p Plan) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+// String returns a human readable description of the plan
+func (p Plan) String() string {
+	if p.Empty() {
+		return "No changes, the grid matches the desired state"
+	}
+
+	counts := map[PlanAction]int{}
+	for _, change := range p.Changes {
+		counts[change.Action]++
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Plan: %d to create, %d to update, %d to cancel\n", counts[PlanCreate], counts[PlanUpdate], counts[PlanCancel])
+	for _, change := range p.Changes {
+		fmt.Fprintf(&b, "  %s\n", change)
+	}
+	return b.String()
+}
+
+// Plan compares the desired state with the deployed objects and returns the changes needed to reach it.
+// deployed objects are loaded from the grid and their computed fields (contracts, keys, IPs...) are copied to the desired objects,
+// so applying the plan updates them in place instead of creating new ones.
+func (t *TFPluginClient) Plan(ctx context.Context, desired DesiredState) (Plan, error) {
+	contracts, err := t.ContractsGetter.ListContractsByTwinID([]string{"Created", "GracePeriod"})
+	if err != nil {
+		return Plan{}, errors.Wrap(err, "could not list twin contracts")
+	}
+
+	p := planner{
+		tfPluginClient: t,
+		deployed:       t.groupContracts(contracts.NodeContracts),
+		nameContracts:  contracts.NameContracts,
+		desired:        make(map[objectKey]bool),
+		projects:       make(map[string]bool),
+	}
+	for _, project := range desired.Projects {
+		p.projects[project] = true
+	}
+	p.storeNetworkContracts()
+
+	var changes []PlanChange
+	for _, znet := range desired.Networks {
+		change, err := p.planNetwork(ctx, znet)
+		if err != nil {
+			return Plan{}, errors.Wrapf(err, "could not plan network %s", znet.Name)
+		}
+		changes = appendChange(changes, change)
+	}
+
+	for _, dl := range desired.Deployments {
+		change, err := p.planDeployment(ctx, dl)
+		if err != nil {
+			return Plan{}, errors.Wrapf(err, "could not plan deployment %s", dl.Name)
+		}
+		changes = appendChange(changes, change)
+	}
+
+	for _, cluster := range desired.K8sClusters {
+		if cluster.Master == nil {
+			return Plan{}, errors.New("could not plan kubernetes cluster without a master node")
+		}
+		change, err := p.planK8s(ctx, cluster)
+		if err != nil {
+			return Plan{}, errors.Wrapf(err, "could not plan kubernetes cluster %s", cluster.Master.Name)
+		}
+		changes = appendChange(changes, change)
+	}
+
+	for _, gw := range desired.GatewayNames {
+		change, err := p.planGatewayName(ctx, gw)
+		if err != nil {
+			return Plan{}, errors.Wrapf(err, "could not plan gateway name %s", gw.Name)
+		}
+		changes = appendChange(changes, change)
+	}
+
+	for _, gw := range desired.GatewayFQDNs {
+		change, err := p.planGatewayFQDN(ctx, gw)
+		if err != nil {
+			return Plan{}, errors.Wrapf(err, "could not plan gateway fqdn %s", gw.Name)
+		}
+		changes = appendChange(changes, change)
+	}
+
+	return Plan{Changes: append(changes, p.cancellations()...)}, nil
+}
+
+// Apply applies the plan changes in dependency order.
+// networks are deployed first, then deployments, kubernetes clusters and gateways.
+// objects are canceled after all deployments are done, in the reverse order.
+func (t *TFPluginClient) Apply(ctx context.Context, plan Plan) error {
+	for _, deploymentType := range deployOrder {
+		for _, change := range plan.Changes {
+			if change.Type != deploymentType || change.Action == PlanCancel {
+				continue
+			}
+
+			log.Info().Str("type", change.Type).Str("name", change.Name).Msgf("%s object", change.Action)
+			if err := t.applyChange(ctx, change); err != nil {
+				return errors.Wrapf(err, "could not %s %s %s", change.Action, change.Type, change.Name)
+			}
+		}
+	}
+
+	for i := len(deployOrder) - 1; i >= 0; i-- {
+		var canceled []PlanChange
+		var contractIDs []uint64
+		for _, change := range plan.Changes {
+			if change.Type != deployOrder[i] || change.Action != PlanCancel {
+				continue
+			}
+			canceled = append(canceled, change)
+			contractIDs = append(contractIDs, change.contractIDs()...)
+		}
+
+		if len(contractIDs) == 0 {
+			continue
+		}
+
+		log.Info().Str("type", deployOrder[i]).Uints64("contracts IDs", contractIDs).Msg("cancel objects")
+		if err := t.BatchCancelContract(contractIDs); err != nil {
+			return t.saveState(errors.Wrapf(err, "could not cancel %s contracts", deployOrder[i]))
+		}
+
+		for _, change := range canceled {
+			for nodeID, contractID := range change.NodeContracts {
+				t.State.RemoveContractIDs(nodeID, contractID)
+			}
+			if change.Type == workloads.NetworkType {
+				t.State.Networks.DeleteNetwork(change.Name)
+			}
+		}
+	}
+
+	return t.State.Save()
+}
+
+func (t *TFPluginClient) applyChange(ctx context.Context, change PlanChange) error {
+	switch object := change.object.(type) {
+	case *workloads.ZNet:
+		return t.NetworkDeployer.Deploy(ctx, object)
+	case *workloads.Deployment:
+		return t.DeploymentDeployer.Deploy(ctx, object)
+	case *workloads.K8sCluster:
+		return t.K8sDeployer.Deploy(ctx, object)
+	case *workloads.GatewayNameProxy:
+		return t.GatewayNameDeployer.Deploy(ctx, object)
+	case *workloads.GatewayFQDNProxy:
+		return t.GatewayFQDNDeployer.Deploy(ctx, object)
+	default:
+		return fmt.Errorf("unsupported object %T", change.object)
+	}
+}
+
+// objectKey identifies a deployed object using its deployment data
+type objectKey struct {
+	projectName    string
+	deploymentType string
+	name           string
+}
+
+// groupContracts groups node contracts of the same object
+func (t *TFPluginClient) groupContracts(contracts []graphql.Contract) map[objectKey]map[uint32]uint64 {
+	deployed := make(map[objectKey]map[uint32]uint64)
+	for _, contract := range contracts {
+		deploymentData, err := t.ContractsGetter.ParseDeploymentData(contract)
+		if err != nil {
+			log.Warn().Err(err).Str("metadata", contract.DeploymentData).Str("id", contract.ContractID).Msg("got contract with invalid metadata")
+			continue
+		}
+
+		contractID, err := strconv.ParseUint(contract.ContractID, 10, 64)
+		if err != nil {
+			log.Warn().Err(err).Str("id", contract.ContractID).Msg("got contract with invalid id")
+			continue
+		}
+
+		key := objectKey{
+			projectName:    deploymentData.ProjectName,
+			deploymentType: deploymentData.Type,
+			name:           deploymentData.Name,
+		}
+		if _, ok := deployed[key]; !ok {
+			deployed[key] = make(map[uint32]uint64)
+		}
+		deployed[key][contract.NodeID] = contractID
+	}
+	return deployed
+}
+
+func appendChange(changes []PlanChange, change *PlanChange) []PlanChange {
+	if change == nil {
+		return changes
+	}
+	return append(changes, *change)
+}
+
+func formatContractIDs(contractIDs []uint64) string {
+	ids := make([]string, 0, len(contractIDs))
+	for _, contractID := range contractIDs {
+		ids = append(ids, strconv.FormatUint(contractID, 10))
+	}
+	return strings.Join(ids, ", ")
+}
@@ -0,0 +1,122 @@
+package deployer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/graphql"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/state"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+)
+
+func newPlanTestClient(t *testing.T, nodeContracts []graphql.Contract) *TFPluginClient {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Query string `json:"query"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+
+		data := map[string]interface{}{
+			"nodeContracts": nodeContracts,
+			"nameContracts": []graphql.Contract{},
+			"rentContracts": []graphql.Contract{},
+		}
+		if strings.Contains(body.Query, "Connection") {
+			data = map[string]interface{}{"items": map[string]interface{}{"count": len(nodeContracts)}}
+		}
+		assert.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{"data": data}))
+	}))
+	t.Cleanup(server.Close)
+
+	gql, err := graphql.NewGraphQl(server.URL)
+	assert.NoError(t, err)
+
+	return &TFPluginClient{
+		ContractsGetter: graphql.NewContractsGetter(1, gql, nil, nil),
+		State:           state.NewState(nil, nil),
+	}
+}
+
+func TestPlan(t *testing.T) {
+	tfPluginClient := newPlanTestClient(t, []graphql.Contract{
+		{ContractID: "10", NodeID: 1, DeploymentData: `{"type":"network","name":"old","projectName":"Network"}`},
+		{ContractID: "11", NodeID: 2, DeploymentData: `{"type":"network","name":"old","projectName":"Network"}`},
+		{ContractID: "12", NodeID: 1, DeploymentData: `{"type":"vm","name":"other","projectName":"other"}`},
+	})
+
+	znet := workloads.ZNet{Name: "new", Nodes: []uint32{1}}
+	dl := workloads.Deployment{Name: "vm", NodeID: 1, NetworkName: "new"}
+
+	plan, err := tfPluginClient.Plan(context.Background(), DesiredState{
+		Networks:    []*workloads.ZNet{&znet},
+		Deployments: []*workloads.Deployment{&dl},
+	})
+	assert.NoError(t, err)
+
+	assert.Len(t, plan.Changes, 3)
+	assert.Equal(t, PlanCreate, plan.Changes[0].Action)
+	assert.Equal(t, workloads.NetworkType, plan.Changes[0].Type)
+	assert.Equal(t, PlanCreate, plan.Changes[1].Action)
+	assert.Equal(t, workloads.VMType, plan.Changes[1].Type)
+	assert.Equal(t, "vm/vm", plan.Changes[1].ProjectName)
+	assert.Equal(t, PlanCancel, plan.Changes[2].Action)
+	assert.Equal(t, "old", plan.Changes[2].Name)
+	assert.Equal(t, []uint64{10, 11}, plan.Changes[2].contractIDs())
+
+	// networks contracts are stored to be able to load deployments networks
+	assert.Equal(t, state.ContractIDs{10}, tfPluginClient.State.CurrentNodeDeployments[1])
+
+	assert.Equal(t, `Plan: 2 to create, 0 to update, 1 to cancel
+  + create network "new" (project: Network)
+  + create vm "vm" (project: vm/vm)
+  - cancel network "old" (project: Network) contracts: 10, 11
+`, plan.String())
+
+	t.Run("duplicated objects", func(t *testing.T) {
+		_, err := tfPluginClient.Plan(context.Background(), DesiredState{
+			Networks: []*workloads.ZNet{&znet, &znet},
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("empty plan", func(t *testing.T) {
+		plan, err := tfPluginClient.Plan(context.Background(), DesiredState{})
+		assert.NoError(t, err)
+		assert.True(t, plan.Empty())
+		assert.Equal(t, "No changes, the grid matches the desired state", plan.String())
+	})
+}
+
+func TestChangedFields(t *testing.T) {
+	current := workloads.Deployment{
+		Name:   "dl",
+		NodeID: 1,
+		Vms: []workloads.VM{
+			{Name: "vm1", CPU: 1, EnvVars: map[string]string{}},
+			{Name: "vm2", CPU: 2, FlistChecksum: "checksum"},
+		},
+	}
+
+	t.Run("same spec", func(t *testing.T) {
+		desired := current
+		desired.Vms = []workloads.VM{{Name: "vm2", CPU: 2}, {Name: "vm1", CPU: 1}}
+		desired.Disks = []workloads.Disk{}
+
+		fields := changedFields(deploymentSpec(current), deploymentSpec(desired), "NodeID", "Disks", "Vms")
+		assert.Empty(t, fields)
+	})
+
+	t.Run("changed spec", func(t *testing.T) {
+		desired := current
+		desired.NodeID = 2
+		desired.Vms = []workloads.VM{{Name: "vm1", CPU: 2}, {Name: "vm2", CPU: 2}}
+
+		fields := changedFields(deploymentSpec(current), deploymentSpec(desired), "NodeID", "Disks", "Vms")
+		assert.Equal(t, []string{"NodeID", "Vms"}, fields)
+	})
+}
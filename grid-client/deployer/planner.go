@@ -0,0 +1,488 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/graphql"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+)
+
+// planner diffs the desired objects against the deployed ones.
+// fields computed by the grid (IPs, keys, contracts...) are copied from the deployed objects to the desired ones before comparing them.
+// an object is planned for an update if any of its user defined fields changed, the deployers skip the unchanged workloads anyway.
+type planner struct {
+	tfPluginClient *TFPluginClient
+	deployed       map[objectKey]map[uint32]uint64
+	nameContracts  []graphql.Contract
+	desired        map[objectKey]bool
+	projects       map[string]bool
+}
+
+// track registers a desired object using its metadata and returns its deployed node contracts
+func (p *planner) track(metadata string) (objectKey, map[uint32]uint64, error) {
+	deploymentData, err := workloads.ParseDeploymentData(metadata, p.tfPluginClient.metadataKey)
+	if err != nil {
+		return objectKey{}, nil, errors.Wrap(err, "could not parse deployment data")
+	}
+
+	key := objectKey{
+		projectName:    deploymentData.ProjectName,
+		deploymentType: deploymentData.Type,
+		name:           deploymentData.Name,
+	}
+	if p.desired[key] {
+		return objectKey{}, nil, fmt.Errorf("%s %s is duplicated in project %s", key.deploymentType, key.name, key.projectName)
+	}
+	p.desired[key] = true
+	p.projects[key.projectName] = true
+
+	nodeContracts := maps.Clone(p.deployed[key])
+	for nodeID, contractID := range nodeContracts {
+		p.tfPluginClient.State.StoreContractIDs(nodeID, contractID)
+	}
+	return key, nodeContracts, nil
+}
+
+// storeNetworkContracts adds the deployed networks contracts to the state,
+// networks are loaded by name from the state contracts when loading deployments and clusters.
+func (p *planner) storeNetworkContracts() {
+	for key, nodeContracts := range p.deployed {
+		if key.deploymentType != workloads.NetworkType {
+			continue
+		}
+		for nodeID, contractID := range nodeContracts {
+			p.tfPluginClient.State.StoreContractIDs(nodeID, contractID)
+		}
+	}
+}
+
+func (p *planner) planNetwork(ctx context.Context, znet *workloads.ZNet) (*PlanChange, error) {
+	metadata, err := znet.GenerateMetadata()
+	if err != nil {
+		return nil, err
+	}
+
+	key, nodeContracts, err := p.track(metadata)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodeContracts) == 0 {
+		return newPlanChange(PlanCreate, key, nil, nil, znet), nil
+	}
+
+	current, err := p.tfPluginClient.State.LoadNetworkFromGrid(ctx, znet.Name)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not load deployed network")
+	}
+
+	znet.NodeDeploymentID = nodeContracts
+	znet.PublicNodeID = current.PublicNodeID
+	znet.ExternalIP = current.ExternalIP
+	znet.ExternalSK = current.ExternalSK
+	znet.AccessWGConfig = current.AccessWGConfig
+	if znet.NodesIPRange == nil {
+		znet.NodesIPRange = current.NodesIPRange
+	}
+	if znet.Keys == nil {
+		znet.Keys = current.Keys
+	}
+	if znet.WGPort == nil {
+		znet.WGPort = current.WGPort
+	}
+	if znet.Endpoints == nil {
+		znet.Endpoints = current.Endpoints
+	}
+	if znet.MyceliumKeys == nil {
+		znet.MyceliumKeys = current.MyceliumKeys
+	}
+	if znet.UserAccesses == nil {
+		znet.UserAccesses = current.UserAccesses
+	}
+	znet.UserAccessWGConfigs = current.UserAccessWGConfigs
+
+	// the public node is added by the deployer if none of the nodes has a public config
+	currentSpec := current
+	currentSpec.Nodes = slices.DeleteFunc(slices.Clone(current.Nodes), func(nodeID uint32) bool {
+		return nodeID == current.PublicNodeID && !slices.Contains(znet.Nodes, nodeID)
+	})
+	slices.Sort(currentSpec.Nodes)
+	desiredSpec := *znet
+	desiredSpec.Nodes = slices.Clone(znet.Nodes)
+	slices.Sort(desiredSpec.Nodes)
+
+	fields := changedFields(currentSpec, desiredSpec, "Nodes", "IPRange", "AddWGAccess")
+	return updateChange(key, nodeContracts, fields, znet), nil
+}
+
+func (p *planner) planDeployment(ctx context.Context, dl *workloads.Deployment) (*PlanChange, error) {
+	metadata, err := dl.GenerateMetadata()
+	if err != nil {
+		return nil, err
+	}
+
+	key, nodeContracts, err := p.track(metadata)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodeContracts) == 0 {
+		return newPlanChange(PlanCreate, key, nil, nil, dl), nil
+	}
+
+	nodeID, contractID := firstContract(nodeContracts)
+	current, err := p.tfPluginClient.State.LoadDeploymentFromGrid(ctx, nodeID, dl.Name)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not load deployed deployment")
+	}
+
+	dl.NodeDeploymentID = nodeContracts
+	dl.ContractID = contractID
+	if dl.IPrange == "" && dl.NodeID == nodeID {
+		dl.IPrange = current.IPrange
+	}
+	for i := range dl.Vms {
+		if idx := slices.IndexFunc(current.Vms, func(vm workloads.VM) bool { return vm.Name == dl.Vms[i].Name }); idx >= 0 {
+			fillVM(&dl.Vms[i], current.Vms[idx])
+		}
+	}
+	for i := range dl.ReservedIPs {
+		if idx := slices.IndexFunc(current.ReservedIPs, func(ip workloads.ReservedIP) bool { return ip.Name == dl.ReservedIPs[i].Name }); idx >= 0 {
+			if dl.ReservedIPs[i].IP == "" || workloads.SameIPAddress(dl.ReservedIPs[i].IP, current.ReservedIPs[idx].IP) {
+				dl.ReservedIPs[i].IP = current.ReservedIPs[idx].IP
+			}
+		}
+	}
+	for i := range dl.Zdbs {
+		if idx := slices.IndexFunc(current.Zdbs, func(zdb workloads.ZDB) bool { return zdb.Name == dl.Zdbs[i].Name }); idx >= 0 {
+			fillZDB(&dl.Zdbs[i], current.Zdbs[idx])
+		}
+	}
+	for i := range dl.QSFS {
+		if idx := slices.IndexFunc(current.QSFS, func(qsfs workloads.QSFS) bool { return qsfs.Name == dl.QSFS[i].Name }); idx >= 0 {
+			dl.QSFS[i].MetricsEndpoint = current.QSFS[idx].MetricsEndpoint
+		}
+	}
+
+	fields := changedFields(deploymentSpec(current), deploymentSpec(*dl), "NodeID", "NetworkName", "Disks", "Zdbs", "Vms", "QSFS", "ReservedIPs")
+	return updateChange(key, nodeContracts, fields, dl), nil
+}
+
+func (p *planner) planK8s(ctx context.Context, cluster *workloads.K8sCluster) (*PlanChange, error) {
+	metadata, err := cluster.GenerateMetadata()
+	if err != nil {
+		return nil, err
+	}
+
+	key, nodeContracts, err := p.track(metadata)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodeContracts) == 0 {
+		return newPlanChange(PlanCreate, key, nil, nil, cluster), nil
+	}
+
+	var nodeIDs []uint32
+	for nodeID := range nodeContracts {
+		nodeIDs = append(nodeIDs, nodeID)
+	}
+	current, err := p.tfPluginClient.State.LoadK8sFromGrid(ctx, nodeIDs, cluster.Master.Name)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not load deployed kubernetes cluster")
+	}
+
+	cluster.NodeDeploymentID = nodeContracts
+	if cluster.NodesIPRange == nil {
+		cluster.NodesIPRange = current.NodesIPRange
+	}
+	fillK8sNode(cluster.Master, *current.Master)
+	for i := range cluster.Workers {
+		if idx := slices.IndexFunc(current.Workers, func(node workloads.K8sNode) bool { return node.Name == cluster.Workers[i].Name }); idx >= 0 {
+			fillK8sNode(&cluster.Workers[i], current.Workers[idx])
+		}
+	}
+
+	fields := changedFields(k8sSpec(current), k8sSpec(*cluster), "Master", "Workers", "Token", "NetworkName", "SSHKey")
+	return updateChange(key, nodeContracts, fields, cluster), nil
+}
+
+func (p *planner) planGatewayName(ctx context.Context, gw *workloads.GatewayNameProxy) (*PlanChange, error) {
+	metadata, err := gw.GenerateMetadata()
+	if err != nil {
+		return nil, err
+	}
+
+	key, nodeContracts, err := p.track(metadata)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodeContracts) == 0 {
+		return newPlanChange(PlanCreate, key, nil, nil, gw), nil
+	}
+
+	nodeID, contractID := firstContract(nodeContracts)
+	current, err := p.tfPluginClient.State.LoadGatewayNameFromGrid(ctx, nodeID, gw.Name, gw.Name)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not load deployed gateway name")
+	}
+
+	gw.NodeDeploymentID = nodeContracts
+	gw.ContractID = contractID
+	gw.NameContractID = current.NameContractID
+	if gw.NodeID == nodeID {
+		gw.FQDN = current.FQDN
+	}
+
+	fields := changedFields(current, *gw, "NodeID", "Backends", "TLSPassthrough", "Network", "Description")
+	return updateChange(key, nodeContracts, fields, gw), nil
+}
+
+func (p *planner) planGatewayFQDN(ctx context.Context, gw *workloads.GatewayFQDNProxy) (*PlanChange, error) {
+	metadata, err := gw.GenerateMetadata()
+	if err != nil {
+		return nil, err
+	}
+
+	key, nodeContracts, err := p.track(metadata)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodeContracts) == 0 {
+		return newPlanChange(PlanCreate, key, nil, nil, gw), nil
+	}
+
+	nodeID, contractID := firstContract(nodeContracts)
+	current, err := p.tfPluginClient.State.LoadGatewayFQDNFromGrid(ctx, nodeID, gw.Name, gw.Name)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not load deployed gateway fqdn")
+	}
+
+	gw.NodeDeploymentID = nodeContracts
+	gw.ContractID = contractID
+
+	fields := changedFields(current, *gw, "NodeID", "Backends", "FQDN", "TLSPassthrough", "Network", "Description")
+	return updateChange(key, nodeContracts, fields, gw), nil
+}
+
+// cancellations returns the deployed objects of the desired projects that are not desired anymore
+func (p *planner) cancellations() []PlanChange {
+	var changes []PlanChange
+	for i := len(deployOrder) - 1; i >= 0; i-- {
+		var typeChanges []PlanChange
+		for key, nodeContracts := range p.deployed {
+			if key.deploymentType != deployOrder[i] || !p.projects[key.projectName] || p.desired[key] {
+				continue
+			}
+
+			change := newPlanChange(PlanCancel, key, nodeContracts, nil, nil)
+			if key.deploymentType == workloads.GatewayNameType {
+				change.NameContractID = p.nameContractID(key.name)
+			}
+			typeChanges = append(typeChanges, *change)
+		}
+
+		slices.SortFunc(typeChanges, func(a, b PlanChange) int {
+			return strings.Compare(a.ProjectName+"/"+a.Name, b.ProjectName+"/"+b.Name)
+		})
+		changes = append(changes, typeChanges...)
+	}
+	return changes
+}
+
+func (p *planner) nameContractID(name string) uint64 {
+	for _, contract := range p.nameContracts {
+		if contract.Name != name {
+			continue
+		}
+		if contractID, err := strconv.ParseUint(contract.ContractID, 10, 64); err == nil {
+			return contractID
+		}
+	}
+	return 0
+}
+
+func newPlanChange(action PlanAction, key objectKey, nodeContracts map[uint32]uint64, fields []string, object interface{}) *PlanChange {
+	return &PlanChange{
+		Action:        action,
+		Type:          key.deploymentType,
+		Name:          key.name,
+		ProjectName:   key.projectName,
+		Fields:        fields,
+		NodeContracts: nodeContracts,
+		object:        object,
+	}
+}
+
+// firstContract returns the node contract of objects deployed on a single node
+func firstContract(nodeContracts map[uint32]uint64) (nodeID uint32, contractID uint64) {
+	for nodeID, contractID = range nodeContracts {
+		break
+	}
+	return
+}
+
+// updateChange returns an update change if any field changed
+func updateChange(key objectKey, nodeContracts map[uint32]uint64, fields []string, object interface{}) *PlanChange {
+	if len(fields) == 0 {
+		return nil
+	}
+	return newPlanChange(PlanUpdate, key, nodeContracts, fields, object)
+}
+
+// fillVM copies the computed fields of a deployed vm to a desired one
+func fillVM(vm *workloads.VM, current workloads.VM) {
+	vm.ComputedIP = current.ComputedIP
+	vm.ComputedIP6 = current.ComputedIP6
+	vm.PlanetaryIP = current.PlanetaryIP
+	vm.MyceliumIP = current.MyceliumIP
+	vm.ConsoleURL = current.ConsoleURL
+	if vm.IP == "" {
+		vm.IP = current.IP
+	}
+	if vm.MyceliumIPSeed == nil {
+		vm.MyceliumIPSeed = current.MyceliumIPSeed
+	}
+}
+
+// fillZDB copies the computed fields of a deployed zdb to a desired one
+func fillZDB(zdb *workloads.ZDB, current workloads.ZDB) {
+	zdb.IPs = current.IPs
+	zdb.Port = current.Port
+	zdb.Namespace = current.Namespace
+	if zdb.Mode == "" {
+		zdb.Mode = current.Mode
+	}
+}
+
+// fillK8sNode copies the computed fields of a deployed kubernetes node to a desired one
+func fillK8sNode(node *workloads.K8sNode, current workloads.K8sNode) {
+	node.ComputedIP = current.ComputedIP
+	node.ComputedIP6 = current.ComputedIP6
+	node.PlanetaryIP = current.PlanetaryIP
+	node.MyceliumIP = current.MyceliumIP
+	node.ConsoleURL = current.ConsoleURL
+	if node.IP == "" {
+		node.IP = current.IP
+	}
+	if node.MyceliumIPSeed == nil {
+		node.MyceliumIPSeed = current.MyceliumIPSeed
+	}
+	if node.Token == "" {
+		node.Token = current.Token
+	}
+	if node.SSHKey == "" {
+		node.SSHKey = current.SSHKey
+	}
+	if node.NetworkName == "" {
+		node.NetworkName = current.NetworkName
+	}
+}
+
+// deploymentSpec returns a copy of the deployment that can be compared regardless of workloads order
+func deploymentSpec(dl workloads.Deployment) workloads.Deployment {
+	dl.Disks = slices.Clone(dl.Disks)
+	slices.SortFunc(dl.Disks, func(a, b workloads.Disk) int { return strings.Compare(a.Name, b.Name) })
+	dl.Zdbs = slices.Clone(dl.Zdbs)
+	slices.SortFunc(dl.Zdbs, func(a, b workloads.ZDB) int { return strings.Compare(a.Name, b.Name) })
+	dl.QSFS = slices.Clone(dl.QSFS)
+	slices.SortFunc(dl.QSFS, func(a, b workloads.QSFS) int { return strings.Compare(a.Name, b.Name) })
+
+	dl.ReservedIPs = slices.Clone(dl.ReservedIPs)
+	slices.SortFunc(dl.ReservedIPs, func(a, b workloads.ReservedIP) int { return strings.Compare(a.Name, b.Name) })
+
+	dl.Vms = slices.Clone(dl.Vms)
+	for i := range dl.Vms {
+		// the checksum is only used to validate the flist and is not part of the vm workload
+		dl.Vms[i].FlistChecksum = ""
+		// a vm pinned to the ip it already has only differs from the deployed vm if it uses a reserved ip
+		vm := dl.Vms[i]
+		reserved := slices.ContainsFunc(dl.ReservedIPs, func(ip workloads.ReservedIP) bool { return workloads.SameIPAddress(ip.IP, vm.PublicIPAddress) })
+		if !reserved && workloads.SameIPAddress(vm.PublicIPAddress, vm.ComputedIP) {
+			dl.Vms[i].PublicIPAddress = ""
+		}
+	}
+	slices.SortFunc(dl.Vms, func(a, b workloads.VM) int { return strings.Compare(a.Name, b.Name) })
+	return dl
+}
+
+// k8sSpec returns a copy of the cluster that can be compared regardless of workers order
+func k8sSpec(cluster workloads.K8sCluster) workloads.K8sCluster {
+	master := *cluster.Master
+	master.FlistChecksum = ""
+	cluster.Master = &master
+
+	cluster.Workers = slices.Clone(cluster.Workers)
+	for i := range cluster.Workers {
+		cluster.Workers[i].FlistChecksum = ""
+	}
+	slices.SortFunc(cluster.Workers, func(a, b workloads.K8sNode) int { return strings.Compare(a.Name, b.Name) })
+	return cluster
+}
+
+// changedFields returns the names of the given fields that differ between two objects of the same type
+func changedFields(current, desired interface{}, fields ...string) []string {
+	currentValue := reflect.Indirect(reflect.ValueOf(current))
+	desiredValue := reflect.Indirect(reflect.ValueOf(desired))
+
+	var changed []string
+	for _, field := range fields {
+		if !specEqual(currentValue.FieldByName(field), desiredValue.FieldByName(field)) {
+			changed = append(changed, field)
+		}
+	}
+	return changed
+}
+
+// specEqual compares two values deeply, nil and empty slices and maps are considered equal
+func specEqual(a, b reflect.Value) bool {
+	if a.Kind() != b.Kind() {
+		return false
+	}
+
+	switch a.Kind() {
+	case reflect.Slice, reflect.Map:
+		if a.Len() != b.Len() {
+			return false
+		}
+		if a.Kind() == reflect.Slice {
+			for i := 0; i < a.Len(); i++ {
+				if !specEqual(a.Index(i), b.Index(i)) {
+					return false
+				}
+			}
+			return true
+		}
+		for _, key := range a.MapKeys() {
+			value := b.MapIndex(key)
+			if !value.IsValid() || !specEqual(a.MapIndex(key), value) {
+				return false
+			}
+		}
+		return true
+	case reflect.Ptr, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		return specEqual(a.Elem(), b.Elem())
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			// unexported fields are internal to the type and can't be compared
+			if !a.Type().Field(i).IsExported() {
+				continue
+			}
+			if !specEqual(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Invalid:
+		return true
+	default:
+		return reflect.DeepEqual(a.Interface(), b.Interface())
+	}
+}
@@ -0,0 +1,46 @@
+package deployer
+
+import (
+	"time"
+
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+)
+
+// ProgressEvent is a state transition of a workload while waiting for its deployment
+type ProgressEvent struct {
+	// Time is when the node reported the new state
+	Time       time.Time
+	NodeID     uint32
+	ContractID uint64
+	Workload   string
+	Type       gridtypes.WorkloadType
+	State      gridtypes.ResultState
+	// Error is the workload error message in the error, paused and deleted states
+	Error string
+}
+
+// ProgressHandler is called with each workload state transition.
+// it can be called concurrently when deployments are deployed in batches.
+type ProgressHandler func(event ProgressEvent)
+
+// emitProgress calls the progress handler with the workload new state if the handler is set
+func (d *Deployer) emitProgress(nodeID uint32, contractID uint64, wl gridtypes.Workload) {
+	if d.progressHandler == nil {
+		return
+	}
+
+	eventTime := time.Now()
+	if wl.Result.Created != 0 {
+		eventTime = wl.Result.Created.Time()
+	}
+
+	d.progressHandler(ProgressEvent{
+		Time:       eventTime,
+		NodeID:     nodeID,
+		ContractID: contractID,
+		Workload:   wl.Name.String(),
+		Type:       wl.Type,
+		State:      wl.Result.State,
+		Error:      wl.Result.Error,
+	})
+}
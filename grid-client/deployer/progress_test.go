@@ -0,0 +1,46 @@
+package deployer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/mocks"
+	client "github.com/threefoldtech/tfgrid-sdk-go/grid-client/node"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
+)
+
+func TestWaitProgress(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cl := mocks.NewRMBMockClient(ctrl)
+
+	var events []ProgressEvent
+	d := Deployer{progressHandler: func(event ProgressEvent) {
+		events = append(events, event)
+	}}
+
+	created := gridtypes.Timestamp(time.Now().Unix())
+	cl.EXPECT().
+		Call(gomock.Any(), twinID, "zos.deployment.changes", gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, twin uint32, fn string, data, result interface{}) error {
+			*result.(*[]gridtypes.Workload) = []gridtypes.Workload{
+				{Name: "disk", Type: zos.ZMountType, Result: gridtypes.Result{State: gridtypes.StateOk, Created: created}},
+				{Name: "vm", Type: zos.ZMachineType, Result: gridtypes.Result{State: gridtypes.StateError, Error: "no flist", Created: created}},
+				{Name: "old", Type: zos.ZMachineType, Version: 1, Result: gridtypes.Result{State: gridtypes.StateOk}},
+			}
+			return nil
+		})
+
+	err := d.WaitOnNode(context.Background(), nodeID, client.NewNodeClient(twinID, cl, 10), contractID, map[string]uint32{"disk": 0, "vm": 0, "old": 0})
+	assert.ErrorContains(t, err, "no flist")
+
+	assert.Equal(t, []ProgressEvent{
+		{Time: created.Time(), NodeID: nodeID, ContractID: contractID, Workload: "disk", Type: zos.ZMountType, State: gridtypes.StateOk},
+		{Time: created.Time(), NodeID: nodeID, ContractID: contractID, Workload: "vm", Type: zos.ZMachineType, State: gridtypes.StateError, Error: "no flist"},
+	}, events)
+}
@@ -0,0 +1,139 @@
+package deployer
+
+import (
+	"context"
+	"slices"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
+)
+
+// validatePinnedIPs checks that the pinned ips of a deployment can be assigned to its contract.
+// node contracts only request a number of public ips and the farm picks which of its free ips they get,
+// so the pinned ips of a new contract must be the only free ips of the node farm,
+// and the pinned ips of an existing contract must be already held by the contract.
+// only reserved ips held by the contract keep their addresses when their vms are recreated.
+func (d *DeploymentDeployer) validatePinnedIPs(ctx context.Context, dl *workloads.Deployment) error {
+	pinned := dl.PinnedIPs()
+	if len(pinned) == 0 {
+		return nil
+	}
+
+	node, err := d.tfPluginClient.GridProxyClient.Node(ctx, dl.NodeID)
+	if err != nil {
+		return errors.Wrapf(err, "could not get node %d data from the grid proxy", dl.NodeID)
+	}
+	farmID := uint64(node.FarmID)
+	farms, _, err := d.tfPluginClient.GridProxyClient.Farms(ctx, proxyTypes.FarmFilter{FarmID: &farmID}, proxyTypes.Limit{Page: 1, Size: 1})
+	if err != nil {
+		return errors.Wrapf(err, "could not get farm %d data from the grid proxy", farmID)
+	}
+	if len(farms) == 0 {
+		return errors.Errorf("farm %d not returned from the proxy", farmID)
+	}
+
+	var free []string
+	for _, farmIP := range farms[0].PublicIps {
+		if farmIP.ContractID == 0 {
+			free = append(free, farmIP.IP)
+		}
+	}
+
+	for _, ip := range pinned {
+		idx := slices.IndexFunc(farms[0].PublicIps, func(farmIP proxyTypes.PublicIP) bool {
+			return workloads.SameIPAddress(farmIP.IP, ip)
+		})
+		if idx == -1 {
+			return errors.Errorf("public ip %s is not an ip of farm %d of node %d", ip, farmID, dl.NodeID)
+		}
+
+		contractID := uint64(farms[0].PublicIps[idx].ContractID)
+		switch {
+		case dl.ContractID != 0 && contractID != dl.ContractID:
+			return errors.Errorf("public ip %s is not held by contract %d, zos can't add specific public ips to an existing contract", ip, dl.ContractID)
+		case dl.ContractID == 0 && contractID != 0:
+			return errors.Errorf("public ip %s is used by contract %d", ip, contractID)
+		}
+	}
+
+	if dl.ContractID == 0 {
+		for _, ip := range free {
+			if !slices.ContainsFunc(pinned, func(p string) bool { return workloads.SameIPAddress(p, ip) }) {
+				return errors.Errorf("farm %d assigns its free public ips to new contracts in any order, pinned ips %v can't be requested while ip %s is free too", farmID, pinned, ip)
+			}
+		}
+	}
+	return nil
+}
+
+// syncPublicIPs sets the reserved ips of a deployed deployment and checks that its pinned ips are the assigned ones.
+// the farm assigns the ips of new contracts, so a new contract is canceled if it didn't get the pinned ips.
+func (d *DeploymentDeployer) syncPublicIPs(ctx context.Context, dl *workloads.Deployment, newContract bool) error {
+	pinnedVMs := slices.ContainsFunc(dl.Vms, func(vm workloads.VM) bool { return vm.PublicIPAddress != "" })
+	if d.tfPluginClient.DryRunReport != nil || dl.ContractID == 0 || (len(dl.ReservedIPs) == 0 && !pinnedVMs) {
+		return nil
+	}
+
+	nodeClient, err := d.tfPluginClient.NcPool.GetNodeClient(d.tfPluginClient.SubstrateConn, dl.NodeID)
+	if err != nil {
+		return errors.Wrapf(err, "could not get node %d client", dl.NodeID)
+	}
+	gridDl, err := nodeClient.DeploymentGet(ctx, dl.ContractID)
+	if err != nil {
+		return errors.Wrapf(err, "could not get deployment %d", dl.ContractID)
+	}
+	reserved, err := workloads.ReservedIPsFromZosDeployment(&gridDl)
+	if err != nil {
+		return err
+	}
+
+	var errs error
+	assigned := make([]string, len(dl.ReservedIPs))
+	for i, ip := range dl.ReservedIPs {
+		idx := slices.IndexFunc(reserved, func(r workloads.ReservedIP) bool { return r.Name == ip.Name })
+		if idx != -1 {
+			assigned[i] = reserved[idx].IP
+		}
+		if ip.IP != "" && !workloads.SameIPAddress(ip.IP, assigned[i]) {
+			errs = multierror.Append(errs, errors.Errorf("reserved ip %s got public ip %q instead of %s", ip.Name, assigned[i], ip.IP))
+		}
+	}
+
+	for _, wl := range gridDl.Workloads {
+		if wl.Type != zos.ZMachineType {
+			continue
+		}
+		idx := slices.IndexFunc(dl.Vms, func(vm workloads.VM) bool { return vm.Name == wl.Name.String() })
+		if idx == -1 || dl.Vms[idx].PublicIPAddress == "" {
+			continue
+		}
+		vm, err := workloads.NewVMFromWorkload(&wl, &gridDl)
+		if err != nil {
+			return errors.Wrapf(err, "could not get vm %s", wl.Name)
+		}
+		if !workloads.SameIPAddress(dl.Vms[idx].PublicIPAddress, vm.ComputedIP) {
+			errs = multierror.Append(errs, errors.Errorf("vm %s got public ip %q instead of %s", vm.Name, vm.ComputedIP, dl.Vms[idx].PublicIPAddress))
+		}
+	}
+
+	if errs == nil {
+		for i := range dl.ReservedIPs {
+			dl.ReservedIPs[i].IP = assigned[i]
+		}
+		return nil
+	}
+
+	if newContract {
+		if err := d.deployer.Cancel(ctx, dl.ContractID); err != nil {
+			errs = multierror.Append(errs, errors.Wrapf(err, "could not cancel contract %d", dl.ContractID))
+			return errors.Wrap(errs, "pinned public ips are not assigned")
+		}
+		d.tfPluginClient.State.RemoveContractIDs(dl.NodeID, dl.ContractID)
+		delete(dl.NodeDeploymentID, dl.NodeID)
+		dl.ContractID = 0
+	}
+	return errors.Wrap(errs, "pinned public ips are not assigned, the farm assigns its free ips to new contracts")
+}
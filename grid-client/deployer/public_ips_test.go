@@ -0,0 +1,138 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/fakegrid"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+)
+
+func TestFakeGridPublicIPPinning(t *testing.T) {
+	tfPluginClient, grid := newFakeGridClient(t)
+	ctx := context.Background()
+
+	require.NoError(t, grid.AddFarm(fakegrid.Farm{
+		FarmID: 2,
+		PublicIPs: []fakegrid.PublicIP{
+			{IP: "185.206.123.40/24", Gateway: "185.206.123.1"},
+			{IP: "185.206.123.41/24", Gateway: "185.206.123.1"},
+			{IP: "185.206.123.42/24", Gateway: "185.206.123.1"},
+		},
+	}))
+	capacity := gridtypes.Capacity{CRU: 8, MRU: 16 * gridtypes.Gigabyte, SRU: 512 * gridtypes.Gigabyte, HRU: 1024 * gridtypes.Gigabyte}
+	require.NoError(t, grid.AddNode(fakegrid.Node{NodeID: 13, FarmID: 2, TotalResources: capacity}))
+
+	network := workloads.ZNet{
+		Name:    "ipnet",
+		Nodes:   []uint32{13},
+		IPRange: gridtypes.NewIPNet(net.IPNet{IP: net.IPv4(10, 20, 0, 0), Mask: net.CIDRMask(16, 32)}),
+	}
+	require.NoError(t, tfPluginClient.NetworkDeployer.Deploy(ctx, &network))
+
+	farmIPContracts := func() map[string]int {
+		farmID := uint64(2)
+		farms, _, err := tfPluginClient.GridProxyClient.Farms(ctx, types.FarmFilter{FarmID: &farmID}, types.Limit{})
+		require.NoError(t, err)
+		contracts := make(map[string]int)
+		for _, ip := range farms[0].PublicIps {
+			contracts[ip.IP] = ip.ContractID
+		}
+		return contracts
+	}
+	vm := workloads.VM{Name: "web", NetworkName: network.Name, CPU: 1, Memory: 1024, PublicIP: true, Flist: grid.FlistURL("base")}
+
+	// reserve an ip ahead of time
+	dl := workloads.NewDeployment("web", 13, "", nil, network.Name, nil, nil, nil, nil)
+	dl.ReservedIPs = []workloads.ReservedIP{{Name: "webip4"}}
+	require.NoError(t, tfPluginClient.DeploymentDeployer.Deploy(ctx, &dl))
+	assert.Equal(t, "185.206.123.40/24", dl.ReservedIPs[0].IP)
+	assert.Equal(t, int(dl.ContractID), farmIPContracts()["185.206.123.40/24"])
+	contractID := dl.ContractID
+
+	t.Run("vm uses the reserved ip", func(t *testing.T) {
+		pinned := vm
+		pinned.PublicIPAddress = "185.206.123.40"
+		dl.Vms = []workloads.VM{pinned}
+		require.NoError(t, tfPluginClient.DeploymentDeployer.Deploy(ctx, &dl))
+		assert.Equal(t, contractID, dl.ContractID)
+
+		loaded, err := tfPluginClient.State.LoadDeploymentFromGrid(ctx, 13, dl.Name)
+		require.NoError(t, err)
+		assert.Equal(t, []workloads.ReservedIP{{Name: "webip4", IP: "185.206.123.40/24"}}, loaded.ReservedIPs)
+		require.Len(t, loaded.Vms, 1)
+		assert.Equal(t, "185.206.123.40/24", loaded.Vms[0].ComputedIP)
+		assert.Equal(t, "185.206.123.40/24", loaded.Vms[0].PublicIPAddress)
+
+		// removing the vm keeps the reserved ip
+		dl.Vms = nil
+		require.NoError(t, tfPluginClient.DeploymentDeployer.Deploy(ctx, &dl))
+		assert.Equal(t, int(contractID), farmIPContracts()["185.206.123.40/24"])
+	})
+
+	t.Run("invalid pinned ips", func(t *testing.T) {
+		other := vm
+		other.PublicIPAddress = "185.206.122.33/24"
+		otherDl := workloads.NewDeployment("other", 13, "", nil, network.Name, nil, nil, []workloads.VM{other}, nil)
+		assert.ErrorContains(t, tfPluginClient.DeploymentDeployer.Deploy(ctx, &otherDl), "not an ip of farm 2")
+
+		otherDl.Vms[0].PublicIPAddress = "185.206.123.40/24"
+		assert.ErrorContains(t, tfPluginClient.DeploymentDeployer.Deploy(ctx, &otherDl), fmt.Sprintf("used by contract %d", contractID))
+		assert.Zero(t, otherDl.ContractID)
+	})
+
+	t.Run("batch errors of each deployment", func(t *testing.T) {
+		first := vm
+		first.PublicIPAddress = "185.206.122.33/24"
+		firstDl := workloads.NewDeployment("first", 13, "", nil, network.Name, nil, nil, []workloads.VM{first}, nil)
+		second := vm
+		second.PublicIPAddress = "185.206.123.40/24"
+		secondDl := workloads.NewDeployment("second", 13, "", nil, network.Name, nil, nil, []workloads.VM{second}, nil)
+
+		err := tfPluginClient.DeploymentDeployer.BatchDeploy(ctx, []*workloads.Deployment{&firstDl, &secondDl})
+		assert.ErrorContains(t, err, "invalid deployment first")
+		assert.ErrorContains(t, err, "invalid deployment second")
+		assert.Zero(t, firstDl.ContractID)
+		assert.Zero(t, secondDl.ContractID)
+	})
+
+	t.Run("new contract can't choose its ip", func(t *testing.T) {
+		contracts := grid.ActiveContracts()
+
+		other := vm
+		other.PublicIPAddress = "185.206.123.42/24"
+		otherDl := workloads.NewDeployment("other", 13, "", nil, network.Name, nil, nil, []workloads.VM{other}, nil)
+		err := tfPluginClient.DeploymentDeployer.Deploy(ctx, &otherDl)
+		assert.ErrorContains(t, err, "while ip 185.206.123.41/24 is free too")
+		assert.Zero(t, otherDl.ContractID)
+		assert.Equal(t, contracts, grid.ActiveContracts())
+	})
+
+	filler := workloads.NewDeployment("filler", 13, "", nil, network.Name, nil, nil, []workloads.VM{{
+		Name: "filler", NetworkName: network.Name, CPU: 1, Memory: 1024, PublicIP: true, Flist: grid.FlistURL("base"),
+	}}, nil)
+	require.NoError(t, tfPluginClient.DeploymentDeployer.Deploy(ctx, &filler))
+	assert.Equal(t, int(filler.ContractID), farmIPContracts()["185.206.123.41/24"])
+
+	t.Run("existing contract can't add a free ip", func(t *testing.T) {
+		pinned := vm
+		pinned.PublicIPAddress = "185.206.123.42/24"
+		dl.Vms = []workloads.VM{pinned}
+		assert.ErrorContains(t, tfPluginClient.DeploymentDeployer.Deploy(ctx, &dl), fmt.Sprintf("not held by contract %d", contractID))
+		dl.Vms = nil
+	})
+
+	t.Run("only free ip", func(t *testing.T) {
+		other := vm
+		other.PublicIPAddress = "185.206.123.42/24"
+		otherDl := workloads.NewDeployment("other", 13, "", nil, network.Name, nil, nil, []workloads.VM{other}, nil)
+		require.NoError(t, tfPluginClient.DeploymentDeployer.Deploy(ctx, &otherDl))
+		assert.Equal(t, int(otherDl.ContractID), farmIPContracts()["185.206.123.42/24"])
+	})
+}
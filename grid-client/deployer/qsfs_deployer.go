@@ -0,0 +1,312 @@
+package deployer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
+)
+
+const (
+	defaultQSFSMetaZDBs      = 4
+	qsfsMetaZDBSize          = 1
+	qsfsMaxZDBDataDirSize    = 512
+	qsfsEncryptionAlgorithm  = "AES"
+	qsfsCompressionAlgorithm = "snappy"
+)
+
+// QSFSCluster is a qsfs mounted in a vm, its data and metadata are stored on zdbs deployed on the nodes picked by the placement constraints
+type QSFSCluster struct {
+	Name string `json:"name"`
+	// NodeID is the node of the vm and the qsfs
+	NodeID uint32 `json:"node_id"`
+	// VM is the vm the qsfs is mounted in, its network must be deployed on the node
+	VM         workloads.VM `json:"vm"`
+	MountPoint string       `json:"mount_point"`
+
+	// Capacity is the qsfs data capacity in GB
+	Capacity int `json:"capacity"`
+	// ExpectedShards is the number of data zdbs, the data is split on all of them
+	ExpectedShards uint32 `json:"expected_shards"`
+	// MinimalShards is the number of data zdbs needed to recover the data
+	MinimalShards uint32 `json:"minimal_shards"`
+	// MetaZDBs is the number of metadata zdbs, it defaults to 4
+	MetaZDBs int `json:"meta_zdbs"`
+	// Cache is the qsfs cache size in MB
+	Cache int `json:"cache"`
+	// EncryptionKey is the hex encoded key of the data and metadata, a random key is generated if it is empty
+	EncryptionKey string `json:"encryption_key"`
+	// Password is the zdbs password, a random password is generated if it is empty
+	Password  string               `json:"password"`
+	Placement PlacementConstraints `json:"-"`
+
+	// computed
+
+	// DataBackends are the deployments of the data zdbs, each deployment has a single zdb with the deployment name
+	DataBackends []workloads.Deployment `json:"data_backends"`
+	// MetaBackends are the deployments of the metadata zdbs
+	MetaBackends []workloads.Deployment `json:"meta_backends"`
+	// Deployment is the deployment of the vm and the qsfs
+	Deployment workloads.Deployment `json:"deployment"`
+}
+
+// QSFSDeployer deploys qsfs clusters
+type QSFSDeployer struct {
+	tfPluginClient *TFPluginClient
+}
+
+// NewQSFSDeployer generates a new qsfs deployer
+func NewQSFSDeployer(tfPluginClient *TFPluginClient) QSFSDeployer {
+	return QSFSDeployer{tfPluginClient: tfPluginClient}
+}
+
+// Validate validates the qsfs cluster and sets its defaults
+func (d *QSFSDeployer) Validate(q *QSFSCluster) error {
+	if q.Name == "" {
+		return errors.New("qsfs name is required")
+	}
+	if q.VM.Name == "" {
+		return errors.New("qsfs vm name is required")
+	}
+	if q.MountPoint == "" {
+		return errors.New("qsfs mount point is required")
+	}
+	if q.Capacity <= 0 {
+		return errors.Errorf("invalid qsfs capacity %d", q.Capacity)
+	}
+	if q.Cache <= 0 {
+		return errors.Errorf("invalid qsfs cache %d", q.Cache)
+	}
+	if q.MinimalShards == 0 || q.ExpectedShards < q.MinimalShards {
+		return errors.Errorf("expected shards (%d) must be greater than or equal to minimal shards (%d) and minimal shards must be positive", q.ExpectedShards, q.MinimalShards)
+	}
+
+	if q.MetaZDBs == 0 {
+		q.MetaZDBs = defaultQSFSMetaZDBs
+	}
+	if q.EncryptionKey == "" {
+		key, err := randomHex(32)
+		if err != nil {
+			return errors.Wrap(err, "failed to generate qsfs encryption key")
+		}
+		q.EncryptionKey = key
+	}
+	if q.Password == "" {
+		password, err := randomHex(16)
+		if err != nil {
+			return errors.Wrap(err, "failed to generate zdbs password")
+		}
+		q.Password = password
+	}
+	return nil
+}
+
+// Deploy deploys the qsfs zdbs on the nodes picked by the placement constraints, then deploys the qsfs and mounts it in the vm.
+// the zdbs are canceled if the qsfs deployment fails.
+func (d *QSFSDeployer) Deploy(ctx context.Context, q *QSFSCluster) error {
+	if q.Deployment.ContractID != 0 {
+		return errors.Errorf("qsfs %s is already deployed", q.Name)
+	}
+	if err := d.Validate(q); err != nil {
+		return err
+	}
+
+	// each data zdb holds a shard, and any minimal shards of them hold the whole data
+	dataSize := (q.Capacity + int(q.MinimalShards) - 1) / int(q.MinimalShards)
+
+	var dls []*workloads.Deployment
+	for i := 0; i < int(q.ExpectedShards); i++ {
+		dls = append(dls, q.backendDeployment(fmt.Sprintf("%s_data%d", q.Name, i), dataSize, zos.ZDBModeSeq))
+	}
+	for i := 0; i < q.MetaZDBs; i++ {
+		dls = append(dls, q.backendDeployment(fmt.Sprintf("%s_meta%d", q.Name, i), qsfsMetaZDBSize, zos.ZDBModeUser))
+	}
+
+	if err := d.tfPluginClient.DeploymentDeployer.ScheduleAndDeploy(ctx, nil, dls, q.Placement); err != nil {
+		return d.cancelBackends(ctx, dls, errors.Wrapf(err, "failed to deploy qsfs %s zdbs", q.Name))
+	}
+
+	backends := make([]workloads.Backend, 0, len(dls))
+	for _, dl := range dls {
+		backend, err := d.loadBackend(ctx, dl)
+		if err != nil {
+			return d.cancelBackends(ctx, dls, err)
+		}
+		backends = append(backends, backend)
+	}
+
+	q.Deployment = q.deployment(backends[:q.ExpectedShards], backends[q.ExpectedShards:])
+	if err := d.tfPluginClient.DeploymentDeployer.Deploy(ctx, &q.Deployment); err != nil {
+		return d.cancelBackends(ctx, dls, errors.Wrapf(err, "failed to deploy qsfs %s", q.Name))
+	}
+
+	q.DataBackends = q.DataBackends[:0]
+	q.MetaBackends = q.MetaBackends[:0]
+	for i, dl := range dls {
+		if i < int(q.ExpectedShards) {
+			q.DataBackends = append(q.DataBackends, *dl)
+			continue
+		}
+		q.MetaBackends = append(q.MetaBackends, *dl)
+	}
+	return nil
+}
+
+// ReplaceBackend replaces a data or metadata zdb by name with a new zdb on another node, the qsfs is updated to use the new zdb then the old one is canceled
+func (d *QSFSDeployer) ReplaceBackend(ctx context.Context, q *QSFSCluster, name string) error {
+	if len(q.Deployment.QSFS) != 1 || len(q.Deployment.QSFS[0].Groups) == 0 {
+		return errors.Errorf("qsfs %s is not deployed", q.Name)
+	}
+	qsfs := &q.Deployment.QSFS[0]
+
+	isBackend := func(dl workloads.Deployment) bool { return dl.Name == name }
+	backends, qsfsBackends := q.DataBackends, qsfs.Groups[0].Backends
+	idx := slices.IndexFunc(backends, isBackend)
+	if idx == -1 {
+		backends, qsfsBackends = q.MetaBackends, qsfs.Metadata.Backends
+		idx = slices.IndexFunc(backends, isBackend)
+	}
+	if idx == -1 || idx >= len(qsfsBackends) {
+		return errors.Errorf("zdb %s is not a backend of qsfs %s", name, q.Name)
+	}
+
+	old := backends[idx]
+	if len(old.Zdbs) != 1 {
+		return errors.Errorf("backend deployment %s must have a single zdb", name)
+	}
+	dl := q.backendDeployment(name, old.Zdbs[0].Size, old.Zdbs[0].Mode)
+
+	// the new zdb is never placed on the old node, nor on the other backends nodes unless allowed
+	placement := q.Placement
+	placement.Filter.Excluded = append(slices.Clone(placement.Filter.Excluded), uint64(old.NodeID))
+	if !placement.AllowSameNode {
+		for _, backend := range append(slices.Clone(q.DataBackends), q.MetaBackends...) {
+			placement.Filter.Excluded = append(placement.Filter.Excluded, uint64(backend.NodeID))
+		}
+	}
+
+	dls := []*workloads.Deployment{dl}
+	if err := d.tfPluginClient.DeploymentDeployer.ScheduleAndDeploy(ctx, nil, dls, placement); err != nil {
+		return d.cancelBackends(ctx, dls, errors.Wrapf(err, "failed to deploy zdb to replace %s", name))
+	}
+
+	backend, err := d.loadBackend(ctx, dl)
+	if err != nil {
+		return d.cancelBackends(ctx, dls, err)
+	}
+
+	oldBackend := qsfsBackends[idx]
+	qsfsBackends[idx] = backend
+	if err := d.tfPluginClient.DeploymentDeployer.Deploy(ctx, &q.Deployment); err != nil {
+		qsfsBackends[idx] = oldBackend
+		return d.cancelBackends(ctx, dls, errors.Wrapf(err, "failed to update qsfs %s backends", q.Name))
+	}
+	backends[idx] = *dl
+
+	if err := d.tfPluginClient.DeploymentDeployer.Cancel(ctx, &old); err != nil {
+		return errors.Wrapf(err, "failed to cancel replaced zdb %s, contract %d", name, old.ContractID)
+	}
+	return nil
+}
+
+// Cancel cancels the qsfs deployment and its zdbs
+func (d *QSFSDeployer) Cancel(ctx context.Context, q *QSFSCluster) error {
+	if q.Deployment.ContractID != 0 {
+		if err := d.tfPluginClient.DeploymentDeployer.Cancel(ctx, &q.Deployment); err != nil {
+			return errors.Wrapf(err, "failed to cancel qsfs %s", q.Name)
+		}
+	}
+
+	var dls []*workloads.Deployment
+	for i := range q.DataBackends {
+		dls = append(dls, &q.DataBackends[i])
+	}
+	for i := range q.MetaBackends {
+		dls = append(dls, &q.MetaBackends[i])
+	}
+	return d.cancelBackends(ctx, dls, nil)
+}
+
+// loadBackend loads the zdb of a backend deployment from the grid
+func (d *QSFSDeployer) loadBackend(ctx context.Context, dl *workloads.Deployment) (workloads.Backend, error) {
+	zdb, err := d.tfPluginClient.State.LoadZdbFromGrid(ctx, dl.NodeID, dl.Name, dl.Name)
+	if err != nil {
+		return workloads.Backend{}, errors.Wrapf(err, "failed to load zdb %s", dl.Name)
+	}
+	if len(zdb.IPs) == 0 {
+		return workloads.Backend{}, errors.Errorf("zdb %s doesn't have ips", dl.Name)
+	}
+
+	// the public ip of the zdb is listed last
+	return workloads.Backend{
+		Address:   fmt.Sprintf("[%s]:%d", zdb.IPs[len(zdb.IPs)-1], zdb.Port),
+		Namespace: zdb.Namespace,
+		Password:  zdb.Password,
+	}, nil
+}
+
+// cancelBackends cancels the deployed backends and appends the cancellation errors to err
+func (d *QSFSDeployer) cancelBackends(ctx context.Context, dls []*workloads.Deployment, err error) error {
+	for _, dl := range dls {
+		if dl.ContractID == 0 {
+			continue
+		}
+		if cerr := d.tfPluginClient.DeploymentDeployer.Cancel(ctx, dl); cerr != nil {
+			err = multierror.Append(err, errors.Wrapf(cerr, "failed to cancel zdb %s, contract %d", dl.Name, dl.ContractID))
+		}
+	}
+	return err
+}
+
+// backendDeployment generates the deployment of a single public zdb
+func (q *QSFSCluster) backendDeployment(name string, size int, mode string) *workloads.Deployment {
+	zdb := workloads.ZDB{
+		Name:     name,
+		Password: q.Password,
+		Public:   true,
+		Size:     size,
+		Mode:     mode,
+	}
+	dl := workloads.NewDeployment(name, 0, q.Name, nil, "", nil, []workloads.ZDB{zdb}, nil, nil)
+	return &dl
+}
+
+// deployment generates the deployment of the qsfs and the vm
+func (q *QSFSCluster) deployment(data, meta workloads.Backends) workloads.Deployment {
+	qsfs := workloads.QSFS{
+		Name:                 q.Name,
+		Cache:                q.Cache,
+		MinimalShards:        q.MinimalShards,
+		ExpectedShards:       q.ExpectedShards,
+		MaxZDBDataDirSize:    qsfsMaxZDBDataDirSize,
+		EncryptionAlgorithm:  qsfsEncryptionAlgorithm,
+		EncryptionKey:        q.EncryptionKey,
+		CompressionAlgorithm: qsfsCompressionAlgorithm,
+		Groups:               workloads.Groups{{Backends: data}},
+		Metadata: workloads.Metadata{
+			Type:                "zdb",
+			Prefix:              q.Name,
+			EncryptionAlgorithm: qsfsEncryptionAlgorithm,
+			EncryptionKey:       q.EncryptionKey,
+			Backends:            meta,
+		},
+	}
+
+	vm := q.VM
+	vm.Mounts = append(slices.Clone(vm.Mounts), workloads.Mount{DiskName: qsfs.Name, MountPoint: q.MountPoint})
+	return workloads.NewDeployment(q.Name, q.NodeID, q.Name, nil, vm.NetworkName, nil, nil, []workloads.VM{vm}, []workloads.QSFS{qsfs})
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
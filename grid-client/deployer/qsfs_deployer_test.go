@@ -0,0 +1,70 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+)
+
+func TestFakeGridQSFSCluster(t *testing.T) {
+	tfPluginClient, grid := newFakeGridClient(t)
+	ctx := context.Background()
+
+	network := workloads.ZNet{
+		Name:    "qsfsnet",
+		Nodes:   []uint32{11},
+		IPRange: gridtypes.NewIPNet(net.IPNet{IP: net.IPv4(10, 20, 0, 0), Mask: net.CIDRMask(16, 32)}),
+	}
+	require.NoError(t, tfPluginClient.NetworkDeployer.Deploy(ctx, &network))
+
+	qsfs := QSFSCluster{
+		Name:           "qsfs",
+		NodeID:         11,
+		VM:             workloads.VM{Name: "vm", NetworkName: network.Name, CPU: 1, Memory: 1024, Flist: grid.FlistURL("base"), Entrypoint: "/sbin/zinit init"},
+		MountPoint:     "/qsfs",
+		Capacity:       20,
+		ExpectedShards: 4,
+		MinimalShards:  2,
+		MetaZDBs:       2,
+		Cache:          1024,
+		Placement:      PlacementConstraints{AllowSameNode: true},
+	}
+	assert.Error(t, tfPluginClient.QSFSDeployer.Deploy(ctx, &QSFSCluster{Name: "invalid", VM: qsfs.VM, MountPoint: "/qsfs", Capacity: 20, ExpectedShards: 1, MinimalShards: 2, Cache: 1024}))
+
+	require.NoError(t, tfPluginClient.QSFSDeployer.Deploy(ctx, &qsfs))
+	require.Len(t, qsfs.DataBackends, 4)
+	require.Len(t, qsfs.MetaBackends, 2)
+	assert.Len(t, qsfs.EncryptionKey, 64)
+	assert.Equal(t, 10, qsfs.DataBackends[0].Zdbs[0].Size)
+
+	loaded, err := tfPluginClient.State.LoadQSFSFromGrid(ctx, 11, qsfs.Name, qsfs.Name)
+	require.NoError(t, err)
+	require.Len(t, loaded.Groups, 1)
+	assert.Len(t, loaded.Groups[0].Backends, 4)
+	assert.Len(t, loaded.Metadata.Backends, 2)
+	assert.NotEmpty(t, loaded.MetricsEndpoint)
+
+	vm, err := tfPluginClient.State.LoadVMFromGrid(ctx, 11, qsfs.VM.Name, qsfs.Name)
+	require.NoError(t, err)
+	assert.Equal(t, []workloads.Mount{{DiskName: qsfs.Name, MountPoint: "/qsfs"}}, vm.Mounts)
+
+	old := qsfs.DataBackends[0]
+	require.NoError(t, tfPluginClient.QSFSDeployer.ReplaceBackend(ctx, &qsfs, old.Name))
+	assert.NotEqual(t, old.NodeID, qsfs.DataBackends[0].NodeID)
+	assert.NotContains(t, grid.ActiveContracts(), old.ContractID)
+
+	loaded, err = tfPluginClient.State.LoadQSFSFromGrid(ctx, 11, qsfs.Name, qsfs.Name)
+	require.NoError(t, err)
+	assert.Contains(t, loaded.Groups[0].Backends[0].Namespace, fmt.Sprint(qsfs.DataBackends[0].ContractID))
+
+	assert.Error(t, tfPluginClient.QSFSDeployer.ReplaceBackend(ctx, &qsfs, "missing"))
+
+	require.NoError(t, tfPluginClient.QSFSDeployer.Cancel(ctx, &qsfs))
+	assert.Equal(t, []uint64{network.NodeDeploymentID[11]}, grid.ActiveContracts())
+}
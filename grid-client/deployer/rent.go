@@ -0,0 +1,108 @@
+package deployer
+
+import (
+	"context"
+	"slices"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+)
+
+// RentAndDeploy rents a node matching the filter that can hold the deployment, adds it to the network and deploys the deployment on it.
+// the network is deployed first if it is given. if the deployment fails, the node is removed from the network and the rent contract is canceled.
+// it returns the rent contract ID, the rent contract is recorded in the deployment metadata and canceled with the project by CancelByProjectName.
+func (t *TFPluginClient) RentAndDeploy(ctx context.Context, filter types.NodeFilter, znet *workloads.ZNet, dl *workloads.Deployment) (uint64, error) {
+	req, err := requirements(dl)
+	if err != nil {
+		return 0, errors.Wrapf(err, "could not calculate deployment %s requirements", dl.Name)
+	}
+
+	filter = nodeFilter(PlacementConstraints{Filter: filter}, req)
+	filter.Rentable = &trueVal
+	nodes, _, err := t.GridProxyClient.Nodes(ctx, filter, types.Limit{Size: 1, Page: 1})
+	if err != nil {
+		return 0, errors.Wrap(err, "could not list rentable nodes")
+	}
+	if len(nodes) == 0 {
+		return 0, errors.Errorf("could not find a rentable node for deployment %s", dl.Name)
+	}
+	nodeID := uint32(nodes[0].NodeID)
+
+	contractID, err := t.createRentContract(nodeID, dl.SolutionProvider)
+	if err != nil {
+		return 0, err
+	}
+
+	dl.NodeID = nodeID
+	dl.RentContractID = contractID
+	if err := t.deployOnRentedNode(ctx, znet, dl); err != nil {
+		dl.RentContractID = 0
+		if rerr := t.cancelRentContract(contractID); rerr != nil {
+			return 0, errors.Wrapf(err, "could not cancel rent contract %d: %s; you must cancel it manually", contractID, rerr)
+		}
+		return 0, err
+	}
+
+	return contractID, nil
+}
+
+// deployOnRentedNode deploys the network and the deployment on the rented node.
+// if the deployment fails, the network is removed from the node so the rent contract can be canceled.
+func (t *TFPluginClient) deployOnRentedNode(ctx context.Context, znet *workloads.ZNet, dl *workloads.Deployment) error {
+	if znet == nil {
+		return t.deployOnNode(ctx, dl)
+	}
+
+	if !slices.Contains(znet.Nodes, dl.NodeID) {
+		znet.Nodes = append(znet.Nodes, dl.NodeID)
+	}
+	if err := t.NetworkDeployer.Deploy(ctx, znet); err != nil {
+		return errors.Wrapf(err, "could not deploy network %s", znet.Name)
+	}
+
+	err := t.deployOnNode(ctx, dl)
+	if err == nil {
+		return nil
+	}
+
+	if len(znet.Nodes) == 1 {
+		if cerr := t.NetworkDeployer.Cancel(ctx, znet); cerr != nil {
+			return multierror.Append(err, errors.Wrapf(cerr, "could not cancel network %s", znet.Name))
+		}
+		return err
+	}
+	if rerr := t.NetworkDeployer.RemoveNodes(ctx, znet, []uint32{dl.NodeID}); rerr != nil {
+		return multierror.Append(err, errors.Wrapf(rerr, "could not remove node %d from network %s", dl.NodeID, znet.Name))
+	}
+	return err
+}
+
+func (t *TFPluginClient) deployOnNode(ctx context.Context, dl *workloads.Deployment) error {
+	if err := t.DeploymentDeployer.Deploy(ctx, dl); err != nil {
+		return errors.Wrapf(err, "could not deploy %s on rented node %d", dl.Name, dl.NodeID)
+	}
+	return nil
+}
+
+func (t *TFPluginClient) createRentContract(nodeID uint32, solutionProviderID *uint64) (uint64, error) {
+	if t.DryRunReport != nil {
+		t.DryRunReport.addContract(DryRunContract{Action: PlanCreate, Type: RentContractType, NodeID: nodeID, SolutionProviderID: solutionProviderID})
+		return 0, nil
+	}
+
+	contractID, err := t.SubstrateConn.CreateRentContract(t.Identity, nodeID, solutionProviderID)
+	if err != nil {
+		return 0, errors.Wrapf(err, "could not rent node %d", nodeID)
+	}
+	return contractID, nil
+}
+
+func (t *TFPluginClient) cancelRentContract(contractID uint64) error {
+	if t.DryRunReport != nil {
+		t.DryRunReport.addContract(DryRunContract{Action: PlanCancel, Type: RentContractType, ContractID: contractID})
+		return nil
+	}
+	return t.SubstrateConn.CancelRentContract(t.Identity, contractID)
+}
@@ -0,0 +1,113 @@
+package deployer
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/fakegrid"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
+)
+
+func TestFakeGridRentAndDeploy(t *testing.T) {
+	tfPluginClient, grid := newFakeGridClient(t)
+	ctx := context.Background()
+
+	require.NoError(t, grid.AddFarm(fakegrid.Farm{FarmID: 2, Dedicated: true}))
+	require.NoError(t, grid.AddNode(fakegrid.Node{
+		NodeID:         21,
+		FarmID:         2,
+		TotalResources: gridtypes.Capacity{CRU: 8, MRU: 16 * gridtypes.Gigabyte, SRU: 512 * gridtypes.Gigabyte},
+	}))
+
+	network := workloads.ZNet{
+		Name:         "rentnet",
+		IPRange:      gridtypes.NewIPNet(net.IPNet{IP: net.IPv4(10, 30, 0, 0), Mask: net.CIDRMask(16, 32)}),
+		SolutionType: "rented",
+	}
+	dl := workloads.NewDeployment("vm", 0, "rented", nil, network.Name, nil, nil, []workloads.VM{{
+		Name: "vm", NetworkName: network.Name, CPU: 1, Memory: 1024, Flist: grid.FlistURL("base"),
+	}}, nil)
+
+	// dedicated nodes can't be used without renting them
+	assert.Error(t, tfPluginClient.NetworkDeployer.Deploy(ctx, &workloads.ZNet{Name: "net", Nodes: []uint32{21}, IPRange: network.IPRange}))
+
+	trueVal := true
+	rentContractID, err := tfPluginClient.RentAndDeploy(ctx, types.NodeFilter{InDedicatedFarm: &trueVal}, &network, &dl)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(21), dl.NodeID)
+	assert.Equal(t, []uint32{21}, network.Nodes)
+
+	id, err := tfPluginClient.SubstrateConn.GetNodeRentContract(21)
+	require.NoError(t, err)
+	assert.Equal(t, rentContractID, id)
+
+	node, err := tfPluginClient.GridProxyClient.Node(ctx, 21)
+	require.NoError(t, err)
+	assert.True(t, node.Rented)
+	assert.Equal(t, uint(tfPluginClient.TwinID), node.RentedByTwinID)
+
+	// the node has active contracts
+	assert.Error(t, tfPluginClient.SubstrateConn.CancelRentContract(tfPluginClient.Identity, rentContractID))
+
+	require.NoError(t, tfPluginClient.CancelByProjectName("rented"))
+	assert.Empty(t, grid.ActiveContracts())
+
+	_, err = tfPluginClient.SubstrateConn.GetNodeRentContract(21)
+	assert.ErrorIs(t, err, substrate.ErrNotFound)
+}
+
+func TestFakeGridRentAndDeployFailure(t *testing.T) {
+	tfPluginClient, grid := newFakeGridClient(t)
+	ctx := context.Background()
+
+	require.NoError(t, grid.AddFarm(fakegrid.Farm{FarmID: 2, Dedicated: true}))
+	capacity := gridtypes.Capacity{CRU: 8, MRU: 16 * gridtypes.Gigabyte, SRU: 512 * gridtypes.Gigabyte}
+	require.NoError(t, grid.AddNode(fakegrid.Node{NodeID: 21, FarmID: 2, TotalResources: capacity}))
+	require.NoError(t, grid.AddNode(fakegrid.Node{NodeID: 22, FarmID: 2, TotalResources: capacity}))
+
+	network := workloads.ZNet{
+		Name:    "rentnet",
+		Nodes:   []uint32{12},
+		IPRange: gridtypes.NewIPNet(net.IPNet{IP: net.IPv4(10, 30, 0, 0), Mask: net.CIDRMask(16, 32)}),
+	}
+	require.NoError(t, tfPluginClient.NetworkDeployer.Deploy(ctx, &network))
+	networkContracts := grid.ActiveContracts()
+
+	t.Run("failed deployment", func(t *testing.T) {
+		grid.FailWorkloads(zos.ZMachineType, "no flist")
+		t.Cleanup(func() { grid.FailWorkloads(zos.ZMachineType, "") })
+
+		dl := workloads.NewDeployment("vm", 0, "rented", nil, network.Name, nil, nil, []workloads.VM{{
+			Name: "vm", NetworkName: network.Name, CPU: 1, Memory: 1024, Flist: grid.FlistURL("base"),
+		}}, nil)
+		trueVal := true
+		_, err := tfPluginClient.RentAndDeploy(ctx, types.NodeFilter{InDedicatedFarm: &trueVal}, &network, &dl)
+		assert.ErrorContains(t, err, "no flist")
+
+		// the network is removed from the rented node and the rent contract is canceled
+		assert.Equal(t, []uint32{12}, network.Nodes)
+		assert.Equal(t, networkContracts, grid.ActiveContracts())
+		_, err = tfPluginClient.SubstrateConn.GetNodeRentContract(dl.NodeID)
+		assert.ErrorIs(t, err, substrate.ErrNotFound)
+	})
+
+	t.Run("rent contracts of the user are kept", func(t *testing.T) {
+		rentContractID, err := tfPluginClient.SubstrateConn.CreateRentContract(tfPluginClient.Identity, 22, nil)
+		require.NoError(t, err)
+
+		dl := workloads.NewDeployment("vm", 22, "owned", nil, "", []workloads.Disk{{Name: "disk", SizeGB: 1}}, nil, nil, nil)
+		require.NoError(t, tfPluginClient.DeploymentDeployer.Deploy(ctx, &dl))
+		require.NoError(t, tfPluginClient.CancelByProjectName("owned"))
+
+		id, err := tfPluginClient.SubstrateConn.GetNodeRentContract(22)
+		require.NoError(t, err)
+		assert.Equal(t, rentContractID, id)
+	})
+}
@@ -0,0 +1,231 @@
+package deployer
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
+)
+
+// PlacementConstraints are the constraints used to pick nodes for deployments
+type PlacementConstraints struct {
+	// Filter is the base nodes filter, deployments free resources and public ips are added to it
+	Filter types.NodeFilter
+	// Farms is the minimum number of farms the deployments are spread on
+	Farms int
+	// Countries is the minimum number of countries the deployments are spread on
+	Countries int
+	// AllowSameNode allows placing more than one deployment on the same node
+	AllowSameNode bool
+	// PreferCertified picks certified nodes first
+	PreferCertified bool
+	// MaxPrice is the maximum node monthly price in USD, zero means no limit
+	MaxPrice float64
+}
+
+// deploymentRequirements are the resources a deployment needs on a node
+type deploymentRequirements struct {
+	capacity  gridtypes.Capacity
+	ssdDisks  []uint64
+	hddDisks  []uint64
+	rootfs    []uint64
+	publicIPs uint64
+}
+
+// Schedule picks a node for each deployment and sets its node ID.
+// nodes are picked to spread the deployments on the constraints farms and countries, then certified nodes and cheaper nodes are preferred.
+// deployments are never placed on the same node unless allowed.
+func (d *DeploymentDeployer) Schedule(ctx context.Context, dls []*workloads.Deployment, constraints PlacementConstraints) error {
+	usedNodes := make(map[int]gridtypes.Capacity)
+	usedFarms := make(map[int]bool)
+	usedCountries := make(map[string]bool)
+
+	for _, dl := range dls {
+		req, err := requirements(dl)
+		if err != nil {
+			return errors.Wrapf(err, "could not calculate deployment %s requirements", dl.Name)
+		}
+
+		nodes, err := FilterNodes(ctx, *d.tfPluginClient, nodeFilter(constraints, req), req.ssdDisks, req.hddDisks, req.rootfs)
+		if err != nil {
+			return errors.Wrapf(err, "could not find nodes for deployment %s", dl.Name)
+		}
+
+		nodes = slices.DeleteFunc(nodes, func(node types.Node) bool {
+			used, ok := usedNodes[node.NodeID]
+			if !ok {
+				return false
+			}
+			return !constraints.AllowSameNode || !hasFreeCapacity(node, used, req.capacity)
+		})
+		if len(nodes) == 0 {
+			return errors.Errorf("could not find a node for deployment %s that satisfies the placement constraints", dl.Name)
+		}
+
+		spreadFarms := len(usedFarms) < constraints.Farms
+		spreadCountries := len(usedCountries) < constraints.Countries
+		slices.SortStableFunc(nodes, func(a, b types.Node) int {
+			if spreadFarms && usedFarms[a.FarmID] != usedFarms[b.FarmID] {
+				return compareBool(!usedFarms[a.FarmID], !usedFarms[b.FarmID])
+			}
+			if spreadCountries && usedCountries[a.Country] != usedCountries[b.Country] {
+				return compareBool(!usedCountries[a.Country], !usedCountries[b.Country])
+			}
+			if constraints.PreferCertified && isCertified(a) != isCertified(b) {
+				return compareBool(isCertified(a), isCertified(b))
+			}
+			if a.PriceUsd != b.PriceUsd {
+				return cmp.Compare(a.PriceUsd, b.PriceUsd)
+			}
+			return cmp.Compare(a.NodeID, b.NodeID)
+		})
+
+		node := nodes[0]
+		dl.NodeID = uint32(node.NodeID)
+
+		used := usedNodes[node.NodeID]
+		used.Add(&req.capacity)
+		usedNodes[node.NodeID] = used
+		usedFarms[node.FarmID] = true
+		usedCountries[node.Country] = true
+	}
+
+	if farms := min(constraints.Farms, len(dls)); len(usedFarms) < farms {
+		return errors.Errorf("could only spread deployments on %d farms, %d are required", len(usedFarms), farms)
+	}
+	if countries := min(constraints.Countries, len(dls)); len(usedCountries) < countries {
+		return errors.Errorf("could only spread deployments on %d countries, %d are required", len(usedCountries), countries)
+	}
+	return nil
+}
+
+// ScheduleAndDeploy picks nodes for the deployments, adds them to their network and deploys them.
+// the network is deployed first if it is given.
+func (d *DeploymentDeployer) ScheduleAndDeploy(ctx context.Context, znet *workloads.ZNet, dls []*workloads.Deployment, constraints PlacementConstraints) error {
+	if err := d.Schedule(ctx, dls, constraints); err != nil {
+		return err
+	}
+
+	if znet != nil {
+		for _, dl := range dls {
+			if !slices.Contains(znet.Nodes, dl.NodeID) {
+				znet.Nodes = append(znet.Nodes, dl.NodeID)
+			}
+		}
+
+		if err := d.tfPluginClient.NetworkDeployer.Deploy(ctx, znet); err != nil {
+			return errors.Wrapf(err, "could not deploy network %s", znet.Name)
+		}
+	}
+
+	return d.BatchDeploy(ctx, dls)
+}
+
+// requirements calculates the deployment capacity and storage from its workloads
+func requirements(dl *workloads.Deployment) (deploymentRequirements, error) {
+	var req deploymentRequirements
+	var wls []gridtypes.Workload
+
+	for _, disk := range dl.Disks {
+		wls = append(wls, disk.ZosWorkload())
+	}
+	for _, zdb := range dl.Zdbs {
+		wls = append(wls, zdb.ZosWorkload())
+	}
+	wls = append(wls, dl.VMsZosWorkloads()...)
+	for idx, q := range dl.QSFS {
+		wl, err := q.ZosWorkload()
+		if err != nil {
+			return deploymentRequirements{}, errors.Wrapf(err, "failed to generate QSFS %d", idx)
+		}
+		wls = append(wls, wl)
+	}
+
+	for _, wl := range wls {
+		wlCap, err := wl.Capacity()
+		if err != nil {
+			return deploymentRequirements{}, err
+		}
+		req.capacity.Add(&wlCap)
+
+		switch wl.Type {
+		case zos.ZMountType:
+			req.ssdDisks = append(req.ssdDisks, uint64(wlCap.SRU))
+		case zos.ZMachineType:
+			req.rootfs = append(req.rootfs, uint64(wlCap.SRU))
+		case zos.ZDBType:
+			req.hddDisks = append(req.hddDisks, uint64(wlCap.HRU))
+		case zos.PublicIPType:
+			data, err := wl.WorkloadData()
+			if err != nil {
+				return deploymentRequirements{}, err
+			}
+			if data.(*zos.PublicIP).V4 {
+				req.publicIPs++
+			}
+		}
+	}
+	return req, nil
+}
+
+func nodeFilter(constraints PlacementConstraints, req deploymentRequirements) types.NodeFilter {
+	filter := constraints.Filter
+	if len(filter.Status) == 0 {
+		filter.Status = []string{"up"}
+	}
+	if req.capacity.MRU != 0 {
+		mru := uint64(req.capacity.MRU)
+		filter.FreeMRU = &mru
+	}
+	if req.capacity.SRU != 0 {
+		sru := uint64(req.capacity.SRU)
+		filter.FreeSRU = &sru
+	}
+	if req.capacity.HRU != 0 {
+		hru := uint64(req.capacity.HRU)
+		filter.FreeHRU = &hru
+	}
+	if req.publicIPs != 0 {
+		ips := req.publicIPs
+		filter.FreeIPs = &ips
+	}
+	if constraints.MaxPrice != 0 {
+		price := constraints.MaxPrice
+		filter.PriceMax = &price
+	}
+	return filter
+}
+
+// hasFreeCapacity checks if the node can hold the needed capacity beside the capacity used by scheduled deployments
+func hasFreeCapacity(node types.Node, used, needed gridtypes.Capacity) bool {
+	free := func(total, nodeUsed, scheduled gridtypes.Unit) gridtypes.Unit {
+		if total < nodeUsed+scheduled {
+			return 0
+		}
+		return total - nodeUsed - scheduled
+	}
+	return free(node.TotalResources.MRU, node.UsedResources.MRU, used.MRU) >= needed.MRU &&
+		free(2*node.TotalResources.SRU, node.UsedResources.SRU, used.SRU) >= needed.SRU &&
+		free(node.TotalResources.HRU, node.UsedResources.HRU, used.HRU) >= needed.HRU
+}
+
+func isCertified(node types.Node) bool {
+	return node.CertificationType == "Certified"
+}
+
+// compareBool sorts true values first
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return -1
+	default:
+		return 1
+	}
+}
@@ -0,0 +1,102 @@
+package deployer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/mocks"
+	client "github.com/threefoldtech/tfgrid-sdk-go/grid-client/node"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
+)
+
+func TestSchedule(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cl := mocks.NewRMBMockClient(ctrl)
+	sub := mocks.NewMockSubstrateExt(ctrl)
+	ncPool := mocks.NewMockNodeClientGetter(ctrl)
+	proxyCl := mocks.NewMockClient(ctrl)
+
+	tfPluginClient := TFPluginClient{
+		TwinID:          twinID,
+		SubstrateConn:   sub,
+		NcPool:          ncPool,
+		GridProxyClient: proxyCl,
+	}
+	d := DeploymentDeployer{tfPluginClient: &tfPluginClient}
+
+	nodes := []types.Node{
+		{NodeID: 1, FarmID: 1, Country: "Egypt", PriceUsd: 10},
+		{NodeID: 2, FarmID: 1, Country: "Egypt", PriceUsd: 5},
+		{NodeID: 3, FarmID: 2, Country: "Belgium", PriceUsd: 20, CertificationType: "Certified"},
+		{NodeID: 4, FarmID: 3, Country: "Belgium", PriceUsd: 15},
+	}
+	for i := range nodes {
+		nodes[i].TotalResources = types.Capacity{MRU: 16 * gridtypes.Gigabyte, SRU: 100 * gridtypes.Gigabyte}
+	}
+	proxyCl.EXPECT().Nodes(gomock.Any(), gomock.Any(), gomock.Any()).Return(nodes, len(nodes), nil).AnyTimes()
+
+	ncPool.EXPECT().GetNodeClient(sub, gomock.Any()).Return(client.NewNodeClient(twinID, cl, 10), nil).AnyTimes()
+	cl.EXPECT().Call(gomock.Any(), twinID, "zos.storage.pools", nil, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, twin uint32, fn string, data, result interface{}) error {
+			*result.(*[]client.PoolMetrics) = []client.PoolMetrics{{Type: zos.SSDDevice, Size: 100 * gridtypes.Gigabyte}}
+			return nil
+		}).AnyTimes()
+
+	replicas := func() []*workloads.Deployment {
+		var dls []*workloads.Deployment
+		for _, name := range []string{"replica1", "replica2", "replica3"} {
+			dls = append(dls, &workloads.Deployment{
+				Name: name,
+				Vms:  []workloads.VM{{Name: name, CPU: 1, Memory: 1024, RootfsSize: 1024}},
+			})
+		}
+		return dls
+	}
+	nodeIDs := func(dls []*workloads.Deployment) []uint32 {
+		var ids []uint32
+		for _, dl := range dls {
+			ids = append(ids, dl.NodeID)
+		}
+		return ids
+	}
+
+	t.Run("cheapest nodes", func(t *testing.T) {
+		dls := replicas()
+		require.NoError(t, d.Schedule(context.Background(), dls, PlacementConstraints{}))
+		assert.Equal(t, []uint32{2, 1, 4}, nodeIDs(dls))
+	})
+
+	t.Run("spread on farms", func(t *testing.T) {
+		dls := replicas()
+		require.NoError(t, d.Schedule(context.Background(), dls, PlacementConstraints{Farms: 3}))
+		assert.Equal(t, []uint32{2, 4, 3}, nodeIDs(dls))
+	})
+
+	t.Run("spread on countries and prefer certified", func(t *testing.T) {
+		dls := replicas()[:2]
+		require.NoError(t, d.Schedule(context.Background(), dls, PlacementConstraints{Countries: 2, PreferCertified: true}))
+		assert.Equal(t, []uint32{3, 2}, nodeIDs(dls))
+	})
+
+	t.Run("not enough farms", func(t *testing.T) {
+		dls := append(replicas(), &workloads.Deployment{Name: "replica4"})
+		err := d.Schedule(context.Background(), dls, PlacementConstraints{Farms: 4})
+		assert.ErrorContains(t, err, "could only spread deployments on 3 farms")
+	})
+
+	t.Run("anti affinity", func(t *testing.T) {
+		dls := append(replicas(), replicas()...)
+		assert.Error(t, d.Schedule(context.Background(), dls, PlacementConstraints{}))
+
+		require.NoError(t, d.Schedule(context.Background(), dls, PlacementConstraints{AllowSameNode: true}))
+		assert.Equal(t, []uint32{2, 2, 2, 2, 2, 2}, nodeIDs(dls))
+	})
+}
@@ -9,15 +9,19 @@ import (
 	"strings"
 	"time"
 
+	"github.com/hashicorp/go-multierror"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/billing"
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/calculator"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/flist"
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/graphql"
 	client "github.com/threefoldtech/tfgrid-sdk-go/grid-client/node"
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/state"
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/subi"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
 	proxy "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/client"
 	"github.com/threefoldtech/tfgrid-sdk-go/rmb-sdk-go"
 	"github.com/threefoldtech/tfgrid-sdk-go/rmb-sdk-go/peer"
@@ -92,6 +96,7 @@ type TFPluginClient struct {
 	GatewayFQDNDeployer GatewayFQDNDeployer
 	GatewayNameDeployer GatewayNameDeployer
 	K8sDeployer         K8sDeployer
+	QSFSDeployer        QSFSDeployer
 
 	// state
 	State *state.State
@@ -103,6 +108,22 @@ type TFPluginClient struct {
 	// calculator
 	Calculator calculator.Calculator
 
+	// billing
+	Billing billing.Billing
+
+	// DryRunReport collects what deployers would do in dry run mode, it is nil otherwise
+	DryRunReport *DryRunReport
+
+	progressHandler ProgressHandler
+	// metadataKey decrypts the twin deployments metadata
+	metadataKey []byte
+	// encryptMetadata encrypts the deployments metadata with the metadata key
+	encryptMetadata bool
+	// atomicBatchDeploy rolls back batch deployments if any of their nodes fails
+	atomicBatchDeploy bool
+	// flistInspector inspects the vms flists when deployments are validated if set
+	flistInspector *flist.Inspector
+
 	cancelRelayContext context.CancelFunc
 }
 
@@ -115,6 +136,23 @@ type pluginCfg struct {
 	rmbTimeout    int
 	showLogs      bool
 	rmbInMemCache bool
+	stateStore    state.StateStore
+	dryRun        bool
+	progress      ProgressHandler
+	backend       Backend
+	encryptMeta   bool
+	atomicBatch   bool
+	nodePoolOpts  []client.PoolOpt
+	inspectFlists bool
+}
+
+// Backend provides the grid clients instead of connecting to tfchain, the relay, the grid proxy and graphql.
+// it is used to run the client against an in process grid like the fakegrid package.
+type Backend interface {
+	SubstrateExt() subi.SubstrateExt
+	RMBClient() rmb.Client
+	GridProxyClient() proxy.Client
+	GraphQLURL() string
 }
 
 type PluginOpt func(*pluginCfg)
@@ -167,6 +205,71 @@ func WithTwinCache() PluginOpt {
 	}
 }
 
+// WithStateStore persists the client state using the given store.
+// the state is loaded from the store when the client is created and saved after deployments and cancellations.
+func WithStateStore(store state.StateStore) PluginOpt {
+	return func(p *pluginCfg) {
+		p.stateStore = store
+	}
+}
+
+// WithDryRun runs the deployers without creating, updating or canceling any contract or deployment.
+// deployments are still validated and generated, and the contracts and deployments are collected in the client's DryRunReport.
+// read only calls to tfchain, grid proxy and nodes are still made, and the state is never persisted.
+// use a separate client for the actual deployment.
+func WithDryRun() PluginOpt {
+	return func(p *pluginCfg) {
+		p.dryRun = true
+	}
+}
+
+// WithProgressHandler calls the handler with the workloads state transitions while the deployers wait for deployments.
+// the handler is called concurrently for batch deployments and should not block.
+func WithProgressHandler(handler ProgressHandler) PluginOpt {
+	return func(p *pluginCfg) {
+		p.progress = handler
+	}
+}
+
+// WithEncryptedMetadata encrypts the deployments and workloads metadata with a key derived from the twin's identity.
+// encrypted metadata can only be read by clients of the same identity, plain metadata is still readable.
+func WithEncryptedMetadata() PluginOpt {
+	return func(p *pluginCfg) {
+		p.encryptMeta = true
+	}
+}
+
+// WithAtomicBatchDeploy makes batch deployments all or nothing.
+// if any node of a batch fails, the contracts created by the batch are canceled, the updated deployments are reverted
+// and a *BatchDeployError with the error of each failed node is returned.
+func WithAtomicBatchDeploy() PluginOpt {
+	return func(p *pluginCfg) {
+		p.atomicBatch = true
+	}
+}
+
+// WithNodeClientPoolOpts configures the node clients pool, it enables the response cache and the circuit breaker that are disabled by default
+func WithNodeClientPoolOpts(opts ...client.PoolOpt) PluginOpt {
+	return func(p *pluginCfg) {
+		p.nodePoolOpts = append(p.nodePoolOpts, opts...)
+	}
+}
+
+// WithFlistInspection inspects the vms flists when the deployment and k8s deployers validate deployments and clusters,
+// and logs warnings about entrypoints that don't exist in the flists and rootfs sizes smaller than the flists vm images.
+func WithFlistInspection() PluginOpt {
+	return func(p *pluginCfg) {
+		p.inspectFlists = true
+	}
+}
+
+// WithBackend uses the backend clients instead of connecting to the network urls
+func WithBackend(backend Backend) PluginOpt {
+	return func(p *pluginCfg) {
+		p.backend = backend
+	}
+}
+
 func parsePluginOpts(opts ...PluginOpt) (pluginCfg, error) {
 	cfg := pluginCfg{
 		network:       "main",
@@ -268,10 +371,15 @@ func NewTFPluginClient(
 	tfPluginClient.proxyURL = cfg.proxyURL
 	tfPluginClient.relayURLs = cfg.relayURLs
 
+	var sub subi.SubstrateExt
 	manager := subi.NewManager(tfPluginClient.substrateURL...)
-	sub, err := manager.SubstrateExt()
-	if err != nil {
-		return TFPluginClient{}, errors.Wrap(err, "could not get substrate client")
+	if cfg.backend != nil {
+		sub = cfg.backend.SubstrateExt()
+	} else {
+		sub, err = manager.SubstrateExt()
+		if err != nil {
+			return TFPluginClient{}, errors.Wrap(err, "could not get substrate client")
+		}
 	}
 
 	if err := validateAccount(sub, tfPluginClient.Identity, tfPluginClient.mnemonicOrSeed); err != nil {
@@ -311,39 +419,75 @@ func NewTFPluginClient(
 	if !cfg.rmbInMemCache {
 		peerOpts = append(peerOpts, peer.WithTwinCache(10*60*60)) // in seconds that's 10 hours
 	}
-	rmbClient, err := peer.NewRpcClient(ctx, tfPluginClient.mnemonicOrSeed, manager, peerOpts...)
-	if err != nil {
-		return TFPluginClient{}, errors.Wrap(err, "could not create rmb client")
-	}
+	if cfg.backend != nil {
+		tfPluginClient.RMB = cfg.backend.RMBClient()
+	} else {
+		rmbClient, err := peer.NewRpcClient(ctx, tfPluginClient.mnemonicOrSeed, manager, peerOpts...)
+		if err != nil {
+			return TFPluginClient{}, errors.Wrap(err, "could not create rmb client")
+		}
 
-	tfPluginClient.RMB = rmbClient
+		tfPluginClient.RMB = rmbClient
+	}
 
 	gridProxyClient := proxy.NewClient(tfPluginClient.proxyURL)
+	if cfg.backend != nil {
+		gridProxyClient = cfg.backend.GridProxyClient()
+	}
 	if err := validateRMBProxyServer(gridProxyClient); err != nil {
 		return TFPluginClient{}, errors.Wrap(err, "could not validate rmb proxy server")
 	}
 	tfPluginClient.GridProxyClient = proxy.NewRetryingClient(gridProxyClient)
 
-	ncPool := client.NewNodeClientPool(tfPluginClient.RMB, tfPluginClient.RMBTimeout)
+	ncPool := client.NewNodeClientPool(tfPluginClient.RMB, tfPluginClient.RMBTimeout, cfg.nodePoolOpts...)
 	tfPluginClient.NcPool = ncPool
 
+	if cfg.dryRun {
+		tfPluginClient.DryRunReport = NewDryRunReport()
+	}
+	tfPluginClient.progressHandler = cfg.progress
+	tfPluginClient.atomicBatchDeploy = cfg.atomicBatch
+
+	// the key is always derived to read the metadata encrypted by other clients of the twin
+	tfPluginClient.metadataKey = workloads.DeriveMetadataKey(keyPair.Seed())
+	tfPluginClient.encryptMetadata = cfg.encryptMeta
+	if cfg.inspectFlists {
+		tfPluginClient.flistInspector = flist.NewInspector()
+	}
+
 	tfPluginClient.DeploymentDeployer = NewDeploymentDeployer(&tfPluginClient)
 	tfPluginClient.NetworkDeployer = NewNetworkDeployer(&tfPluginClient)
 	tfPluginClient.GatewayFQDNDeployer = NewGatewayFqdnDeployer(&tfPluginClient)
 	tfPluginClient.K8sDeployer = NewK8sDeployer(&tfPluginClient)
 	tfPluginClient.GatewayNameDeployer = NewGatewayNameDeployer(&tfPluginClient)
+	tfPluginClient.QSFSDeployer = NewQSFSDeployer(&tfPluginClient)
 
 	graphqlURL := GraphQlURLs[cfg.network]
+	if cfg.backend != nil {
+		graphqlURL = cfg.backend.GraphQLURL()
+	}
 	tfPluginClient.graphQl, err = graphql.NewGraphQl(graphqlURL)
 	if err != nil {
 		return TFPluginClient{}, errors.Wrapf(err, "could not create a new graphql with url: %s", graphqlURL)
 	}
 
 	tfPluginClient.ContractsGetter = graphql.NewContractsGetter(tfPluginClient.TwinID, tfPluginClient.graphQl, tfPluginClient.SubstrateConn, tfPluginClient.NcPool)
+	tfPluginClient.ContractsGetter.SetMetadataKey(tfPluginClient.metadataKey)
 
 	tfPluginClient.State = state.NewState(tfPluginClient.NcPool, tfPluginClient.SubstrateConn)
+	tfPluginClient.State.SetMetadataKey(tfPluginClient.metadataKey)
+	if cfg.stateStore != nil {
+		tfPluginClient.State.SetStore(cfg.stateStore)
+		if err := tfPluginClient.State.Load(); err != nil {
+			return TFPluginClient{}, errors.Wrap(err, "could not load client state")
+		}
+		if cfg.dryRun {
+			tfPluginClient.State.SetStore(nil)
+		}
+	}
 
 	tfPluginClient.Calculator = calculator.NewCalculator(tfPluginClient.SubstrateConn, tfPluginClient.Identity)
+	tfPluginClient.Billing = billing.NewBilling(tfPluginClient.Identity, tfPluginClient.SubstrateConn, tfPluginClient.GridProxyClient, tfPluginClient.ContractsGetter)
 
 	return tfPluginClient, nil
 }
@@ -359,9 +503,26 @@ func (t *TFPluginClient) Close() {
 
 // BatchCancelContract to cancel a batch of contracts
 func (t *TFPluginClient) BatchCancelContract(contracts []uint64) error {
+	if t.DryRunReport != nil {
+		t.DryRunReport.cancelContracts(contracts...)
+		return nil
+	}
 	return t.SubstrateConn.BatchCancelContract(t.Identity, contracts)
 }
 
+// saveState persists the plugin state after a deploy or a cancel.
+// the state is saved even if the operation failed to keep track of the contracts that were created.
+func (t *TFPluginClient) saveState(err error) error {
+	saveErr := t.State.Save()
+	if saveErr == nil {
+		return err
+	}
+	if err == nil {
+		return saveErr
+	}
+	return multierror.Append(err, saveErr)
+}
+
 func generateSessionID() string {
 	return fmt.Sprintf("tf-%d", os.Getpid())
 }
@@ -6,9 +6,11 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/graphql"
 )
 
-// CancelByProjectName cancels a deployed project
+// CancelByProjectName cancels a deployed project.
+// the rent contracts created by RentAndDeploy for the project deployments are canceled too if their nodes have no other contracts of the twin.
 func (t *TFPluginClient) CancelByProjectName(projectName string, noGateways ...bool) error {
 	log.Info().Str("project name", projectName).Msg("canceling contracts")
 
@@ -17,6 +19,11 @@ func (t *TFPluginClient) CancelByProjectName(projectName string, noGateways ...b
 		return errors.Wrapf(err, "could not load contracts for project %s", projectName)
 	}
 
+	rentContracts, err := t.emptiedRentContracts(contracts.NodeContracts)
+	if err != nil {
+		return errors.Wrapf(err, "could not load rent contracts for project %s", projectName)
+	}
+
 	contractsSlice := append(contracts.NameContracts, contracts.NodeContracts...)
 
 	const batchSize = 400 // Process contracts in groups of 400
@@ -42,9 +49,76 @@ func (t *TFPluginClient) CancelByProjectName(projectName string, noGateways ...b
 
 		log.Debug().Uints64("contracts IDs", batchContractIDS).Msg("Batch cancel")
 		if err := t.BatchCancelContract(batchContractIDS); err != nil {
-			return fmt.Errorf("failed to cancel contracts (batch %d-%d) for project %s: %w", i, end, projectName, err)
+			return t.saveState(fmt.Errorf("failed to cancel contracts (batch %d-%d) for project %s: %w", i, end, projectName, err))
+		}
+
+		// name contracts are not tracked in the state
+		for idx, contract := range contractsSlice[i:end] {
+			if contract.NodeID != 0 {
+				t.State.RemoveContractIDs(contract.NodeID, batchContractIDS[idx])
+			}
 		}
 	}
+
+	for _, contractID := range rentContracts {
+		log.Debug().Uint64("contract ID", contractID).Msg("cancel rent contract")
+		if err := t.cancelRentContract(contractID); err != nil {
+			return t.saveState(errors.Wrapf(err, "failed to cancel rent contract %d for project %s", contractID, projectName))
+		}
+	}
+
+	if err := t.State.Save(); err != nil {
+		return err
+	}
+
 	log.Info().Str("project name", projectName).Msg("project is canceled")
 	return nil
 }
+
+// emptiedRentContracts returns the rent contracts recorded in the metadata of the canceled node contracts
+// whose nodes are left without any twin node contract after canceling them
+func (t *TFPluginClient) emptiedRentContracts(canceled []graphql.Contract) ([]uint64, error) {
+	recorded := make(map[uint64]bool)
+	for _, contract := range canceled {
+		deploymentData, err := t.ContractsGetter.ParseDeploymentData(contract)
+		if err == nil && deploymentData.RentContractID != 0 {
+			recorded[deploymentData.RentContractID] = true
+		}
+	}
+	if len(recorded) == 0 {
+		return nil, nil
+	}
+
+	twinContracts, err := t.ContractsGetter.ListContractsByTwinID([]string{"Created", "GracePeriod"})
+	if err != nil {
+		return nil, err
+	}
+	if len(twinContracts.RentContracts) == 0 {
+		return nil, nil
+	}
+
+	remaining := make(map[uint32]int)
+	for _, contract := range twinContracts.NodeContracts {
+		remaining[contract.NodeID]++
+	}
+	for _, contract := range canceled {
+		remaining[contract.NodeID]--
+	}
+
+	var rentContracts []uint64
+	for _, contract := range twinContracts.RentContracts {
+		count, ok := remaining[contract.NodeID]
+		if !ok || count > 0 {
+			continue
+		}
+
+		contractID, err := strconv.ParseUint(contract.ContractID, 0, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not parse contract %s into uint64", contract.ContractID)
+		}
+		if recorded[contractID] {
+			rentContracts = append(rentContracts, contractID)
+		}
+	}
+	return rentContracts, nil
+}
@@ -1,6 +1,8 @@
 package deployer
 
 import (
+	"context"
+	"fmt"
 	"math"
 	"math/big"
 	"regexp"
@@ -10,6 +12,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/flist"
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/subi"
 	proxy "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/client"
 )
@@ -81,8 +84,31 @@ func validateAccountBalanceForExtrinsics(sub subi.SubstrateExt, identity substra
 	}
 
 	if balance.Free.Cmp(big.NewInt(20000000)) == -1 {
-		return errors.Errorf("account contains %f tft, min fee is 2 tft", float64(balance.Free.Int64())/math.Pow(10, 7))
+		return &InsufficientBalanceError{Balance: float64(balance.Free.Int64()) / math.Pow(10, 7), Required: 2}
 	}
 
 	return nil
 }
+
+// flistWorkload is a vm workload whose flist can be inspected before it's deployed
+type flistWorkload interface {
+	FlistWarnings(info flist.Info) []string
+}
+
+// flistWarnings inspects the flist of a vm if the client inspects flists and returns the problems of the vm with its flist
+func (t *TFPluginClient) flistWarnings(ctx context.Context, name, flistURL string, vm flistWorkload) []string {
+	if t.flistInspector == nil {
+		return nil
+	}
+
+	info, err := t.flistInspector.Inspect(ctx, flistURL)
+	if err != nil {
+		return []string{fmt.Sprintf("vm %s: %s", name, err)}
+	}
+
+	var warnings []string
+	for _, warning := range vm.FlistWarnings(info) {
+		warnings = append(warnings, fmt.Sprintf("vm %s: %s", name, warning))
+	}
+	return warnings
+}
@@ -0,0 +1,276 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
+)
+
+// VMUpdate is a targeted change of a deployed vm, it can also change the deployment holding the vm
+type VMUpdate func(dl *workloads.Deployment, vm *workloads.VM) error
+
+// ResizeVM changes the vm cpu and memory in MB
+func ResizeVM(cpu, memory int) VMUpdate {
+	return func(_ *workloads.Deployment, vm *workloads.VM) error {
+		if memory <= 0 {
+			return errors.Errorf("invalid vm memory %d", memory)
+		}
+		vm.CPU = cpu
+		vm.Memory = memory
+		return nil
+	}
+}
+
+// SetVMEnvVars adds the given environment variables to the vm or overrides them
+func SetVMEnvVars(envVars map[string]string) VMUpdate {
+	return func(_ *workloads.Deployment, vm *workloads.VM) error {
+		if vm.EnvVars == nil {
+			vm.EnvVars = make(map[string]string)
+		}
+		maps.Copy(vm.EnvVars, envVars)
+		return nil
+	}
+}
+
+// AddVMMount mounts a disk on the vm, the disk is added to the deployment if it doesn't exist
+func AddVMMount(disk workloads.Disk, mountPoint string) VMUpdate {
+	return func(dl *workloads.Deployment, vm *workloads.VM) error {
+		for _, mount := range vm.Mounts {
+			if mount.DiskName == disk.Name {
+				return errors.Errorf("disk %s is already mounted on vm %s", disk.Name, vm.Name)
+			}
+			if mount.MountPoint == mountPoint {
+				return errors.Errorf("mount point %s is already used on vm %s", mountPoint, vm.Name)
+			}
+		}
+
+		if !slices.ContainsFunc(dl.Disks, func(d workloads.Disk) bool { return d.Name == disk.Name }) {
+			dl.Disks = append(dl.Disks, disk)
+		}
+		vm.Mounts = append(vm.Mounts, workloads.Mount{DiskName: disk.Name, MountPoint: mountPoint})
+		return nil
+	}
+}
+
+// RemoveVMMount unmounts a disk from the vm, the disk and its data are kept in the deployment
+func RemoveVMMount(diskName string) VMUpdate {
+	return func(_ *workloads.Deployment, vm *workloads.VM) error {
+		idx := slices.IndexFunc(vm.Mounts, func(m workloads.Mount) bool { return m.DiskName == diskName })
+		if idx == -1 {
+			return errors.Errorf("disk %s is not mounted on vm %s", diskName, vm.Name)
+		}
+		vm.Mounts = slices.Delete(vm.Mounts, idx, idx+1)
+		return nil
+	}
+}
+
+// SetVMPublicIP enables or disables the vm public ipv4
+func SetVMPublicIP(enabled bool) VMUpdate {
+	return func(_ *workloads.Deployment, vm *workloads.VM) error {
+		vm.PublicIP = enabled
+		return nil
+	}
+}
+
+// PinVMPublicIP attaches the vm to a reserved ip of its deployment so the vm keeps the address when it is recreated
+func PinVMPublicIP(ip string) VMUpdate {
+	return func(dl *workloads.Deployment, vm *workloads.VM) error {
+		if !slices.ContainsFunc(dl.ReservedIPs, func(reserved workloads.ReservedIP) bool { return workloads.SameIPAddress(reserved.IP, ip) }) {
+			return errors.Errorf("public ip %s is not reserved by deployment %s", ip, dl.Name)
+		}
+		vm.PublicIP = true
+		vm.PublicIP6 = false
+		vm.PublicIPAddress = ip
+		return nil
+	}
+}
+
+// UpdateVM loads the deployment from the grid, applies the updates to its vm and pushes the deployment update.
+// zos can't update vms and public ips in place, so updates changing them fail with ErrRecreateRequired
+// and have to be applied with RecreateVM instead.
+// the update is validated against the node free capacity and the contract public ips before anything is changed.
+func (d *DeploymentDeployer) UpdateVM(ctx context.Context, dl *workloads.Deployment, vmName string, updates ...VMUpdate) error {
+	return d.updateVM(ctx, dl, vmName, false, updates)
+}
+
+// RecreateVM is like UpdateVM but it allows changes that zos can't apply in place.
+// changed vms and public ips are removed in a first deployment update then added back in a second one,
+// the contract, disks and reserved public ips are kept but the vm root filesystem is wiped.
+// if the second update fails, the vm is deployed back with its old configuration.
+func (d *DeploymentDeployer) RecreateVM(ctx context.Context, dl *workloads.Deployment, vmName string, updates ...VMUpdate) error {
+	return d.updateVM(ctx, dl, vmName, true, updates)
+}
+
+func (d *DeploymentDeployer) updateVM(ctx context.Context, dl *workloads.Deployment, vmName string, recreate bool, updates []VMUpdate) error {
+	if dl.ContractID == 0 {
+		return errors.Errorf("deployment %s is not deployed", dl.Name)
+	}
+
+	oldDls, err := d.deployer.GetDeployments(ctx, dl.NodeDeploymentID)
+	if err != nil {
+		return errors.Wrapf(err, "could not get deployment %s", dl.Name)
+	}
+	oldDl, ok := oldDls[dl.NodeID]
+	if !ok {
+		return errors.Errorf("could not find deployment %s on node %d", dl.Name, dl.NodeID)
+	}
+
+	if err := d.Sync(ctx, dl); err != nil {
+		return errors.Wrapf(err, "could not load deployment %s", dl.Name)
+	}
+
+	newDl := copyDeployment(dl)
+	idx := slices.IndexFunc(newDl.Vms, func(vm workloads.VM) bool { return vm.Name == vmName })
+	if idx == -1 {
+		return errors.Errorf("could not find vm %s in deployment %s", vmName, dl.Name)
+	}
+
+	vm := newDl.Vms[idx]
+	for _, update := range updates {
+		if err := update(&newDl, &vm); err != nil {
+			return errors.Wrapf(err, "could not update vm %s", vmName)
+		}
+	}
+	newDl.Vms[idx] = vm
+
+	if err := newDl.Validate(); err != nil {
+		return errors.Wrapf(err, "invalid deployment %s", dl.Name)
+	}
+
+	currentDl, err := d.generateNodeDeployment(ctx, dl)
+	if err != nil {
+		return err
+	}
+	gridDl, err := d.generateNodeDeployment(ctx, &newDl)
+	if err != nil {
+		return err
+	}
+
+	if err := d.validateUpdate(ctx, dl.NodeID, oldDl, gridDl); err != nil {
+		return err
+	}
+
+	removed, err := withoutChangedWorkloads(oldDl, gridDl, zos.ZMachineType, zos.PublicIPType)
+	if err != nil {
+		return err
+	}
+	recreated := len(removed.Workloads) != len(gridDl.Workloads)
+	if recreated && !recreate {
+		return errors.Wrapf(ErrRecreateRequired, "vm %s of deployment %s", vmName, dl.Name)
+	}
+
+	solutionProvider := map[uint32]*uint64{dl.NodeID: dl.SolutionProvider}
+	if recreated {
+		if _, err := d.deployer.Deploy(ctx, dl.NodeDeploymentID, map[uint32]gridtypes.Deployment{dl.NodeID: removed}, solutionProvider); err != nil {
+			return errors.Wrapf(err, "could not remove vm %s to recreate it", vmName)
+		}
+	}
+
+	if _, err := d.deployer.Deploy(ctx, dl.NodeDeploymentID, map[uint32]gridtypes.Deployment{dl.NodeID: gridDl}, solutionProvider); err != nil {
+		err = errors.Wrapf(err, "could not deploy updated vm %s", vmName)
+		if !recreated {
+			return err
+		}
+		if _, restoreErr := d.deployer.Deploy(ctx, dl.NodeDeploymentID, map[uint32]gridtypes.Deployment{dl.NodeID: currentDl}, solutionProvider); restoreErr != nil {
+			return multierror.Append(err, errors.Wrapf(restoreErr, "could not deploy vm %s back, it is removed from deployment %s", vmName, dl.Name))
+		}
+		return errors.Wrapf(err, "vm %s is deployed back with its old configuration", vmName)
+	}
+
+	*dl = newDl
+	return d.Sync(ctx, dl)
+}
+
+// generateNodeDeployment generates the grid deployment of a deployment on its node
+func (d *DeploymentDeployer) generateNodeDeployment(ctx context.Context, dl *workloads.Deployment) (gridtypes.Deployment, error) {
+	dlsPerNodes, err := d.GenerateVersionlessDeployments(ctx, []*workloads.Deployment{dl})
+	if err != nil {
+		return gridtypes.Deployment{}, errors.Wrap(err, "could not generate deployments data")
+	}
+	if len(dlsPerNodes[dl.NodeID]) == 0 {
+		return gridtypes.Deployment{}, fmt.Errorf("failed to generate the grid deployment")
+	}
+	return dlsPerNodes[dl.NodeID][0], nil
+}
+
+// validateUpdate checks the node has enough free capacity and the contract has enough public ips for the new deployment
+func (d *DeploymentDeployer) validateUpdate(ctx context.Context, nodeID uint32, oldDl, newDl gridtypes.Deployment) error {
+	oldCap, err := Capacity(oldDl)
+	if err != nil {
+		return errors.Wrapf(err, "could not read deployment %d capacity", oldDl.ContractID)
+	}
+	newCap, err := Capacity(newDl)
+	if err != nil {
+		return errors.Wrap(err, "could not read updated deployment capacity")
+	}
+
+	node, err := d.tfPluginClient.GridProxyClient.Node(ctx, nodeID)
+	if err != nil {
+		return errors.Wrapf(err, "could not get node %d data from the grid proxy", nodeID)
+	}
+
+	free := gridtypes.Capacity{
+		MRU: node.Capacity.Total.MRU - node.Capacity.Used.MRU + oldCap.MRU,
+		SRU: 2*node.Capacity.Total.SRU - node.Capacity.Used.SRU + oldCap.SRU,
+		HRU: node.Capacity.Total.HRU - node.Capacity.Used.HRU + oldCap.HRU,
+	}
+	if free.MRU < newCap.MRU || free.SRU < newCap.SRU || free.HRU < newCap.HRU {
+		return &InsufficientCapacityError{NodeID: nodeID, Needed: newCap, Free: free}
+	}
+
+	publicIPs, err := CountDeploymentPublicIPs(newDl)
+	if err != nil {
+		return errors.Wrap(err, "failed to count deployment public IPs")
+	}
+
+	contract, err := d.tfPluginClient.SubstrateConn.GetContract(oldDl.ContractID)
+	if err != nil {
+		return errors.Wrapf(err, "could not get node contract %d", oldDl.ContractID)
+	}
+	if reserved := contract.PublicIPCount(); publicIPs > reserved {
+		return errors.Errorf("zos can't add public ips to an existing contract, contract %d reserves %d public ips and the update needs %d; redeploy the deployment instead", oldDl.ContractID, reserved, publicIPs)
+	}
+	return nil
+}
+
+// withoutChangedWorkloads returns the new deployment without its workloads of the given types that are changed from the old deployment
+func withoutChangedWorkloads(oldDl, newDl gridtypes.Deployment, types ...gridtypes.WorkloadType) (gridtypes.Deployment, error) {
+	oldHashes, err := GetWorkloadHashes(oldDl)
+	if err != nil {
+		return gridtypes.Deployment{}, errors.Wrap(err, "could not get old workloads hashes")
+	}
+	newHashes, err := GetWorkloadHashes(newDl)
+	if err != nil {
+		return gridtypes.Deployment{}, errors.Wrap(err, "could not get new workloads hashes")
+	}
+
+	res := newDl
+	res.Workloads = nil
+	for _, wl := range newDl.Workloads {
+		oldHash, ok := oldHashes[wl.Name.String()]
+		if ok && oldHash != newHashes[wl.Name.String()] && slices.Contains(types, wl.Type) {
+			continue
+		}
+		res.Workloads = append(res.Workloads, wl)
+	}
+	return res, nil
+}
+
+// copyDeployment copies the deployment slices so updating the copy keeps the original unchanged
+func copyDeployment(dl *workloads.Deployment) workloads.Deployment {
+	res := *dl
+	res.Disks = slices.Clone(dl.Disks)
+	res.Vms = slices.Clone(dl.Vms)
+	for i := range res.Vms {
+		res.Vms[i].Mounts = slices.Clone(res.Vms[i].Mounts)
+		res.Vms[i].EnvVars = maps.Clone(res.Vms[i].EnvVars)
+	}
+	return res
+}
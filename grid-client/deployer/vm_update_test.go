@@ -0,0 +1,153 @@
+package deployer
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/mocks"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/subi"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
+)
+
+func TestVMUpdates(t *testing.T) {
+	dl := constructTestDeployment()
+	newDl := copyDeployment(&dl)
+	vm := newDl.Vms[1]
+
+	updates := []VMUpdate{
+		ResizeVM(4, 4096),
+		SetVMEnvVars(map[string]string{"key": "value"}),
+		RemoveVMMount("disk1"),
+		AddVMMount(workloads.Disk{Name: "disk3", SizeGB: 10}, "/data3"),
+		SetVMPublicIP(true),
+	}
+	for _, update := range updates {
+		require.NoError(t, update(&newDl, &vm))
+	}
+
+	assert.Equal(t, 4, vm.CPU)
+	assert.Equal(t, 4096, vm.Memory)
+	assert.Equal(t, "value", vm.EnvVars["key"])
+	assert.Equal(t, []workloads.Mount{{DiskName: "disk2", MountPoint: "/data2"}, {DiskName: "disk3", MountPoint: "/data3"}}, vm.Mounts)
+	assert.True(t, vm.PublicIP)
+	assert.Len(t, newDl.Disks, 3)
+
+	// the original deployment is not changed
+	assert.Len(t, dl.Disks, 2)
+	assert.Len(t, dl.Vms[1].Mounts, 2)
+	assert.NotContains(t, dl.Vms[1].EnvVars, "key")
+
+	t.Run("invalid updates", func(t *testing.T) {
+		assert.Error(t, RemoveVMMount("disk3")(&newDl, &dl.Vms[0]))
+		assert.Error(t, AddVMMount(workloads.Disk{Name: "disk1"}, "/other")(&newDl, &dl.Vms[0]))
+		assert.Error(t, AddVMMount(workloads.Disk{Name: "disk3"}, "/data1")(&newDl, &dl.Vms[0]))
+		assert.Error(t, ResizeVM(1, 0)(&newDl, &vm))
+	})
+}
+
+func TestWithoutChangedWorkloads(t *testing.T) {
+	oldVM := workloads.VM{Name: "vm", CPU: 1, Memory: 1024, NetworkName: "network", PublicIP: true}
+	disk := workloads.Disk{Name: "disk", SizeGB: 10}
+	oldDl := workloads.NewGridDeployment(twinID, append(oldVM.ZosWorkload(), disk.ZosWorkload()))
+
+	newVM := oldVM
+	newVM.CPU = 2
+	newDisk := disk
+	newDisk.SizeGB = 20
+	newDl := workloads.NewGridDeployment(twinID, append(newVM.ZosWorkload(), newDisk.ZosWorkload()))
+
+	res, err := withoutChangedWorkloads(oldDl, newDl, zos.ZMachineType, zos.PublicIPType)
+	require.NoError(t, err)
+
+	// the changed vm is removed, the unchanged public ip and the updatable disk are kept
+	var names []string
+	for _, wl := range res.Workloads {
+		names = append(names, wl.Name.String())
+	}
+	assert.Equal(t, []string{"vmip", "disk"}, names)
+}
+
+func TestValidateVMUpdate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sub := mocks.NewMockSubstrateExt(ctrl)
+	proxyCl := mocks.NewMockClient(ctrl)
+
+	tfPluginClient := TFPluginClient{SubstrateConn: sub, GridProxyClient: proxyCl}
+	d := DeploymentDeployer{tfPluginClient: &tfPluginClient}
+
+	vm := workloads.VM{Name: "vm", CPU: 1, Memory: 1024, NetworkName: "network"}
+	oldDl := workloads.NewGridDeployment(twinID, vm.ZosWorkload())
+	oldDl.ContractID = contractID
+
+	proxyCl.EXPECT().Node(gomock.Any(), nodeID).Return(proxyTypes.NodeWithNestedCapacity{
+		Capacity: proxyTypes.CapacityResult{
+			Total: proxyTypes.Capacity{MRU: 4 * gridtypes.Gigabyte},
+			Used:  proxyTypes.Capacity{MRU: 2 * gridtypes.Gigabyte},
+		},
+	}, nil).AnyTimes()
+	sub.EXPECT().GetContract(contractID).Return(subi.Contract{
+		Contract: &substrate.Contract{ContractType: substrate.ContractType{
+			NodeContract: substrate.NodeContract{PublicIPsCount: 0},
+		}},
+	}, nil).AnyTimes()
+
+	t.Run("valid", func(t *testing.T) {
+		newVM := vm
+		newVM.Memory = 3 * 1024
+		newDl := workloads.NewGridDeployment(twinID, newVM.ZosWorkload())
+		assert.NoError(t, d.validateUpdate(context.Background(), nodeID, oldDl, newDl))
+	})
+
+	t.Run("not enough memory", func(t *testing.T) {
+		newVM := vm
+		newVM.Memory = 4 * 1024
+		newDl := workloads.NewGridDeployment(twinID, newVM.ZosWorkload())
+		assert.ErrorContains(t, d.validateUpdate(context.Background(), nodeID, oldDl, newDl), "enough resources")
+	})
+
+	t.Run("public ip", func(t *testing.T) {
+		newVM := vm
+		newVM.PublicIP = true
+		newDl := workloads.NewGridDeployment(twinID, newVM.ZosWorkload())
+		assert.ErrorContains(t, d.validateUpdate(context.Background(), nodeID, oldDl, newDl), "can't add public ips")
+	})
+}
+
+func TestFakeGridUpdateVM(t *testing.T) {
+	tfPluginClient, grid := newFakeGridClient(t)
+	ctx := context.Background()
+
+	network := workloads.ZNet{
+		Name:    "net",
+		Nodes:   []uint32{12},
+		IPRange: gridtypes.NewIPNet(net.IPNet{IP: net.IPv4(10, 20, 0, 0), Mask: net.CIDRMask(16, 32)}),
+	}
+	require.NoError(t, tfPluginClient.NetworkDeployer.Deploy(ctx, &network))
+
+	vm := workloads.VM{Name: "vm", NetworkName: network.Name, CPU: 1, Memory: 1024, Flist: grid.FlistURL("base")}
+	dl := workloads.NewDeployment("vm", 12, "", nil, network.Name, nil, nil, []workloads.VM{vm}, nil)
+	require.NoError(t, tfPluginClient.DeploymentDeployer.Deploy(ctx, &dl))
+	contractID := dl.ContractID
+
+	err := tfPluginClient.DeploymentDeployer.UpdateVM(ctx, &dl, vm.Name, ResizeVM(2, 2048))
+	assert.ErrorIs(t, err, ErrRecreateRequired)
+	assert.Equal(t, 1, dl.Vms[0].CPU)
+
+	require.NoError(t, tfPluginClient.DeploymentDeployer.RecreateVM(ctx, &dl, vm.Name, ResizeVM(2, 2048)))
+	assert.Equal(t, contractID, dl.ContractID)
+
+	loadedVM, err := tfPluginClient.State.LoadVMFromGrid(ctx, 12, vm.Name, dl.Name)
+	require.NoError(t, err)
+	assert.Equal(t, 2, loadedVM.CPU)
+	assert.Equal(t, 2048, loadedVM.Memory)
+}
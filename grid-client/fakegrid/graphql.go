@@ -0,0 +1,115 @@
+package fakegrid
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	countQueryRegex    = regexp.MustCompile(`items: (\w+)Connection\(where: \{twinID_eq: (\d+), state_in: \[([^\]]*)\]\}`)
+	contractQueryRegex = regexp.MustCompile(`(nameContracts|nodeContracts|rentContracts)\(where: \{twinID_eq: (\d+), state_in: \[([^\]]*)\]\}`)
+)
+
+// graphqlHandler answers the contracts queries of the grid client
+type graphqlHandler struct {
+	grid *Grid
+}
+
+type graphqlContract struct {
+	ContractID     string `json:"contractID"`
+	State          string `json:"state"`
+	DeploymentData string `json:"deploymentData,omitempty"`
+	NodeID         uint32 `json:"nodeID,omitempty"`
+	Name           string `json:"name,omitempty"`
+}
+
+func (h *graphqlHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Query string `json:"query"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeGraphqlError(w, err.Error())
+		return
+	}
+
+	data := make(map[string]interface{})
+	if match := countQueryRegex.FindStringSubmatch(req.Query); match != nil {
+		contracts, err := h.contracts(match[1], match[2], match[3])
+		if err != nil {
+			writeGraphqlError(w, err.Error())
+			return
+		}
+		data["items"] = map[string]interface{}{"count": len(contracts)}
+	} else {
+		matches := contractQueryRegex.FindAllStringSubmatch(req.Query, -1)
+		if len(matches) == 0 {
+			writeGraphqlError(w, "unsupported query")
+			return
+		}
+		for _, match := range matches {
+			contracts, err := h.contracts(match[1], match[2], match[3])
+			if err != nil {
+				writeGraphqlError(w, err.Error())
+				return
+			}
+			data[match[1]] = contracts
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+// contracts returns the contracts of a type owned by a twin in one of the states
+func (h *graphqlHandler) contracts(items, twin, states string) ([]graphqlContract, error) {
+	twinID, err := strconv.ParseUint(twin, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	var stateList []string
+	for _, state := range strings.Split(states, ",") {
+		stateList = append(stateList, strings.TrimSpace(state))
+	}
+
+	h.grid.mu.Lock()
+	defer h.grid.mu.Unlock()
+
+	contracts := []graphqlContract{}
+	for _, id := range h.grid.sortedContractIDs() {
+		c := h.grid.contracts[id]
+		state := "Created"
+		if c.deleted {
+			state = "Deleted"
+		}
+		if uint64(c.twinID) != twinID || !slices.Contains(stateList, state) {
+			continue
+		}
+
+		contract := graphqlContract{ContractID: fmt.Sprint(c.id), State: state}
+		switch {
+		case items == "nameContracts" && c.typ == nameContract:
+			contract.Name = c.name
+		case items == "nodeContracts" && c.typ == nodeContract:
+			contract.NodeID = c.nodeID
+			contract.DeploymentData = c.data
+		case items == "rentContracts" && c.typ == rentContract:
+			contract.NodeID = c.nodeID
+		default:
+			continue
+		}
+		contracts = append(contracts, contract)
+	}
+	return contracts, nil
+}
+
+func writeGraphqlError(w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"errors": []map[string]string{{"message": msg}}})
+}
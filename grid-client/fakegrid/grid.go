@@ -0,0 +1,371 @@
+// Package fakegrid is an in memory grid to run grid client deployments without network access.
+// it simulates tfchain, zos nodes, the grid proxy and graphql from the same model so they are always consistent.
+package fakegrid
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/subi"
+	proxy "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/client"
+	"github.com/threefoldtech/tfgrid-sdk-go/rmb-sdk-go"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+)
+
+const (
+	// DefaultBalance is the balance of each account in units of 1e-7 TFT
+	DefaultBalance = 1000 * 10_000_000
+	// DefaultTFTPrice is the TFT price in mUSD
+	DefaultTFTPrice = 50
+
+	nodeTwinOffset = 10000
+)
+
+// Farm is a farm of the fake grid
+type Farm struct {
+	FarmID            uint32
+	Name              string
+	TwinID            uint32
+	Dedicated         bool
+	CertificationType string
+	// PublicIPs are the farm public ips that can be reserved by contracts
+	PublicIPs []PublicIP
+}
+
+// PublicIP is a farm public ip in cidr format with its gateway
+type PublicIP struct {
+	IP      string
+	Gateway string
+}
+
+// Node is a node of the fake grid
+type Node struct {
+	NodeID uint32
+	FarmID uint32
+	// TwinID is the node twin, it is generated if not set
+	TwinID    uint32
+	Country   string
+	City      string
+	Certified bool
+	// Status is the node status reported by the grid proxy, nodes that are not up don't answer rmb calls. it defaults to up
+	Status         string
+	TotalResources gridtypes.Capacity
+	// PublicIPv4 and PublicIPv6 are the node public config ips in cidr format, a node without both is hidden
+	PublicIPv4 string
+	PublicIPv6 string
+	// Domain is the node domain used by name gateways
+	Domain   string
+	PriceUsd float64
+}
+
+type contractType string
+
+const (
+	nodeContract contractType = "node"
+	nameContract contractType = "name"
+	rentContract contractType = "rent"
+)
+
+type contract struct {
+	id               uint64
+	twinID           uint32
+	typ              contractType
+	nodeID           uint32
+	name             string
+	hash             string
+	data             string
+	publicIPs        []substrate.PublicIP
+	solutionProvider *uint64
+	deleted          bool
+}
+
+type node struct {
+	Node
+	deployments map[uint64]gridtypes.Deployment
+	// rentContractID is the active rent contract of the node, it is 0 if the node is not rented
+	rentContractID uint64
+}
+
+type farm struct {
+	Farm
+	// ipContracts are the contracts reserving the farm public ips
+	ipContracts map[string]uint64
+}
+
+// Grid is an in memory grid
+type Grid struct {
+	mu sync.Mutex
+
+	twins      map[string]uint32
+	twinKeys   map[uint32][]byte
+	nextTwinID uint32
+
+	farms     map[uint32]*farm
+	nodes     map[uint32]*node
+	nodeTwins map[uint32]uint32
+
+	contracts      map[uint64]*contract
+	names          map[string]uint64
+	nextContractID uint64
+
+	failures map[gridtypes.WorkloadType]string
+
+	server *httptest.Server
+}
+
+// NewGrid creates a new empty fake grid
+func NewGrid() *Grid {
+	return &Grid{
+		twins:          make(map[string]uint32),
+		twinKeys:       make(map[uint32][]byte),
+		nextTwinID:     1,
+		farms:          make(map[uint32]*farm),
+		nodes:          make(map[uint32]*node),
+		nodeTwins:      make(map[uint32]uint32),
+		contracts:      make(map[uint64]*contract),
+		names:          make(map[string]uint64),
+		nextContractID: 1,
+		failures:       make(map[gridtypes.WorkloadType]string),
+	}
+}
+
+// AddFarm adds a farm to the grid
+func (g *Grid) AddFarm(f Farm) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, ok := g.farms[f.FarmID]; ok {
+		return errors.Errorf("farm %d already exists", f.FarmID)
+	}
+	for _, ip := range f.PublicIPs {
+		if _, _, err := net.ParseCIDR(ip.IP); err != nil {
+			return errors.Wrapf(err, "invalid farm %d public ip %s", f.FarmID, ip.IP)
+		}
+	}
+	if f.Name == "" {
+		f.Name = fmt.Sprintf("farm%d", f.FarmID)
+	}
+
+	g.farms[f.FarmID] = &farm{Farm: f, ipContracts: make(map[string]uint64)}
+	return nil
+}
+
+// AddNode adds a node to one of the grid farms
+func (g *Grid) AddNode(n Node) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, ok := g.nodes[n.NodeID]; ok {
+		return errors.Errorf("node %d already exists", n.NodeID)
+	}
+	if _, ok := g.farms[n.FarmID]; !ok {
+		return errors.Errorf("farm %d of node %d does not exist", n.FarmID, n.NodeID)
+	}
+	for _, ip := range []string{n.PublicIPv4, n.PublicIPv6} {
+		if ip == "" {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(ip); err != nil {
+			return errors.Wrapf(err, "invalid node %d public ip %s", n.NodeID, ip)
+		}
+	}
+	if n.TwinID == 0 {
+		n.TwinID = nodeTwinOffset + n.NodeID
+	}
+	if n.Status == "" {
+		n.Status = "up"
+	}
+
+	g.nodes[n.NodeID] = &node{Node: n, deployments: make(map[uint64]gridtypes.Deployment)}
+	g.nodeTwins[n.TwinID] = n.NodeID
+	return nil
+}
+
+// SetNodeStatus changes the node status, nodes that are not up don't answer rmb calls
+func (g *Grid) SetNodeStatus(nodeID uint32, status string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	n, ok := g.nodes[nodeID]
+	if !ok {
+		return errors.Errorf("node %d does not exist", nodeID)
+	}
+	n.Status = status
+	return nil
+}
+
+// FailWorkloads makes the nodes report an error state with the message for the workloads of the given type,
+// an empty message stops failing them
+func (g *Grid) FailWorkloads(wlType gridtypes.WorkloadType, message string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if message == "" {
+		delete(g.failures, wlType)
+		return
+	}
+	g.failures[wlType] = message
+}
+
+// NodeDeployments returns the deployments stored on a node sorted by contract ID
+func (g *Grid) NodeDeployments(nodeID uint32) []gridtypes.Deployment {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	n, ok := g.nodes[nodeID]
+	if !ok {
+		return nil
+	}
+	return n.sortedDeployments()
+}
+
+// ActiveContracts returns the IDs of the contracts that are not canceled
+func (g *Grid) ActiveContracts() []uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var ids []uint64
+	for id, c := range g.contracts {
+		if !c.deleted {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// SubstrateExt returns a tfchain client of the grid
+func (g *Grid) SubstrateExt() subi.SubstrateExt {
+	return &substrateClient{g}
+}
+
+// RMBClient returns an rmb client that routes calls to the grid nodes
+func (g *Grid) RMBClient() rmb.Client {
+	return &rmbClient{g}
+}
+
+// GridProxyClient returns a grid proxy client of the grid
+func (g *Grid) GridProxyClient() proxy.Client {
+	return &proxyClient{g}
+}
+
+// GraphQLURL returns the url of the grid graphql endpoint
+func (g *Grid) GraphQLURL() string {
+	return g.serverURL() + "/graphql"
+}
+
+// FlistURL returns the url of an flist served by the grid, its md5 checksum is the md5 of the name.
+// flists from the hub can't be used since loading k8s clusters requires the flist checksum.
+func (g *Grid) FlistURL(name string) string {
+	return fmt.Sprintf("%s/flists/%s.flist", g.serverURL(), name)
+}
+
+// serverURL returns the url of the in process http server of the grid, the server is started on first use
+func (g *Grid) serverURL() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.server == nil {
+		mux := http.NewServeMux()
+		mux.Handle("/graphql", &graphqlHandler{g})
+		mux.HandleFunc("/flists/", serveFlistChecksum)
+		g.server = httptest.NewServer(mux)
+	}
+	return g.server.URL
+}
+
+// Close stops the http server if it was started
+func (g *Grid) Close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.server != nil {
+		g.server.Close()
+		g.server = nil
+	}
+}
+
+// twinOf returns the twin of a public key, the twin is created if it doesn't exist
+func (g *Grid) twinOf(pk []byte) uint32 {
+	key := hex.EncodeToString(pk)
+	if twin, ok := g.twins[key]; ok {
+		return twin
+	}
+
+	twin := g.nextTwinID
+	g.nextTwinID++
+	g.twins[key] = twin
+	g.twinKeys[twin] = pk
+	return twin
+}
+
+// usedCapacity returns the capacity used by the node deployments
+func (n *node) usedCapacity() gridtypes.Capacity {
+	var used gridtypes.Capacity
+	for _, dl := range n.deployments {
+		for _, wl := range dl.Workloads {
+			if wl.Result.State == gridtypes.StateDeleted {
+				continue
+			}
+			wlCap, err := wl.Capacity()
+			if err != nil {
+				continue
+			}
+			used.Add(&wlCap)
+		}
+	}
+	return used
+}
+
+// rentedBy returns the twin renting the node or 0 if the node is not rented
+func (g *Grid) rentedBy(n *node) uint32 {
+	if n.rentContractID == 0 {
+		return 0
+	}
+	return g.contracts[n.rentContractID].twinID
+}
+
+// hasNodeContracts checks if the node has active node contracts
+func (g *Grid) hasNodeContracts(nodeID uint32) bool {
+	for _, c := range g.contracts {
+		if !c.deleted && c.typ == nodeContract && c.nodeID == nodeID {
+			return true
+		}
+	}
+	return false
+}
+
+// rentable checks if a node can be rented, dedicated farm nodes are always rentable while other nodes must be empty
+func (g *Grid) rentable(n *node) bool {
+	return n.rentContractID == 0 && (g.farms[n.FarmID].Dedicated || !g.hasNodeContracts(n.NodeID))
+}
+
+func (n *node) sortedDeployments() []gridtypes.Deployment {
+	var dls []gridtypes.Deployment
+	for _, dl := range n.deployments {
+		dls = append(dls, dl)
+	}
+	sort.Slice(dls, func(i, j int) bool { return dls[i].ContractID < dls[j].ContractID })
+	return dls
+}
+
+// serveFlistChecksum serves the md5 checksum of flists, the flists themselves are not served
+func serveFlistChecksum(w http.ResponseWriter, r *http.Request) {
+	name, ok := strings.CutSuffix(r.URL.Path, ".flist.md5")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	fmt.Fprintf(w, "%x\n", md5.Sum([]byte(path.Base(name))))
+}
@@ -0,0 +1,204 @@
+package fakegrid
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/graphql"
+	client "github.com/threefoldtech/tfgrid-sdk-go/grid-client/node"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
+)
+
+func newTestGrid(t *testing.T) (*Grid, substrate.Identity) {
+	grid := NewGrid()
+	t.Cleanup(grid.Close)
+
+	require.NoError(t, grid.AddFarm(Farm{FarmID: 1, PublicIPs: []PublicIP{{IP: "185.206.122.33/24", Gateway: "185.206.122.1"}}}))
+	require.NoError(t, grid.AddNode(Node{
+		NodeID:         11,
+		FarmID:         1,
+		TotalResources: gridtypes.Capacity{CRU: 4, MRU: 4 * gridtypes.Gigabyte, SRU: 100 * gridtypes.Gigabyte},
+		PublicIPv4:     "185.206.122.10/24",
+	}))
+	assert.Error(t, grid.AddNode(Node{NodeID: 12, FarmID: 2}))
+
+	identity, err := substrate.NewIdentityFromSr25519Phrase("//Alice")
+	require.NoError(t, err)
+	return grid, identity
+}
+
+func diskDeployment(t *testing.T, twinID uint32, size gridtypes.Unit) (gridtypes.Deployment, string) {
+	dl := workloads.NewGridDeployment(twinID, []gridtypes.Workload{{
+		Name: "disk",
+		Type: zos.ZMountType,
+		Data: gridtypes.MustMarshal(zos.ZMount{Size: size}),
+	}})
+
+	hash, err := hashOf(&dl)
+	require.NoError(t, err)
+	return dl, hash
+}
+
+func TestSubstrateContracts(t *testing.T) {
+	grid, identity := newTestGrid(t)
+	sub := grid.SubstrateExt()
+
+	twinID, err := sub.GetTwinByPubKey(identity.PublicKey())
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), twinID)
+
+	_, err = sub.CreateNodeContract(identity, 11, "", "hash1", 2, nil)
+	assert.ErrorContains(t, err, "enough public ips")
+
+	contractID, err := sub.CreateNodeContract(identity, 11, "data", "hash1", 1, nil)
+	require.NoError(t, err)
+
+	_, err = sub.CreateNodeContract(identity, 11, "", "hash1", 0, nil)
+	assert.ErrorContains(t, err, "same hash")
+
+	contract, err := sub.GetContract(contractID)
+	require.NoError(t, err)
+	assert.True(t, contract.IsCreated())
+	assert.Equal(t, uint32(1), contract.PublicIPCount())
+	assert.Equal(t, "data", contract.ContractType.NodeContract.DeploymentData)
+
+	nameContractID, err := sub.CreateNameContract(identity, "name")
+	require.NoError(t, err)
+	_, err = sub.CreateNameContract(identity, "name")
+	assert.Error(t, err)
+
+	id, err := sub.GetContractIDByNameRegistration("name")
+	require.NoError(t, err)
+	assert.Equal(t, nameContractID, id)
+
+	require.NoError(t, sub.BatchCancelContract(identity, []uint64{contractID, nameContractID}))
+	_, err = sub.GetContract(contractID)
+	assert.ErrorIs(t, err, substrate.ErrNotFound)
+	_, err = sub.GetContractIDByNameRegistration("name")
+	assert.ErrorIs(t, err, substrate.ErrNotFound)
+
+	assert.ErrorContains(t, sub.CancelContract(identity, contractID), "ContractNotExists")
+	assert.NoError(t, sub.EnsureContractCanceled(identity, contractID))
+
+	// the public ip is free again
+	_, err = sub.CreateNodeContract(identity, 11, "", "hash2", 1, nil)
+	assert.NoError(t, err)
+}
+
+func TestZosDeployments(t *testing.T) {
+	grid, identity := newTestGrid(t)
+	sub := grid.SubstrateExt()
+	ctx := context.Background()
+
+	twinID, err := sub.GetTwinByPubKey(identity.PublicKey())
+	require.NoError(t, err)
+
+	nodeClient, err := client.NewNodeClientPool(grid.RMBClient(), time.Minute).GetNodeClient(sub, 11)
+	require.NoError(t, err)
+
+	dl, hash := diskDeployment(t, twinID, 10*gridtypes.Gigabyte)
+	dl.ContractID, err = sub.CreateNodeContract(identity, 11, "", hash, 0, nil)
+	require.NoError(t, err)
+
+	// the deployment is not signed
+	assert.ErrorContains(t, nodeClient.DeploymentDeploy(ctx, dl), "signature")
+
+	require.NoError(t, dl.Sign(twinID, identity))
+	require.NoError(t, nodeClient.DeploymentDeploy(ctx, dl))
+
+	changes, err := nodeClient.DeploymentChanges(ctx, dl.ContractID)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, gridtypes.StateOk, changes[0].Result.State)
+
+	var result zos.ZMountResult
+	require.NoError(t, changes[0].Result.Unmarshal(&result))
+	assert.NotEmpty(t, result.ID)
+
+	// the node doesn't have enough storage for another deployment
+	other, hash := diskDeployment(t, twinID, 95*gridtypes.Gigabyte)
+	other.ContractID, err = sub.CreateNodeContract(identity, 11, "", hash, 0, nil)
+	require.NoError(t, err)
+	require.NoError(t, other.Sign(twinID, identity))
+	assert.ErrorContains(t, nodeClient.DeploymentDeploy(ctx, other), "capacity")
+
+	// the hash doesn't match the contract hash
+	other.Workloads[0].Description = "changed"
+	require.NoError(t, other.Sign(twinID, identity))
+	assert.ErrorContains(t, nodeClient.DeploymentDeploy(ctx, other), "hash")
+
+	grid.FailWorkloads(zos.ZMountType, "no space")
+	dl.Version = 1
+	dl.Workloads[0].Version = 1
+	hash, err = hashOf(&dl)
+	require.NoError(t, err)
+	_, err = sub.UpdateNodeContract(identity, dl.ContractID, "", hash)
+	require.NoError(t, err)
+	require.NoError(t, dl.Sign(twinID, identity))
+	require.NoError(t, nodeClient.DeploymentUpdate(ctx, dl))
+
+	changes, err = nodeClient.DeploymentChanges(ctx, dl.ContractID)
+	require.NoError(t, err)
+	assert.Equal(t, gridtypes.StateError, changes[0].Result.State)
+	assert.Equal(t, "no space", changes[0].Result.Error)
+
+	require.NoError(t, grid.SetNodeStatus(11, "down"))
+	assert.Error(t, nodeClient.IsNodeUp(ctx))
+
+	require.NoError(t, sub.CancelContract(identity, dl.ContractID))
+	assert.Empty(t, grid.NodeDeployments(11))
+}
+
+func TestProxyAndGraphql(t *testing.T) {
+	grid, identity := newTestGrid(t)
+	sub := grid.SubstrateExt()
+	proxyClient := grid.GridProxyClient()
+	ctx := context.Background()
+
+	twinID, err := sub.GetTwinByPubKey(identity.PublicKey())
+	require.NoError(t, err)
+
+	freeIPs := uint64(1)
+	nodes, count, err := proxyClient.Nodes(ctx, types.NodeFilter{FreeIPs: &freeIPs, Status: []string{"up"}}, types.Limit{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, "185.206.122.10/24", nodes[0].PublicConfig.Ipv4)
+
+	contractID, err := sub.CreateNodeContract(identity, 11, `{"type":"vm","name":"vm","projectName":"vm"}`, "hash", 1, nil)
+	require.NoError(t, err)
+
+	nodes, _, err = proxyClient.Nodes(ctx, types.NodeFilter{FreeIPs: &freeIPs}, types.Limit{})
+	require.NoError(t, err)
+	assert.Empty(t, nodes)
+
+	gql, err := graphql.NewGraphQl(grid.GraphQLURL())
+	require.NoError(t, err)
+	contractsGetter := graphql.NewContractsGetter(twinID, gql, sub, client.NewNodeClientPool(grid.RMBClient(), time.Minute))
+
+	contracts, err := contractsGetter.ListContractsByTwinID([]string{"Created", "GracePeriod"})
+	require.NoError(t, err)
+	require.Len(t, contracts.NodeContracts, 1)
+	assert.Equal(t, uint32(11), contracts.NodeContracts[0].NodeID)
+
+	require.NoError(t, sub.CancelContract(identity, contractID))
+	contracts, err = contractsGetter.ListContractsByTwinID([]string{"Created", "GracePeriod"})
+	require.NoError(t, err)
+	assert.Empty(t, contracts.NodeContracts)
+
+	checksum, err := workloads.GetFlistChecksum(grid.FlistURL("base"))
+	require.NoError(t, err)
+	assert.Len(t, checksum, 32)
+}
+
+func hashOf(dl *gridtypes.Deployment) (string, error) {
+	hash, err := dl.ChallengeHash()
+	return hex.EncodeToString(hash), err
+}
@@ -0,0 +1,418 @@
+package fakegrid
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	proxy "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/client"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+)
+
+// proxyClient is a grid proxy client that reads the grid model
+type proxyClient struct {
+	grid *Grid
+}
+
+var _ proxy.Client = (*proxyClient)(nil)
+
+// Ping always succeeds
+func (p *proxyClient) Ping() error {
+	return nil
+}
+
+// Nodes returns the nodes matching the filter
+func (p *proxyClient) Nodes(ctx context.Context, filter types.NodeFilter, limit types.Limit) ([]types.Node, int, error) {
+	p.grid.mu.Lock()
+	defer p.grid.mu.Unlock()
+
+	var res []types.Node
+	for _, id := range p.grid.sortedNodeIDs() {
+		n := p.grid.nodes[id]
+		if !p.grid.matchNode(n, filter) {
+			continue
+		}
+		res = append(res, p.grid.proxyNode(n))
+	}
+
+	total := len(res)
+	return paginate(res, limit), total, nil
+}
+
+// Farms returns the farms matching the filter
+func (p *proxyClient) Farms(ctx context.Context, filter types.FarmFilter, limit types.Limit) ([]types.Farm, int, error) {
+	p.grid.mu.Lock()
+	defer p.grid.mu.Unlock()
+
+	var ids []uint32
+	for id := range p.grid.farms {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	var res []types.Farm
+	for _, id := range ids {
+		f := p.grid.farms[id]
+		if filter.FarmID != nil && uint64(f.FarmID) != *filter.FarmID ||
+			filter.TwinID != nil && uint64(f.TwinID) != *filter.TwinID ||
+			filter.Name != nil && f.Name != *filter.Name ||
+			filter.Dedicated != nil && f.Dedicated != *filter.Dedicated ||
+			filter.FreeIPs != nil && uint64(f.freeIPs()) < *filter.FreeIPs {
+			continue
+		}
+		res = append(res, f.toProxy())
+	}
+
+	total := len(res)
+	return paginate(res, limit), total, nil
+}
+
+// Contracts returns the contracts matching the filter
+func (p *proxyClient) Contracts(ctx context.Context, filter types.ContractFilter, limit types.Limit) ([]types.Contract, int, error) {
+	p.grid.mu.Lock()
+	defer p.grid.mu.Unlock()
+
+	var res []types.Contract
+	for _, id := range p.grid.sortedContractIDs() {
+		c := p.grid.contracts[id]
+		proxyContract := p.grid.proxyContract(c)
+		if filter.ContractID != nil && c.id != *filter.ContractID ||
+			filter.TwinID != nil && uint64(c.twinID) != *filter.TwinID ||
+			filter.NodeID != nil && (c.typ == nameContract || uint64(c.nodeID) != *filter.NodeID) ||
+			filter.Type != nil && proxyContract.Type != *filter.Type ||
+			filter.Name != nil && c.name != *filter.Name ||
+			len(filter.State) != 0 && !slices.Contains(filter.State, proxyContract.State) {
+			continue
+		}
+		res = append(res, proxyContract)
+	}
+
+	total := len(res)
+	return paginate(res, limit), total, nil
+}
+
+// Contract returns a contract
+func (p *proxyClient) Contract(ctx context.Context, contractID uint32) (types.Contract, error) {
+	p.grid.mu.Lock()
+	defer p.grid.mu.Unlock()
+
+	c, ok := p.grid.contracts[uint64(contractID)]
+	if !ok {
+		return types.Contract{}, errors.Errorf("contract %d not found", contractID)
+	}
+	return p.grid.proxyContract(c), nil
+}
+
+// ContractBills returns no bills, the fake grid doesn't bill contracts
+func (p *proxyClient) ContractBills(ctx context.Context, contractID uint32, limit types.Limit) ([]types.ContractBilling, uint, error) {
+	return []types.ContractBilling{}, 0, nil
+}
+
+// Twins returns the twins matching the filter
+func (p *proxyClient) Twins(ctx context.Context, filter types.TwinFilter, limit types.Limit) ([]types.Twin, int, error) {
+	p.grid.mu.Lock()
+	defer p.grid.mu.Unlock()
+
+	var ids []uint32
+	for id := range p.grid.twinKeys {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	var res []types.Twin
+	for _, id := range ids {
+		twin := types.Twin{TwinID: uint(id), PublicKey: hex.EncodeToString(p.grid.twinKeys[id])}
+		if filter.TwinID != nil && uint64(id) != *filter.TwinID ||
+			filter.PublicKey != nil && twin.PublicKey != *filter.PublicKey {
+			continue
+		}
+		res = append(res, twin)
+	}
+
+	total := len(res)
+	return paginate(res, limit), total, nil
+}
+
+// Node returns a node
+func (p *proxyClient) Node(ctx context.Context, nodeID uint32) (types.NodeWithNestedCapacity, error) {
+	p.grid.mu.Lock()
+	defer p.grid.mu.Unlock()
+
+	n, ok := p.grid.nodes[nodeID]
+	if !ok {
+		return types.NodeWithNestedCapacity{}, errors.Errorf("node %d not found", nodeID)
+	}
+
+	node := p.grid.proxyNode(n)
+	return types.NodeWithNestedCapacity{
+		ID:                node.ID,
+		NodeID:            node.NodeID,
+		FarmID:            node.FarmID,
+		FarmName:          node.FarmName,
+		TwinID:            node.TwinID,
+		Country:           node.Country,
+		City:              node.City,
+		Capacity:          types.CapacityResult{Total: node.TotalResources, Used: node.UsedResources},
+		Location:          node.Location,
+		PublicConfig:      node.PublicConfig,
+		Status:            node.Status,
+		CertificationType: node.CertificationType,
+		Dedicated:         node.Dedicated,
+		InDedicatedFarm:   node.InDedicatedFarm,
+		RentContractID:    node.RentContractID,
+		RentedByTwinID:    node.RentedByTwinID,
+		Rented:            node.Rented,
+		Rentable:          node.Rentable,
+		Healthy:           node.Healthy,
+		PriceUsd:          node.PriceUsd,
+	}, nil
+}
+
+// NodeStatus returns the status of a node
+func (p *proxyClient) NodeStatus(ctx context.Context, nodeID uint32) (types.NodeStatus, error) {
+	p.grid.mu.Lock()
+	defer p.grid.mu.Unlock()
+
+	n, ok := p.grid.nodes[nodeID]
+	if !ok {
+		return types.NodeStatus{}, errors.Errorf("node %d not found", nodeID)
+	}
+	return types.NodeStatus{Status: n.Status}, nil
+}
+
+// Stats returns the grid statistics
+func (p *proxyClient) Stats(ctx context.Context, filter types.StatsFilter) (types.Stats, error) {
+	p.grid.mu.Lock()
+	defer p.grid.mu.Unlock()
+
+	stats := types.Stats{
+		Farms:             int64(len(p.grid.farms)),
+		Twins:             int64(len(p.grid.twinKeys)),
+		NodesDistribution: make(map[string]int64),
+	}
+	for _, c := range p.grid.contracts {
+		if !c.deleted {
+			stats.Contracts++
+		}
+	}
+	for _, f := range p.grid.farms {
+		stats.PublicIPs += int64(len(f.PublicIPs))
+	}
+	for _, n := range p.grid.nodes {
+		if len(filter.Status) != 0 && !slices.Contains(filter.Status, n.Status) {
+			continue
+		}
+		stats.Nodes++
+		stats.NodesDistribution[n.Country]++
+		stats.TotalCRU += int64(n.TotalResources.CRU)
+		stats.TotalMRU += int64(n.TotalResources.MRU)
+		stats.TotalSRU += int64(n.TotalResources.SRU)
+		stats.TotalHRU += int64(n.TotalResources.HRU)
+		if n.PublicIPv4 != "" || n.PublicIPv6 != "" {
+			stats.AccessNodes++
+		}
+		if n.Domain != "" {
+			stats.Gateways++
+		}
+		for _, dl := range n.deployments {
+			stats.WorkloadsNumber += uint32(len(dl.Workloads))
+		}
+	}
+	stats.Countries = int64(len(stats.NodesDistribution))
+	return stats, nil
+}
+
+// matchNode checks if a node matches the supported node filters
+func (g *Grid) matchNode(n *node, filter types.NodeFilter) bool {
+	f := g.farms[n.FarmID]
+	total := n.TotalResources
+	used := n.usedCapacity()
+
+	switch {
+	case len(filter.Status) != 0 && !slices.Contains(filter.Status, n.Status),
+		filter.FreeMRU != nil && uint64(total.MRU-used.MRU) < *filter.FreeMRU,
+		filter.FreeSRU != nil && uint64(total.SRU-used.SRU) < *filter.FreeSRU,
+		filter.FreeHRU != nil && uint64(total.HRU-used.HRU) < *filter.FreeHRU,
+		filter.TotalCRU != nil && total.CRU < *filter.TotalCRU,
+		filter.FreeIPs != nil && uint64(f.freeIPs()) < *filter.FreeIPs,
+		len(filter.FarmIDs) != 0 && !slices.Contains(filter.FarmIDs, uint64(n.FarmID)),
+		filter.NodeID != nil && uint64(n.NodeID) != *filter.NodeID,
+		len(filter.NodeIDs) != 0 && !slices.Contains(filter.NodeIDs, uint64(n.NodeID)),
+		slices.Contains(filter.Excluded, uint64(n.NodeID)),
+		filter.TwinID != nil && uint64(n.TwinID) != *filter.TwinID,
+		filter.IPv4 != nil && (n.PublicIPv4 != "") != *filter.IPv4,
+		filter.IPv6 != nil && (n.PublicIPv6 != "") != *filter.IPv6,
+		filter.HasIpv6 != nil && (n.PublicIPv6 != "") != *filter.HasIpv6,
+		filter.Domain != nil && (n.Domain != "") != *filter.Domain,
+		filter.Country != nil && !strings.EqualFold(n.Country, *filter.Country),
+		filter.City != nil && !strings.EqualFold(n.City, *filter.City),
+		filter.FarmName != nil && f.Name != *filter.FarmName,
+		filter.InDedicatedFarm != nil && f.Dedicated != *filter.InDedicatedFarm,
+		filter.CertificationType != nil && !strings.EqualFold(certification(n.Certified), *filter.CertificationType),
+		filter.PriceMin != nil && n.PriceUsd < *filter.PriceMin,
+		filter.PriceMax != nil && n.PriceUsd > *filter.PriceMax,
+		filter.Rented != nil && (n.rentContractID != 0) != *filter.Rented,
+		filter.RentedBy != nil && uint64(g.rentedBy(n)) != *filter.RentedBy,
+		filter.Rentable != nil && g.rentable(n) != *filter.Rentable,
+		filter.AvailableFor != nil && !g.availableFor(n, uint32(*filter.AvailableFor)),
+		filter.Dedicated != nil && f.Dedicated != *filter.Dedicated,
+		filter.HasGPU != nil && *filter.HasGPU:
+		return false
+	}
+	return true
+}
+
+// availableFor checks if a twin can deploy on a node, rented nodes are only available for their renter
+func (g *Grid) availableFor(n *node, twin uint32) bool {
+	renter := g.rentedBy(n)
+	if renter != 0 {
+		return renter == twin
+	}
+	return !g.farms[n.FarmID].Dedicated
+}
+
+func (g *Grid) proxyNode(n *node) types.Node {
+	f := g.farms[n.FarmID]
+	used := n.usedCapacity()
+
+	node := types.Node{
+		ID:                fmt.Sprintf("node-%d", n.NodeID),
+		NodeID:            int(n.NodeID),
+		FarmID:            int(n.FarmID),
+		FarmName:          f.Name,
+		TwinID:            int(n.TwinID),
+		Country:           n.Country,
+		City:              n.City,
+		TotalResources:    toProxyCapacity(n.TotalResources),
+		UsedResources:     toProxyCapacity(used),
+		Location:          types.Location{Country: n.Country, City: n.City},
+		PublicConfig:      types.PublicConfig{Domain: n.Domain, Ipv4: n.PublicIPv4, Ipv6: n.PublicIPv6},
+		Status:            n.Status,
+		CertificationType: certification(n.Certified),
+		InDedicatedFarm:   f.Dedicated,
+		Dedicated:         f.Dedicated,
+		Rentable:          g.rentable(n),
+		Rented:            n.rentContractID != 0,
+		RentContractID:    uint(n.rentContractID),
+		RentedByTwinID:    uint(g.rentedBy(n)),
+		Healthy:           n.Status == "up",
+		PriceUsd:          n.PriceUsd,
+	}
+	return node
+}
+
+func (g *Grid) proxyContract(c *contract) types.Contract {
+	res := types.Contract{
+		ContractID: uint(c.id),
+		TwinID:     uint(c.twinID),
+		State:      "Created",
+		Type:       string(c.typ),
+	}
+	if c.deleted {
+		res.State = "Deleted"
+	}
+
+	switch c.typ {
+	case nameContract:
+		res.Details = types.NameContractDetails{Name: c.name}
+	case nodeContract:
+		n := g.nodes[c.nodeID]
+		res.Details = types.NodeContractDetails{
+			NodeID:            uint(c.nodeID),
+			DeploymentData:    c.data,
+			DeploymentHash:    c.hash,
+			NumberOfPublicIps: uint(len(c.publicIPs)),
+			FarmName:          g.farms[n.FarmID].Name,
+			FarmId:            uint64(n.FarmID),
+		}
+	case rentContract:
+		n := g.nodes[c.nodeID]
+		res.Details = types.RentContractDetails{
+			NodeID:   uint(c.nodeID),
+			FarmName: g.farms[n.FarmID].Name,
+			FarmId:   uint64(n.FarmID),
+		}
+	}
+	return res
+}
+
+func (f *farm) freeIPs() int {
+	return len(f.PublicIPs) - len(f.ipContracts)
+}
+
+func (f *farm) toProxy() types.Farm {
+	res := types.Farm{
+		Name:              f.Name,
+		FarmID:            int(f.FarmID),
+		TwinID:            int(f.TwinID),
+		PricingPolicyID:   1,
+		CertificationType: f.CertificationType,
+		Dedicated:         f.Dedicated,
+		PublicIps:         []types.PublicIP{},
+	}
+	if res.CertificationType == "" {
+		res.CertificationType = "NotCertified"
+	}
+
+	for i, ip := range f.PublicIPs {
+		res.PublicIps = append(res.PublicIps, types.PublicIP{
+			ID:         fmt.Sprintf("%d-%d", f.FarmID, i),
+			IP:         ip.IP,
+			FarmID:     fmt.Sprint(f.FarmID),
+			ContractID: int(f.ipContracts[ip.IP]),
+			Gateway:    ip.Gateway,
+		})
+	}
+	return res
+}
+
+func (g *Grid) sortedNodeIDs() []uint32 {
+	var ids []uint32
+	for id := range g.nodes {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func (g *Grid) sortedContractIDs() []uint64 {
+	var ids []uint64
+	for id := range g.contracts {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func toProxyCapacity(c gridtypes.Capacity) types.Capacity {
+	return types.Capacity{CRU: c.CRU, SRU: c.SRU, HRU: c.HRU, MRU: c.MRU}
+}
+
+func certification(certified bool) string {
+	if certified {
+		return "Certified"
+	}
+	return "Diy"
+}
+
+// paginate returns a page of the results, an unset page size returns all of them
+func paginate[T any](res []T, limit types.Limit) []T {
+	if limit.Size == 0 {
+		return res
+	}
+
+	page := limit.Page
+	if page == 0 {
+		page = 1
+	}
+	start := (page - 1) * limit.Size
+	if start >= uint64(len(res)) {
+		return nil
+	}
+	end := min(start+limit.Size, uint64(len(res)))
+	return res[start:end]
+}
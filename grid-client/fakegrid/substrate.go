@@ -0,0 +1,503 @@
+package fakegrid
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/subi"
+)
+
+// errContractNotExists matches the tfchain error of canceling a missing contract
+var errContractNotExists = errors.New("ContractNotExists")
+
+// substrateClient simulates tfchain on top of the grid model
+type substrateClient struct {
+	grid *Grid
+}
+
+var _ subi.SubstrateExt = (*substrateClient)(nil)
+
+// CancelContract cancels a contract of the identity twin
+func (s *substrateClient) CancelContract(identity substrate.Identity, contractID uint64) error {
+	if contractID == 0 {
+		return nil
+	}
+
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	return chainError("CancelContract", s.grid.cancelContract(s.grid.twinOf(identity.PublicKey()), contractID))
+}
+
+// CreateNodeContract creates a node contract and reserves its public ips
+func (s *substrateClient) CreateNodeContract(identity substrate.Identity, node uint32, body string, hash string, publicIPs uint32, solutionProviderID *uint64) (uint64, error) {
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	id, err := s.grid.createNodeContract(s.grid.twinOf(identity.PublicKey()), node, body, hash, publicIPs, solutionProviderID)
+	return id, chainError("CreateNodeContract", err)
+}
+
+// UpdateNodeContract updates the hash and data of a node contract, an empty body keeps the contract data
+func (s *substrateClient) UpdateNodeContract(identity substrate.Identity, contractID uint64, body string, hash string) (uint64, error) {
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	c, err := s.grid.ownedContract(s.grid.twinOf(identity.PublicKey()), contractID)
+	if err != nil {
+		return 0, err
+	}
+	if c.typ != nodeContract {
+		return 0, errors.Errorf("contract %d is not a node contract", contractID)
+	}
+
+	c.hash = hash
+	if body != "" {
+		c.data = body
+	}
+	return contractID, nil
+}
+
+// Close does nothing, the grid is closed by its owner
+func (s *substrateClient) Close() {}
+
+// GetTwinByPubKey returns the twin of a public key, twins are created on first use
+func (s *substrateClient) GetTwinByPubKey(pk []byte) (uint32, error) {
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	return s.grid.twinOf(pk), nil
+}
+
+// EnsureContractCanceled cancels a contract if it exists
+func (s *substrateClient) EnsureContractCanceled(identity substrate.Identity, contractID uint64) error {
+	err := s.CancelContract(identity, contractID)
+	if errors.Is(err, errContractNotExists) {
+		return nil
+	}
+	return err
+}
+
+// DeleteInvalidContracts removes the contracts that are not valid
+func (s *substrateClient) DeleteInvalidContracts(contracts map[uint32]uint64) error {
+	for node, contractID := range contracts {
+		valid, err := s.IsValidContract(contractID)
+		if err != nil {
+			return err
+		}
+		if !valid {
+			delete(contracts, node)
+		}
+	}
+	return nil
+}
+
+// IsValidContract checks if a contract exists and is not canceled
+func (s *substrateClient) IsValidContract(contractID uint64) (bool, error) {
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	c, ok := s.grid.contracts[contractID]
+	return ok && !c.deleted, nil
+}
+
+// InvalidateNameContract cancels a name contract if its name doesn't match
+func (s *substrateClient) InvalidateNameContract(ctx context.Context, identity substrate.Identity, contractID uint64, name string) (uint64, error) {
+	if contractID == 0 {
+		return 0, nil
+	}
+
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	c, ok := s.grid.contracts[contractID]
+	if !ok || c.deleted {
+		return 0, nil
+	}
+
+	if c.name != name {
+		if err := s.grid.cancelContract(s.grid.twinOf(identity.PublicKey()), contractID); err != nil {
+			return 0, errors.Wrap(err, "failed to cleanup unmatched name contract")
+		}
+		return 0, nil
+	}
+
+	return contractID, nil
+}
+
+// GetContract returns a contract, canceled contracts are not found like on tfchain
+func (s *substrateClient) GetContract(contractID uint64) (subi.Contract, error) {
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	c, ok := s.grid.contracts[contractID]
+	if !ok || c.deleted {
+		return subi.Contract{}, substrate.ErrNotFound
+	}
+	return subi.Contract{Contract: c.toSubstrate()}, nil
+}
+
+// GetNodeTwin returns the twin of a node
+func (s *substrateClient) GetNodeTwin(nodeID uint32) (uint32, error) {
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	n, ok := s.grid.nodes[nodeID]
+	if !ok {
+		return 0, substrate.ErrNotFound
+	}
+	return n.TwinID, nil
+}
+
+// CreateNameContract creates a name contract, names are unique
+func (s *substrateClient) CreateNameContract(identity substrate.Identity, name string) (uint64, error) {
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	id, err := s.grid.createNameContract(s.grid.twinOf(identity.PublicKey()), name)
+	return id, chainError("CreateNameContract", err)
+}
+
+// GetAccount returns the account of the identity with the default balance
+func (s *substrateClient) GetAccount(identity substrate.Identity) (substrate.AccountInfo, error) {
+	balance, err := s.GetBalance(identity)
+	return substrate.AccountInfo{Data: balance}, err
+}
+
+// GetBalance returns the default balance, the fake grid doesn't bill contracts
+func (s *substrateClient) GetBalance(identity substrate.Identity) (substrate.Balance, error) {
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	s.grid.twinOf(identity.PublicKey())
+	return substrate.Balance{Free: types.NewU128(*big.NewInt(DefaultBalance))}, nil
+}
+
+// GetTFTPrice returns the TFT price in mUSD
+func (s *substrateClient) GetTFTPrice() (types.U32, error) {
+	return DefaultTFTPrice, nil
+}
+
+// GetPricingPolicy returns a pricing policy with the main net values
+func (s *substrateClient) GetPricingPolicy(policyID uint32) (substrate.PricingPolicy, error) {
+	if policyID != 1 {
+		return substrate.PricingPolicy{}, substrate.ErrNotFound
+	}
+
+	return substrate.PricingPolicy{
+		ID:                     types.U32(policyID),
+		Name:                   "threefold_default_pricing_policy",
+		SU:                     substrate.Policy{Value: 50000},
+		CU:                     substrate.Policy{Value: 100000},
+		NU:                     substrate.Policy{Value: 15000},
+		IPU:                    substrate.Policy{Value: 40000},
+		UniqueName:             substrate.Policy{Value: 2500},
+		DomainName:             substrate.Policy{Value: 5000},
+		DedicatedNodesDiscount: 50,
+	}, nil
+}
+
+// GetTwinPK returns the public key of a twin
+func (s *substrateClient) GetTwinPK(twinID uint32) ([]byte, error) {
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	pk, ok := s.grid.twinKeys[twinID]
+	if !ok {
+		return nil, substrate.ErrNotFound
+	}
+	return pk, nil
+}
+
+// GetContractIDByNameRegistration returns the contract of a name
+func (s *substrateClient) GetContractIDByNameRegistration(name string) (uint64, error) {
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	id, ok := s.grid.names[name]
+	if !ok {
+		return 0, substrate.ErrNotFound
+	}
+	return id, nil
+}
+
+// BatchCreateContract creates contracts until one of them fails and returns the index of the failing contract
+func (s *substrateClient) BatchCreateContract(identity substrate.Identity, contractsData []substrate.BatchCreateContractData) ([]uint64, *int, error) {
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	twin := s.grid.twinOf(identity.PublicKey())
+	contracts := make([]uint64, 0, len(contractsData))
+	for i, data := range contractsData {
+		id, err := s.grid.createBatchContract(twin, data)
+		if err != nil {
+			return contracts, &i, chainError("BatchCreateContract", errors.Wrap(err, "failed to create contracts"))
+		}
+		contracts = append(contracts, id)
+	}
+	return contracts, nil, nil
+}
+
+// BatchAllCreateContract creates all contracts or none of them
+func (s *substrateClient) BatchAllCreateContract(identity substrate.Identity, contractsData []substrate.BatchCreateContractData) ([]uint64, error) {
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	twin := s.grid.twinOf(identity.PublicKey())
+	contracts := make([]uint64, 0, len(contractsData))
+	for _, data := range contractsData {
+		id, err := s.grid.createBatchContract(twin, data)
+		if err != nil {
+			for _, created := range contracts {
+				_ = s.grid.cancelContract(twin, created)
+			}
+			return nil, chainError("BatchAllCreateContract", errors.Wrap(err, "failed to create contracts"))
+		}
+		contracts = append(contracts, id)
+	}
+	return contracts, nil
+}
+
+// BatchCancelContract cancels all contracts or none of them
+func (s *substrateClient) BatchCancelContract(identity substrate.Identity, contracts []uint64) error {
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	twin := s.grid.twinOf(identity.PublicKey())
+	for _, id := range contracts {
+		if _, err := s.grid.ownedContract(twin, id); err != nil {
+			return err
+		}
+	}
+	for _, id := range contracts {
+		if err := s.grid.cancelContract(twin, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateRentContract rents a node, the node must not be rented or have active node contracts
+func (s *substrateClient) CreateRentContract(identity substrate.Identity, nodeID uint32, solutionProviderID *uint64) (uint64, error) {
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	id, err := s.grid.createRentContract(s.grid.twinOf(identity.PublicKey()), nodeID, solutionProviderID)
+	return id, chainError("CreateRentContract", err)
+}
+
+// GetNodeRentContract returns the active rent contract of a node
+func (s *substrateClient) GetNodeRentContract(nodeID uint32) (uint64, error) {
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	n, ok := s.grid.nodes[nodeID]
+	if !ok || n.rentContractID == 0 {
+		return 0, substrate.ErrNotFound
+	}
+	return n.rentContractID, nil
+}
+
+// CancelRentContract cancels a rent contract of the identity twin
+func (s *substrateClient) CancelRentContract(identity substrate.Identity, contractID uint64) error {
+	if contractID == 0 {
+		return nil
+	}
+
+	s.grid.mu.Lock()
+	defer s.grid.mu.Unlock()
+
+	twin := s.grid.twinOf(identity.PublicKey())
+	c, err := s.grid.ownedContract(twin, contractID)
+	if err != nil {
+		return err
+	}
+	if c.typ != rentContract {
+		return errors.Errorf("contract %d is not a rent contract", contractID)
+	}
+	return s.grid.cancelContract(twin, contractID)
+}
+
+// ownedContract returns an active contract of the twin
+func (g *Grid) ownedContract(twin uint32, contractID uint64) (*contract, error) {
+	c, ok := g.contracts[contractID]
+	if !ok || c.deleted {
+		return nil, errors.Wrapf(errContractNotExists, "contract %d", contractID)
+	}
+	if c.twinID != twin {
+		return nil, errors.Errorf("twin %d is not authorized to use contract %d", twin, contractID)
+	}
+	return c, nil
+}
+
+func (g *Grid) createBatchContract(twin uint32, data substrate.BatchCreateContractData) (uint64, error) {
+	if data.Name != "" {
+		return g.createNameContract(twin, data.Name)
+	}
+	return g.createNodeContract(twin, data.Node, data.Body, data.Hash, data.PublicIPs, data.SolutionProviderID)
+}
+
+func (g *Grid) createNodeContract(twin uint32, nodeID uint32, body string, hash string, publicIPs uint32, solutionProviderID *uint64) (uint64, error) {
+	n, ok := g.nodes[nodeID]
+	if !ok {
+		return 0, errors.Errorf("node %d does not exist", nodeID)
+	}
+
+	renter := g.rentedBy(n)
+	if renter != 0 && renter != twin {
+		return 0, errors.Errorf("node %d is rented by twin %d", nodeID, renter)
+	}
+	if renter == 0 && g.farms[n.FarmID].Dedicated {
+		return 0, errors.Errorf("node %d is dedicated and has to be rented first", nodeID)
+	}
+
+	for _, c := range g.contracts {
+		if !c.deleted && c.typ == nodeContract && c.nodeID == nodeID && c.hash == hash {
+			return 0, errors.Errorf("contract with the same hash already exists on node %d", nodeID)
+		}
+	}
+
+	f := g.farms[n.FarmID]
+	var free []PublicIP
+	for _, ip := range f.PublicIPs {
+		if _, reserved := f.ipContracts[ip.IP]; !reserved {
+			free = append(free, ip)
+		}
+	}
+	if uint32(len(free)) < publicIPs {
+		return 0, errors.Errorf("farm %d doesn't have enough public ips: %d requested, %d free", f.FarmID, publicIPs, len(free))
+	}
+
+	c := &contract{
+		id:               g.nextContractID,
+		twinID:           twin,
+		typ:              nodeContract,
+		nodeID:           nodeID,
+		hash:             hash,
+		data:             body,
+		solutionProvider: solutionProviderID,
+	}
+	g.nextContractID++
+
+	for _, ip := range free[:publicIPs] {
+		f.ipContracts[ip.IP] = c.id
+		c.publicIPs = append(c.publicIPs, substrate.PublicIP{IP: ip.IP, Gateway: ip.Gateway, ContractID: types.U64(c.id)})
+	}
+
+	g.contracts[c.id] = c
+	return c.id, nil
+}
+
+func (g *Grid) createNameContract(twin uint32, name string) (uint64, error) {
+	if _, ok := g.names[name]; ok {
+		return 0, errors.Errorf("name %s is already registered", name)
+	}
+
+	c := &contract{
+		id:     g.nextContractID,
+		twinID: twin,
+		typ:    nameContract,
+		name:   name,
+	}
+	g.nextContractID++
+
+	g.contracts[c.id] = c
+	g.names[name] = c.id
+	return c.id, nil
+}
+
+func (g *Grid) createRentContract(twin uint32, nodeID uint32, solutionProviderID *uint64) (uint64, error) {
+	n, ok := g.nodes[nodeID]
+	if !ok {
+		return 0, errors.Errorf("node %d does not exist", nodeID)
+	}
+	if n.rentContractID != 0 {
+		return 0, errors.Errorf("node %d is already rented", nodeID)
+	}
+	if g.hasNodeContracts(nodeID) {
+		return 0, errors.Errorf("node %d has active contracts", nodeID)
+	}
+
+	c := &contract{
+		id:               g.nextContractID,
+		twinID:           twin,
+		typ:              rentContract,
+		nodeID:           nodeID,
+		solutionProvider: solutionProviderID,
+	}
+	g.nextContractID++
+
+	g.contracts[c.id] = c
+	n.rentContractID = c.id
+	return c.id, nil
+}
+
+// cancelContract cancels a contract, frees its public ips and removes its deployment from the node
+func (g *Grid) cancelContract(twin uint32, contractID uint64) error {
+	c, err := g.ownedContract(twin, contractID)
+	if err != nil {
+		return err
+	}
+
+	if c.typ == rentContract && g.hasNodeContracts(c.nodeID) {
+		return errors.Errorf("node %d of rent contract %d has active contracts", c.nodeID, contractID)
+	}
+
+	c.deleted = true
+	switch c.typ {
+	case rentContract:
+		g.nodes[c.nodeID].rentContractID = 0
+	case nameContract:
+		delete(g.names, c.name)
+	case nodeContract:
+		n := g.nodes[c.nodeID]
+		delete(n.deployments, c.id)
+
+		f := g.farms[n.FarmID]
+		for _, ip := range c.publicIPs {
+			delete(f.ipContracts, ip.IP)
+		}
+	}
+	return nil
+}
+
+func (c *contract) toSubstrate() *substrate.Contract {
+	res := substrate.Contract{
+		State:      substrate.ContractState{IsCreated: !c.deleted, IsDeleted: c.deleted},
+		ContractID: types.U64(c.id),
+		TwinID:     types.U32(c.twinID),
+	}
+	if c.solutionProvider != nil {
+		res.SolutionProviderID = types.NewOptionU64(types.U64(*c.solutionProvider))
+	}
+
+	switch c.typ {
+	case nameContract:
+		res.ContractType.IsNameContract = true
+		res.ContractType.NameContract.Name = c.name
+	case nodeContract:
+		res.ContractType.IsNodeContract = true
+		res.ContractType.NodeContract = substrate.NodeContract{
+			Node:           types.U32(c.nodeID),
+			DeploymentHash: substrate.NewHexHash(c.hash),
+			DeploymentData: c.data,
+			PublicIPsCount: types.U32(len(c.publicIPs)),
+			PublicIPs:      c.publicIPs,
+		}
+	case rentContract:
+		res.ContractType.IsRentContract = true
+		res.ContractType.RentContract.Node = types.U32(c.nodeID)
+	}
+	return &res
+}
+
+// chainError wraps the error of an extrinsic like the substrate client does
+func chainError(call string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &subi.ChainError{Call: call, Err: err}
+}
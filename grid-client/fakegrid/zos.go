@@ -0,0 +1,415 @@
+package fakegrid
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+
+	"github.com/pkg/errors"
+	client "github.com/threefoldtech/tfgrid-sdk-go/grid-client/node"
+	"github.com/threefoldtech/tfgrid-sdk-go/rmb-sdk-go"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
+)
+
+// rmbClient routes rmb calls to the simulated zos of the grid nodes
+type rmbClient struct {
+	grid *Grid
+}
+
+type contractArgs struct {
+	ContractID uint64 `json:"contract_id"`
+}
+
+type networkArgs struct {
+	NetworkName string `json:"network_name"`
+}
+
+// Call runs a zos command on the node of the destination twin
+func (c *rmbClient) Call(ctx context.Context, twin uint32, fn string, data interface{}, result interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// data and result go through json like they do over rmb
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode request")
+	}
+
+	c.grid.mu.Lock()
+	defer c.grid.mu.Unlock()
+
+	nodeID, ok := c.grid.nodeTwins[twin]
+	if !ok {
+		return errors.Errorf("twin %d is not a node twin", twin)
+	}
+	n := c.grid.nodes[nodeID]
+	if n.Status != "up" {
+		return errors.Errorf("node %d is %s", nodeID, n.Status)
+	}
+
+	res, err := c.grid.handle(n, fn, payload)
+	if err != nil {
+		// zos errors reach the caller as remote errors like they do over rmb
+		return rmb.RemoteError{Message: err.Error()}
+	}
+
+	if result == nil {
+		return nil
+	}
+	out, err := json.Marshal(res)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode response")
+	}
+	return json.Unmarshal(out, result)
+}
+
+// handle runs a zos command on a node
+func (g *Grid) handle(n *node, fn string, payload []byte) (interface{}, error) {
+	switch fn {
+	case "zos.deployment.deploy":
+		return nil, g.deploy(n, payload, false)
+	case "zos.deployment.update":
+		return nil, g.deploy(n, payload, true)
+	case "zos.deployment.get":
+		return n.deployment(payload)
+	case "zos.deployment.changes":
+		dl, err := n.deployment(payload)
+		return dl.Workloads, err
+	case "zos.deployment.delete":
+		dl, err := n.deployment(payload)
+		if err != nil {
+			return nil, err
+		}
+		delete(n.deployments, dl.ContractID)
+		return nil, nil
+	case "zos.deployment.list":
+		return n.sortedDeployments(), nil
+	case "zos.statistics.get":
+		return map[string]gridtypes.Capacity{"total": n.TotalResources, "used": n.usedCapacity()}, nil
+	case "zos.system.version":
+		return client.Version{ZOS: "fake", ZInit: "fake"}, nil
+	case "zos.storage.pools":
+		return []client.PoolMetrics{
+			{Name: "ssd", Type: zos.SSDDevice, Size: n.TotalResources.SRU, Used: n.usedCapacity().SRU},
+			{Name: "hdd", Type: zos.HDDDevice, Size: n.TotalResources.HRU, Used: n.usedCapacity().HRU},
+		}, nil
+	case "zos.gpu.list":
+		return []client.GPU{}, nil
+	case "zos.network.list_wg_ports":
+		return n.wgPorts(), nil
+	case "zos.network.list_private_ips":
+		var args networkArgs
+		if err := json.Unmarshal(payload, &args); err != nil {
+			return nil, errors.Wrap(err, "invalid request")
+		}
+		return n.privateIPs(gridtypes.Name(args.NetworkName)), nil
+	case "zos.network.interfaces":
+		return map[string][]net.IP{"zos": {net.IPv4(192, 168, 123, byte(n.NodeID))}}, nil
+	case "zos.network.public_config_get":
+		return n.publicConfig()
+	case "zos.network.list_public_ips":
+		return g.nodePublicIPs(n), nil
+	case "zos.network.has_ipv6":
+		return n.PublicIPv6 != "", nil
+	}
+
+	return nil, errors.Errorf("unknown command %s", fn)
+}
+
+// deploy stores a new or updated deployment after checking it like zos does
+func (g *Grid) deploy(n *node, payload []byte, update bool) error {
+	var dl gridtypes.Deployment
+	if err := json.Unmarshal(payload, &dl); err != nil {
+		return errors.Wrap(err, "invalid deployment")
+	}
+
+	old, exists := n.deployments[dl.ContractID]
+	if update && !exists {
+		return errors.Errorf("deployment %d does not exist", dl.ContractID)
+	}
+	if !update && exists {
+		return errors.Errorf("deployment %d already exists", dl.ContractID)
+	}
+	if update && dl.Version <= old.Version {
+		return errors.Errorf("deployment version %d must be higher than %d", dl.Version, old.Version)
+	}
+
+	c, ok := g.contracts[dl.ContractID]
+	if !ok || c.deleted || c.typ != nodeContract {
+		return errors.Errorf("contract %d does not exist", dl.ContractID)
+	}
+	if c.nodeID != n.NodeID {
+		return errors.Errorf("contract %d is not for node %d", dl.ContractID, n.NodeID)
+	}
+	if c.twinID != dl.TwinID {
+		return errors.Errorf("contract %d is not owned by twin %d", dl.ContractID, dl.TwinID)
+	}
+
+	if err := dl.Valid(); err != nil {
+		return errors.Wrap(err, "invalid deployment")
+	}
+	if err := dl.Verify(keyGetter(g.twinKeys)); err != nil {
+		return errors.Wrap(err, "failed to verify deployment signatures")
+	}
+	hash, err := dl.ChallengeHash()
+	if err != nil {
+		return errors.Wrap(err, "failed to compute deployment hash")
+	}
+	if hex.EncodeToString(hash) != c.hash {
+		return errors.Errorf("deployment hash doesn't match contract %d hash", dl.ContractID)
+	}
+
+	if err := n.checkCapacity(dl); err != nil {
+		return err
+	}
+
+	oldWorkloads := make(map[gridtypes.Name]gridtypes.Workload)
+	for _, wl := range old.Workloads {
+		oldWorkloads[wl.Name] = wl
+	}
+
+	usedIPs := make(map[string]bool)
+	for i := range dl.Workloads {
+		wl := &dl.Workloads[i]
+		if oldWl, ok := oldWorkloads[wl.Name]; ok && oldWl.Version == wl.Version {
+			wl.Result = oldWl.Result
+			continue
+		}
+		wl.Result = g.provision(n, c, &dl, wl, usedIPs)
+	}
+
+	n.deployments[dl.ContractID] = dl
+	return nil
+}
+
+// provision returns the result of a workload, workloads are ready right away
+func (g *Grid) provision(n *node, c *contract, dl *gridtypes.Deployment, wl *gridtypes.Workload, usedIPs map[string]bool) gridtypes.Result {
+	result := gridtypes.Result{Created: gridtypes.Now(), State: gridtypes.StateOk}
+	fail := func(err error) gridtypes.Result {
+		result.State = gridtypes.StateError
+		result.Error = err.Error()
+		return result
+	}
+
+	if msg, ok := g.failures[wl.Type]; ok {
+		return fail(errors.New(msg))
+	}
+
+	data, err := wl.WorkloadData()
+	if err != nil {
+		return fail(err)
+	}
+
+	var res interface{}
+	id := fmt.Sprintf("%d-%d-%s", dl.TwinID, dl.ContractID, wl.Name)
+	switch wl.Type {
+	case zos.ZMachineType:
+		vm := data.(*zos.ZMachine)
+		vmRes := zos.ZMachineResult{ID: id}
+		if len(vm.Network.Interfaces) != 0 {
+			vmRes.IP = vm.Network.Interfaces[0].IP.String()
+		}
+		if vm.Network.Planetary {
+			vmRes.PlanetaryIP = fmt.Sprintf("300:%x::%x", n.NodeID, dl.ContractID)
+		}
+		if vm.Network.Mycelium != nil {
+			vmRes.MyceliumIP = fmt.Sprintf("400:%x::%x", n.NodeID, dl.ContractID)
+		}
+		res = vmRes
+	case zos.PublicIPType:
+		ip := data.(*zos.PublicIP)
+		var ipRes zos.PublicIPResult
+		if ip.V4 {
+			reserved, err := reserveIP(c, usedIPs)
+			if err != nil {
+				return fail(err)
+			}
+			ipNet, err := gridtypes.ParseIPNet(reserved.IP)
+			if err != nil {
+				return fail(err)
+			}
+			ipRes.IP = ipNet
+			ipRes.Gateway = net.ParseIP(reserved.Gateway)
+		}
+		if ip.V6 {
+			if n.PublicIPv6 == "" {
+				return fail(errors.New("node doesn't have public ipv6"))
+			}
+			ipRes.IPv6 = gridtypes.IPNet{IPNet: net.IPNet{
+				IP:   net.ParseIP(fmt.Sprintf("2001:db8:%x::%x", n.NodeID, dl.ContractID)),
+				Mask: net.CIDRMask(64, 128),
+			}}
+		}
+		res = ipRes
+	case zos.ZMountType:
+		res = zos.ZMountResult{ID: id}
+	case zos.ZDBType:
+		res = zos.ZDBResult{Namespace: id, IPs: []string{fmt.Sprintf("2001:db8:%x::1", n.NodeID)}, Port: 9900}
+	case zos.QuantumSafeFSType:
+		res = zos.QuatumSafeFSResult{Path: fmt.Sprintf("/qsfs/%s", id), MetricsEndpoint: fmt.Sprintf("http://[2001:db8:%x::1]:9100/metrics", n.NodeID)}
+	case zos.GatewayNameProxyType:
+		if n.Domain == "" {
+			return fail(errors.New("node doesn't support name gateways"))
+		}
+		gw := data.(*zos.GatewayNameProxy)
+		res = zos.GatewayProxyResult{FQDN: fmt.Sprintf("%s.%s", gw.Name, n.Domain)}
+	case zos.GatewayFQDNProxyType:
+		if n.PublicIPv4 == "" {
+			return fail(errors.New("node doesn't have a public config"))
+		}
+		res = zos.GatewayFQDNResult{}
+	default:
+		return result
+	}
+
+	resData, err := json.Marshal(res)
+	if err != nil {
+		return fail(err)
+	}
+	result.Data = resData
+	return result
+}
+
+// reserveIP returns a public ip of the contract that is not used by another workload of the deployment
+func reserveIP(c *contract, usedIPs map[string]bool) (PublicIP, error) {
+	for _, ip := range c.publicIPs {
+		if !usedIPs[ip.IP] {
+			usedIPs[ip.IP] = true
+			return PublicIP{IP: ip.IP, Gateway: ip.Gateway}, nil
+		}
+	}
+	return PublicIP{}, errors.Errorf("contract %d doesn't have a free public ip", c.id)
+}
+
+// checkCapacity checks the node has enough capacity for the deployment
+func (n *node) checkCapacity(dl gridtypes.Deployment) error {
+	var used gridtypes.Capacity
+	for id, other := range n.deployments {
+		if id == dl.ContractID {
+			continue
+		}
+		for _, wl := range other.Workloads {
+			wlCap, err := wl.Capacity()
+			if err != nil {
+				return err
+			}
+			used.Add(&wlCap)
+		}
+	}
+
+	for _, wl := range dl.Workloads {
+		wlCap, err := wl.Capacity()
+		if err != nil {
+			return errors.Wrapf(err, "invalid workload %s", wl.Name)
+		}
+		used.Add(&wlCap)
+	}
+
+	total := n.TotalResources
+	if used.MRU > total.MRU || used.SRU > total.SRU || used.HRU > total.HRU {
+		return errors.Errorf("node %d doesn't have enough capacity", n.NodeID)
+	}
+	return nil
+}
+
+func (n *node) deployment(payload []byte) (gridtypes.Deployment, error) {
+	var args contractArgs
+	if err := json.Unmarshal(payload, &args); err != nil {
+		return gridtypes.Deployment{}, errors.Wrap(err, "invalid request")
+	}
+
+	dl, ok := n.deployments[args.ContractID]
+	if !ok {
+		return gridtypes.Deployment{}, errors.Errorf("deployment %d not found", args.ContractID)
+	}
+	return dl, nil
+}
+
+// workloads returns the workloads of the given type on the node
+func (n *node) workloads(typ gridtypes.WorkloadType) []gridtypes.WorkloadData {
+	var res []gridtypes.WorkloadData
+	for _, dl := range n.sortedDeployments() {
+		for _, wl := range dl.Workloads {
+			if wl.Type != typ {
+				continue
+			}
+			data, err := wl.WorkloadData()
+			if err != nil {
+				continue
+			}
+			res = append(res, data)
+		}
+	}
+	return res
+}
+
+func (n *node) wgPorts() []uint16 {
+	ports := []uint16{}
+	for _, data := range n.workloads(zos.NetworkType) {
+		ports = append(ports, data.(*zos.Network).WGListenPort)
+	}
+	return ports
+}
+
+func (n *node) privateIPs(network gridtypes.Name) []string {
+	ips := []string{}
+	for _, data := range n.workloads(zos.ZMachineType) {
+		for _, iface := range data.(*zos.ZMachine).Network.Interfaces {
+			if iface.Network == network {
+				ips = append(ips, iface.IP.String())
+			}
+		}
+	}
+	return ips
+}
+
+func (n *node) publicConfig() (client.PublicConfig, error) {
+	if n.PublicIPv4 == "" && n.PublicIPv6 == "" {
+		return client.PublicConfig{}, errors.New("no public configuration")
+	}
+
+	cfg := client.PublicConfig{Domain: n.Domain}
+	for _, ip := range []string{n.PublicIPv4, n.PublicIPv6} {
+		if ip == "" {
+			continue
+		}
+		ipNet, err := gridtypes.ParseIPNet(ip)
+		if err != nil {
+			return client.PublicConfig{}, err
+		}
+		if ipNet.IP.To4() != nil {
+			cfg.IPv4 = ipNet
+		} else {
+			cfg.IPv6 = ipNet
+		}
+	}
+	return cfg, nil
+}
+
+func (g *Grid) nodePublicIPs(n *node) []string {
+	ips := []string{}
+	for _, c := range g.contracts {
+		if c.deleted || c.typ != nodeContract || c.nodeID != n.NodeID {
+			continue
+		}
+		for _, ip := range c.publicIPs {
+			ips = append(ips, ip.IP)
+		}
+	}
+	return ips
+}
+
+// keyGetter returns the public keys of the grid twins to verify deployment signatures
+type keyGetter map[uint32][]byte
+
+func (k keyGetter) GetKey(twin uint32) ([]byte, error) {
+	pk, ok := k[twin]
+	if !ok {
+		return nil, errors.Errorf("twin %d not found", twin)
+	}
+	return pk, nil
+}
@@ -0,0 +1,142 @@
+package flist
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DatabaseName is the sqlite database of the flist directories in the flist archives
+const DatabaseName = "flistdb.sqlite3"
+
+// maxDatabaseSize limits the size of the flist databases read to memory
+const maxDatabaseSize = 512 << 20
+
+// the inode types of the flist schema, they are the order of the inode attributes union members
+const (
+	dirInode = iota
+	fileInode
+	linkInode
+	specialInode
+)
+
+// ReadArchive lists the contents of an flist archive.
+// flist archives are tar.gz archives of the flist sqlite database whose entries table maps keys to the flist directories,
+// each directory is a cap'n proto message of its path and inodes as defined by the 0-flist schema.
+func ReadArchive(r io.Reader) (Contents, error) {
+	data, err := archiveDatabase(r)
+	if err != nil {
+		return Contents{}, err
+	}
+	db, err := newSQLiteDB(data)
+	if err != nil {
+		return Contents{}, errors.Wrap(err, "invalid flist database")
+	}
+	rows, err := db.table("entries")
+	if err != nil {
+		return Contents{}, errors.Wrap(err, "invalid flist database")
+	}
+
+	var contents Contents
+	for _, row := range rows {
+		// entries are key and value rows, the value of the directories is a cap'n proto blob
+		if len(row) < 2 {
+			return Contents{}, errors.New("invalid flist database entry")
+		}
+		var value []byte
+		switch v := row[1].(type) {
+		case []byte:
+			value = v
+		case string:
+			value = []byte(v)
+		default:
+			return Contents{}, errors.Errorf("invalid flist database entry %v", row[0])
+		}
+
+		files, err := decodeDir(value)
+		if err != nil {
+			return Contents{}, errors.Wrapf(err, "invalid flist directory entry %v", row[0])
+		}
+		for _, file := range files {
+			if file.Type == RegularFile {
+				contents.FullSize += file.Size
+			}
+		}
+		contents.Content = append(contents.Content, files...)
+	}
+
+	slices.SortFunc(contents.Content, func(a, b File) int { return strings.Compare(a.Path, b.Path) })
+	return contents, nil
+}
+
+// archiveDatabase returns the flist database of an flist archive
+func archiveDatabase(r io.Reader) ([]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid flist archive")
+	}
+	defer gz.Close()
+
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, errors.Errorf("flist archive has no %s database", DatabaseName)
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid flist archive")
+		}
+		if header.Typeflag != tar.TypeReg || path.Base(header.Name) != DatabaseName {
+			continue
+		}
+
+		data, err := io.ReadAll(io.LimitReader(archive, maxDatabaseSize+1))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read the flist database")
+		}
+		if len(data) > maxDatabaseSize {
+			return nil, errors.Errorf("flist database is larger than %d bytes", maxDatabaseSize)
+		}
+		return data, nil
+	}
+}
+
+// decodeDir returns the files of an flist directory entry.
+// the entries table also has the acls of the files, they are skipped as they have less pointers than the directories.
+func decodeDir(value []byte) ([]File, error) {
+	msg, err := readCapnpMessage(value)
+	if err != nil {
+		return nil, err
+	}
+
+	// Dir: name @0, location @1, contents @2 :List(Inode), parent @3, size @4, aclkey @5
+	dir := msg.root()
+	if dir.ptrWords < 5 {
+		return nil, msg.err
+	}
+	location := path.Join("/", dir.text(1))
+
+	var files []File
+	for _, inode := range dir.structList(2) {
+		// Inode: name @0, size @1, attributes union of dir @2, file @3, link @4 and special @5 whose tag follows size
+		file := File{Path: path.Join(location, inode.text(0)), Size: inode.uint64(0)}
+		switch inode.uint16(4) {
+		case dirInode:
+			file.Type = Directory
+			file.Size = 0
+		case fileInode:
+			file.Type = RegularFile
+		case linkInode:
+			file.Type = Symlink
+		default:
+			file.Type = Special
+		}
+		files = append(files, file)
+	}
+	return files, msg.err
+}
@@ -0,0 +1,409 @@
+package flist
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPageSize is small so the test databases have interior and overflow pages
+const testPageSize = 512
+
+type testInode struct {
+	name  string
+	size  uint64
+	inode uint16
+}
+
+type testDir struct {
+	location string
+	inodes   []testInode
+}
+
+// capnpBuilder builds single segment cap'n proto messages
+type capnpBuilder struct {
+	words []uint64
+}
+
+func (b *capnpBuilder) alloc(words int) int {
+	offset := len(b.words)
+	b.words = append(b.words, make([]uint64, words)...)
+	return offset
+}
+
+func (b *capnpBuilder) setStruct(at, dataWords, ptrWords int) int {
+	content := b.alloc(dataWords + ptrWords)
+	b.words[at] = uint64(uint32(content-at-1)<<2) | uint64(dataWords)<<32 | uint64(ptrWords)<<48
+	return content
+}
+
+func (b *capnpBuilder) setText(at int, text string) {
+	data := append([]byte(text), 0)
+	content := b.alloc((len(data) + 7) / 8)
+	for i, c := range data {
+		b.words[content+i/8] |= uint64(c) << (8 * (i % 8))
+	}
+	b.words[at] = uint64(uint32(content-at-1)<<2) | listPointer | 2<<32 | uint64(len(data))<<35
+}
+
+func (b *capnpBuilder) setStructList(at, count, dataWords, ptrWords int) int {
+	words := count * (dataWords + ptrWords)
+	tag := b.alloc(1 + words)
+	b.words[tag] = uint64(count)<<2 | uint64(dataWords)<<32 | uint64(ptrWords)<<48
+	b.words[at] = uint64(uint32(tag-at-1)<<2) | listPointer | compositeList<<32 | uint64(words)<<35
+	return tag + 1
+}
+
+// segment returns the words of the message segment
+func (b *capnpBuilder) segment() []byte {
+	data := make([]byte, 8*len(b.words))
+	for i, word := range b.words {
+		binary.LittleEndian.PutUint64(data[8*i:], word)
+	}
+	return data
+}
+
+// message frames the segment with the segments table
+func (b *capnpBuilder) message() []byte {
+	table := make([]byte, 8)
+	binary.LittleEndian.PutUint32(table[4:], uint32(len(b.words)))
+	return append(table, b.segment()...)
+}
+
+// encodeDir encodes a directory entry of the flist schema
+func encodeDir(dir testDir) []byte {
+	b := &capnpBuilder{}
+	root := b.alloc(1)
+	d := b.setStruct(root, 1, 5)
+	b.setText(d+1, strings.TrimPrefix(dir.location, "/"))
+	b.setText(d+2, dir.location)
+	inodes := b.setStructList(d+3, len(dir.inodes), 3, 3)
+	for i, inode := range dir.inodes {
+		element := inodes + i*6
+		b.words[element] = inode.size
+		b.words[element+1] = uint64(inode.inode)
+		b.setText(element+3, inode.name)
+	}
+	return b.message()
+}
+
+// encodeACL encodes an acl entry of the flist schema, acls are stored in the entries table with the directories
+func encodeACL() []byte {
+	b := &capnpBuilder{}
+	root := b.alloc(1)
+	acl := b.setStruct(root, 2, 3)
+	b.setText(acl+2, "root")
+	b.setText(acl+3, "root")
+	return b.message()
+}
+
+func sqliteVarintBytes(v uint64) []byte {
+	if v > 1<<56-1 {
+		panic("large varints are not used by the tests")
+	}
+	var groups []byte
+	for {
+		groups = append([]byte{byte(v & 0x7f)}, groups...)
+		v >>= 7
+		if v == 0 {
+			break
+		}
+	}
+	for i := 0; i < len(groups)-1; i++ {
+		groups[i] |= 0x80
+	}
+	return groups
+}
+
+func encodeRecord(values ...interface{}) []byte {
+	var header, body []byte
+	for _, value := range values {
+		switch v := value.(type) {
+		case int64:
+			header = append(header, 4)
+			body = binary.BigEndian.AppendUint32(body, uint32(v))
+		case string:
+			header = append(header, sqliteVarintBytes(uint64(13+2*len(v)))...)
+			body = append(body, v...)
+		case []byte:
+			header = append(header, sqliteVarintBytes(uint64(12+2*len(v)))...)
+			body = append(body, v...)
+		}
+	}
+	// the header size fits a single byte in the tests
+	return append(append([]byte{byte(len(header) + 1)}, header...), body...)
+}
+
+// sqliteWriter writes an sqlite database of a single table, the rows are split to leaf pages under an interior root page
+type sqliteWriter struct {
+	pages [][]byte
+}
+
+func (w *sqliteWriter) page() ([]byte, uint32) {
+	w.pages = append(w.pages, make([]byte, testPageSize))
+	return w.pages[len(w.pages)-1], uint32(len(w.pages))
+}
+
+// cell creates a table leaf cell, the payload spills to overflow pages if it doesn't fit
+func (w *sqliteWriter) cell(rowID int64, payload []byte) []byte {
+	cell := append(sqliteVarintBytes(uint64(len(payload))), sqliteVarintBytes(uint64(rowID))...)
+	local := len(payload)
+	if local > testPageSize-35 {
+		minLocal := (testPageSize-12)*32/255 - 23
+		local = minLocal + (len(payload)-minLocal)%(testPageSize-4)
+		if local > testPageSize-35 {
+			local = minLocal
+		}
+	}
+	cell = append(cell, payload[:local]...)
+	if local == len(payload) {
+		return cell
+	}
+
+	cell = binary.BigEndian.AppendUint32(cell, uint32(len(w.pages)+1))
+	for rest := payload[local:]; len(rest) != 0; {
+		page, _ := w.page()
+		chunk := min(len(rest), testPageSize-4)
+		copy(page[4:], rest[:chunk])
+		rest = rest[chunk:]
+		if len(rest) != 0 {
+			binary.BigEndian.PutUint32(page, uint32(len(w.pages)+1))
+		}
+	}
+	return cell
+}
+
+// btreePage writes a b-tree page of cells, the cells content is at the end of the page
+func btreePage(page []byte, header int, kind byte, cells [][]byte, rightChild uint32) {
+	headerSize := 8
+	if kind == tableInteriorPage {
+		headerSize = 12
+		binary.BigEndian.PutUint32(page[header+8:], rightChild)
+	}
+	page[header] = kind
+	binary.BigEndian.PutUint16(page[header+3:], uint16(len(cells)))
+	content := len(page)
+	for i, cell := range cells {
+		content -= len(cell)
+		copy(page[content:], cell)
+		binary.BigEndian.PutUint16(page[header+headerSize+2*i:], uint16(content))
+	}
+	binary.BigEndian.PutUint16(page[header+5:], uint16(content))
+}
+
+func writeSQLite(t *testing.T, table, columns string, rows [][]interface{}) []byte {
+	t.Helper()
+	w := &sqliteWriter{}
+	schema, _ := w.page()
+	root, rootNumber := w.page()
+
+	// leaves are filled with cells in the order of their row ids
+	leaves := [][][]byte{nil}
+	var lastRows []int
+	used := 8
+	for i, row := range rows {
+		cell := w.cell(int64(i+1), encodeRecord(row...))
+		if used+2+len(cell) > testPageSize {
+			leaves = append(leaves, nil)
+			lastRows = append(lastRows, i)
+			used = 8
+		}
+		leaves[len(leaves)-1] = append(leaves[len(leaves)-1], cell)
+		used += 2 + len(cell)
+	}
+
+	if len(leaves) == 1 {
+		btreePage(root, 0, tableLeafPage, leaves[0], 0)
+	} else {
+		var rootCells [][]byte
+		var right uint32
+		for i, cells := range leaves {
+			page, number := w.page()
+			btreePage(page, 0, tableLeafPage, cells, 0)
+			if i == len(leaves)-1 {
+				right = number
+				break
+			}
+			// interior cells are the left child and its largest row id
+			cell := binary.BigEndian.AppendUint32(nil, number)
+			rootCells = append(rootCells, append(cell, sqliteVarintBytes(uint64(lastRows[i]))...))
+		}
+		btreePage(root, 0, tableInteriorPage, rootCells, right)
+	}
+
+	sql := fmt.Sprintf("CREATE TABLE %s (%s)", table, columns)
+	btreePage(schema, 100, tableLeafPage, [][]byte{w.cell(1, encodeRecord("table", table, table, int64(rootNumber), sql))}, 0)
+	copy(schema, sqliteHeader)
+	binary.BigEndian.PutUint16(schema[16:], testPageSize)
+	schema[18], schema[19], schema[21], schema[22], schema[23] = 1, 1, 64, 32, 32
+	binary.BigEndian.PutUint32(schema[24:], 1)
+	binary.BigEndian.PutUint32(schema[28:], uint32(len(w.pages)))
+	binary.BigEndian.PutUint32(schema[40:], 1)
+	binary.BigEndian.PutUint32(schema[44:], 4)
+	binary.BigEndian.PutUint32(schema[56:], 1)
+	binary.BigEndian.PutUint32(schema[92:], 1)
+	binary.BigEndian.PutUint32(schema[96:], 3040001)
+
+	return bytes.Join(w.pages, nil)
+}
+
+// writeArchive writes an flist archive of the directories
+func writeArchive(t *testing.T, dirs ...testDir) []byte {
+	t.Helper()
+	rows := [][]interface{}{{"acl", encodeACL()}}
+	for _, dir := range dirs {
+		rows = append(rows, []interface{}{dir.location, encodeDir(dir)})
+	}
+	return tarGzip(t, "./"+DatabaseName, writeSQLite(t, "entries", "key VARCHAR(64), value BLOB", rows))
+}
+
+func tarGzip(t *testing.T, name string, data []byte) []byte {
+	t.Helper()
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	writer := tar.NewWriter(gz)
+	require.NoError(t, writer.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), Typeflag: tar.TypeReg}))
+	_, err := writer.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	require.NoError(t, gz.Close())
+	return archive.Bytes()
+}
+
+func TestReadArchive(t *testing.T) {
+	dirs := []testDir{
+		{location: "", inodes: []testInode{
+			{name: "sbin", size: 4096, inode: dirInode},
+			{name: "init", inode: linkInode},
+			{name: "image.raw", size: 1 << 30, inode: fileInode},
+		}},
+		{location: "sbin", inodes: []testInode{
+			{name: "zinit", size: 100, inode: fileInode},
+			{name: "null", inode: specialInode},
+		}},
+	}
+	// enough directories to fill more than a page, with entries larger than a page
+	for i := 0; i < 20; i++ {
+		dir := testDir{location: fmt.Sprintf("usr/share/%d", i)}
+		for j := 0; j < 20; j++ {
+			dir.inodes = append(dir.inodes, testInode{name: fmt.Sprintf("file-with-a-long-name-%d", j), size: 1, inode: fileInode})
+		}
+		dirs = append(dirs, dir)
+	}
+
+	contents, err := ReadArchive(bytes.NewReader(writeArchive(t, dirs...)))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1<<30+100+400), contents.FullSize)
+	assert.Len(t, contents.Content, 5+400)
+	assert.Equal(t, []File{
+		{Path: "/image.raw", Size: 1 << 30, Type: RegularFile},
+		{Path: "/init", Type: Symlink},
+		{Path: "/sbin", Type: Directory},
+		{Path: "/sbin/null", Type: Special},
+		{Path: "/sbin/zinit", Size: 100, Type: RegularFile},
+	}, contents.Content[:5])
+	assert.Equal(t, File{Path: "/usr/share/0/file-with-a-long-name-0", Size: 1, Type: RegularFile}, contents.Content[5])
+
+	info := NewInfo("flist", contents)
+	assert.True(t, info.Image)
+	assert.Equal(t, []string{"/sbin/zinit", "/init"}, info.Entrypoints)
+
+	t.Run("no database", func(t *testing.T) {
+		_, err := ReadArchive(bytes.NewReader(tarGzip(t, "router.yaml", []byte("pools: {}"))))
+		assert.ErrorContains(t, err, "flist archive has no flistdb.sqlite3 database")
+	})
+
+	t.Run("not an archive", func(t *testing.T) {
+		_, err := ReadArchive(strings.NewReader("flistdb.sqlite3"))
+		assert.ErrorContains(t, err, "invalid flist archive")
+	})
+
+	t.Run("invalid database", func(t *testing.T) {
+		_, err := ReadArchive(bytes.NewReader(tarGzip(t, DatabaseName, []byte("not a database"))))
+		assert.ErrorContains(t, err, "invalid flist database")
+	})
+
+	t.Run("invalid directory", func(t *testing.T) {
+		dir := encodeDir(dirs[1])
+		data := writeSQLite(t, "entries", "key, value", [][]interface{}{{"sbin", dir[:len(dir)-16]}})
+		_, err := ReadArchive(bytes.NewReader(tarGzip(t, DatabaseName, data)))
+		assert.ErrorContains(t, err, "invalid flist directory entry sbin")
+	})
+}
+
+func TestCapnpMessage(t *testing.T) {
+	dir := testDir{location: "sbin", inodes: []testInode{{name: "zinit", size: 100, inode: fileInode}}}
+	want := []File{{Path: "/sbin/zinit", Size: 100, Type: RegularFile}}
+
+	t.Run("packed", func(t *testing.T) {
+		packed := packCapnp(encodeDir(dir))
+		files, err := decodeDir(packed)
+		require.NoError(t, err)
+		assert.Equal(t, want, files)
+	})
+
+	t.Run("far pointers", func(t *testing.T) {
+		b := &capnpBuilder{}
+		root := b.alloc(1)
+		d := b.setStruct(root, 1, 5)
+		b.setText(d+2, dir.location)
+		inodes := b.setStructList(d+3, 1, 3, 3)
+		b.words[inodes] = dir.inodes[0].size
+		b.words[inodes+1] = fileInode
+		b.setText(inodes+3, dir.inodes[0].name)
+		content := b.segment()
+
+		// the root is a far pointer to a landing pad in the first segment of a message of two segments
+		single := append([]byte{1, 0, 0, 0, 1, 0, 0, 0, byte(len(content) / 8), 0, 0, 0, 0, 0, 0, 0}, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint64(single[8*2:], uint64(farPointer)|1<<32)
+		files, err := decodeDir(append(single, content...))
+		require.NoError(t, err)
+		assert.Equal(t, want, files)
+
+		// the root is a far pointer to a double landing pad whose tag is the root struct pointer
+		double := b.words[root]
+		b.words[root] = farPointer | 1<<2 | uint64(len(b.words))<<3
+		b.words = append(b.words, farPointer|uint64(root+1)<<3, double&^0xffffffff)
+		content = b.segment()
+		message := append([]byte{0, 0, 0, 0, byte(len(content) / 8), 0, 0, 0}, content...)
+		files, err = decodeDir(message)
+		require.NoError(t, err)
+		assert.Equal(t, want, files)
+	})
+
+	t.Run("out of bounds", func(t *testing.T) {
+		b := &capnpBuilder{}
+		root := b.alloc(1)
+		d := b.setStruct(root, 1, 5)
+		b.words[d+3] = listPointer | compositeList<<32 | 100<<35
+		_, err := decodeDir(b.message())
+		assert.ErrorContains(t, err, "out of the message")
+	})
+}
+
+// packCapnp encodes a message with the packed encoding without the runs of zero and raw words
+func packCapnp(data []byte) []byte {
+	var packed []byte
+	for ; len(data) != 0; data = data[8:] {
+		var tag byte
+		var nonzero []byte
+		for i, b := range data[:8] {
+			if b != 0 {
+				tag |= 1 << i
+				nonzero = append(nonzero, b)
+			}
+		}
+		packed = append(append(packed, tag), nonzero...)
+		if tag == 0 || tag == 0xff {
+			packed = append(packed, 0)
+		}
+	}
+	return packed
+}
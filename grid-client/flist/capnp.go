@@ -0,0 +1,266 @@
+package flist
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// maxSegments limits the segments of the cap'n proto messages, the flist entries are small single segment messages
+const maxSegments = 512
+
+// the cap'n proto pointer kinds
+const (
+	structPointer = 0
+	listPointer   = 1
+	farPointer    = 2
+)
+
+// compositeList is the element size of the lists of structs
+const compositeList = 7
+
+// capnpMessage reads the structs, texts and lists of structs of a cap'n proto message.
+// decoding errors are kept in err and the fields of invalid objects read as their default values.
+type capnpMessage struct {
+	segments [][]byte
+	err      error
+}
+
+// capnpStruct is a struct of a message, the zero struct reads all its fields as default values
+type capnpStruct struct {
+	msg *capnpMessage
+	seg int
+	// data and pointers are the word offsets of the struct sections in its segment
+	data      int
+	dataWords int
+	pointers  int
+	ptrWords  int
+}
+
+// readCapnpMessage decodes a message with its segments table, the message is packed if the table is invalid
+func readCapnpMessage(data []byte) (*capnpMessage, error) {
+	msg, err := framedMessage(data)
+	if err == nil {
+		return msg, nil
+	}
+
+	unpacked, packedErr := unpackCapnp(data)
+	if packedErr != nil {
+		return nil, err
+	}
+	return framedMessage(unpacked)
+}
+
+// framedMessage splits a message to its segments using the segments count and sizes at its start
+func framedMessage(data []byte) (*capnpMessage, error) {
+	if len(data) < 8 {
+		return nil, errors.New("message is too short")
+	}
+	count := int(binary.LittleEndian.Uint32(data)) + 1
+	if count <= 0 || count > maxSegments {
+		return nil, errors.Errorf("invalid message segments count %d", count)
+	}
+
+	// the segments table is padded to a word
+	offset := (4 + 4*count + 7) &^ 7
+	if offset > len(data) {
+		return nil, errors.New("message segments table is truncated")
+	}
+	msg := &capnpMessage{}
+	for i := 0; i < count; i++ {
+		size := int(binary.LittleEndian.Uint32(data[4+4*i:])) * 8
+		if size < 0 || size > len(data)-offset {
+			return nil, errors.Errorf("message segment %d is truncated", i)
+		}
+		msg.segments = append(msg.segments, data[offset:offset+size])
+		offset += size
+	}
+	return msg, nil
+}
+
+// unpackCapnp decodes the packed encoding, each word is a tag of its non zero bytes followed by these bytes.
+// a zero tag is followed by the count of the extra zero words and a full tag by the count of the extra raw words.
+func unpackCapnp(data []byte) ([]byte, error) {
+	var out []byte
+	for len(data) != 0 {
+		tag := data[0]
+		data = data[1:]
+
+		var word [8]byte
+		for i := 0; i < 8; i++ {
+			if tag&(1<<i) == 0 {
+				continue
+			}
+			if len(data) == 0 {
+				return nil, errors.New("packed word is truncated")
+			}
+			word[i] = data[0]
+			data = data[1:]
+		}
+		out = append(out, word[:]...)
+
+		if tag != 0 && tag != 0xff {
+			continue
+		}
+		if len(data) == 0 {
+			return nil, errors.New("packed words count is missing")
+		}
+		words := int(data[0])
+		data = data[1:]
+		if tag == 0 {
+			out = append(out, make([]byte, words*8)...)
+			continue
+		}
+		if len(data) < words*8 {
+			return nil, errors.New("packed raw words are truncated")
+		}
+		out = append(out, data[:words*8]...)
+		data = data[words*8:]
+	}
+	return out, nil
+}
+
+func (m *capnpMessage) fail(err error) {
+	if m.err == nil {
+		m.err = err
+	}
+}
+
+func (m *capnpMessage) word(seg, offset int) uint64 {
+	if seg < 0 || seg >= len(m.segments) || offset < 0 || offset >= len(m.segments[seg])/8 {
+		m.fail(errors.Errorf("word %d of segment %d is out of the message", offset, seg))
+		return 0
+	}
+	return binary.LittleEndian.Uint64(m.segments[seg][offset*8:])
+}
+
+// inSegment checks that a number of words starting at an offset are in a segment
+func (m *capnpMessage) inSegment(seg, offset, words int) bool {
+	if seg < 0 || seg >= len(m.segments) || offset < 0 || words < 0 || offset+words > len(m.segments[seg])/8 {
+		m.fail(errors.Errorf("object of %d words at %d of segment %d is out of the message", words, offset, seg))
+		return false
+	}
+	return true
+}
+
+// pointer resolves the pointer at an offset of a segment to the location of its content and the struct or list pointer describing it.
+// far pointers point to a landing pad in another segment, the pad is the pointer of the content
+// or a far pointer to the content followed by a pointer describing it.
+func (m *capnpMessage) pointer(seg, offset int) (int, int, uint64) {
+	word := m.word(seg, offset)
+	if word == 0 || word&3 != farPointer {
+		return seg, offset + 1 + int(int32(uint32(word))>>2), word
+	}
+
+	padSeg, pad := int(word>>32), int(uint32(word)>>3)
+	if word&4 == 0 {
+		content := m.word(padSeg, pad)
+		if content&3 == farPointer {
+			m.fail(errors.New("far pointer landing pad is a far pointer"))
+			return 0, 0, 0
+		}
+		return padSeg, pad + 1 + int(int32(uint32(content))>>2), content
+	}
+
+	far, tag := m.word(padSeg, pad), m.word(padSeg, pad+1)
+	if far&7 != farPointer || tag&3 == farPointer {
+		m.fail(errors.New("invalid far pointer double landing pad"))
+		return 0, 0, 0
+	}
+	return int(far >> 32), int(uint32(far) >> 3), tag
+}
+
+// root returns the root struct of the message
+func (m *capnpMessage) root() capnpStruct {
+	return m.structAt(0, 0)
+}
+
+func (m *capnpMessage) structAt(seg, offset int) capnpStruct {
+	seg, content, word := m.pointer(seg, offset)
+	if word == 0 {
+		return capnpStruct{msg: m}
+	}
+	if word&3 != structPointer {
+		m.fail(errors.New("expected a struct pointer"))
+		return capnpStruct{msg: m}
+	}
+
+	dataWords, ptrWords := int(uint16(word>>32)), int(uint16(word>>48))
+	if !m.inSegment(seg, content, dataWords+ptrWords) {
+		return capnpStruct{msg: m}
+	}
+	return capnpStruct{msg: m, seg: seg, data: content, dataWords: dataWords, pointers: content + dataWords, ptrWords: ptrWords}
+}
+
+// uint64 returns a 64 bits field at a word index of the data section
+func (s capnpStruct) uint64(index int) uint64 {
+	if index >= s.dataWords {
+		return 0
+	}
+	return s.msg.word(s.seg, s.data+index)
+}
+
+// uint16 returns a 16 bits field at a 16 bits index of the data section
+func (s capnpStruct) uint16(index int) uint16 {
+	if index/4 >= s.dataWords {
+		return 0
+	}
+	return uint16(s.msg.word(s.seg, s.data+index/4) >> (16 * (index % 4)))
+}
+
+// text returns a text field at an index of the pointers section
+func (s capnpStruct) text(index int) string {
+	if index >= s.ptrWords {
+		return ""
+	}
+	seg, content, word := s.msg.pointer(s.seg, s.pointers+index)
+	if word == 0 {
+		return ""
+	}
+	// texts are lists of bytes ending with a nul byte
+	if word&3 != listPointer || (word>>32)&7 != 2 {
+		s.msg.fail(errors.New("expected a text pointer"))
+		return ""
+	}
+
+	size := int(word >> 35)
+	if size == 0 || !s.msg.inSegment(seg, content, (size+7)/8) {
+		return ""
+	}
+	return string(s.msg.segments[seg][content*8 : content*8+size-1])
+}
+
+// structList returns a list of structs field at an index of the pointers section
+func (s capnpStruct) structList(index int) []capnpStruct {
+	if index >= s.ptrWords {
+		return nil
+	}
+	seg, content, word := s.msg.pointer(s.seg, s.pointers+index)
+	if word == 0 {
+		return nil
+	}
+	if word&3 != listPointer || (word>>32)&7 != compositeList {
+		s.msg.fail(errors.New("expected a list of structs pointer"))
+		return nil
+	}
+
+	// composite lists start with a tag word, a struct pointer whose offset is the count of the elements
+	words := int(word >> 35)
+	if !s.msg.inSegment(seg, content, words+1) {
+		return nil
+	}
+	tag := s.msg.word(seg, content)
+	count := int(uint32(tag) >> 2)
+	dataWords, ptrWords := int(uint16(tag>>32)), int(uint16(tag>>48))
+	if tag&3 != structPointer || dataWords+ptrWords == 0 || count*(dataWords+ptrWords) > words {
+		s.msg.fail(errors.New("invalid list of structs tag"))
+		return nil
+	}
+
+	list := make([]capnpStruct, 0, count)
+	for i := 0; i < count; i++ {
+		element := content + 1 + i*(dataWords+ptrWords)
+		list = append(list, capnpStruct{msg: s.msg, seg: seg, data: element, dataWords: dataWords, pointers: element + dataWords, ptrWords: ptrWords})
+	}
+	return list
+}
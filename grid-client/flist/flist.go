@@ -0,0 +1,277 @@
+// Package flist inspects the contents of flists to validate vms before they are deployed.
+// the contents are read from the flist archives, flists hosted on a hub with the /api/flist contents api
+// are listed by the hub instead of downloading their archives.
+package flist
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// gzipMagic starts the flist archives
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// ImagePath is the file of full vm image flists, flists without it are booted as containers
+const ImagePath = "/image.raw"
+
+// entrypointCandidates are the common init files of container flists
+var entrypointCandidates = []string{
+	"/sbin/zinit",
+	"/init",
+	"/sbin/init",
+	"/entrypoint.sh",
+	"/docker-entrypoint.sh",
+	"/usr/local/bin/docker-entrypoint.sh",
+	"/start.sh",
+}
+
+// FileType is the type of an flist entry
+type FileType string
+
+const (
+	// RegularFile is a regular file
+	RegularFile FileType = "regular"
+	// Directory is a directory
+	Directory FileType = "directory"
+	// Symlink is a symbolic link, its target is not checked
+	Symlink FileType = "symlink"
+	// Special is a device, a socket or a pipe
+	Special FileType = "special"
+)
+
+// File is an flist entry
+type File struct {
+	Path string   `json:"path"`
+	Size uint64   `json:"size"`
+	Type FileType `json:"type"`
+}
+
+// Contents is the flist contents listing as returned by the hub api
+type Contents struct {
+	// FullSize is the size of all the flist files in bytes
+	FullSize uint64 `json:"fullsize"`
+	Content  []File `json:"content"`
+}
+
+// Info is the inspected metadata of an flist
+type Info struct {
+	URL string
+	// Image is set for full vm images, they are booted from ImagePath instead of being mounted as a container root
+	Image bool
+	// Size is the size of all the flist files in bytes
+	Size uint64
+	// ImageSize is the size of the vm image in bytes, it is zero for container flists
+	ImageSize uint64
+	// Entrypoints are the common init files found in the flist
+	Entrypoints  []string
+	HasZinit     bool
+	HasCloudInit bool
+
+	files map[string]File
+}
+
+// NewInfo creates the flist info from its contents
+func NewInfo(flistURL string, contents Contents) Info {
+	info := Info{URL: flistURL, Size: contents.FullSize, files: make(map[string]File)}
+	for _, file := range contents.Content {
+		file.Path = path.Join("/", file.Path)
+		info.files[file.Path] = file
+	}
+
+	if image, ok := info.files[ImagePath]; ok && image.Type == RegularFile {
+		info.Image = true
+		info.ImageSize = image.Size
+	}
+	for _, candidate := range entrypointCandidates {
+		if info.Exists(candidate) {
+			info.Entrypoints = append(info.Entrypoints, candidate)
+		}
+	}
+	info.HasZinit = info.Exists("/sbin/zinit")
+	info.HasCloudInit = info.Exists("/usr/bin/cloud-init") || info.Exists("/etc/cloud/cloud.cfg")
+	return info
+}
+
+// Exists checks if the flist has a file, a directory or a link at an absolute path
+func (i Info) Exists(filePath string) bool {
+	_, ok := i.files[path.Join("/", filePath)]
+	return ok
+}
+
+// Executable checks if the flist has a file or a link at an absolute path that can be executed
+func (i Info) Executable(filePath string) bool {
+	file, ok := i.files[path.Join("/", filePath)]
+	return ok && (file.Type == RegularFile || file.Type == Symlink)
+}
+
+// Inspector fetches and caches the info of flists
+type Inspector struct {
+	client *http.Client
+	cache  sync.Map
+}
+
+// NewInspector creates an flist inspector.
+// http flists are listed by the contents api of their hub like https://hub.grid.tf/api/flist/user/name.flist
+// and their archives are downloaded if the listing fails.
+// file urls are flist archives, json contents listings as returned by the hub api or unpacked root filesystem directories.
+func NewInspector() *Inspector {
+	return &Inspector{client: &http.Client{Timeout: 2 * time.Minute}}
+}
+
+// Inspect returns the info of an flist, the info of each flist is fetched once
+func (i *Inspector) Inspect(ctx context.Context, flistURL string) (Info, error) {
+	if info, ok := i.cache.Load(flistURL); ok {
+		return info.(Info), nil
+	}
+
+	u, err := url.Parse(flistURL)
+	if err != nil {
+		return Info{}, errors.Wrapf(err, "invalid flist url %s", flistURL)
+	}
+
+	var contents Contents
+	switch u.Scheme {
+	case "http", "https":
+		contents, err = i.hubContents(ctx, u)
+		if err != nil {
+			contents, err = i.archiveContents(ctx, u)
+		}
+	case "file":
+		contents, err = localContents(u.Path)
+	default:
+		err = errors.Errorf("unsupported flist url scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return Info{}, errors.Wrapf(err, "could not inspect flist %s", flistURL)
+	}
+
+	info := NewInfo(flistURL, contents)
+	i.cache.Store(flistURL, info)
+	return info, nil
+}
+
+// HubContentsURL returns the url of the contents api of an flist hosted on a hub like https://hub.grid.tf/user/name.flist
+func HubContentsURL(flistURL *url.URL) string {
+	u := *flistURL
+	u.Path = path.Join("/api/flist", u.Path)
+	u.RawQuery = ""
+	return u.String()
+}
+
+func (i *Inspector) hubContents(ctx context.Context, u *url.URL) (Contents, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, HubContentsURL(u), nil)
+	if err != nil {
+		return Contents{}, err
+	}
+	response, err := i.client.Do(req)
+	if err != nil {
+		return Contents{}, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return Contents{}, errors.Errorf("hub contents api %s responded with status %s", req.URL, response.Status)
+	}
+
+	var contents Contents
+	if err := json.NewDecoder(response.Body).Decode(&contents); err != nil {
+		return Contents{}, errors.Wrap(err, "invalid hub contents response")
+	}
+	return contents, nil
+}
+
+// archiveContents downloads and reads an flist archive
+func (i *Inspector) archiveContents(ctx context.Context, u *url.URL) (Contents, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return Contents{}, err
+	}
+	response, err := i.client.Do(req)
+	if err != nil {
+		return Contents{}, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return Contents{}, errors.Errorf("flist %s responded with status %s", req.URL, response.Status)
+	}
+	return ReadArchive(response.Body)
+}
+
+// localContents lists a local root filesystem directory, reads an flist archive or decodes a json contents listing
+func localContents(root string) (Contents, error) {
+	stat, err := os.Stat(root)
+	if err != nil {
+		return Contents{}, err
+	}
+
+	if !stat.IsDir() {
+		data, err := os.ReadFile(root)
+		if err != nil {
+			return Contents{}, err
+		}
+		if bytes.HasPrefix(data, gzipMagic) {
+			return ReadArchive(bytes.NewReader(data))
+		}
+		var contents Contents
+		if err := json.Unmarshal(data, &contents); err != nil {
+			return Contents{}, errors.Wrap(err, "invalid contents listing")
+		}
+		return contents, nil
+	}
+
+	var contents Contents
+	err = filepath.WalkDir(root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, filePath)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		file := File{Path: "/" + filepath.ToSlash(rel), Type: fileType(entry.Type())}
+		if file.Type == RegularFile {
+			fileInfo, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			file.Size = uint64(fileInfo.Size())
+			contents.FullSize += file.Size
+		}
+		contents.Content = append(contents.Content, file)
+		return nil
+	})
+	if err != nil {
+		return Contents{}, err
+	}
+
+	slices.SortFunc(contents.Content, func(a, b File) int { return strings.Compare(a.Path, b.Path) })
+	return contents, nil
+}
+
+func fileType(mode fs.FileMode) FileType {
+	switch {
+	case mode.IsRegular():
+		return RegularFile
+	case mode.IsDir():
+		return Directory
+	case mode&fs.ModeSymlink != 0:
+		return Symlink
+	default:
+		return Special
+	}
+}
@@ -0,0 +1,123 @@
+package flist
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspectHub(t *testing.T) {
+	requests := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/flist/tf-official-apps/base:latest.flist", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_ = json.NewEncoder(w).Encode(Contents{
+			FullSize: 300,
+			Content: []File{
+				{Path: "/sbin", Type: Directory},
+				{Path: "/sbin/zinit", Size: 100, Type: RegularFile},
+				{Path: "/sbin/init", Type: Symlink},
+				{Path: "/usr/bin/cloud-init", Size: 200, Type: RegularFile},
+			},
+		})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	inspector := NewInspector()
+	flistURL := server.URL + "/tf-official-apps/base:latest.flist"
+	info, err := inspector.Inspect(context.Background(), flistURL)
+	require.NoError(t, err)
+
+	assert.Equal(t, flistURL, info.URL)
+	assert.False(t, info.Image)
+	assert.Equal(t, uint64(300), info.Size)
+	assert.Equal(t, []string{"/sbin/zinit", "/sbin/init"}, info.Entrypoints)
+	assert.True(t, info.HasZinit)
+	assert.True(t, info.HasCloudInit)
+	assert.True(t, info.Executable("/sbin/init"))
+	assert.True(t, info.Exists("/sbin"))
+	assert.False(t, info.Executable("/sbin"))
+	assert.False(t, info.Exists("/bin/sh"))
+
+	// the info is cached
+	_, err = inspector.Inspect(context.Background(), flistURL)
+	require.NoError(t, err)
+	assert.Equal(t, 1, requests)
+
+	t.Run("flist archive", func(t *testing.T) {
+		archive := writeArchive(t, testDir{location: "", inodes: []testInode{{name: "image.raw", size: 1 << 30, inode: fileInode}}})
+		mux.HandleFunc("/other/ubuntu.flist", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write(archive)
+		})
+
+		// the hub has no listing of flists on other hosts, their archives are downloaded instead
+		info, err := inspector.Inspect(context.Background(), server.URL+"/other/ubuntu.flist")
+		require.NoError(t, err)
+		assert.True(t, info.Image)
+		assert.Equal(t, uint64(1<<30), info.ImageSize)
+	})
+
+	t.Run("missing flist", func(t *testing.T) {
+		_, err := inspector.Inspect(context.Background(), server.URL+"/tf-official-apps/missing.flist")
+		assert.ErrorContains(t, err, "404")
+	})
+
+	t.Run("unsupported scheme", func(t *testing.T) {
+		_, err := inspector.Inspect(context.Background(), "ftp://hub/base.flist")
+		assert.Error(t, err)
+	})
+}
+
+func TestInspectLocal(t *testing.T) {
+	inspector := NewInspector()
+
+	t.Run("root filesystem directory", func(t *testing.T) {
+		root := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(root, "sbin"), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(root, "sbin", "zinit"), []byte("zinit"), 0o755))
+		require.NoError(t, os.Symlink("zinit", filepath.Join(root, "sbin", "init")))
+
+		info, err := inspector.Inspect(context.Background(), "file://"+root)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(5), info.Size)
+		assert.Equal(t, []string{"/sbin/zinit", "/sbin/init"}, info.Entrypoints)
+		assert.True(t, info.Executable("/sbin/init"))
+	})
+
+	t.Run("vm image listing", func(t *testing.T) {
+		data, err := json.Marshal(Contents{FullSize: 1 << 30, Content: []File{{Path: "image.raw", Size: 1 << 30, Type: RegularFile}}})
+		require.NoError(t, err)
+		listing := filepath.Join(t.TempDir(), "ubuntu.json")
+		require.NoError(t, os.WriteFile(listing, data, 0o644))
+
+		info, err := inspector.Inspect(context.Background(), "file://"+listing)
+		require.NoError(t, err)
+		assert.True(t, info.Image)
+		assert.Equal(t, uint64(1<<30), info.ImageSize)
+		assert.Empty(t, info.Entrypoints)
+	})
+
+	t.Run("flist archive", func(t *testing.T) {
+		archive := writeArchive(t, testDir{location: "sbin", inodes: []testInode{{name: "zinit", size: 5, inode: fileInode}}})
+		path := filepath.Join(t.TempDir(), "base.flist")
+		require.NoError(t, os.WriteFile(path, archive, 0o644))
+
+		info, err := inspector.Inspect(context.Background(), "file://"+path)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(5), info.Size)
+		assert.True(t, info.HasZinit)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := inspector.Inspect(context.Background(), "file:///missing/flist")
+		assert.Error(t, err)
+	})
+}
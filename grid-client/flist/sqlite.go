@@ -0,0 +1,269 @@
+package flist
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// sqliteHeader starts the sqlite database files
+const sqliteHeader = "SQLite format 3\x00"
+
+// maxTreeDepth limits the depth of the b-trees so corrupted databases with page cycles fail instead of looping
+const maxTreeDepth = 64
+
+// the b-tree page types of the tables
+const (
+	tableInteriorPage = 0x05
+	tableLeafPage     = 0x0d
+)
+
+// sqliteDB reads the rows of the tables of an sqlite database.
+// it supports the subset of the file format used by the flist databases:
+// utf-8 databases of rowid tables without a write ahead log.
+type sqliteDB struct {
+	data     []byte
+	pageSize int
+	// usable is the page size without the reserved space at the end of each page
+	usable int
+}
+
+func newSQLiteDB(data []byte) (*sqliteDB, error) {
+	if len(data) < 100 || string(data[:len(sqliteHeader)]) != sqliteHeader {
+		return nil, errors.New("invalid sqlite database header")
+	}
+
+	pageSize := int(binary.BigEndian.Uint16(data[16:18]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 {
+		return nil, errors.Errorf("invalid sqlite page size %d", pageSize)
+	}
+	if encoding := binary.BigEndian.Uint32(data[56:60]); encoding > 1 {
+		return nil, errors.Errorf("unsupported sqlite text encoding %d", encoding)
+	}
+
+	return &sqliteDB{data: data, pageSize: pageSize, usable: pageSize - int(data[20])}, nil
+}
+
+// table returns the rows of a table, the columns are nil, int64, float64, string or []byte values
+func (db *sqliteDB) table(name string) ([][]interface{}, error) {
+	// the schema table is rooted at the first page, its columns are type, name, tbl_name, rootpage and sql
+	var root int64
+	err := db.scan(1, 0, func(row []interface{}) error {
+		if len(row) >= 4 && row[0] == "table" && row[1] == name {
+			root, _ = row[3].(int64)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the database schema")
+	}
+	if root <= 0 || root > math.MaxUint32 {
+		return nil, errors.Errorf("table %s is not found", name)
+	}
+
+	var rows [][]interface{}
+	err = db.scan(uint32(root), 0, func(row []interface{}) error {
+		rows = append(rows, row)
+		return nil
+	})
+	return rows, errors.Wrapf(err, "failed to read table %s", name)
+}
+
+func (db *sqliteDB) page(number uint32) ([]byte, error) {
+	start := (int(number) - 1) * db.pageSize
+	if number == 0 || start+db.pageSize > len(db.data) {
+		return nil, errors.Errorf("page %d is out of the database", number)
+	}
+	return db.data[start : start+db.pageSize], nil
+}
+
+// scan calls fn with the rows of the table b-tree rooted at a page in the order of their row ids
+func (db *sqliteDB) scan(number uint32, depth int, fn func(row []interface{}) error) error {
+	if depth > maxTreeDepth {
+		return errors.New("table b-tree is too deep")
+	}
+	page, err := db.page(number)
+	if err != nil {
+		return err
+	}
+
+	// the first page starts with the database header
+	header := 0
+	if number == 1 {
+		header = 100
+	}
+	kind := page[header]
+	headerSize := 8
+	if kind == tableInteriorPage {
+		headerSize = 12
+	}
+	cells := int(binary.BigEndian.Uint16(page[header+3:]))
+	pointers := header + headerSize
+	if pointers+2*cells > db.usable {
+		return errors.Errorf("page %d has an invalid cells count %d", number, cells)
+	}
+
+	for i := 0; i < cells; i++ {
+		offset := int(binary.BigEndian.Uint16(page[pointers+2*i:]))
+		if offset < pointers || offset >= db.usable || (kind == tableInteriorPage && offset+4 > db.usable) {
+			return errors.Errorf("page %d has an invalid cell offset %d", number, offset)
+		}
+
+		switch kind {
+		case tableInteriorPage:
+			// interior cells are the left child page number and the largest row id of the child
+			if err := db.scan(binary.BigEndian.Uint32(page[offset:]), depth+1, fn); err != nil {
+				return err
+			}
+		case tableLeafPage:
+			payload, err := db.payload(page, offset)
+			if err != nil {
+				return errors.Wrapf(err, "invalid cell %d of page %d", i, number)
+			}
+			row, err := decodeRecord(payload)
+			if err != nil {
+				return errors.Wrapf(err, "invalid cell %d of page %d", i, number)
+			}
+			if err := fn(row); err != nil {
+				return err
+			}
+		default:
+			return errors.Errorf("page %d is not a table b-tree page, its type is %#x", number, kind)
+		}
+	}
+
+	if kind == tableInteriorPage {
+		return db.scan(binary.BigEndian.Uint32(page[header+8:]), depth+1, fn)
+	}
+	return nil
+}
+
+// payload returns the record of a table leaf cell, large records spill to a chain of overflow pages
+func (db *sqliteDB) payload(page []byte, offset int) ([]byte, error) {
+	size, n := sqliteVarint(page[offset:db.usable])
+	offset += n
+	// the row id isn't needed
+	_, m := sqliteVarint(page[offset:db.usable])
+	offset += m
+	if n == 0 || m == 0 || size > uint64(len(db.data)) {
+		return nil, errors.New("invalid cell header")
+	}
+
+	total := int(size)
+	local := total
+	if maxLocal := db.usable - 35; total > maxLocal {
+		minLocal := (db.usable-12)*32/255 - 23
+		local = minLocal + (total-minLocal)%(db.usable-4)
+		if local > maxLocal {
+			local = minLocal
+		}
+	}
+	if offset+local > db.usable || (local < total && offset+local+4 > db.usable) {
+		return nil, errors.New("cell overflows its page")
+	}
+	if local == total {
+		return page[offset : offset+local], nil
+	}
+
+	payload := make([]byte, 0, total)
+	payload = append(payload, page[offset:offset+local]...)
+	next := binary.BigEndian.Uint32(page[offset+local:])
+	for pages := 0; len(payload) < total; pages++ {
+		if pages > len(db.data)/db.pageSize {
+			return nil, errors.New("overflow pages chain has a cycle")
+		}
+		overflow, err := db.page(next)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid overflow page")
+		}
+		chunk := min(total-len(payload), db.usable-4)
+		payload = append(payload, overflow[4:4+chunk]...)
+		next = binary.BigEndian.Uint32(overflow)
+	}
+	return payload, nil
+}
+
+// decodeRecord decodes the columns of a record, a header of the columns serial types followed by their values
+func decodeRecord(payload []byte) ([]interface{}, error) {
+	headerSize, n := sqliteVarint(payload)
+	if n == 0 || headerSize < uint64(n) || headerSize > uint64(len(payload)) {
+		return nil, errors.New("invalid record header size")
+	}
+
+	var row []interface{}
+	body := payload[headerSize:]
+	for header := payload[n:headerSize]; len(header) != 0; {
+		serialType, n := sqliteVarint(header)
+		if n == 0 {
+			return nil, errors.New("invalid record header")
+		}
+		header = header[n:]
+
+		size := serialTypeSize(serialType)
+		if size < 0 || size > len(body) {
+			return nil, errors.Errorf("invalid record column of serial type %d", serialType)
+		}
+		value := body[:size]
+		body = body[size:]
+
+		switch {
+		case serialType == 0:
+			row = append(row, nil)
+		case serialType <= 6:
+			var v int64
+			if value[0]&0x80 != 0 {
+				v = -1
+			}
+			for _, b := range value {
+				v = v<<8 | int64(b)
+			}
+			row = append(row, v)
+		case serialType == 7:
+			row = append(row, math.Float64frombits(binary.BigEndian.Uint64(value)))
+		case serialType == 8 || serialType == 9:
+			row = append(row, int64(serialType-8))
+		case serialType%2 == 0:
+			row = append(row, value)
+		default:
+			row = append(row, string(value))
+		}
+	}
+	return row, nil
+}
+
+// serialTypeSize returns the size of the values of a record serial type, it is negative for the reserved types
+func serialTypeSize(serialType uint64) int {
+	switch {
+	case serialType <= 4:
+		return int(serialType)
+	case serialType == 5:
+		return 6
+	case serialType == 6 || serialType == 7:
+		return 8
+	case serialType == 8 || serialType == 9:
+		return 0
+	case serialType >= 12 && serialType < math.MaxInt32:
+		return int(serialType-12) / 2
+	default:
+		return -1
+	}
+}
+
+// sqliteVarint decodes a big endian variable length integer of up to 9 bytes, the size is zero if the integer is truncated
+func sqliteVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < len(b) && i < 9; i++ {
+		if i == 8 {
+			return v<<8 | uint64(b[i]), 9
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i] < 0x80 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
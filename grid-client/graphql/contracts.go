@@ -23,6 +23,8 @@ type ContractsGetter struct {
 	graphql       GraphQl
 	substrateConn subi.SubstrateExt
 	ncPool        client.NodeClientGetter
+	// metadataKey decrypts the encrypted contracts deployment data
+	metadataKey []byte
 }
 
 // Contracts from graphql
@@ -56,6 +58,16 @@ func NewContractsGetter(twinID uint32, graphql GraphQl, substrateConn subi.Subst
 	}
 }
 
+// SetMetadataKey sets the key used to decrypt the contracts deployment data
+func (c *ContractsGetter) SetMetadataKey(key []byte) {
+	c.metadataKey = key
+}
+
+// ParseDeploymentData parses the deployment data of a node contract
+func (c *ContractsGetter) ParseDeploymentData(contract Contract) (workloads.DeploymentData, error) {
+	return workloads.ParseDeploymentData(contract.DeploymentData, c.metadataKey)
+}
+
 // ListContractsByTwinID returns contracts for a twinID
 func (c *ContractsGetter) ListContractsByTwinID(states []string) (Contracts, error) {
 	state := fmt.Sprintf(`[%v]`, strings.Join(states, ", "))
@@ -129,7 +141,7 @@ func (c *ContractsGetter) ListContractsOfProjectName(projectName string, noGatew
 	}
 
 	for _, contract := range contractsList.NodeContracts {
-		deploymentData, err := workloads.ParseDeploymentData(contract.DeploymentData)
+		deploymentData, err := c.ParseDeploymentData(contract)
 		if err != nil {
 			log.Warn().Err(err).Str("metadata", contract.DeploymentData).Str("id", contract.ContractID).Msg("got contract with invalid metadata")
 			continue
@@ -161,7 +173,7 @@ func (c *ContractsGetter) GetNodeContractsByTypeAndName(projectName, deploymentT
 	}
 	nodeContractIDs := make(map[uint32]uint64)
 	for _, contract := range contracts.NodeContracts {
-		deploymentData, err := workloads.ParseDeploymentData(contract.DeploymentData)
+		deploymentData, err := c.ParseDeploymentData(contract)
 		if err != nil {
 			log.Warn().Err(err).Str("metadata", contract.DeploymentData).Str("id", contract.ContractID).Msg("got contract with invalid metadata")
 			continue
@@ -165,6 +165,20 @@ func (mr *MockSubstrateExtMockRecorder) CancelContract(identity, contractID inte
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelContract", reflect.TypeOf((*MockSubstrateExt)(nil).CancelContract), identity, contractID)
 }
 
+// CancelRentContract mocks base method.
+func (m *MockSubstrateExt) CancelRentContract(identity substrate.Identity, contractID uint64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CancelRentContract", identity, contractID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CancelRentContract indicates an expected call of CancelRentContract.
+func (mr *MockSubstrateExtMockRecorder) CancelRentContract(identity, contractID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelRentContract", reflect.TypeOf((*MockSubstrateExt)(nil).CancelRentContract), identity, contractID)
+}
+
 // Close mocks base method.
 func (m *MockSubstrateExt) Close() {
 	m.ctrl.T.Helper()
@@ -207,6 +221,21 @@ func (mr *MockSubstrateExtMockRecorder) CreateNodeContract(identity, node, body,
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateNodeContract", reflect.TypeOf((*MockSubstrateExt)(nil).CreateNodeContract), identity, node, body, hash, publicIPs, solutionProviderID)
 }
 
+// CreateRentContract mocks base method.
+func (m *MockSubstrateExt) CreateRentContract(identity substrate.Identity, node uint32, solutionProviderID *uint64) (uint64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateRentContract", identity, node, solutionProviderID)
+	ret0, _ := ret[0].(uint64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateRentContract indicates an expected call of CreateRentContract.
+func (mr *MockSubstrateExtMockRecorder) CreateRentContract(identity, node, solutionProviderID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateRentContract", reflect.TypeOf((*MockSubstrateExt)(nil).CreateRentContract), identity, node, solutionProviderID)
+}
+
 // DeleteInvalidContracts mocks base method.
 func (m *MockSubstrateExt) DeleteInvalidContracts(contracts map[uint32]uint64) error {
 	m.ctrl.T.Helper()
@@ -325,6 +354,21 @@ func (mr *MockSubstrateExtMockRecorder) GetContractIDByNameRegistration(name int
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetContractIDByNameRegistration", reflect.TypeOf((*MockSubstrateExt)(nil).GetContractIDByNameRegistration), name)
 }
 
+// GetNodeRentContract mocks base method.
+func (m *MockSubstrateExt) GetNodeRentContract(node uint32) (uint64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetNodeRentContract", node)
+	ret0, _ := ret[0].(uint64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetNodeRentContract indicates an expected call of GetNodeRentContract.
+func (mr *MockSubstrateExtMockRecorder) GetNodeRentContract(node interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNodeRentContract", reflect.TypeOf((*MockSubstrateExt)(nil).GetNodeRentContract), node)
+}
+
 // GetNodeTwin mocks base method.
 func (m *MockSubstrateExt) GetNodeTwin(id uint32) (uint32, error) {
 	m.ctrl.T.Helper()
@@ -15,20 +15,54 @@ type NodeClientGetter interface {
 	GetNodeClient(sub subi.SubstrateExt, nodeID uint32) (*NodeClient, error)
 }
 
-// NodeClientPool is a pool for node clients and rmb
+// NodeClientPool is a pool for node clients and rmb.
+// it tracks the health of the nodes, and it can cache the responses of read only calls
+// and fail fast the calls to nodes that recently timed out if it is configured to.
 type NodeClientPool struct {
 	nodeClients sync.Map
+	nodeStates  sync.Map
 	rmb         rmb.Client
 	timeout     time.Duration
+
+	cacheTTL         time.Duration
+	failureThreshold int
+	cooldown         time.Duration
+	now              func() time.Time
+}
+
+// PoolOpt configures a node client pool
+type PoolOpt func(*NodeClientPool)
+
+// WithCacheTTL caches the responses of read only calls for the ttl, the cache is disabled by default.
+// cached responses don't see the changes made by other clients to the nodes, so the ttl should be short.
+func WithCacheTTL(ttl time.Duration) PoolOpt {
+	return func(p *NodeClientPool) {
+		p.cacheTTL = ttl
+	}
+}
+
+// WithCircuitBreaker opens a node circuit after the given number of consecutive failures,
+// calls to the node fail fast until the cooldown passes. the circuit breaker is disabled by default.
+func WithCircuitBreaker(failures int, cooldown time.Duration) PoolOpt {
+	return func(p *NodeClientPool) {
+		p.failureThreshold = failures
+		p.cooldown = cooldown
+	}
 }
 
 // NewNodeClientPool generates a new client pool
-func NewNodeClientPool(rmb rmb.Client, timeout time.Duration) *NodeClientPool {
-	return &NodeClientPool{
+func NewNodeClientPool(rmb rmb.Client, timeout time.Duration, opts ...PoolOpt) *NodeClientPool {
+	p := &NodeClientPool{
 		nodeClients: sync.Map{},
+		nodeStates:  sync.Map{},
 		rmb:         rmb,
 		timeout:     timeout,
+		now:         time.Now,
 	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
 }
 
 // GetNodeClient gets the node client according to node ID
@@ -43,7 +77,25 @@ func (p *NodeClientPool) GetNodeClient(sub subi.SubstrateExt, nodeID uint32) (*N
 		return nil, errors.Wrapf(err, "failed to get node %d", nodeID)
 	}
 
-	cl, _ = p.nodeClients.LoadOrStore(nodeID, NewNodeClient(twinID, p.rmb, p.timeout))
+	nodeClient := NewNodeClient(twinID, p.rmb, p.timeout)
+	nodeClient.nodeID = nodeID
+	nodeClient.state = p.nodeState(nodeID)
+	cl, _ = p.nodeClients.LoadOrStore(nodeID, nodeClient)
 
 	return cl.(*NodeClient), nil
 }
+
+// NodeHealth returns the health of a node from the calls made by the pool clients
+func (p *NodeClientPool) NodeHealth(nodeID uint32) NodeHealth {
+	return p.nodeState(nodeID).getHealth()
+}
+
+// ResetNode forgets the health and the cached responses of a node, its circuit is closed
+func (p *NodeClientPool) ResetNode(nodeID uint32) {
+	p.nodeState(nodeID).reset()
+}
+
+func (p *NodeClientPool) nodeState(nodeID uint32) *nodeState {
+	state, _ := p.nodeStates.LoadOrStore(nodeID, &nodeState{pool: p, cache: make(map[string]cachedResponse)})
+	return state.(*nodeState)
+}
@@ -73,6 +73,7 @@ package client
 
 import (
 	"context"
+	"fmt"
 	"math/rand"
 	"net"
 	"slices"
@@ -140,11 +141,35 @@ type Interface struct {
 	Mac string   `json:"mac"`
 }
 
+// NodeUnreachableError is returned if the node didn't respond to a call in time
+type NodeUnreachableError struct {
+	// NodeID is zero for clients that are not created by a NodeClientPool
+	NodeID uint32
+	TwinID uint32
+	Err    error
+}
+
+// Error returns the unreachable node and the call error
+func (e *NodeUnreachableError) Error() string {
+	if e.NodeID == 0 {
+		return fmt.Sprintf("node with twin %d is unreachable: %s", e.TwinID, e.Err)
+	}
+	return fmt.Sprintf("node %d is unreachable: %s", e.NodeID, e.Err)
+}
+
+// Unwrap returns the call error
+func (e *NodeUnreachableError) Unwrap() error {
+	return e.Err
+}
+
 // NodeClient struct
 type NodeClient struct {
+	nodeID   uint32
 	nodeTwin uint32
 	bus      rmb.Client
 	timeout  time.Duration
+	// state is shared by the clients of a NodeClientPool, it is nil for other clients
+	state *nodeState
 }
 
 // rmbCmdArgs is a map of command line arguments
@@ -160,13 +185,49 @@ func NewNodeClient(nodeTwin uint32, bus rmb.Client, timeout time.Duration) *Node
 	}
 }
 
+// call sends the command to the node, the node is unreachable if the call context deadline is exceeded.
+// calls that fail without a response from the node count as failures of the node health.
+// clients of a pool fail fast if the node circuit is open and use the cached responses of read only calls.
+func (n *NodeClient) call(ctx context.Context, cmd string, data interface{}, result interface{}) error {
+	if n.state == nil {
+		return n.send(ctx, cmd, data, result)
+	}
+
+	if err := n.state.allow(); err != nil {
+		return &NodeUnreachableError{NodeID: n.nodeID, TwinID: n.nodeTwin, Err: err}
+	}
+	if n.state.load(cmd, result) {
+		return nil
+	}
+
+	err := n.send(ctx, cmd, data, result)
+	// errors returned by the node itself are responses, any other error means the node couldn't be reached
+	var remote rmb.RemoteError
+	if !errors.Is(err, context.Canceled) {
+		n.state.record(err != nil && !errors.As(err, &remote))
+	}
+	n.state.invalidate(cmd)
+	if err == nil {
+		n.state.store(cmd, result)
+	}
+	return err
+}
+
+func (n *NodeClient) send(ctx context.Context, cmd string, data interface{}, result interface{}) error {
+	err := n.bus.Call(ctx, n.nodeTwin, cmd, data, result)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &NodeUnreachableError{NodeID: n.nodeID, TwinID: n.nodeTwin, Err: err}
+	}
+	return err
+}
+
 // DeploymentDeploy sends the deployment to the node for processing.
 func (n *NodeClient) DeploymentDeploy(ctx context.Context, dl gridtypes.Deployment) error {
 	ctx, cancel := context.WithTimeout(ctx, n.timeout)
 	defer cancel()
 
 	const cmd = "zos.deployment.deploy"
-	return n.bus.Call(ctx, n.nodeTwin, cmd, dl, nil)
+	return n.call(ctx, cmd, dl, nil)
 }
 
 // DeploymentUpdate update the given deployment. deployment must be a valid update for
@@ -176,7 +237,7 @@ func (n *NodeClient) DeploymentUpdate(ctx context.Context, dl gridtypes.Deployme
 	defer cancel()
 
 	const cmd = "zos.deployment.update"
-	return n.bus.Call(ctx, n.nodeTwin, cmd, dl, nil)
+	return n.call(ctx, cmd, dl, nil)
 }
 
 // DeploymentGet gets a deployment via contract ID
@@ -189,7 +250,7 @@ func (n *NodeClient) DeploymentGet(ctx context.Context, contractID uint64) (dl g
 		"contract_id": contractID,
 	}
 
-	if err = n.bus.Call(ctx, n.nodeTwin, cmd, in, &dl); err != nil {
+	if err = n.call(ctx, cmd, in, &dl); err != nil {
 		return dl, err
 	}
 
@@ -207,7 +268,7 @@ func (n *NodeClient) DeploymentDelete(ctx context.Context, contractID uint64) er
 		"contract_id": contractID,
 	}
 
-	return n.bus.Call(ctx, n.nodeTwin, cmd, in, nil)
+	return n.call(ctx, cmd, in, nil)
 }
 
 // DeploymentList gets all deployments for a twin
@@ -217,7 +278,7 @@ func (n *NodeClient) DeploymentList(ctx context.Context) (dls []gridtypes.Deploy
 
 	const cmd = "zos.deployment.list"
 
-	err = n.bus.Call(ctx, n.nodeTwin, cmd, nil, &dls)
+	err = n.call(ctx, cmd, nil, &dls)
 	return
 }
 
@@ -243,7 +304,7 @@ func (n *NodeClient) Statistics(ctx context.Context) (total gridtypes.Capacity,
 		} `json:"users"`
 	}{}
 
-	if err = n.bus.Call(ctx, n.nodeTwin, cmd, nil, &result); err != nil {
+	if err = n.call(ctx, cmd, nil, &result); err != nil {
 		return
 	}
 
@@ -261,7 +322,7 @@ func (n *NodeClient) NetworkListPrivateIPs(ctx context.Context, networkName stri
 		"network_name": networkName,
 	}
 
-	if err := n.bus.Call(ctx, n.nodeTwin, cmd, in, &result); err != nil {
+	if err := n.call(ctx, cmd, in, &result); err != nil {
 		return nil, err
 	}
 
@@ -277,7 +338,7 @@ func (n *NodeClient) NetworkListWGPorts(ctx context.Context) ([]uint16, error) {
 	const cmd = "zos.network.list_wg_ports"
 	var result []uint16
 
-	if err := n.bus.Call(ctx, n.nodeTwin, cmd, nil, &result); err != nil {
+	if err := n.call(ctx, cmd, nil, &result); err != nil {
 		return nil, err
 	}
 
@@ -292,7 +353,7 @@ func (n *NodeClient) NetworkListInterfaces(ctx context.Context) (map[string][]ne
 	const cmd = "zos.network.interfaces"
 	var result map[string][]net.IP
 
-	if err := n.bus.Call(ctx, n.nodeTwin, cmd, nil, &result); err != nil {
+	if err := n.call(ctx, cmd, nil, &result); err != nil {
 		return nil, err
 	}
 
@@ -309,7 +370,7 @@ func (n *NodeClient) DeploymentChanges(ctx context.Context, contractID uint64) (
 		"contract_id": contractID,
 	}
 
-	if err = n.bus.Call(ctx, n.nodeTwin, cmd, in, &changes); err != nil {
+	if err = n.call(ctx, cmd, in, &changes); err != nil {
 		return changes, err
 	}
 
@@ -324,7 +385,7 @@ func (n *NodeClient) NetworkListIPs(ctx context.Context) ([]string, error) {
 	const cmd = "zos.network.list_public_ips"
 	var result []string
 
-	if err := n.bus.Call(ctx, n.nodeTwin, cmd, nil, &result); err != nil {
+	if err := n.call(ctx, cmd, nil, &result); err != nil {
 		return nil, err
 	}
 
@@ -339,7 +400,7 @@ func (n *NodeClient) NetworkGetPublicConfig(ctx context.Context) (cfg PublicConf
 
 	const cmd = "zos.network.public_config_get"
 
-	if err = n.bus.Call(ctx, n.nodeTwin, cmd, nil, &cfg); err != nil {
+	if err = n.call(ctx, cmd, nil, &cfg); err != nil {
 		return
 	}
 
@@ -353,7 +414,7 @@ func (n *NodeClient) NetworkSetPublicConfig(ctx context.Context, cfg PublicConfi
 	defer cancel()
 
 	const cmd = "zos.network.public_config_set"
-	return n.bus.Call(ctx, n.nodeTwin, cmd, cfg, nil)
+	return n.call(ctx, cmd, cfg, nil)
 }
 
 // SystemDMI executes dmidecode to get dmidecode output
@@ -363,7 +424,7 @@ func (n *NodeClient) SystemDMI(ctx context.Context) (result dmi.DMI, err error)
 
 	const cmd = "zos.system.dmi"
 
-	if err = n.bus.Call(ctx, n.nodeTwin, cmd, nil, &result); err != nil {
+	if err = n.call(ctx, cmd, nil, &result); err != nil {
 		return
 	}
 
@@ -377,7 +438,7 @@ func (n *NodeClient) SystemHypervisor(ctx context.Context) (result string, err e
 
 	const cmd = "zos.system.hypervisor"
 
-	if err = n.bus.Call(ctx, n.nodeTwin, cmd, nil, &result); err != nil {
+	if err = n.call(ctx, cmd, nil, &result); err != nil {
 		return
 	}
 
@@ -397,7 +458,7 @@ func (n *NodeClient) SystemVersion(ctx context.Context) (ver Version, err error)
 
 	const cmd = "zos.system.version"
 
-	if err = n.bus.Call(ctx, n.nodeTwin, cmd, nil, &ver); err != nil {
+	if err = n.call(ctx, cmd, nil, &ver); err != nil {
 		return
 	}
 
@@ -418,7 +479,7 @@ func (n *NodeClient) GetPerfTestResults(ctx context.Context) (result []TaskResul
 	defer cancel()
 
 	const cmd = "zos.perf.get_all"
-	err = n.bus.Call(ctx, n.nodeTwin, cmd, nil, &result)
+	err = n.call(ctx, cmd, nil, &result)
 
 	return
 }
@@ -435,14 +496,18 @@ func (n *NodeClient) GetPerfTestResult(ctx context.Context, testName string) (re
 	}
 
 	const cmd = "zos.perf.get"
-	err = n.bus.Call(ctx, n.nodeTwin, cmd, payload, &result)
+	err = n.call(ctx, cmd, payload, &result)
 
 	return
 }
 
-// IsNodeUp checks if the node is up
+// IsNodeUp checks if the node is up, any failure is returned as a NodeUnreachableError
 func (n *NodeClient) IsNodeUp(ctx context.Context) error {
 	_, err := n.SystemVersion(ctx)
+	var unreachable *NodeUnreachableError
+	if err != nil && !errors.As(err, &unreachable) {
+		return &NodeUnreachableError{NodeID: n.nodeID, TwinID: n.nodeTwin, Err: err}
+	}
 	return err
 }
 
@@ -522,7 +587,7 @@ func (n *NodeClient) Pools(ctx context.Context) (pools []PoolMetrics, err error)
 	defer cancel()
 
 	const cmd = "zos.storage.pools"
-	err = n.bus.Call(ctx, n.nodeTwin, cmd, nil, &pools)
+	err = n.call(ctx, cmd, nil, &pools)
 	return
 }
 
@@ -539,7 +604,7 @@ func (n *NodeClient) GPUs(ctx context.Context) (gpus []GPU, err error) {
 	defer cancel()
 
 	const cmd = "zos.gpu.list"
-	err = n.bus.Call(ctx, n.nodeTwin, cmd, nil, &gpus)
+	err = n.call(ctx, cmd, nil, &gpus)
 	return
 }
 
@@ -551,7 +616,7 @@ func (n *NodeClient) HasPublicIPv6(ctx context.Context) (bool, error) {
 	const cmd = "zos.network.has_ipv6"
 	var result bool
 
-	if err := n.bus.Call(ctx, n.nodeTwin, cmd, nil, &result); err != nil {
+	if err := n.call(ctx, cmd, nil, &result); err != nil {
 		return false, err
 	}
 
@@ -564,7 +629,7 @@ func (n *NodeClient) NetworkListAllInterfaces(ctx context.Context) (result map[s
 	defer cancel()
 
 	const cmd = "zos.network.admin.interfaces"
-	err = n.bus.Call(ctx, n.nodeTwin, cmd, nil, &result)
+	err = n.call(ctx, cmd, nil, &result)
 
 	return
 }
@@ -576,7 +641,7 @@ func (n *NodeClient) NetworkSetPublicExitDevice(ctx context.Context, iface strin
 	defer cancel()
 
 	const cmd = "zos.network.admin.set_public_nic"
-	return n.bus.Call(ctx, n.nodeTwin, cmd, iface, nil)
+	return n.call(ctx, cmd, iface, nil)
 }
 
 // NetworkGetPublicExitDevice gets the current dual nic setup of the node.
@@ -585,7 +650,7 @@ func (n *NodeClient) NetworkGetPublicExitDevice(ctx context.Context) (exit ExitD
 	defer cancel()
 
 	const cmd = "zos.network.admin.get_public_nic"
-	err = n.bus.Call(ctx, n.nodeTwin, cmd, nil, &exit)
+	err = n.call(ctx, cmd, nil, &exit)
 	return
 }
 
@@ -0,0 +1,143 @@
+package client
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrCircuitOpen is returned for calls to a node whose circuit is opened after consecutive failures
+var ErrCircuitOpen = errors.New("node recently timed out, calls fail fast until the circuit cooldown passes")
+
+// NodeHealth is the health of a node tracked from the results of its calls
+type NodeHealth struct {
+	// LastSuccess is the last time the node responded to a call
+	LastSuccess time.Time
+	LastFailure time.Time
+	// ConsecutiveFailures is the number of calls that timed out since the last response of the node
+	ConsecutiveFailures int
+	// OpenUntil is set while the node circuit is open, calls to the node fail fast until then
+	OpenUntil time.Time
+}
+
+// cachedCmds are the read only calls cached by the pool clients, they don't take any arguments
+var cachedCmds = map[string]bool{
+	"zos.statistics.get":               true,
+	"zos.storage.pools":                true,
+	"zos.network.list_wg_ports":        true,
+	"zos.network.interfaces":           true,
+	"zos.network.public_config_get":    true,
+	"zos.network.has_ipv6":             true,
+	"zos.network.list_public_ips":      true,
+	"zos.gpu.list":                     true,
+	"zos.network.admin.interfaces":     true,
+	"zos.network.admin.get_public_nic": true,
+}
+
+// invalidatingCmds change the node resources, they drop the cached responses of the node
+var invalidatingCmds = map[string]bool{
+	"zos.deployment.deploy":            true,
+	"zos.deployment.update":            true,
+	"zos.deployment.delete":            true,
+	"zos.network.public_config_set":    true,
+	"zos.network.admin.set_public_nic": true,
+}
+
+type cachedResponse struct {
+	data    []byte
+	expires time.Time
+}
+
+// nodeState is the health and the cached responses of a node shared by the clients of a pool
+type nodeState struct {
+	pool *NodeClientPool
+
+	mu     sync.Mutex
+	health NodeHealth
+	cache  map[string]cachedResponse
+}
+
+func (s *nodeState) getHealth() NodeHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.health
+}
+
+func (s *nodeState) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.health = NodeHealth{}
+	s.cache = make(map[string]cachedResponse)
+}
+
+// allow fails if the node circuit is open
+func (s *nodeState) allow() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pool.now().Before(s.health.OpenUntil) {
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+// record updates the node health with a call result, the circuit is opened after enough consecutive failures
+func (s *nodeState) record(failed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.pool.now()
+	if !failed {
+		s.health.LastSuccess = now
+		s.health.ConsecutiveFailures = 0
+		s.health.OpenUntil = time.Time{}
+		return
+	}
+
+	s.health.LastFailure = now
+	s.health.ConsecutiveFailures++
+	if s.pool.failureThreshold > 0 && s.health.ConsecutiveFailures >= s.pool.failureThreshold {
+		s.health.OpenUntil = now.Add(s.pool.cooldown)
+	}
+}
+
+// load decodes the cached response of a command into result, it returns false if there is no valid cached response
+func (s *nodeState) load(cmd string, result interface{}) bool {
+	if s.pool.cacheTTL <= 0 || !cachedCmds[cmd] {
+		return false
+	}
+
+	s.mu.Lock()
+	cached, ok := s.cache[cmd]
+	s.mu.Unlock()
+	if !ok || !s.pool.now().Before(cached.expires) {
+		return false
+	}
+	return json.Unmarshal(cached.data, result) == nil
+}
+
+// invalidate drops the cached responses of the node if the command changes the node
+func (s *nodeState) invalidate(cmd string) {
+	if !invalidatingCmds[cmd] {
+		return
+	}
+	s.mu.Lock()
+	s.cache = make(map[string]cachedResponse)
+	s.mu.Unlock()
+}
+
+// store caches the response of a read only command
+func (s *nodeState) store(cmd string, result interface{}) {
+	if s.pool.cacheTTL <= 0 || !cachedCmds[cmd] {
+		return
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	s.cache[cmd] = cachedResponse{data: data, expires: s.pool.now().Add(s.pool.cacheTTL)}
+	s.mu.Unlock()
+}
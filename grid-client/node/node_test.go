@@ -0,0 +1,244 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfgrid-sdk-go/rmb-sdk-go"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+)
+
+// busFunc is an rmb client that handles all calls with a function
+type busFunc func(ctx context.Context) error
+
+func (f busFunc) Call(ctx context.Context, twin uint32, fn string, data interface{}, result interface{}) error {
+	return f(ctx)
+}
+
+func TestNodeUnreachableError(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("node doesn't respond", func(t *testing.T) {
+		bus := busFunc(func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		cl := NewNodeClient(7, bus, 10*time.Millisecond)
+		cl.nodeID = 11
+
+		_, err := cl.DeploymentChanges(ctx, 1)
+		var unreachableErr *NodeUnreachableError
+		require.ErrorAs(t, err, &unreachableErr)
+		assert.Equal(t, uint32(11), unreachableErr.NodeID)
+		assert.Equal(t, uint32(7), unreachableErr.TwinID)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("node returns an error", func(t *testing.T) {
+		bus := busFunc(func(ctx context.Context) error {
+			return errors.New("deployment not found")
+		})
+		cl := NewNodeClient(7, bus, time.Minute)
+
+		_, err := cl.DeploymentChanges(ctx, 1)
+		var unreachableErr *NodeUnreachableError
+		assert.False(t, errors.As(err, &unreachableErr))
+
+		// failed health checks are always unreachable nodes
+		err = cl.IsNodeUp(ctx)
+		require.ErrorAs(t, err, &unreachableErr)
+		assert.Equal(t, uint32(7), unreachableErr.TwinID)
+	})
+}
+
+// cmdBus is an rmb client that counts the calls of each command
+type cmdBus struct {
+	calls map[string]int
+	down  bool
+	err   error
+}
+
+func (b *cmdBus) Call(ctx context.Context, twin uint32, fn string, data interface{}, result interface{}) error {
+	b.calls[fn]++
+	if b.down {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	if b.err != nil {
+		return b.err
+	}
+	if ports, ok := result.(*[]uint16); ok {
+		*ports = []uint16{uint16(b.calls[fn])}
+	}
+	return nil
+}
+
+const (
+	cacheTTL         = 30 * time.Second
+	failureThreshold = 2
+	cooldown         = time.Minute
+)
+
+// poolClient creates a client of node 11 in the pool with a fake clock
+func poolClient(bus *cmdBus, now *time.Time, opts ...PoolOpt) (*NodeClientPool, *NodeClient) {
+	pool := NewNodeClientPool(bus, 10*time.Millisecond, opts...)
+	pool.now = func() time.Time { return *now }
+
+	cl := NewNodeClient(7, bus, 10*time.Millisecond)
+	cl.nodeID = 11
+	cl.state = pool.nodeState(11)
+	return pool, cl
+}
+
+func TestNodeClientPoolCache(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	bus := &cmdBus{calls: map[string]int{}}
+	_, cl := poolClient(bus, &now, WithCacheTTL(cacheTTL))
+
+	ports, err := cl.NetworkListWGPorts(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{1}, ports)
+
+	ports, err = cl.NetworkListWGPorts(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{1}, ports)
+	assert.Equal(t, 1, bus.calls["zos.network.list_wg_ports"])
+
+	t.Run("deployments invalidate the cache", func(t *testing.T) {
+		require.NoError(t, cl.DeploymentDeploy(ctx, gridtypes.Deployment{}))
+		ports, err := cl.NetworkListWGPorts(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []uint16{2}, ports)
+	})
+
+	t.Run("cached responses expire", func(t *testing.T) {
+		now = now.Add(cacheTTL)
+		ports, err := cl.NetworkListWGPorts(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []uint16{3}, ports)
+	})
+
+	t.Run("calls with arguments are not cached", func(t *testing.T) {
+		_, err := cl.NetworkListPrivateIPs(ctx, "net")
+		require.NoError(t, err)
+		_, err = cl.NetworkListPrivateIPs(ctx, "net")
+		require.NoError(t, err)
+		assert.Equal(t, 2, bus.calls["zos.network.list_private_ips"])
+	})
+
+	t.Run("cache is disabled by default", func(t *testing.T) {
+		bus := &cmdBus{calls: map[string]int{}}
+		_, cl := poolClient(bus, &now)
+		for i := 0; i < 2; i++ {
+			_, err := cl.NetworkListWGPorts(ctx)
+			require.NoError(t, err)
+		}
+		assert.Equal(t, 2, bus.calls["zos.network.list_wg_ports"])
+	})
+}
+
+func TestNodeClientPoolCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	bus := &cmdBus{calls: map[string]int{}, down: true}
+	pool, cl := poolClient(bus, &now, WithCircuitBreaker(failureThreshold, cooldown))
+
+	for i := 0; i < failureThreshold; i++ {
+		_, err := cl.DeploymentChanges(ctx, 1)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	}
+	health := pool.NodeHealth(11)
+	assert.Equal(t, failureThreshold, health.ConsecutiveFailures)
+	assert.Equal(t, now, health.LastFailure)
+	assert.Equal(t, now.Add(cooldown), health.OpenUntil)
+
+	// the open circuit fails fast without calling the node
+	_, err := cl.DeploymentChanges(ctx, 1)
+	var unreachableErr *NodeUnreachableError
+	require.ErrorAs(t, err, &unreachableErr)
+	assert.Equal(t, uint32(11), unreachableErr.NodeID)
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, failureThreshold, bus.calls["zos.deployment.changes"])
+
+	t.Run("a failure after the cooldown opens the circuit again", func(t *testing.T) {
+		now = now.Add(cooldown)
+		_, err := cl.DeploymentChanges(ctx, 1)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		_, err = cl.DeploymentChanges(ctx, 1)
+		assert.ErrorIs(t, err, ErrCircuitOpen)
+	})
+
+	t.Run("a response closes the circuit", func(t *testing.T) {
+		now = now.Add(cooldown)
+		bus.down = false
+		_, err := cl.DeploymentChanges(ctx, 1)
+		require.NoError(t, err)
+
+		health := pool.NodeHealth(11)
+		assert.Zero(t, health.ConsecutiveFailures)
+		assert.Zero(t, health.OpenUntil)
+		assert.Equal(t, now, health.LastSuccess)
+	})
+
+	t.Run("node errors are responses", func(t *testing.T) {
+		now = now.Add(time.Second)
+		bus.err = rmb.RemoteError{Message: "deployment not found"}
+		defer func() { bus.err = nil }()
+
+		_, err := cl.DeploymentChanges(ctx, 1)
+		assert.EqualError(t, err, "deployment not found")
+		health := pool.NodeHealth(11)
+		assert.Zero(t, health.ConsecutiveFailures)
+		assert.Equal(t, now, health.LastSuccess)
+	})
+
+	t.Run("relay errors are failures", func(t *testing.T) {
+		bus.err = errors.New("twin not connected")
+		defer func() { bus.err = nil }()
+
+		for i := 0; i < failureThreshold; i++ {
+			_, err := cl.DeploymentChanges(ctx, 1)
+			assert.EqualError(t, err, "twin not connected")
+		}
+		_, err := cl.DeploymentChanges(ctx, 1)
+		assert.ErrorIs(t, err, ErrCircuitOpen)
+		pool.ResetNode(11)
+	})
+
+	t.Run("canceled calls are not recorded", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		bus.err = context.Canceled
+		defer func() { bus.err = nil }()
+
+		_, err := cl.DeploymentChanges(ctx, 1)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, NodeHealth{}, pool.NodeHealth(11))
+	})
+
+	t.Run("reset node", func(t *testing.T) {
+		bus.down = true
+		for i := 0; i < failureThreshold; i++ {
+			_, _ = cl.DeploymentChanges(ctx, 1)
+		}
+		pool.ResetNode(11)
+		assert.Equal(t, NodeHealth{}, pool.NodeHealth(11))
+		_, err := cl.DeploymentChanges(ctx, 1)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("circuit breaker is disabled by default", func(t *testing.T) {
+		bus := &cmdBus{calls: map[string]int{}, down: true}
+		pool, cl := poolClient(bus, &now)
+		for i := 0; i <= failureThreshold; i++ {
+			_, err := cl.DeploymentChanges(ctx, 1)
+			assert.ErrorIs(t, err, context.DeadlineExceeded)
+		}
+		assert.Zero(t, pool.NodeHealth(11).OpenUntil)
+	})
+}
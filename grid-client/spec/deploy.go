@@ -0,0 +1,43 @@
+package spec
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/deployer"
+)
+
+// Deploy deploys the project objects in order: networks, deployments, kubernetes clusters then gateways.
+// gateway vm backends are resolved after the deployments get their private ips.
+func (p *Project) Deploy(ctx context.Context, tfPluginClient *deployer.TFPluginClient) error {
+	for _, znet := range p.Networks {
+		if err := tfPluginClient.NetworkDeployer.Deploy(ctx, znet); err != nil {
+			return errors.Wrapf(err, "could not deploy network %s", znet.Name)
+		}
+	}
+	for _, dl := range p.Deployments {
+		if err := tfPluginClient.DeploymentDeployer.Deploy(ctx, dl); err != nil {
+			return errors.Wrapf(err, "could not deploy deployment %s", dl.Name)
+		}
+	}
+	for _, cluster := range p.K8sClusters {
+		if err := tfPluginClient.K8sDeployer.Deploy(ctx, cluster); err != nil {
+			return errors.Wrapf(err, "could not deploy kubernetes cluster %s", cluster.Master.Name)
+		}
+	}
+
+	if err := p.ResolveBackends(); err != nil {
+		return errors.Wrap(err, "could not resolve gateway backends")
+	}
+	for _, gw := range p.GatewayNames {
+		if err := tfPluginClient.GatewayNameDeployer.Deploy(ctx, gw); err != nil {
+			return errors.Wrapf(err, "could not deploy gateway %s", gw.Name)
+		}
+	}
+	for _, gw := range p.GatewayFQDNs {
+		if err := tfPluginClient.GatewayFQDNDeployer.Deploy(ctx, gw); err != nil {
+			return errors.Wrapf(err, "could not deploy gateway %s", gw.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,572 @@
+package spec
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultIPRange is used for networks without an ip range
+const defaultIPRange = "10.20.0.0/16"
+
+// Project is the set of typed workloads described by a spec
+type Project struct {
+	Name         string
+	Networks     []*workloads.ZNet
+	Deployments  []*workloads.Deployment
+	K8sClusters  []*workloads.K8sCluster
+	GatewayNames []*workloads.GatewayNameProxy
+	GatewayFQDNs []*workloads.GatewayFQDNProxy
+
+	// vmBackends are the gateways backends that point to vms, they are resolved from the vms private ips
+	vmBackends []vmBackend
+}
+
+// vmBackend is a gateway backend that points to a port of a spec vm
+type vmBackend struct {
+	backends *[]zos.Backend
+	index    int
+	vm       string
+	port     uint16
+	protocol string
+}
+
+// Load reads a YAML or JSON spec file and converts it to a project
+func Load(path string) (*Project, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read spec file %s", path)
+	}
+
+	s, err := Parse(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not parse spec file %s", path)
+	}
+	return s.Project()
+}
+
+// Parse decodes a YAML or JSON spec, unknown fields are rejected
+func Parse(data []byte) (Spec, error) {
+	var s Spec
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&s); err != nil {
+		return Spec{}, errors.Wrap(err, "invalid spec")
+	}
+	return s, nil
+}
+
+// Validate checks the spec version, names and the references between its objects
+func (s Spec) Validate() error {
+	var errs error
+	fail := func(format string, args ...interface{}) {
+		errs = multierror.Append(errs, fmt.Errorf(format, args...))
+	}
+
+	if s.Version != Version {
+		fail("unsupported spec version %d, expected %d", s.Version, Version)
+	}
+
+	networks := make(map[string][]uint32)
+	for _, network := range s.Networks {
+		if network.Name == "" {
+			fail("network name can't be empty")
+		} else if _, ok := networks[network.Name]; ok {
+			fail("network %s is duplicated", network.Name)
+		}
+		networks[network.Name] = network.Nodes
+		if len(network.Nodes) == 0 {
+			fail("network %s has no nodes", network.Name)
+		}
+		for _, key := range network.MyceliumKeys {
+			if !slices.Contains(network.Nodes, key.Node) {
+				fail("network %s has a mycelium key of node %d that is not one of its nodes", network.Name, key.Node)
+			}
+			if _, err := hex.DecodeString(key.Key); err != nil {
+				fail("network %s has an invalid mycelium key of node %d: %s", network.Name, key.Node, err)
+			}
+		}
+		for _, access := range network.UserAccesses {
+			if _, err := wgtypes.ParseKey(access.PrivateKey); access.PrivateKey != "" && err != nil {
+				fail("user access %s of network %s has an invalid private key: %s", access.Name, network.Name, err)
+			}
+		}
+		if _, err := wgtypes.ParseKey(network.WGAccessPrivateKey); network.WGAccessPrivateKey != "" && err != nil {
+			fail("network %s has an invalid wireguard access private key: %s", network.Name, err)
+		}
+	}
+
+	deployments := make(map[string]bool)
+	vms := make(map[string]string)
+	for _, dl := range s.Deployments {
+		if dl.Name == "" {
+			fail("deployment name can't be empty")
+		} else if deployments[dl.Name] {
+			fail("deployment %s is duplicated", dl.Name)
+		}
+		deployments[dl.Name] = true
+
+		if _, ok := networks[dl.Network]; dl.Network != "" && !ok {
+			fail("deployment %s uses unknown network %s", dl.Name, dl.Network)
+		}
+
+		mountable := make(map[string]bool)
+		for _, disk := range dl.Disks {
+			mountable[disk.Name] = true
+		}
+		for _, qsfs := range dl.QSFS {
+			mountable[qsfs.Name] = true
+		}
+
+		for _, vm := range dl.VMs {
+			if _, ok := vms[vm.Name]; ok {
+				fail("vm %s is duplicated", vm.Name)
+			}
+			vms[vm.Name] = dl.Network
+
+			for _, mount := range vm.Mounts {
+				if !mountable[mount.Name] {
+					fail("vm %s mounts unknown disk or qsfs %s of deployment %s", vm.Name, mount.Name, dl.Name)
+				}
+			}
+			if _, err := hex.DecodeString(vm.MyceliumIPSeed); err != nil {
+				fail("vm %s has an invalid mycelium ip seed: %s", vm.Name, err)
+			}
+		}
+	}
+
+	masters := make(map[string]bool)
+	for _, cluster := range s.K8s {
+		if masters[cluster.Master.Name] {
+			fail("kubernetes cluster %s is duplicated", cluster.Master.Name)
+		}
+		masters[cluster.Master.Name] = true
+
+		if _, ok := networks[cluster.Network]; !ok {
+			fail("kubernetes cluster %s uses unknown network %s", cluster.Master.Name, cluster.Network)
+		}
+		for _, node := range append([]K8sNode{cluster.Master}, cluster.Workers...) {
+			if _, err := hex.DecodeString(node.MyceliumIPSeed); err != nil {
+				fail("kubernetes node %s has an invalid mycelium ip seed: %s", node.Name, err)
+			}
+		}
+	}
+
+	gateways := make(map[string]bool)
+	for _, gw := range s.Gateways {
+		if gw.Name == "" {
+			fail("gateway name can't be empty")
+		} else if gateways[gw.Name] {
+			fail("gateway %s is duplicated", gw.Name)
+		}
+		gateways[gw.Name] = true
+
+		if _, ok := networks[gw.Network]; gw.Network != "" && !ok {
+			fail("gateway %s uses unknown network %s", gw.Name, gw.Network)
+		}
+		if len(gw.Backends) == 0 {
+			fail("gateway %s has no backends", gw.Name)
+		}
+		gwNetwork := gw.Network
+		for _, backend := range gw.Backends {
+			switch {
+			case (backend.URL == "") == (backend.VM == ""):
+				fail("gateway %s backends must have either a url or a vm", gw.Name)
+			case backend.VM == "":
+				continue
+			}
+
+			network, ok := vms[backend.VM]
+			if !ok {
+				fail("gateway %s backend uses unknown vm %s", gw.Name, backend.VM)
+				continue
+			}
+			if backend.Port == 0 {
+				fail("gateway %s backend vm %s has no port", gw.Name, backend.VM)
+			}
+			switch {
+			case gw.Network != "" && gw.Network != network:
+				fail("gateway %s network %s is not the network of vm %s", gw.Name, gw.Network, backend.VM)
+			case gwNetwork != "" && gwNetwork != network:
+				fail("gateway %s backends use vms of different networks %s and %s", gw.Name, gwNetwork, network)
+			default:
+				gwNetwork = network
+			}
+		}
+
+		if nodes, ok := networks[gwNetwork]; ok && !slices.Contains(nodes, gw.Node) {
+			fail("gateway %s node %d is not a node of network %s", gw.Name, gw.Node, gwNetwork)
+		}
+	}
+
+	return errs
+}
+
+// Project validates the spec and converts it to typed workloads.
+// gateway backends that point to vms without private ips are resolved with ResolveBackends after the vms are deployed.
+func (s Spec) Project() (*Project, error) {
+	if err := s.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid spec")
+	}
+
+	p := &Project{Name: s.ProjectName}
+	for _, network := range s.Networks {
+		znet, err := s.network(network)
+		if err != nil {
+			return nil, err
+		}
+		p.Networks = append(p.Networks, znet)
+	}
+
+	vmNetworks := make(map[string]string)
+	for _, dl := range s.Deployments {
+		deployment, err := s.deployment(dl)
+		if err != nil {
+			return nil, err
+		}
+		p.Deployments = append(p.Deployments, deployment)
+		for _, vm := range dl.VMs {
+			vmNetworks[vm.Name] = dl.Network
+		}
+	}
+
+	for _, cluster := range s.K8s {
+		k8sCluster, err := s.k8sCluster(cluster)
+		if err != nil {
+			return nil, err
+		}
+		p.K8sClusters = append(p.K8sClusters, k8sCluster)
+	}
+
+	for _, gw := range s.Gateways {
+		backends := make([]zos.Backend, len(gw.Backends))
+		network := gw.Network
+		for i, backend := range gw.Backends {
+			backends[i] = zos.Backend(backend.URL)
+			if backend.VM != "" {
+				network = vmNetworks[backend.VM]
+			}
+		}
+
+		if gw.FQDN != "" {
+			fqdn := &workloads.GatewayFQDNProxy{
+				NodeID:         gw.Node,
+				Name:           gw.Name,
+				FQDN:           gw.FQDN,
+				Backends:       backends,
+				TLSPassthrough: gw.TLSPassthrough,
+				Network:        network,
+				SolutionType:   s.ProjectName,
+			}
+			p.GatewayFQDNs = append(p.GatewayFQDNs, fqdn)
+			p.addVMBackends(&fqdn.Backends, gw.Backends)
+			continue
+		}
+
+		name := &workloads.GatewayNameProxy{
+			NodeID:         gw.Node,
+			Name:           gw.Name,
+			Backends:       backends,
+			TLSPassthrough: gw.TLSPassthrough,
+			Network:        network,
+			SolutionType:   s.ProjectName,
+		}
+		p.GatewayNames = append(p.GatewayNames, name)
+		p.addVMBackends(&name.Backends, gw.Backends)
+	}
+
+	// backends of vms with known ips are resolved right away
+	p.vmBackends = p.resolveBackends()
+	return p, nil
+}
+
+// addVMBackends registers the vm backends of a gateway to be resolved
+func (p *Project) addVMBackends(backends *[]zos.Backend, specBackends []Backend) {
+	for i, backend := range specBackends {
+		if backend.VM == "" {
+			continue
+		}
+		protocol := backend.Protocol
+		if protocol == "" {
+			protocol = "http"
+		}
+		p.vmBackends = append(p.vmBackends, vmBackend{backends: backends, index: i, vm: backend.VM, port: backend.Port, protocol: protocol})
+	}
+}
+
+// ResolveBackends sets the gateway backends that point to vms using the vms private ips.
+// it fails if a vm has no private ip yet, vm ips are assigned when their deployments are deployed.
+func (p *Project) ResolveBackends() error {
+	p.vmBackends = p.resolveBackends()
+
+	var errs error
+	for _, backend := range p.vmBackends {
+		errs = multierror.Append(errs, fmt.Errorf("vm %s has no private ip, it must be deployed first", backend.vm))
+	}
+	return errs
+}
+
+// resolveBackends sets the backends of the vms with private ips and returns the unresolved backends
+func (p *Project) resolveBackends() []vmBackend {
+	ips := make(map[string]string)
+	for _, dl := range p.Deployments {
+		for _, vm := range dl.Vms {
+			ips[vm.Name] = vm.IP
+		}
+	}
+
+	var unresolved []vmBackend
+	for _, backend := range p.vmBackends {
+		ip := ips[backend.vm]
+		if ip == "" {
+			unresolved = append(unresolved, backend)
+			continue
+		}
+		(*backend.backends)[backend.index] = zos.Backend(fmt.Sprintf("%s://%s:%d", backend.protocol, ip, backend.port))
+	}
+	return unresolved
+}
+
+func (s Spec) network(network Network) (*workloads.ZNet, error) {
+	ipRange := network.IPRange
+	if ipRange == "" {
+		ipRange = defaultIPRange
+	}
+	ipNet, err := gridtypes.ParseIPNet(ipRange)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid ip range of network %s", network.Name)
+	}
+
+	znet := &workloads.ZNet{
+		Name:         network.Name,
+		Description:  network.Description,
+		Nodes:        network.Nodes,
+		IPRange:      ipNet,
+		AddWGAccess:  network.WGAccess,
+		MyceliumOnly: network.MyceliumOnly,
+		SolutionType: s.ProjectName,
+	}
+	if network.Mycelium || len(network.MyceliumKeys) != 0 {
+		znet.MyceliumKeys = make(map[uint32][]byte)
+	}
+	for _, key := range network.MyceliumKeys {
+		znet.MyceliumKeys[key.Node], err = hex.DecodeString(key.Key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid mycelium key of node %d in network %s", key.Node, network.Name)
+		}
+	}
+	for _, node := range network.Nodes {
+		if !network.Mycelium || len(znet.MyceliumKeys[node]) != 0 {
+			continue
+		}
+		znet.MyceliumKeys[node], err = workloads.RandomMyceliumKey()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to generate mycelium key of network %s", network.Name)
+		}
+	}
+
+	for _, access := range network.UserAccesses {
+		privateKey := access.PrivateKey
+		if privateKey == "" {
+			key, err := wgtypes.GeneratePrivateKey()
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to generate private key of user access %s", access.Name)
+			}
+			privateKey = key.String()
+		}
+		znet.UserAccesses = append(znet.UserAccesses, workloads.UserAccess{Name: access.Name, Subnet: access.Subnet, PrivateKey: privateKey})
+	}
+
+	if network.WGAccessSubnet != "" {
+		externalIP, err := gridtypes.ParseIPNet(network.WGAccessSubnet)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid wireguard access subnet of network %s", network.Name)
+		}
+		znet.ExternalIP = &externalIP
+	}
+	if network.WGAccessPrivateKey != "" {
+		znet.ExternalSK, err = wgtypes.ParseKey(network.WGAccessPrivateKey)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid wireguard access private key of network %s", network.Name)
+		}
+	}
+	znet.PublicNodeID = network.PublicNode
+
+	if err := znet.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "invalid network %s", network.Name)
+	}
+	return znet, nil
+}
+
+func (s Spec) deployment(dl Deployment) (*workloads.Deployment, error) {
+	deployment := workloads.NewDeployment(dl.Name, dl.Node, s.ProjectName, nil, dl.Network, nil, nil, nil, nil)
+
+	for _, disk := range dl.Disks {
+		deployment.Disks = append(deployment.Disks, workloads.Disk{Name: disk.Name, SizeGB: disk.Size, Description: disk.Description})
+	}
+	for _, zdb := range dl.ZDBs {
+		deployment.Zdbs = append(deployment.Zdbs, workloads.ZDB{
+			Name:        zdb.Name,
+			Description: zdb.Description,
+			Size:        zdb.Size,
+			Mode:        zdb.Mode,
+			Password:    zdb.Password,
+			Public:      zdb.Public,
+		})
+	}
+	for _, qsfs := range dl.QSFS {
+		deployment.QSFS = append(deployment.QSFS, workloadQSFS(qsfs))
+	}
+	for _, ip := range dl.ReservedIPs {
+		deployment.ReservedIPs = append(deployment.ReservedIPs, workloads.ReservedIP{Name: ip.Name, IP: ip.IP})
+	}
+
+	for _, vm := range dl.VMs {
+		seed, err := myceliumIPSeed(vm.Mycelium, vm.MyceliumIPSeed)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to generate mycelium ip seed of vm %s", vm.Name)
+		}
+
+		var gpus []zos.GPU
+		for _, gpu := range vm.GPUs {
+			gpus = append(gpus, zos.GPU(gpu))
+		}
+		var mounts []workloads.Mount
+		for _, mount := range vm.Mounts {
+			mounts = append(mounts, workloads.Mount{DiskName: mount.Name, MountPoint: mount.Path})
+		}
+
+		deployment.Vms = append(deployment.Vms, workloads.VM{
+			Name:            vm.Name,
+			Description:     vm.Description,
+			Flist:           vm.Flist,
+			Entrypoint:      vm.Entrypoint,
+			CPU:             vm.CPU,
+			Memory:          vm.Memory,
+			RootfsSize:      vm.RootfsSize,
+			PublicIP:        vm.PublicIP,
+			PublicIP6:       vm.PublicIP6,
+			PublicIPAddress: vm.PublicIPAddress,
+			Planetary:       vm.Planetary,
+			MyceliumIPSeed:  seed,
+			IP:              vm.IP,
+			GPUs:            gpus,
+			EnvVars:         vm.Env,
+			Mounts:          mounts,
+			NetworkName:     dl.Network,
+		})
+	}
+
+	if err := deployment.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "invalid deployment %s", dl.Name)
+	}
+	return &deployment, nil
+}
+
+func (s Spec) k8sCluster(cluster K8sCluster) (*workloads.K8sCluster, error) {
+	k8sNode := func(node K8sNode) (workloads.K8sNode, error) {
+		seed, err := myceliumIPSeed(node.Mycelium, node.MyceliumIPSeed)
+		if err != nil {
+			return workloads.K8sNode{}, errors.Wrapf(err, "failed to generate mycelium ip seed of kubernetes node %s", node.Name)
+		}
+		return workloads.K8sNode{
+			Name:           node.Name,
+			Node:           node.Node,
+			Flist:          node.Flist,
+			CPU:            node.CPU,
+			Memory:         node.Memory,
+			DiskSize:       node.DiskSize,
+			PublicIP:       node.PublicIP,
+			PublicIP6:      node.PublicIP6,
+			Planetary:      node.Planetary,
+			MyceliumIPSeed: seed,
+			IP:             node.IP,
+			NetworkName:    cluster.Network,
+		}, nil
+	}
+
+	master, err := k8sNode(cluster.Master)
+	if err != nil {
+		return nil, err
+	}
+	k8sCluster := &workloads.K8sCluster{
+		Master:       &master,
+		Token:        cluster.Token,
+		NetworkName:  cluster.Network,
+		SSHKey:       cluster.SSHKey,
+		SolutionType: s.ProjectName,
+	}
+	for _, worker := range cluster.Workers {
+		node, err := k8sNode(worker)
+		if err != nil {
+			return nil, err
+		}
+		k8sCluster.Workers = append(k8sCluster.Workers, node)
+	}
+
+	if err := k8sCluster.ValidateToken(); err != nil {
+		return nil, errors.Wrapf(err, "invalid kubernetes cluster %s", master.Name)
+	}
+	if err := k8sCluster.ValidateNames(); err != nil {
+		return nil, errors.Wrapf(err, "invalid kubernetes cluster %s", master.Name)
+	}
+	return k8sCluster, nil
+}
+
+func workloadQSFS(qsfs QSFS) workloads.QSFS {
+	backends := func(specBackends []ZDBBackend) workloads.Backends {
+		var res workloads.Backends
+		for _, backend := range specBackends {
+			res = append(res, workloads.Backend{Address: backend.Address, Namespace: backend.Namespace, Password: backend.Password})
+		}
+		return res
+	}
+
+	var groups workloads.Groups
+	for _, group := range qsfs.Groups {
+		groups = append(groups, workloads.Group{Backends: backends(group)})
+	}
+
+	return workloads.QSFS{
+		Name:                 qsfs.Name,
+		Description:          qsfs.Description,
+		Cache:                qsfs.Cache,
+		MinimalShards:        qsfs.MinimalShards,
+		ExpectedShards:       qsfs.ExpectedShards,
+		RedundantGroups:      qsfs.RedundantGroups,
+		RedundantNodes:       qsfs.RedundantNodes,
+		MaxZDBDataDirSize:    qsfs.MaxZDBDataDirSize,
+		EncryptionAlgorithm:  qsfs.EncryptionAlgorithm,
+		EncryptionKey:        qsfs.EncryptionKey,
+		CompressionAlgorithm: qsfs.CompressionAlgorithm,
+		Metadata: workloads.Metadata{
+			Type:                qsfs.Metadata.Type,
+			Prefix:              qsfs.Metadata.Prefix,
+			EncryptionAlgorithm: qsfs.Metadata.EncryptionAlgorithm,
+			EncryptionKey:       qsfs.Metadata.EncryptionKey,
+			Backends:            backends(qsfs.Metadata.Backends),
+		},
+		Groups: groups,
+	}
+}
+
+// myceliumIPSeed decodes a hex seed, or generates a random one if mycelium is enabled without a seed
+func myceliumIPSeed(enabled bool, seed string) ([]byte, error) {
+	if seed != "" {
+		return hex.DecodeString(seed)
+	}
+	if !enabled {
+		return nil, nil
+	}
+	return workloads.RandomMyceliumIPSeed()
+}
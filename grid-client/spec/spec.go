@@ -0,0 +1,199 @@
+// Package spec includes a versioned YAML/JSON format to describe grid deployments and converts it to workloads
+package spec
+
+// Version is the current spec format version
+const Version = 1
+
+// Spec describes the grid objects of a project
+type Spec struct {
+	Version     int          `yaml:"version" json:"version"`
+	ProjectName string       `yaml:"project,omitempty" json:"project,omitempty"`
+	Networks    []Network    `yaml:"networks,omitempty" json:"networks,omitempty"`
+	Deployments []Deployment `yaml:"deployments,omitempty" json:"deployments,omitempty"`
+	K8s         []K8sCluster `yaml:"kubernetes,omitempty" json:"kubernetes,omitempty"`
+	Gateways    []Gateway    `yaml:"gateways,omitempty" json:"gateways,omitempty"`
+}
+
+// Network is a private network on a set of nodes
+type Network struct {
+	Name        string   `yaml:"name" json:"name"`
+	Description string   `yaml:"description,omitempty" json:"description,omitempty"`
+	Nodes       []uint32 `yaml:"nodes" json:"nodes"`
+	// IPRange is a /16 ip range, 10.20.0.0/16 is used if it is empty
+	IPRange  string `yaml:"ip_range,omitempty" json:"ip_range,omitempty"`
+	WGAccess bool   `yaml:"wg_access,omitempty" json:"wg_access,omitempty"`
+	// Mycelium enables mycelium on all the network nodes, the keys of the nodes missing from MyceliumKeys are generated when the spec is loaded
+	Mycelium     bool          `yaml:"mycelium,omitempty" json:"mycelium,omitempty"`
+	MyceliumOnly bool          `yaml:"mycelium_only,omitempty" json:"mycelium_only,omitempty"`
+	MyceliumKeys []MyceliumKey `yaml:"mycelium_keys,omitempty" json:"mycelium_keys,omitempty"`
+	UserAccesses []UserAccess  `yaml:"user_accesses,omitempty" json:"user_accesses,omitempty"`
+	// the wireguard access and the public node of a deployed network are kept so its wireguard configs don't change
+	WGAccessSubnet     string `yaml:"wg_access_subnet,omitempty" json:"wg_access_subnet,omitempty"`
+	WGAccessPrivateKey string `yaml:"wg_access_private_key,omitempty" json:"wg_access_private_key,omitempty"`
+	PublicNode         uint32 `yaml:"public_node,omitempty" json:"public_node,omitempty"`
+}
+
+// MyceliumKey is the hex encoded mycelium key of a network node
+type MyceliumKey struct {
+	Node uint32 `yaml:"node" json:"node"`
+	Key  string `yaml:"key" json:"key"`
+}
+
+// UserAccess is a named wireguard access to a network, its private key is generated and its subnet is assigned if they are empty
+type UserAccess struct {
+	Name       string `yaml:"name" json:"name"`
+	Subnet     string `yaml:"subnet,omitempty" json:"subnet,omitempty"`
+	PrivateKey string `yaml:"private_key,omitempty" json:"private_key,omitempty"`
+}
+
+// Deployment is a group of vms, disks, zdbs and qsfs on a single node
+type Deployment struct {
+	Name    string `yaml:"name" json:"name"`
+	Node    uint32 `yaml:"node" json:"node"`
+	Network string `yaml:"network,omitempty" json:"network,omitempty"`
+	VMs     []VM   `yaml:"vms,omitempty" json:"vms,omitempty"`
+	Disks   []Disk `yaml:"disks,omitempty" json:"disks,omitempty"`
+	ZDBs    []ZDB  `yaml:"zdbs,omitempty" json:"zdbs,omitempty"`
+	QSFS    []QSFS `yaml:"qsfs,omitempty" json:"qsfs,omitempty"`
+	// ReservedIPs are public ips held by the deployment contract, vms use them by pinning their public ip address
+	ReservedIPs []ReservedIP `yaml:"reserved_ips,omitempty" json:"reserved_ips,omitempty"`
+}
+
+// ReservedIP is a public ipv4 reserved by a deployment, the farm assigns it on deployment if IP is empty
+type ReservedIP struct {
+	Name string `yaml:"name" json:"name"`
+	IP   string `yaml:"ip,omitempty" json:"ip,omitempty"`
+}
+
+// VM is a virtual machine in the deployment network
+type VM struct {
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	Flist       string `yaml:"flist" json:"flist"`
+	Entrypoint  string `yaml:"entrypoint,omitempty" json:"entrypoint,omitempty"`
+	CPU         int    `yaml:"cpu" json:"cpu"`
+	// Memory is in MB
+	Memory int `yaml:"memory" json:"memory"`
+	// RootfsSize is in MB
+	RootfsSize int  `yaml:"rootfs_size,omitempty" json:"rootfs_size,omitempty"`
+	PublicIP   bool `yaml:"public_ip,omitempty" json:"public_ip,omitempty"`
+	PublicIP6  bool `yaml:"public_ip6,omitempty" json:"public_ip6,omitempty"`
+	// PublicIPAddress pins the vm public ipv4 to a farm ip or a reserved ip of the deployment
+	PublicIPAddress string `yaml:"public_ip_address,omitempty" json:"public_ip_address,omitempty"`
+	Planetary       bool   `yaml:"planetary,omitempty" json:"planetary,omitempty"`
+	// Mycelium gives the vm a mycelium ip, a random seed is used if MyceliumIPSeed is empty
+	Mycelium bool `yaml:"mycelium,omitempty" json:"mycelium,omitempty"`
+	// MyceliumIPSeed is a hex encoded seed to keep the same mycelium ip
+	MyceliumIPSeed string `yaml:"mycelium_ip_seed,omitempty" json:"mycelium_ip_seed,omitempty"`
+	// IP is the private ip of the vm, it is assigned on deployment if it is empty
+	IP     string            `yaml:"ip,omitempty" json:"ip,omitempty"`
+	GPUs   []string          `yaml:"gpus,omitempty" json:"gpus,omitempty"`
+	Env    map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
+	Mounts []Mount           `yaml:"mounts,omitempty" json:"mounts,omitempty"`
+}
+
+// Mount mounts a disk or a qsfs of the vm deployment
+type Mount struct {
+	Name string `yaml:"name" json:"name"`
+	Path string `yaml:"path" json:"path"`
+}
+
+// Disk is a vm disk
+type Disk struct {
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	// Size is in GB
+	Size int `yaml:"size" json:"size"`
+}
+
+// ZDB is a zero-db namespace
+type ZDB struct {
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	// Size is in GB
+	Size     int    `yaml:"size" json:"size"`
+	Mode     string `yaml:"mode,omitempty" json:"mode,omitempty"`
+	Password string `yaml:"password,omitempty" json:"password,omitempty"`
+	Public   bool   `yaml:"public,omitempty" json:"public,omitempty"`
+}
+
+// QSFS is a quantum safe filesystem backed by zdbs
+type QSFS struct {
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	// Cache is in MB
+	Cache                int            `yaml:"cache" json:"cache"`
+	MinimalShards        uint32         `yaml:"minimal_shards" json:"minimal_shards"`
+	ExpectedShards       uint32         `yaml:"expected_shards" json:"expected_shards"`
+	RedundantGroups      uint32         `yaml:"redundant_groups,omitempty" json:"redundant_groups,omitempty"`
+	RedundantNodes       uint32         `yaml:"redundant_nodes,omitempty" json:"redundant_nodes,omitempty"`
+	MaxZDBDataDirSize    uint32         `yaml:"max_zdb_data_dir_size" json:"max_zdb_data_dir_size"`
+	EncryptionAlgorithm  string         `yaml:"encryption_algorithm,omitempty" json:"encryption_algorithm,omitempty"`
+	EncryptionKey        string         `yaml:"encryption_key" json:"encryption_key"`
+	CompressionAlgorithm string         `yaml:"compression_algorithm,omitempty" json:"compression_algorithm,omitempty"`
+	Metadata             QSFSMetadata   `yaml:"metadata" json:"metadata"`
+	Groups               [][]ZDBBackend `yaml:"groups" json:"groups"`
+}
+
+// QSFSMetadata is the metadata store of a qsfs
+type QSFSMetadata struct {
+	Type                string       `yaml:"type,omitempty" json:"type,omitempty"`
+	Prefix              string       `yaml:"prefix" json:"prefix"`
+	EncryptionAlgorithm string       `yaml:"encryption_algorithm,omitempty" json:"encryption_algorithm,omitempty"`
+	EncryptionKey       string       `yaml:"encryption_key" json:"encryption_key"`
+	Backends            []ZDBBackend `yaml:"backends" json:"backends"`
+}
+
+// ZDBBackend is a zdb namespace used by a qsfs
+type ZDBBackend struct {
+	Address   string `yaml:"address" json:"address"`
+	Namespace string `yaml:"namespace" json:"namespace"`
+	Password  string `yaml:"password" json:"password"`
+}
+
+// K8sCluster is a kubernetes cluster in a network
+type K8sCluster struct {
+	Network string    `yaml:"network" json:"network"`
+	Token   string    `yaml:"token" json:"token"`
+	SSHKey  string    `yaml:"ssh_key,omitempty" json:"ssh_key,omitempty"`
+	Master  K8sNode   `yaml:"master" json:"master"`
+	Workers []K8sNode `yaml:"workers,omitempty" json:"workers,omitempty"`
+}
+
+// K8sNode is a kubernetes master or worker
+type K8sNode struct {
+	Name  string `yaml:"name" json:"name"`
+	Node  uint32 `yaml:"node" json:"node"`
+	Flist string `yaml:"flist" json:"flist"`
+	CPU   int    `yaml:"cpu" json:"cpu"`
+	// Memory is in MB
+	Memory int `yaml:"memory" json:"memory"`
+	// DiskSize is in GB
+	DiskSize       int    `yaml:"disk_size" json:"disk_size"`
+	PublicIP       bool   `yaml:"public_ip,omitempty" json:"public_ip,omitempty"`
+	PublicIP6      bool   `yaml:"public_ip6,omitempty" json:"public_ip6,omitempty"`
+	Planetary      bool   `yaml:"planetary,omitempty" json:"planetary,omitempty"`
+	Mycelium       bool   `yaml:"mycelium,omitempty" json:"mycelium,omitempty"`
+	MyceliumIPSeed string `yaml:"mycelium_ip_seed,omitempty" json:"mycelium_ip_seed,omitempty"`
+	IP             string `yaml:"ip,omitempty" json:"ip,omitempty"`
+}
+
+// Gateway is a gateway name proxy, or a gateway fqdn proxy if FQDN is set
+type Gateway struct {
+	Name           string    `yaml:"name" json:"name"`
+	Node           uint32    `yaml:"node" json:"node"`
+	FQDN           string    `yaml:"fqdn,omitempty" json:"fqdn,omitempty"`
+	TLSPassthrough bool      `yaml:"tls_passthrough,omitempty" json:"tls_passthrough,omitempty"`
+	Network        string    `yaml:"network,omitempty" json:"network,omitempty"`
+	Backends       []Backend `yaml:"backends" json:"backends"`
+}
+
+// Backend is a gateway backend, either a url or a vm port
+type Backend struct {
+	URL string `yaml:"url,omitempty" json:"url,omitempty"`
+	// VM is the name of a spec vm, the gateway joins the vm network and proxies to its private ip
+	VM   string `yaml:"vm,omitempty" json:"vm,omitempty"`
+	Port uint16 `yaml:"port,omitempty" json:"port,omitempty"`
+	// Protocol of the vm backend, http is used if it is empty
+	Protocol string `yaml:"protocol,omitempty" json:"protocol,omitempty"`
+}
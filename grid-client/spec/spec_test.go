@@ -0,0 +1,232 @@
+package spec
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/deployer"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/fakegrid"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
+	"github.com/vedhavyas/go-subkey"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+const testSpec = `
+version: 1
+project: shop
+networks:
+  - name: net
+    nodes: [11, 12]
+    mycelium: true
+deployments:
+  - name: web
+    node: 12
+    network: net
+    disks:
+      - name: data
+        size: 10
+    vms:
+      - name: web
+        flist: https://hub.grid.tf/tf-official-apps/base:latest.flist
+        cpu: 2
+        memory: 1024
+        mycelium: true
+        env:
+          SSH_KEY: key
+        mounts:
+          - name: data
+            path: /data
+gateways:
+  - name: shop
+    node: 11
+    backends:
+      - vm: web
+        port: 80
+`
+
+func TestParse(t *testing.T) {
+	s, err := Parse([]byte(testSpec))
+	require.NoError(t, err)
+
+	p, err := s.Project()
+	require.NoError(t, err)
+	assert.Equal(t, "shop", p.Name)
+
+	require.Len(t, p.Networks, 1)
+	znet := p.Networks[0]
+	assert.Equal(t, "10.20.0.0/16", znet.IPRange.String())
+	assert.Len(t, znet.MyceliumKeys, 2)
+	assert.Equal(t, "shop", znet.SolutionType)
+
+	require.Len(t, p.Deployments, 1)
+	dl := p.Deployments[0]
+	assert.Equal(t, uint32(12), dl.NodeID)
+	require.Len(t, dl.Vms, 1)
+	vm := dl.Vms[0]
+	assert.Equal(t, "net", vm.NetworkName)
+	assert.Len(t, vm.MyceliumIPSeed, zos.MyceliumIPSeedLen)
+	assert.Equal(t, map[string]string{"SSH_KEY": "key"}, vm.EnvVars)
+	assert.Equal(t, "data", vm.Mounts[0].DiskName)
+	assert.Equal(t, "/data", vm.Mounts[0].MountPoint)
+
+	require.Len(t, p.GatewayNames, 1)
+	gw := p.GatewayNames[0]
+	assert.Equal(t, "net", gw.Network)
+	assert.Error(t, p.ResolveBackends())
+
+	dl.Vms[0].IP = "10.20.3.2"
+	require.NoError(t, p.ResolveBackends())
+	assert.Equal(t, []zos.Backend{"http://10.20.3.2:80"}, gw.Backends)
+
+	t.Run("json", func(t *testing.T) {
+		s, err := Parse([]byte(`{"version": 1, "gateways": [{"name": "gw", "node": 11, "backends": [{"url": "http://1.1.1.1:80"}]}]}`))
+		require.NoError(t, err)
+		p, err := s.Project()
+		require.NoError(t, err)
+		require.Len(t, p.GatewayNames, 1)
+		assert.Equal(t, []zos.Backend{"http://1.1.1.1:80"}, p.GatewayNames[0].Backends)
+	})
+
+	t.Run("unknown fields", func(t *testing.T) {
+		_, err := Parse([]byte("version: 1\nnetwork: []\n"))
+		assert.Error(t, err)
+	})
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() Spec {
+		s, err := Parse([]byte(testSpec))
+		require.NoError(t, err)
+		return s
+	}
+	require.NoError(t, valid().Validate())
+
+	cases := map[string]func(s *Spec){
+		"version": func(s *Spec) { s.Version = 2 },
+		"duplicated network": func(s *Spec) {
+			s.Networks = append(s.Networks, s.Networks[0])
+		},
+		"unknown network": func(s *Spec) { s.Deployments[0].Network = "other" },
+		"unknown mount":   func(s *Spec) { s.Deployments[0].VMs[0].Mounts[0].Name = "other" },
+		"invalid seed":    func(s *Spec) { s.Deployments[0].VMs[0].MyceliumIPSeed = "xyz" },
+		"unknown vm":      func(s *Spec) { s.Gateways[0].Backends[0].VM = "other" },
+		"url and vm":      func(s *Spec) { s.Gateways[0].Backends[0].URL = "http://1.1.1.1:80" },
+		"no port":         func(s *Spec) { s.Gateways[0].Backends[0].Port = 0 },
+		"gateway network": func(s *Spec) {
+			s.Networks = append(s.Networks, Network{Name: "other", Nodes: []uint32{11}})
+			s.Gateways[0].Network = "other"
+		},
+		"gateway node":      func(s *Spec) { s.Gateways[0].Node = 13 },
+		"mycelium key node": func(s *Spec) { s.Networks[0].MyceliumKeys = []MyceliumKey{{Node: 13, Key: "00"}} },
+		"mycelium key":      func(s *Spec) { s.Networks[0].MyceliumKeys = []MyceliumKey{{Node: 11, Key: "xyz"}} },
+		"user access key": func(s *Spec) {
+			s.Networks[0].UserAccesses = []UserAccess{{Name: "ci", PrivateKey: "key"}}
+		},
+		"backends networks": func(s *Spec) {
+			s.Networks = append(s.Networks, Network{Name: "other", Nodes: []uint32{11}})
+			s.Deployments = append(s.Deployments, Deployment{Name: "api", Node: 11, Network: "other", VMs: []VM{{Name: "api"}}})
+			s.Gateways[0].Backends = append(s.Gateways[0].Backends, Backend{VM: "api", Port: 80})
+		},
+	}
+	for name, invalidate := range cases {
+		t.Run(name, func(t *testing.T) {
+			s := valid()
+			invalidate(&s)
+			assert.Error(t, s.Validate())
+			_, err := s.Project()
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	s, err := Parse([]byte(testSpec))
+	require.NoError(t, err)
+	p, err := s.Project()
+	require.NoError(t, err)
+	p.Deployments[0].Vms[0].IP = "10.20.3.2"
+	require.NoError(t, p.ResolveBackends())
+
+	// the network keys, accesses and public node are kept
+	znet := p.Networks[0]
+	require.NoError(t, znet.AddUserAccess("ci"))
+	znet.UserAccesses[0].Subnet = "10.20.4.0/24"
+	externalIP := gridtypes.MustParseIPNet("10.20.5.0/24")
+	znet.AddWGAccess, znet.ExternalIP = true, &externalIP
+	znet.ExternalSK, err = wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+	znet.PublicNodeID = 11
+
+	written := p.Spec()
+	assert.Equal(t, []Backend{{VM: "web", Port: 80}}, written.Gateways[0].Backends)
+	assert.Equal(t, "net", written.Gateways[0].Network)
+	assert.Equal(t, "10.20.3.2", written.Deployments[0].VMs[0].IP)
+	assert.True(t, written.Networks[0].Mycelium)
+
+	for _, format := range []Format{FormatYAML, FormatJSON} {
+		t.Run(string(format), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "spec."+string(format))
+			assert.Equal(t, format, FormatFromPath(path))
+			require.NoError(t, Save(path, written))
+			stat, err := os.Stat(path)
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0o600), stat.Mode().Perm())
+
+			loaded, err := Load(path)
+			require.NoError(t, err)
+			assert.Equal(t, p.Deployments[0].Vms[0].MyceliumIPSeed, loaded.Deployments[0].Vms[0].MyceliumIPSeed)
+			assert.Equal(t, p.GatewayNames[0].Backends, loaded.GatewayNames[0].Backends)
+			loadedNet := loaded.Networks[0]
+			assert.Equal(t, znet.MyceliumKeys, loadedNet.MyceliumKeys)
+			assert.Equal(t, znet.UserAccesses, loadedNet.UserAccesses)
+			assert.Equal(t, znet.ExternalIP, loadedNet.ExternalIP)
+			assert.Equal(t, znet.ExternalSK, loadedNet.ExternalSK)
+			assert.Equal(t, znet.PublicNodeID, loadedNet.PublicNodeID)
+			assert.Equal(t, written, loaded.Spec())
+		})
+	}
+}
+
+func TestDeploy(t *testing.T) {
+	grid := fakegrid.NewGrid()
+	t.Cleanup(grid.Close)
+
+	require.NoError(t, grid.AddFarm(fakegrid.Farm{FarmID: 1}))
+	capacity := gridtypes.Capacity{CRU: 8, MRU: 16 * gridtypes.Gigabyte, SRU: 512 * gridtypes.Gigabyte, HRU: 1024 * gridtypes.Gigabyte}
+	require.NoError(t, grid.AddNode(fakegrid.Node{
+		NodeID:         11,
+		FarmID:         1,
+		TotalResources: capacity,
+		PublicIPv4:     "185.206.122.10/24",
+		Domain:         "gent01.fake.grid.tf",
+	}))
+	require.NoError(t, grid.AddNode(fakegrid.Node{NodeID: 12, FarmID: 1, TotalResources: capacity}))
+
+	identity, err := substrate.NewIdentityFromSr25519Phrase("//Alice")
+	require.NoError(t, err)
+	keyPair, err := identity.KeyPair()
+	require.NoError(t, err)
+	tfPluginClient, err := deployer.NewTFPluginClient(subkey.EncodeHex(keyPair.Seed()), deployer.WithBackend(grid))
+	require.NoError(t, err)
+	t.Cleanup(tfPluginClient.Close)
+
+	s, err := Parse([]byte(testSpec))
+	require.NoError(t, err)
+	p, err := s.Project()
+	require.NoError(t, err)
+
+	require.NoError(t, p.Deploy(context.Background(), &tfPluginClient))
+
+	vm := p.Deployments[0].Vms[0]
+	require.NotEmpty(t, vm.IP)
+	gw := p.GatewayNames[0]
+	assert.Equal(t, []zos.Backend{zos.Backend("http://" + vm.IP + ":80")}, gw.Backends)
+	assert.NotZero(t, gw.ContractID)
+	assert.NotZero(t, gw.NameContractID)
+}
@@ -0,0 +1,297 @@
+package spec
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/deployer"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/workloads"
+	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is a spec file format
+type Format string
+
+const (
+	// FormatYAML is the yaml spec format
+	FormatYAML Format = "yaml"
+	// FormatJSON is the json spec format
+	FormatJSON Format = "json"
+)
+
+// FormatFromPath returns the spec format of a file from its extension, yaml is used for unknown extensions
+func FormatFromPath(path string) Format {
+	if filepath.Ext(path) == ".json" {
+		return FormatJSON
+	}
+	return FormatYAML
+}
+
+// Marshal encodes a spec in the given format
+func Marshal(s Spec, format Format) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		return json.MarshalIndent(s, "", "  ")
+	case FormatYAML:
+		return yaml.Marshal(s)
+	default:
+		return nil, errors.Errorf("unsupported spec format %q", format)
+	}
+}
+
+// Save writes a spec to a file in the format of its extension.
+// the file is only readable by its owner, specs hold secrets like zdb passwords, the k8s token and qsfs encryption keys.
+func Save(path string, s Spec) error {
+	data, err := Marshal(s, FormatFromPath(path))
+	if err != nil {
+		return errors.Wrap(err, "could not encode spec")
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return err
+	}
+	// existing files keep their mode when they are written
+	return os.Chmod(path, 0o600)
+}
+
+// ProjectFromImported creates a project from the objects imported from the grid
+func ProjectFromImported(imported *deployer.ImportedProject) *Project {
+	return &Project{
+		Name:         imported.Name,
+		Networks:     imported.Networks,
+		Deployments:  imported.Deployments,
+		K8sClusters:  imported.K8sClusters,
+		GatewayNames: imported.GatewayNames,
+		GatewayFQDNs: imported.GatewayFQDNs,
+	}
+}
+
+// Spec converts the project workloads to a spec.
+// computed fields like private ips and mycelium seeds are kept so the spec describes the same objects,
+// and gateway backends that point to a project vm private ip are written as vm backends.
+func (p *Project) Spec() Spec {
+	s := Spec{Version: Version, ProjectName: p.Name}
+
+	for _, znet := range p.Networks {
+		s.Networks = append(s.Networks, specNetwork(znet))
+	}
+
+	// vms are found by their network and private ip to write gateway backends as vm backends
+	vms := make(map[string]string)
+	for _, dl := range p.Deployments {
+		s.Deployments = append(s.Deployments, specDeployment(dl))
+		for _, vm := range dl.Vms {
+			if vm.IP != "" {
+				vms[dl.NetworkName+"/"+vm.IP] = vm.Name
+			}
+		}
+	}
+
+	for _, cluster := range p.K8sClusters {
+		k8sCluster := K8sCluster{
+			Network: cluster.NetworkName,
+			Token:   cluster.Token,
+			SSHKey:  cluster.SSHKey,
+		}
+		if cluster.Master != nil {
+			k8sCluster.Master = specK8sNode(*cluster.Master)
+		}
+		for _, worker := range cluster.Workers {
+			k8sCluster.Workers = append(k8sCluster.Workers, specK8sNode(worker))
+		}
+		s.K8s = append(s.K8s, k8sCluster)
+	}
+
+	for _, gw := range p.GatewayNames {
+		s.Gateways = append(s.Gateways, Gateway{
+			Name:           gw.Name,
+			Node:           gw.NodeID,
+			TLSPassthrough: gw.TLSPassthrough,
+			Network:        gw.Network,
+			Backends:       specBackends(gw.Backends, gw.Network, vms),
+		})
+	}
+	for _, gw := range p.GatewayFQDNs {
+		s.Gateways = append(s.Gateways, Gateway{
+			Name:           gw.Name,
+			Node:           gw.NodeID,
+			FQDN:           gw.FQDN,
+			TLSPassthrough: gw.TLSPassthrough,
+			Network:        gw.Network,
+			Backends:       specBackends(gw.Backends, gw.Network, vms),
+		})
+	}
+
+	return s
+}
+
+func specNetwork(znet *workloads.ZNet) Network {
+	network := Network{
+		Name:         znet.Name,
+		Description:  znet.Description,
+		Nodes:        znet.Nodes,
+		IPRange:      znet.IPRange.String(),
+		WGAccess:     znet.AddWGAccess,
+		Mycelium:     len(znet.MyceliumKeys) != 0 && !znet.MyceliumOnly,
+		MyceliumOnly: znet.MyceliumOnly,
+		PublicNode:   znet.PublicNodeID,
+	}
+
+	// keys are written in the order of the network nodes so the spec doesn't change between writes
+	for _, node := range znet.Nodes {
+		if key := znet.MyceliumKeys[node]; len(key) != 0 {
+			network.MyceliumKeys = append(network.MyceliumKeys, MyceliumKey{Node: node, Key: hex.EncodeToString(key)})
+		}
+	}
+	for _, access := range znet.UserAccesses {
+		network.UserAccesses = append(network.UserAccesses, UserAccess{Name: access.Name, Subnet: access.Subnet, PrivateKey: access.PrivateKey})
+	}
+	if znet.ExternalIP != nil {
+		network.WGAccessSubnet = znet.ExternalIP.String()
+	}
+	if znet.ExternalSK.String() != workloads.ExternalSKZeroValue {
+		network.WGAccessPrivateKey = znet.ExternalSK.String()
+	}
+	return network
+}
+
+func specDeployment(dl *workloads.Deployment) Deployment {
+	deployment := Deployment{Name: dl.Name, Node: dl.NodeID, Network: dl.NetworkName}
+
+	for _, disk := range dl.Disks {
+		deployment.Disks = append(deployment.Disks, Disk{Name: disk.Name, Description: disk.Description, Size: disk.SizeGB})
+	}
+	for _, zdb := range dl.Zdbs {
+		deployment.ZDBs = append(deployment.ZDBs, ZDB{
+			Name:        zdb.Name,
+			Description: zdb.Description,
+			Size:        zdb.Size,
+			Mode:        zdb.Mode,
+			Password:    zdb.Password,
+			Public:      zdb.Public,
+		})
+	}
+	for _, qsfs := range dl.QSFS {
+		deployment.QSFS = append(deployment.QSFS, specQSFS(qsfs))
+	}
+	for _, ip := range dl.ReservedIPs {
+		deployment.ReservedIPs = append(deployment.ReservedIPs, ReservedIP{Name: ip.Name, IP: ip.IP})
+	}
+
+	for _, vm := range dl.Vms {
+		var gpus []string
+		for _, gpu := range vm.GPUs {
+			gpus = append(gpus, string(gpu))
+		}
+		var mounts []Mount
+		for _, mount := range vm.Mounts {
+			mounts = append(mounts, Mount{Name: mount.DiskName, Path: mount.MountPoint})
+		}
+
+		deployment.VMs = append(deployment.VMs, VM{
+			Name:            vm.Name,
+			Description:     vm.Description,
+			Flist:           vm.Flist,
+			Entrypoint:      vm.Entrypoint,
+			CPU:             vm.CPU,
+			Memory:          vm.Memory,
+			RootfsSize:      vm.RootfsSize,
+			PublicIP:        vm.PublicIP,
+			PublicIP6:       vm.PublicIP6,
+			PublicIPAddress: vm.PublicIPAddress,
+			Planetary:       vm.Planetary,
+			Mycelium:        len(vm.MyceliumIPSeed) != 0,
+			MyceliumIPSeed:  hex.EncodeToString(vm.MyceliumIPSeed),
+			IP:              vm.IP,
+			GPUs:            gpus,
+			Env:             vm.EnvVars,
+			Mounts:          mounts,
+		})
+	}
+	return deployment
+}
+
+func specK8sNode(node workloads.K8sNode) K8sNode {
+	return K8sNode{
+		Name:           node.Name,
+		Node:           node.Node,
+		Flist:          node.Flist,
+		CPU:            node.CPU,
+		Memory:         node.Memory,
+		DiskSize:       node.DiskSize,
+		PublicIP:       node.PublicIP,
+		PublicIP6:      node.PublicIP6,
+		Planetary:      node.Planetary,
+		Mycelium:       len(node.MyceliumIPSeed) != 0,
+		MyceliumIPSeed: hex.EncodeToString(node.MyceliumIPSeed),
+		IP:             node.IP,
+	}
+}
+
+func specQSFS(qsfs workloads.QSFS) QSFS {
+	backends := func(workloadBackends workloads.Backends) []ZDBBackend {
+		var res []ZDBBackend
+		for _, backend := range workloadBackends {
+			res = append(res, ZDBBackend{Address: backend.Address, Namespace: backend.Namespace, Password: backend.Password})
+		}
+		return res
+	}
+
+	var groups [][]ZDBBackend
+	for _, group := range qsfs.Groups {
+		groups = append(groups, backends(group.Backends))
+	}
+
+	return QSFS{
+		Name:                 qsfs.Name,
+		Description:          qsfs.Description,
+		Cache:                qsfs.Cache,
+		MinimalShards:        qsfs.MinimalShards,
+		ExpectedShards:       qsfs.ExpectedShards,
+		RedundantGroups:      qsfs.RedundantGroups,
+		RedundantNodes:       qsfs.RedundantNodes,
+		MaxZDBDataDirSize:    qsfs.MaxZDBDataDirSize,
+		EncryptionAlgorithm:  qsfs.EncryptionAlgorithm,
+		EncryptionKey:        qsfs.EncryptionKey,
+		CompressionAlgorithm: qsfs.CompressionAlgorithm,
+		Metadata: QSFSMetadata{
+			Type:                qsfs.Metadata.Type,
+			Prefix:              qsfs.Metadata.Prefix,
+			EncryptionAlgorithm: qsfs.Metadata.EncryptionAlgorithm,
+			EncryptionKey:       qsfs.Metadata.EncryptionKey,
+			Backends:            backends(qsfs.Metadata.Backends),
+		},
+		Groups: groups,
+	}
+}
+
+// specBackends converts gateway backends, backends that point to a vm in the gateway network are written as vm backends
+func specBackends(backends []zos.Backend, network string, vms map[string]string) []Backend {
+	var res []Backend
+	for _, backend := range backends {
+		u, err := url.Parse(string(backend))
+		if err == nil && network != "" {
+			vm, ok := vms[network+"/"+u.Hostname()]
+			port, portErr := strconv.ParseUint(u.Port(), 10, 16)
+			if ok && portErr == nil && u.Path == "" {
+				res = append(res, Backend{VM: vm, Port: uint16(port), Protocol: protocolName(u.Scheme)})
+				continue
+			}
+		}
+		res = append(res, Backend{URL: string(backend)})
+	}
+	return res
+}
+
+// protocolName returns an empty protocol for the default http protocol
+func protocolName(scheme string) string {
+	if scheme == "http" {
+		return ""
+	}
+	return scheme
+}
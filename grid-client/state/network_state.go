@@ -50,6 +50,29 @@ func (nm *NetworkState) UpdateNetworkSubnets(networkName string, ipRange map[uin
 	nm.State[networkName] = network
 }
 
+// copyState returns a copy of all networks
+func (nm *NetworkState) copyState() map[string]Network {
+	nm.stateLock.Lock()
+	defer nm.stateLock.Unlock()
+
+	networks := make(map[string]Network, len(nm.State))
+	for name, network := range nm.State {
+		networks[name] = network.copy()
+	}
+	return networks
+}
+
+// setState replaces all networks with the given ones
+func (nm *NetworkState) setState(networks map[string]Network) {
+	nm.stateLock.Lock()
+	defer nm.stateLock.Unlock()
+
+	nm.State = make(map[string]Network, len(networks))
+	for name, network := range networks {
+		nm.State[name] = network.copy()
+	}
+}
+
 // DeleteNetwork deletes a Network using its name
 func (nm *NetworkState) DeleteNetwork(networkName string) {
 	nm.stateLock.Lock()
@@ -67,6 +90,15 @@ func (n *Network) SetNodeSubnet(nodeID uint32, subnet string) {
 	n.Subnets[nodeID] = subnet
 }
 
+// copy returns a deep copy of the network
+func (n *Network) copy() Network {
+	net := NewNetwork()
+	for nodeID, subnet := range n.Subnets {
+		net.SetNodeSubnet(nodeID, subnet)
+	}
+	return net
+}
+
 // DeleteNodeSubnet deletes a node subnet using its ID
 func (n *Network) deleteNodeSubnet(nodeID uint32) {
 	delete(n.Subnets, nodeID)
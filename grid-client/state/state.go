@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 	"reflect"
 	"slices"
 	"strings"
@@ -30,6 +31,10 @@ type State struct {
 
 	NcPool    client.NodeClientGetter
 	Substrate subi.SubstrateExt
+
+	store StateStore
+	// metadataKey decrypts the encrypted deployments metadata
+	metadataKey []byte
 }
 
 // ErrNotFound for state not found instances
@@ -45,6 +50,66 @@ func NewState(ncPool client.NodeClientGetter, substrate subi.SubstrateExt) *Stat
 	}
 }
 
+// SetStore sets the store used to load and save the state
+func (st *State) SetStore(store StateStore) {
+	st.store = store
+}
+
+// SetMetadataKey sets the key used to decrypt the deployments metadata
+func (st *State) SetMetadataKey(key []byte) {
+	st.metadataKey = key
+}
+
+// MetadataKey returns the key used to decrypt the deployments metadata
+func (st *State) MetadataKey() []byte {
+	return st.metadataKey
+}
+
+// Snapshot returns a serializable copy of the state
+func (st *State) Snapshot() Snapshot {
+	snapshot := NewSnapshot()
+	for nodeID, contractIDs := range st.CurrentNodeDeployments {
+		if len(contractIDs) == 0 {
+			continue
+		}
+		snapshot.CurrentNodeDeployments[nodeID] = append(ContractIDs{}, contractIDs...)
+	}
+	snapshot.Networks = st.Networks.copyState()
+	return snapshot
+}
+
+// Load replaces the state with the one saved in the state store, it does nothing if no store is set
+func (st *State) Load() error {
+	if st.store == nil {
+		return nil
+	}
+
+	snapshot, err := st.store.Load()
+	if err != nil {
+		return errors.Wrap(err, "could not load state from store")
+	}
+
+	st.CurrentNodeDeployments = make(map[uint32]ContractIDs)
+	for nodeID, contractIDs := range snapshot.CurrentNodeDeployments {
+		st.StoreContractIDs(nodeID, contractIDs...)
+	}
+	st.Networks.setState(snapshot.Networks)
+	return nil
+}
+
+// Save persists the state to the state store, it does nothing if no store is set
+func (st *State) Save() error {
+	if st.store == nil {
+		return nil
+	}
+
+	if err := st.store.Save(st.Snapshot()); err != nil {
+		return errors.Wrap(err, "could not save state to store")
+	}
+	return nil
+}
+
+// StoreContractIDs adds contract IDs to a node deployments
 func (st *State) StoreContractIDs(nodeID uint32, contractIDs ...uint64) {
 	for _, contractID := range contractIDs {
 		if !slices.Contains(st.CurrentNodeDeployments[nodeID], contractID) {
@@ -53,6 +118,7 @@ func (st *State) StoreContractIDs(nodeID uint32, contractIDs ...uint64) {
 	}
 }
 
+// RemoveContractIDs removes contract IDs from a node deployments
 func (st *State) RemoveContractIDs(nodeID uint32, contractIDs ...uint64) {
 	for _, contractID := range contractIDs {
 		st.CurrentNodeDeployments[nodeID] = workloads.Delete(st.CurrentNodeDeployments[nodeID], contractID)
@@ -76,7 +142,7 @@ func (st *State) LoadGatewayFQDNFromGrid(ctx context.Context, nodeID uint32, nam
 		return workloads.GatewayFQDNProxy{}, errors.Wrapf(err, "could not get workload from node %d within deployment %v", nodeID, dl)
 	}
 
-	deploymentData, err := workloads.ParseDeploymentData(dl.Metadata)
+	deploymentData, err := workloads.ParseDeploymentData(dl.Metadata, st.metadataKey)
 	if err != nil {
 		return workloads.GatewayFQDNProxy{}, errors.Wrapf(err, "could not generate deployment metadata for %s", name)
 	}
@@ -112,7 +178,7 @@ func (st *State) LoadGatewayNameFromGrid(ctx context.Context, nodeID uint32, nam
 	if err != nil {
 		return workloads.GatewayNameProxy{}, errors.Wrapf(err, "failed to get gateway name contract %s", name)
 	}
-	deploymentData, err := workloads.ParseDeploymentData(dl.Metadata)
+	deploymentData, err := workloads.ParseDeploymentData(dl.Metadata, st.metadataKey)
 	if err != nil {
 		return workloads.GatewayNameProxy{}, errors.Wrapf(err, "could not generate deployment metadata for %s", name)
 	}
@@ -184,7 +250,7 @@ func (st *State) LoadK8sFromGrid(ctx context.Context, nodeIDs []uint32, deployme
 			}
 			if isMaster {
 				cluster.Master = &node
-				deploymentData, err := workloads.ParseDeploymentData(deployment.Metadata)
+				deploymentData, err := workloads.ParseDeploymentData(deployment.Metadata, st.metadataKey)
 				if err != nil {
 					return workloads.K8sCluster{}, errors.Wrapf(err, "could not generate node deployment metadata for %s", workload.Name)
 				}
@@ -284,6 +350,8 @@ func (st *State) LoadNetworkFromGrid(ctx context.Context, name string) (znet wor
 	var zNets []workloads.ZNet
 	nodeDeploymentsIDs := map[uint32]uint64{}
 	publicNodeEndpoint := ""
+	// peer endpoints by wireguard public key, hidden nodes are peers without endpoints
+	peerEndpoints := map[string]string{}
 
 	sub := st.Substrate
 	for nodeID := range st.CurrentNodeDeployments {
@@ -309,18 +377,26 @@ func (st *State) LoadNetworkFromGrid(ctx context.Context, name string) (znet wor
 				}
 			}
 
-			deploymentData, err := workloads.ParseDeploymentData(dl.Metadata)
+			deploymentData, err := workloads.ParseDeploymentData(dl.Metadata, st.metadataKey)
 			if err != nil {
 				return znet, errors.Wrapf(err, "could not generate deployment metadata for %s", name)
 			}
 
 			for _, wl := range dl.Workloads {
 				if wl.Type == zos.NetworkType && wl.Name == gridtypes.Name(name) {
-					znet, err = workloads.NewNetworkFromWorkload(wl, nodeID)
+					znet, err = workloads.NewNetworkFromWorkload(wl, nodeID, st.metadataKey)
 					if err != nil {
 						return workloads.ZNet{}, errors.Wrapf(err, "failed to get network from workload %s", name)
 					}
 
+					if data, err := wl.WorkloadData(); err == nil {
+						for _, peer := range data.(*zos.Network).Peers {
+							if peerEndpoints[peer.WGPublicKey] == "" {
+								peerEndpoints[peer.WGPublicKey] = peer.Endpoint
+							}
+						}
+					}
+
 					znet.SolutionType = deploymentData.ProjectName
 					zNets = append(zNets, znet)
 					nodeDeploymentsIDs[nodeID] = dl.ContractID
@@ -361,6 +437,7 @@ func (st *State) LoadNetworkFromGrid(ctx context.Context, name string) (znet wor
 	znet.NodesIPRange = nodesIPRange
 	znet.Keys = keys
 	znet.WGPort = wgPort
+	znet.Endpoints = networkEndpoints(keys, peerEndpoints)
 
 	if znet.AddWGAccess {
 		znet.AccessWGConfig = workloads.GenerateWGConfig(
@@ -372,17 +449,47 @@ func (st *State) LoadNetworkFromGrid(ctx context.Context, name string) (znet wor
 		)
 	}
 
+	if len(znet.UserAccesses) != 0 {
+		znet.UserAccessWGConfigs = make(map[string]string)
+	}
+	for _, access := range znet.UserAccesses {
+		znet.UserAccessWGConfigs[access.Name], err = znet.UserAccessWGConfig(access, fmt.Sprintf("%s:%d", publicNodeEndpoint, znet.WGPort[znet.PublicNodeID]))
+		if err != nil {
+			return znet, err
+		}
+	}
+
 	st.Networks.UpdateNetworkSubnets(znet.Name, znet.NodesIPRange)
 	return znet, nil
 }
 
+// networkEndpoints returns the wireguard endpoints of the network nodes found in the peers of the other nodes
+func networkEndpoints(keys map[uint32]wgtypes.Key, peerEndpoints map[string]string) map[uint32]net.IP {
+	endpoints := make(map[uint32]net.IP)
+	for nodeID, key := range keys {
+		endpoint, ok := peerEndpoints[key.PublicKey().String()]
+		if !ok {
+			continue
+		}
+		if endpoint == "" {
+			endpoints[nodeID] = nil
+			continue
+		}
+		host, _, err := net.SplitHostPort(endpoint)
+		if ip := net.ParseIP(host); err == nil && ip != nil {
+			endpoints[nodeID] = ip
+		}
+	}
+	return endpoints
+}
+
 // LoadDeploymentFromGrid loads deployment from grid
 func (st *State) LoadDeploymentFromGrid(ctx context.Context, nodeID uint32, name string) (workloads.Deployment, error) {
 	_, deployment, err := st.GetWorkloadInDeployment(ctx, nodeID, "", name)
 	if err != nil {
 		return workloads.Deployment{}, err
 	}
-	d, err := workloads.NewDeploymentFromZosDeployment(deployment, nodeID)
+	d, err := workloads.NewDeploymentFromZosDeployment(deployment, nodeID, st.metadataKey)
 	if err != nil {
 		return workloads.Deployment{}, err
 	}
@@ -426,7 +533,7 @@ func (st *State) GetWorkloadInDeployment(ctx context.Context, nodeID uint32, nam
 				}
 			}
 
-			dlData, err := workloads.ParseDeploymentData(dl.Metadata)
+			dlData, err := workloads.ParseDeploymentData(dl.Metadata, st.metadataKey)
 			if err != nil {
 				return gridtypes.Workload{}, gridtypes.Deployment{}, errors.Wrapf(err, "could not get deployment %d data", contractID)
 			}
@@ -370,6 +370,7 @@ func TestLoadNetworkFromGrid(t *testing.T) {
 		NodeDeploymentID: map[uint32]uint64{1: 10},
 		WGPort:           map[uint32]int{},
 		Keys:             map[uint32]wgtypes.Key{},
+		Endpoints:        map[uint32]net.IP{},
 		NodesIPRange:     map[uint32]gridtypes.IPNet{1: ipRange},
 		MyceliumKeys:     make(map[uint32][]byte),
 	}
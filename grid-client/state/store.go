@@ -0,0 +1,147 @@
+// Package state for grid state
+package state
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// StateStore is a backend used to persist the state between processes
+type StateStore interface {
+	// Load returns the last saved snapshot, an empty snapshot is returned if nothing was saved before
+	Load() (Snapshot, error)
+	// Save persists the given snapshot replacing any saved one
+	Save(snapshot Snapshot) error
+}
+
+// Snapshot is a serializable copy of the state
+type Snapshot struct {
+	CurrentNodeDeployments map[uint32]ContractIDs `json:"current_node_deployments"`
+	Networks               map[string]Network     `json:"networks"`
+}
+
+// NewSnapshot generates a new empty snapshot
+func NewSnapshot() Snapshot {
+	return Snapshot{
+		CurrentNodeDeployments: make(map[uint32]ContractIDs),
+		Networks:               make(map[string]Network),
+	}
+}
+
+// copy returns a deep copy of the snapshot
+func (s Snapshot) copy() Snapshot {
+	res := NewSnapshot()
+	for nodeID, contractIDs := range s.CurrentNodeDeployments {
+		res.CurrentNodeDeployments[nodeID] = append(ContractIDs{}, contractIDs...)
+	}
+	for name, network := range s.Networks {
+		res.Networks[name] = network.copy()
+	}
+	return res
+}
+
+// MemoryStore is an in-memory state store, it is useful to share the state between clients of the same process
+type MemoryStore struct {
+	snapshot Snapshot
+	lock     sync.Mutex
+}
+
+// NewMemoryStore generates a new in-memory state store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{snapshot: NewSnapshot()}
+}
+
+// Load returns a copy of the stored snapshot
+func (m *MemoryStore) Load() (Snapshot, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.snapshot.copy(), nil
+}
+
+// Save stores a copy of the given snapshot
+func (m *MemoryStore) Save(snapshot Snapshot) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.snapshot = snapshot.copy()
+	return nil
+}
+
+// FileStore is a state store that keeps the state as json in a file
+type FileStore struct {
+	path string
+	lock sync.Mutex
+}
+
+// NewFileStore generates a new file state store for the given path
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Load reads the snapshot from the store file, an empty snapshot is returned if the file doesn't exist
+func (f *FileStore) Load() (Snapshot, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return NewSnapshot(), nil
+	}
+	if err != nil {
+		return Snapshot{}, errors.Wrapf(err, "could not read state file %s", f.path)
+	}
+
+	snapshot := NewSnapshot()
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return Snapshot{}, errors.Wrapf(err, "could not parse state file %s", f.path)
+	}
+
+	if snapshot.CurrentNodeDeployments == nil {
+		snapshot.CurrentNodeDeployments = make(map[uint32]ContractIDs)
+	}
+	if snapshot.Networks == nil {
+		snapshot.Networks = make(map[string]Network)
+	}
+	return snapshot, nil
+}
+
+// Save writes the snapshot to the store file.
+// the snapshot is written to a temporary file first then renamed so a crash never leaves a partial state file.
+func (f *FileStore) Save(snapshot Snapshot) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "could not marshal state")
+	}
+
+	dir := filepath.Dir(f.path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return errors.Wrapf(err, "could not create state directory %s", dir)
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(f.path)+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "could not create temporary state file")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "could not write temporary state file")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "could not close temporary state file")
+	}
+
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return errors.Wrapf(err, "could not write state file %s", f.path)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// Package state for grid state
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testSnapshot() Snapshot {
+	snapshot := NewSnapshot()
+	snapshot.CurrentNodeDeployments[1] = ContractIDs{10, 11}
+	snapshot.Networks["network"] = Network{Subnets: map[uint32]string{1: "10.1.2.0/24"}}
+	return snapshot
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+
+	snapshot, err := store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, NewSnapshot(), snapshot)
+
+	saved := testSnapshot()
+	assert.NoError(t, store.Save(saved))
+
+	// changing the saved snapshot should not change the stored one
+	saved.CurrentNodeDeployments[1] = append(saved.CurrentNodeDeployments[1], 12)
+
+	snapshot, err = store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, testSnapshot(), snapshot)
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "state.json")
+	store := NewFileStore(path)
+
+	t.Run("load missing file", func(t *testing.T) {
+		snapshot, err := store.Load()
+		assert.NoError(t, err)
+		assert.Equal(t, NewSnapshot(), snapshot)
+	})
+
+	t.Run("save and load", func(t *testing.T) {
+		assert.NoError(t, store.Save(testSnapshot()))
+
+		snapshot, err := NewFileStore(path).Load()
+		assert.NoError(t, err)
+		assert.Equal(t, testSnapshot(), snapshot)
+	})
+
+	t.Run("load invalid file", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(path, []byte(invalid), 0o600))
+
+		_, err := store.Load()
+		assert.Error(t, err)
+	})
+}
+
+func TestStateStore(t *testing.T) {
+	store := NewMemoryStore()
+
+	st := NewState(nil, nil)
+	assert.NoError(t, st.Save())
+	assert.NoError(t, st.Load())
+
+	st.SetStore(store)
+	st.StoreContractIDs(1, 10, 11)
+	st.StoreContractIDs(2, 20)
+	st.RemoveContractIDs(2, 20)
+	st.Networks.setState(testSnapshot().Networks)
+	assert.NoError(t, st.Save())
+
+	loaded := NewState(nil, nil)
+	loaded.SetStore(store)
+	assert.NoError(t, loaded.Load())
+
+	assert.Equal(t, testSnapshot(), loaded.Snapshot())
+	network := loaded.Networks.GetNetwork("network")
+	assert.Equal(t, "10.1.2.0/24", network.GetNodeSubnet(1))
+}
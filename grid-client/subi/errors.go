@@ -0,0 +1,26 @@
+package subi
+
+// ChainError is returned if an extrinsic failed on the chain
+type ChainError struct {
+	// Call is the name of the failed extrinsic
+	Call string
+	Err  error
+}
+
+// Error returns the chain error
+func (e *ChainError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the chain error
+func (e *ChainError) Unwrap() error {
+	return e.Err
+}
+
+// chainError normalizes the error of an extrinsic and wraps it in a ChainError
+func chainError(call string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &ChainError{Call: call, Err: normalizeNotFoundErrors(err)}
+}
@@ -62,6 +62,9 @@ type SubstrateExt interface {
 	BatchCreateContract(identity substrate.Identity, contractsData []substrate.BatchCreateContractData) ([]uint64, *int, error)
 	BatchAllCreateContract(identity substrate.Identity, contractsData []substrate.BatchCreateContractData) ([]uint64, error)
 	BatchCancelContract(identity substrate.Identity, contracts []uint64) error
+	CreateRentContract(identity substrate.Identity, node uint32, solutionProviderID *uint64) (uint64, error)
+	GetNodeRentContract(node uint32) (uint64, error)
+	CancelRentContract(identity substrate.Identity, contractID uint64) error
 }
 
 // SubstrateImpl struct to use dev substrate
@@ -122,7 +125,8 @@ func (s *SubstrateImpl) CreateNameContract(identity substrate.Identity, name str
 	s.m.Lock()
 	defer s.m.Unlock()
 
-	return s.Substrate.CreateNameContract(identity, name)
+	res, err := s.Substrate.CreateNameContract(identity, name)
+	return res, chainError("CreateNameContract", err)
 }
 
 // GetContractIDByNameRegistration returns contract ID using its name
@@ -137,7 +141,7 @@ func (s *SubstrateImpl) CreateNodeContract(identity substrate.Identity, node uin
 	defer s.m.Unlock()
 
 	res, err := s.Substrate.CreateNodeContract(identity, node, body, hash, publicIPs, solutionProviderID)
-	return res, normalizeNotFoundErrors(err)
+	return res, chainError("CreateNodeContract", err)
 }
 
 // UpdateNodeContract updates a new name contract
@@ -146,9 +150,44 @@ func (s *SubstrateImpl) UpdateNodeContract(identity substrate.Identity, contract
 	defer s.m.Unlock()
 
 	res, err := s.Substrate.UpdateNodeContract(identity, contract, body, hash)
+	return res, chainError("UpdateNodeContract", err)
+}
+
+// CreateRentContract creates a new rent contract on a node
+func (s *SubstrateImpl) CreateRentContract(identity substrate.Identity, node uint32, solutionProviderID *uint64) (uint64, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	res, err := s.Substrate.CreateRentContract(identity, node, solutionProviderID)
+	return res, chainError("CreateRentContract", err)
+}
+
+// GetNodeRentContract returns the active rent contract ID of a node
+func (s *SubstrateImpl) GetNodeRentContract(node uint32) (uint64, error) {
+	res, err := s.Substrate.GetNodeRentContract(node)
 	return res, normalizeNotFoundErrors(err)
 }
 
+// CancelRentContract cancels a rent contract, it fails if the contract is not a rent contract
+func (s *SubstrateImpl) CancelRentContract(identity substrate.Identity, contractID uint64) error {
+	if contractID == 0 {
+		return nil
+	}
+
+	contract, err := s.Substrate.GetContract(contractID)
+	if err != nil {
+		return errors.Wrapf(normalizeNotFoundErrors(err), "could not get contract %d", contractID)
+	}
+	if !contract.ContractType.IsRentContract {
+		return errors.Errorf("contract %d is not a rent contract", contractID)
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return chainError("CancelContract", s.Substrate.CancelContract(identity, contractID))
+}
+
 // GetContract returns a contract given its ID
 func (s *SubstrateImpl) GetContract(contractID uint64) (Contract, error) {
 	contract, err := s.Substrate.GetContract(contractID)
@@ -164,10 +203,7 @@ func (s *SubstrateImpl) CancelContract(identity substrate.Identity, contractID u
 	s.m.Lock()
 	defer s.m.Unlock()
 
-	if err := s.Substrate.CancelContract(identity, contractID); err != nil {
-		return normalizeNotFoundErrors(err)
-	}
-	return nil
+	return chainError("CancelContract", s.Substrate.CancelContract(identity, contractID))
 }
 
 // EnsureContractCanceled ensures a canceled contract
@@ -179,10 +215,7 @@ func (s *SubstrateImpl) EnsureContractCanceled(identity substrate.Identity, cont
 	s.m.Lock()
 	defer s.m.Unlock()
 
-	if err := s.Substrate.CancelContract(identity, contractID); err != nil {
-		return normalizeNotFoundErrors(err)
-	}
-	return nil
+	return chainError("CancelContract", s.Substrate.CancelContract(identity, contractID))
 }
 
 // DeleteInvalidContracts deletes invalid contracts
@@ -218,17 +251,19 @@ func (s *SubstrateImpl) IsValidContract(contractID uint64) (bool, error) {
 
 // BatchCreateContract creates a batch of contracts non-atomically
 func (s *SubstrateImpl) BatchCreateContract(identity substrate.Identity, contractsData []substrate.BatchCreateContractData) ([]uint64, *int, error) {
-	return s.Substrate.BatchCreateContract(identity, contractsData)
+	contracts, index, err := s.Substrate.BatchCreateContract(identity, contractsData)
+	return contracts, index, chainError("BatchCreateContract", err)
 }
 
 // BatchAllCreateContract creates a batch of contracts atomically
 func (s *SubstrateImpl) BatchAllCreateContract(identity substrate.Identity, contractsData []substrate.BatchCreateContractData) ([]uint64, error) {
-	return s.Substrate.BatchAllCreateContract(identity, contractsData)
+	contracts, err := s.Substrate.BatchAllCreateContract(identity, contractsData)
+	return contracts, chainError("BatchAllCreateContract", err)
 }
 
 // BatchCancelContract cancels a batch of contracts
 func (s *SubstrateImpl) BatchCancelContract(identity substrate.Identity, contracts []uint64) error {
-	return s.Substrate.BatchCancelContract(identity, contracts)
+	return chainError("BatchCancelContract", s.Substrate.BatchCancelContract(identity, contracts))
 }
 
 // InvalidateNameContract invalidate a name contract
@@ -26,6 +26,10 @@ type Deployment struct {
 	Zdbs             []ZDB
 	Vms              []VM
 	QSFS             []QSFS
+	// ReservedIPs are public ipv4s held by the deployment contract, vms use them by pinning their addresses
+	ReservedIPs []ReservedIP
+	// RentContractID is the rent contract created for the deployment node by RentAndDeploy
+	RentContractID uint64
 
 	// computed
 	NodeDeploymentID map[uint32]uint64
@@ -66,9 +70,110 @@ func (d *Deployment) Validate() error {
 			return errors.Wrapf(err, "vm %s validation failed", vm.Name)
 		}
 	}
+
+	return d.validatePublicIPs()
+}
+
+// validatePublicIPs checks that reserved ips and pinned vm addresses are unique
+func (d *Deployment) validatePublicIPs() error {
+	names := make(map[string]bool)
+	for _, vm := range d.Vms {
+		names[vm.Name] = true
+		names[publicIPName(vm.Name)] = true
+	}
+
+	var ips []string
+	for _, ip := range d.ReservedIPs {
+		if ip.Name == "" {
+			return errors.New("reserved ip name can't be empty")
+		}
+		if names[ip.Name] {
+			return errors.Errorf("reserved ip name %s is duplicated or used by a vm", ip.Name)
+		}
+		names[ip.Name] = true
+
+		if ip.IP == "" {
+			continue
+		}
+		if parsed := ParseIPAddress(ip.IP); parsed == nil || parsed.To4() == nil {
+			return errors.Errorf("reserved ip %s has an invalid ipv4 %s", ip.Name, ip.IP)
+		}
+		ips = append(ips, ip.IP)
+	}
+
+	pinned := make([]string, 0, len(d.Vms))
+	for _, vm := range d.Vms {
+		if vm.PublicIPAddress == "" {
+			continue
+		}
+		for _, ip := range pinned {
+			if SameIPAddress(ip, vm.PublicIPAddress) {
+				return errors.Errorf("public ip address %s is pinned by more than one vm", vm.PublicIPAddress)
+			}
+		}
+		pinned = append(pinned, vm.PublicIPAddress)
+
+		if vm.PublicIP6 && d.reservedIPName(vm.PublicIPAddress) != "" {
+			return errors.Errorf("vm %s uses reserved ip %s which can't have a public ipv6", vm.Name, vm.PublicIPAddress)
+		}
+	}
+
+	for i := range ips {
+		for j := range ips[:i] {
+			if SameIPAddress(ips[i], ips[j]) {
+				return errors.Errorf("reserved ip %s is duplicated", ips[i])
+			}
+		}
+	}
 	return nil
 }
 
+// reservedIPName returns the name of the reserved ip with the given address, or an empty name if it is not reserved
+func (d *Deployment) reservedIPName(ip string) string {
+	if ip == "" {
+		return ""
+	}
+	for _, reserved := range d.ReservedIPs {
+		if SameIPAddress(reserved.IP, ip) {
+			return reserved.Name
+		}
+	}
+	return ""
+}
+
+// PinnedIPs returns the public ips requested by the deployment reserved ips and vms
+func (d *Deployment) PinnedIPs() []string {
+	var ips []string
+	for _, ip := range d.ReservedIPs {
+		if ip.IP != "" {
+			ips = append(ips, ip.IP)
+		}
+	}
+	for _, vm := range d.Vms {
+		if vm.PublicIPAddress != "" && d.reservedIPName(vm.PublicIPAddress) == "" {
+			ips = append(ips, vm.PublicIPAddress)
+		}
+	}
+	return ips
+}
+
+// VMsZosWorkloads generates the workloads of the deployment reserved ips and vms,
+// vms pinned to a reserved ip use its public ip workload
+func (d *Deployment) VMsZosWorkloads() []gridtypes.Workload {
+	var wls []gridtypes.Workload
+	for _, ip := range d.ReservedIPs {
+		wls = append(wls, ConstructPublicIPWorkload(ip.Name, true, false))
+	}
+	for _, vm := range d.Vms {
+		if name := d.reservedIPName(vm.PublicIPAddress); name != "" {
+			wls = append(wls, vm.machineWorkloads(name)...)
+			continue
+		}
+		wls = append(wls, vm.ZosWorkload()...)
+	}
+	return wls
+}
+
 // GenerateMetadata generates deployment metadata
 func (d *Deployment) GenerateMetadata() (string, error) {
 	if len(d.SolutionType) == 0 {
@@ -76,10 +181,11 @@ func (d *Deployment) GenerateMetadata() (string, error) {
 	}
 
 	deploymentData := DeploymentData{
-		Version:     Version,
-		Name:        d.Name,
-		Type:        "vm",
-		ProjectName: d.SolutionType,
+		Version:        Version,
+		Name:           d.Name,
+		Type:           "vm",
+		ProjectName:    d.SolutionType,
+		RentContractID: d.RentContractID,
 	}
 
 	deploymentDataBytes, err := json.Marshal(deploymentData)
@@ -96,6 +202,7 @@ func (d *Deployment) Nullify() {
 	d.QSFS = nil
 	d.Disks = nil
 	d.Zdbs = nil
+	d.ReservedIPs = nil
 	d.ContractID = 0
 }
 
@@ -149,10 +256,7 @@ func (d *Deployment) ZosDeployment(twin uint32) (gridtypes.Deployment, error) {
 		wls = append(wls, z.ZosWorkload())
 	}
 
-	for _, v := range d.Vms {
-		vmWls := v.ZosWorkload()
-		wls = append(wls, vmWls...)
-	}
+	wls = append(wls, d.VMsZosWorkloads()...)
 
 	for _, q := range d.QSFS {
 		qWls, err := q.ZosWorkload()
@@ -219,10 +323,15 @@ func GetUsedIPs(dl gridtypes.Deployment) ([]byte, error) {
 	return usedIPs, nil
 }
 
-// ParseDeploymentData parses the deployment metadata
-func ParseDeploymentData(deploymentMetaData string) (DeploymentData, error) {
+// ParseDeploymentData parses the deployment metadata, encrypted metadata is decrypted with the metadata key
+func ParseDeploymentData(deploymentMetaData string, metadataKey []byte) (DeploymentData, error) {
+	deploymentMetaData, err := DecryptMetadata(metadataKey, deploymentMetaData)
+	if err != nil {
+		return DeploymentData{}, err
+	}
+
 	var deploymentData DeploymentData
-	err := json.Unmarshal([]byte(deploymentMetaData), &deploymentData)
+	err = json.Unmarshal([]byte(deploymentMetaData), &deploymentData)
 	if err != nil {
 		return DeploymentData{}, err
 	}
@@ -230,9 +339,36 @@ func ParseDeploymentData(deploymentMetaData string) (DeploymentData, error) {
 	return deploymentData, nil
 }
 
+// ReservedIPsFromZosDeployment gets the public ips of a zos deployment that are not the public ips of its vms
+func ReservedIPsFromZosDeployment(dl *gridtypes.Deployment) ([]ReservedIP, error) {
+	vmIPs := make(map[string]bool)
+	for _, wl := range dl.Workloads {
+		if wl.Type == zos.ZMachineType {
+			vmIPs[publicIPName(wl.Name.String())] = true
+		}
+	}
+
+	var reserved []ReservedIP
+	for _, wl := range dl.Workloads {
+		if wl.Type != zos.PublicIPType || vmIPs[wl.Name.String()] {
+			continue
+		}
+		res, err := pubIP(dl, wl.Name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get reserved ip %s", wl.Name)
+		}
+		ip := ReservedIP{Name: wl.Name.String()}
+		if !res.IP.Nil() {
+			ip.IP = res.IP.String()
+		}
+		reserved = append(reserved, ip)
+	}
+	return reserved, nil
+}
+
 // NewDeploymentFromZosDeployment generates deployment from zos deployment
-func NewDeploymentFromZosDeployment(d gridtypes.Deployment, nodeID uint32) (Deployment, error) {
-	deploymentData, err := ParseDeploymentData(d.Metadata)
+func NewDeploymentFromZosDeployment(d gridtypes.Deployment, nodeID uint32, metadataKey []byte) (Deployment, error) {
+	deploymentData, err := ParseDeploymentData(d.Metadata, metadataKey)
 	if err != nil {
 		return Deployment{}, errors.Wrap(err, "failed to parse deployment data")
 	}
@@ -271,6 +407,11 @@ func NewDeploymentFromZosDeployment(d gridtypes.Deployment, nodeID uint32) (Depl
 		}
 	}
 
+	reservedIPs, err := ReservedIPsFromZosDeployment(&d)
+	if err != nil {
+		return Deployment{}, err
+	}
+
 	return Deployment{
 		Name:             deploymentData.Name,
 		SolutionType:     deploymentData.ProjectName,
@@ -279,6 +420,8 @@ func NewDeploymentFromZosDeployment(d gridtypes.Deployment, nodeID uint32) (Depl
 		Disks:            disks,
 		QSFS:             qs,
 		Zdbs:             zdbs,
+		ReservedIPs:      reservedIPs,
+		RentContractID:   deploymentData.RentContractID,
 		NodeID:           nodeID,
 		NodeDeploymentID: map[uint32]uint64{nodeID: d.ContractID},
 		ContractID:       d.ContractID,
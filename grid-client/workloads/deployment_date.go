@@ -20,4 +20,6 @@ type DeploymentData struct {
 	Type        string `json:"type"`
 	Name        string `json:"name"`
 	ProjectName string `json:"projectName"`
+	// RentContractID is the rent contract created for the deployment node, it is canceled with the project
+	RentContractID uint64 `json:"rentContractID,omitempty"`
 }
@@ -68,3 +68,51 @@ func TestNewDeployment(t *testing.T) {
 		assert.Equal(t, deployment.ContractID, uint64(0))
 	})
 }
+
+func TestDeploymentReservedIPs(t *testing.T) {
+	vm := VMWorkload
+	vm.Zlogs = nil
+	vm.PublicIPAddress = "185.206.122.33"
+	deployment := NewDeployment("test", 1, "", nil, Network.Name, nil, nil, []VM{vm}, nil)
+	deployment.ReservedIPs = []ReservedIP{{Name: "reserved", IP: "185.206.122.33/24"}}
+
+	t.Run("pinned vms use the reserved ip workload", func(t *testing.T) {
+		assert.NoError(t, deployment.Validate())
+		assert.Equal(t, []string{"185.206.122.33/24"}, deployment.PinnedIPs())
+
+		wls := deployment.VMsZosWorkloads()
+		assert.Len(t, wls, 2)
+		assert.Equal(t, gridtypes.Name("reserved"), wls[0].Name)
+		assert.Equal(t, zos.PublicIPType, wls[0].Type)
+
+		data, err := wls[1].WorkloadData()
+		assert.NoError(t, err)
+		assert.Equal(t, gridtypes.Name("reserved"), data.(*zos.ZMachine).Network.PublicIP)
+	})
+
+	t.Run("other pinned vms get their own ip", func(t *testing.T) {
+		dl := deployment
+		dl.Vms = []VM{vm}
+		dl.Vms[0].PublicIPAddress = "185.206.122.34/24"
+		assert.Equal(t, []string{"185.206.122.33/24", "185.206.122.34/24"}, dl.PinnedIPs())
+		assert.Equal(t, vm.ZosWorkload(), dl.VMsZosWorkloads()[1:])
+	})
+
+	t.Run("invalid reserved ips", func(t *testing.T) {
+		dl := deployment
+		dl.ReservedIPs = []ReservedIP{{Name: "testip"}}
+		assert.Error(t, dl.Validate())
+
+		dl.ReservedIPs = []ReservedIP{{Name: "reserved", IP: "1.1.1.1/24"}, {Name: "reserved2", IP: "1.1.1.1"}}
+		assert.Error(t, dl.Validate())
+
+		dl.ReservedIPs = deployment.ReservedIPs
+		dl.Vms = []VM{vm}
+		dl.Vms[0].PublicIP6 = true
+		assert.Error(t, dl.Validate())
+
+		dl.Vms[0].PublicIP6 = false
+		dl.Vms[0].PublicIP = false
+		assert.Error(t, dl.Validate())
+	})
+}
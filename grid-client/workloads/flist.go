@@ -7,6 +7,9 @@ import (
 	"net/http"
 	"strings"
 	"time"
+
+	gridflist "github.com/threefoldtech/tfgrid-sdk-go/grid-client/flist"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
 )
 
 // FlistChecksumURL returns flist check sum url format
@@ -27,3 +30,43 @@ func GetFlistChecksum(url string) (string, error) {
 	hash, err := io.ReadAll(response.Body)
 	return strings.TrimSpace(string(hash)), err
 }
+
+// FlistWarnings returns the problems of the vm with its flist that zos only reports after the vm is deployed
+func (vm *VM) FlistWarnings(info gridflist.Info) []string {
+	var warnings []string
+
+	if info.Image {
+		if rootfs := uint64(vm.RootfsSize) * uint64(gridtypes.Megabyte); rootfs < info.ImageSize {
+			warnings = append(warnings, fmt.Sprintf(
+				"rootfs size %d MB is smaller than the flist vm image size %d MB",
+				vm.RootfsSize, (info.ImageSize+uint64(gridtypes.Megabyte)-1)/uint64(gridtypes.Megabyte),
+			))
+		}
+		if vm.Entrypoint != "" {
+			warnings = append(warnings, fmt.Sprintf("entrypoint %s is ignored, the flist is a full vm image", vm.Entrypoint))
+		}
+		return warnings
+	}
+
+	fields := strings.Fields(vm.Entrypoint)
+	switch {
+	case len(fields) == 0 && len(info.Entrypoints) == 0:
+		warnings = append(warnings, "no entrypoint is set and the flist has no known init")
+	case len(fields) != 0 && strings.HasPrefix(fields[0], "/") && !info.Executable(fields[0]):
+		warning := fmt.Sprintf("entrypoint %s doesn't exist in the flist", fields[0])
+		if len(info.Entrypoints) != 0 {
+			warning += fmt.Sprintf(", found %s", strings.Join(info.Entrypoints, ", "))
+		}
+		warnings = append(warnings, warning)
+	}
+	return warnings
+}
+
+// FlistWarnings returns the problems of the k8s node with its flist that zos only reports after the node vm is deployed
+func (k *K8sNode) FlistWarnings(info gridflist.Info) []string {
+	if info.Image {
+		return []string{"the flist is a full vm image, k8s nodes are started from container flists with zinit"}
+	}
+	vm := VM{Entrypoint: k8sEntrypoint}
+	return vm.FlistWarnings(info)
+}
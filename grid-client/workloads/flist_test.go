@@ -5,6 +5,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	gridflist "github.com/threefoldtech/tfgrid-sdk-go/grid-client/flist"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
 )
 
 func TestFlistChecksum(t *testing.T) {
@@ -22,3 +24,51 @@ func TestFlistChecksum(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+func TestFlistWarnings(t *testing.T) {
+	container := gridflist.NewInfo("container", gridflist.Contents{Content: []gridflist.File{
+		{Path: "/sbin/zinit", Type: gridflist.RegularFile},
+		{Path: "/sbin", Type: gridflist.Directory},
+	}})
+	image := gridflist.NewInfo("image", gridflist.Contents{Content: []gridflist.File{
+		{Path: "/image.raw", Size: 2 * uint64(gridtypes.Gigabyte), Type: gridflist.RegularFile},
+	}})
+
+	t.Run("test_container_entrypoint", func(t *testing.T) {
+		vm := VM{Entrypoint: "/sbin/zinit init"}
+		assert.Empty(t, vm.FlistWarnings(container))
+
+		vm.Entrypoint = "/init.sh"
+		warnings := vm.FlistWarnings(container)
+		assert.Len(t, warnings, 1)
+		assert.Contains(t, warnings[0], "/init.sh doesn't exist")
+		assert.Contains(t, warnings[0], "found /sbin/zinit")
+
+		vm.Entrypoint = "/sbin"
+		assert.Len(t, vm.FlistWarnings(container), 1)
+
+		vm.Entrypoint = ""
+		assert.Empty(t, vm.FlistWarnings(container))
+		assert.Len(t, vm.FlistWarnings(gridflist.NewInfo("empty", gridflist.Contents{})), 1)
+	})
+
+	t.Run("test_image_rootfs_size", func(t *testing.T) {
+		vm := VM{RootfsSize: 2 * 1024}
+		assert.Empty(t, vm.FlistWarnings(image))
+
+		vm.RootfsSize = 1024
+		vm.Entrypoint = "/sbin/zinit init"
+		warnings := vm.FlistWarnings(image)
+		assert.Len(t, warnings, 2)
+		assert.Contains(t, warnings[0], "smaller than the flist vm image size 2048 MB")
+	})
+	t.Run("test_k8s_node", func(t *testing.T) {
+		node := K8sNode{Name: "master"}
+		assert.Empty(t, node.FlistWarnings(container))
+		assert.Len(t, node.FlistWarnings(gridflist.NewInfo("empty", gridflist.Contents{})), 1)
+
+		warnings := node.FlistWarnings(image)
+		assert.Len(t, warnings, 1)
+		assert.Contains(t, warnings[0], "full vm image")
+	})
+}
@@ -15,6 +15,9 @@ import (
 	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
 )
 
+// k8sEntrypoint is the entrypoint of the k8s nodes vms
+const k8sEntrypoint = "/sbin/zinit init"
+
 // K8sNode kubernetes data
 type K8sNode struct {
 	Name           string `json:"name"`
@@ -308,7 +311,7 @@ func (k *K8sNode) zosWorkload(cluster *K8sCluster, isWorker bool) (K8sWorkloads
 				CPU:    uint8(k.CPU),
 				Memory: gridtypes.Unit(uint(k.Memory)) * gridtypes.Megabyte,
 			},
-			Entrypoint: "/sbin/zinit init",
+			Entrypoint: k8sEntrypoint,
 			Mounts: []zos.MachineMount{
 				{Name: gridtypes.Name(diskName), Mountpoint: "/mydisk"},
 			},
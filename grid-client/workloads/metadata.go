@@ -0,0 +1,101 @@
+package workloads
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// encryptedMetadataPrefix marks encrypted metadata, it is followed by the key id and the encrypted metadata
+const encryptedMetadataPrefix = "enc:"
+
+// ErrMetadataKeyNotFound is returned when metadata is encrypted with a key other than the given one
+var ErrMetadataKeyNotFound = errors.New("metadata encryption key not found")
+
+// DeriveMetadataKey derives the metadata encryption key from an identity seed
+func DeriveMetadataKey(seed []byte) []byte {
+	return hmacSum(seed, "tfgrid metadata encryption key")
+}
+
+// IsEncryptedMetadata checks if the metadata is encrypted
+func IsEncryptedMetadata(metadata string) bool {
+	return strings.HasPrefix(metadata, encryptedMetadataPrefix)
+}
+
+// EncryptMetadata encrypts the metadata with the key, empty or already encrypted metadata is returned as is.
+// the nonce is derived from the metadata so encrypting the same metadata twice gives the same result
+// and the workloads hashes don't change between updates.
+func EncryptMetadata(key []byte, metadata string) (string, error) {
+	if len(metadata) == 0 || IsEncryptedMetadata(metadata) {
+		return metadata, nil
+	}
+
+	aead, err := newMetadataCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := hmacSum(key, "nonce:"+metadata)[:aead.NonceSize()]
+	sealed := aead.Seal(nonce, nonce, []byte(metadata), nil)
+
+	return encryptedMetadataPrefix + metadataKeyID(key) + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptMetadata decrypts metadata encrypted with the key, plain metadata is returned as is
+func DecryptMetadata(key []byte, metadata string) (string, error) {
+	if !IsEncryptedMetadata(metadata) {
+		return metadata, nil
+	}
+
+	keyID, encoded, ok := strings.Cut(strings.TrimPrefix(metadata, encryptedMetadataPrefix), ":")
+	if !ok {
+		return "", errors.New("invalid encrypted metadata format")
+	}
+
+	if key == nil || metadataKeyID(key) != keyID {
+		return "", errors.Wrapf(ErrMetadataKeyNotFound, "key id %s", keyID)
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to decode encrypted metadata")
+	}
+
+	aead, err := newMetadataCipher(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("encrypted metadata is too short")
+	}
+
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to decrypt metadata")
+	}
+	return string(plain), nil
+}
+
+func newMetadataCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(hmacSum(key, "encryption"))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create metadata cipher")
+	}
+	return cipher.NewGCM(block)
+}
+
+func metadataKeyID(key []byte) string {
+	return hex.EncodeToString(hmacSum(key, "id")[:8])
+}
+
+func hmacSum(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
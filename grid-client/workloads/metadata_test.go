@@ -0,0 +1,59 @@
+package workloads
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetadataEncryption(t *testing.T) {
+	key := DeriveMetadataKey([]byte("seed"))
+	metadata := `{"version":3,"type":"network","name":"net","projectName":"Network"}`
+
+	encrypted, err := EncryptMetadata(key, metadata)
+	require.NoError(t, err)
+	assert.True(t, IsEncryptedMetadata(encrypted))
+	assert.NotContains(t, encrypted, "projectName")
+
+	t.Run("encryption is deterministic", func(t *testing.T) {
+		again, err := EncryptMetadata(key, metadata)
+		require.NoError(t, err)
+		assert.Equal(t, encrypted, again)
+
+		twice, err := EncryptMetadata(key, encrypted)
+		require.NoError(t, err)
+		assert.Equal(t, encrypted, twice)
+	})
+
+	t.Run("other key", func(t *testing.T) {
+		other, err := EncryptMetadata(DeriveMetadataKey([]byte("other seed")), metadata)
+		require.NoError(t, err)
+
+		_, err = ParseDeploymentData(other, key)
+		assert.ErrorIs(t, err, ErrMetadataKeyNotFound)
+	})
+
+	t.Run("no key", func(t *testing.T) {
+		_, err := ParseDeploymentData(encrypted, nil)
+		assert.ErrorIs(t, err, ErrMetadataKeyNotFound)
+	})
+
+	t.Run("same key", func(t *testing.T) {
+		deploymentData, err := ParseDeploymentData(encrypted, key)
+		require.NoError(t, err)
+		assert.Equal(t, "net", deploymentData.Name)
+		assert.Equal(t, "Network", deploymentData.ProjectName)
+	})
+
+	t.Run("plain metadata", func(t *testing.T) {
+		plain, err := DecryptMetadata(nil, metadata)
+		require.NoError(t, err)
+		assert.Equal(t, metadata, plain)
+	})
+
+	t.Run("tampered metadata", func(t *testing.T) {
+		_, err := DecryptMetadata(key, encrypted[:len(encrypted)-2])
+		assert.Error(t, err)
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"slices"
 
 	"github.com/pkg/errors"
 	client "github.com/threefoldtech/tfgrid-sdk-go/grid-client/node"
@@ -21,6 +22,8 @@ var ExternalSKZeroValue = "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="
 
 // UserAccess struct
 type UserAccess struct {
+	// Name is empty for the network wireguard access added by AddWGAccess
+	Name       string `json:"name,omitempty"`
 	Subnet     string `json:"subnet"`
 	PrivateKey string `json:"private_key"`
 	NodeID     uint32 `json:"node_id"`
@@ -30,12 +33,14 @@ type UserAccess struct {
 type NetworkMetaData struct {
 	Version      int          `json:"version"`
 	UserAccesses []UserAccess `json:"user_accesses"`
+	MyceliumOnly bool         `json:"mycelium_only,omitempty"`
 }
 
 func (m *NetworkMetaData) UnmarshalJSON(data []byte) error {
 	var deprecated struct {
 		Version      int          `json:"version"`
 		UserAccesses []UserAccess `json:"user_accesses"`
+		MyceliumOnly bool         `json:"mycelium_only"`
 		// deprecated fields
 
 		UserAccessIP string `json:"ip"`
@@ -47,6 +52,7 @@ func (m *NetworkMetaData) UnmarshalJSON(data []byte) error {
 	}
 	m.Version = deprecated.Version
 	m.UserAccesses = deprecated.UserAccesses
+	m.MyceliumOnly = deprecated.MyceliumOnly
 	if deprecated.UserAccessIP != "" || deprecated.PrivateKey != "" || deprecated.PublicNodeID != 0 {
 		// it must be deprecated format
 		m.UserAccesses = []UserAccess{{
@@ -66,6 +72,10 @@ type ZNet struct {
 	IPRange      gridtypes.IPNet
 	AddWGAccess  bool
 	MyceliumKeys map[uint32][]byte
+	// UserAccesses are named wireguard accesses to the network, each one has its own key and subnet
+	UserAccesses []UserAccess
+	// MyceliumOnly networks connect their nodes through mycelium only, without wireguard peers or a public node
+	MyceliumOnly bool
 
 	// computed
 	SolutionType     string
@@ -78,10 +88,15 @@ type ZNet struct {
 
 	WGPort map[uint32]int
 	Keys   map[uint32]wgtypes.Key
+	// Endpoints are the wireguard endpoints of the nodes, hidden nodes have nil endpoints
+	Endpoints map[uint32]net.IP
+
+	// UserAccessWGConfigs are the wireguard configs of the named user accesses
+	UserAccessWGConfigs map[string]string
 }
 
 // NewNetworkFromWorkload generates a new znet from a workload
-func NewNetworkFromWorkload(wl gridtypes.Workload, nodeID uint32) (ZNet, error) {
+func NewNetworkFromWorkload(wl gridtypes.Workload, nodeID uint32, metadataKey []byte) (ZNet, error) {
 	dataI, err := wl.WorkloadData()
 	if err != nil {
 		return ZNet{}, errors.Wrap(err, "failed to get workload data")
@@ -106,8 +121,13 @@ func NewNetworkFromWorkload(wl gridtypes.Workload, nodeID uint32) (ZNet, error)
 		wgPort[nodeID] = int(data.WGListenPort)
 	}
 
+	plainMetadata, err := DecryptMetadata(metadataKey, wl.Metadata)
+	if err != nil {
+		return ZNet{}, errors.Wrapf(err, "failed to decrypt network metadata from workload %s", wl.Name)
+	}
+
 	metadata := NetworkMetaData{}
-	if err := json.Unmarshal([]byte(wl.Metadata), &metadata); err != nil {
+	if err := json.Unmarshal([]byte(plainMetadata), &metadata); err != nil {
 		return ZNet{}, errors.Wrapf(err, "failed to parse network metadata from workload %s", wl.Name)
 	}
 
@@ -134,6 +154,12 @@ func NewNetworkFromWorkload(wl gridtypes.Workload, nodeID uint32) (ZNet, error)
 	if len(metadata.UserAccesses) > 0 {
 		publicNodeID = metadata.UserAccesses[0].NodeID
 	}
+	var userAccesses []UserAccess
+	for _, access := range metadata.UserAccesses {
+		if access.Name != "" {
+			userAccesses = append(userAccesses, access)
+		}
+	}
 	myceliumKeys := make(map[uint32][]byte)
 	if data.Mycelium != nil {
 		myceliumKeys[nodeID] = data.Mycelium.Key
@@ -152,6 +178,8 @@ func NewNetworkFromWorkload(wl gridtypes.Workload, nodeID uint32) (ZNet, error)
 		ExternalIP:   externalIP,
 		ExternalSK:   externalSK,
 		MyceliumKeys: myceliumKeys,
+		UserAccesses: userAccesses,
+		MyceliumOnly: metadata.MyceliumOnly,
 	}, nil
 }
 
@@ -171,6 +199,20 @@ func (znet *ZNet) Validate() error {
 			return fmt.Errorf("invalid mycelium key length %d must be %d or empty", len(key), zos.MyceliumKeyLen)
 		}
 	}
+	if znet.MyceliumOnly && (znet.AddWGAccess || len(znet.UserAccesses) != 0) {
+		return errors.New("mycelium only networks can't have wireguard accesses")
+	}
+
+	names := make(map[string]struct{})
+	for _, access := range znet.UserAccesses {
+		if access.Name == "" {
+			return errors.New("user access name can't be empty")
+		}
+		if _, ok := names[access.Name]; ok {
+			return errors.Errorf("user access %s is duplicated", access.Name)
+		}
+		names[access.Name] = struct{}{}
+	}
 
 	return nil
 }
@@ -230,6 +272,11 @@ func (znet *ZNet) AssignNodesIPs(nodes []uint32) error {
 			ips[node] = ip
 		}
 	}
+	for _, access := range znet.UserAccesses {
+		if ip, err := gridtypes.ParseIPNet(access.Subnet); err == nil && ip.IP.To4() != nil {
+			usedIPs = append(usedIPs, ip.IP.To4()[2])
+		}
+	}
 	var cur byte = 2
 	if znet.AddWGAccess {
 		if znet.ExternalIP != nil {
@@ -254,10 +301,65 @@ func (znet *ZNet) AssignNodesIPs(nodes []uint32) error {
 			ips[nodeID] = IPNet(znet.IPRange.IP[l-4], znet.IPRange.IP[l-3], cur, znet.IPRange.IP[l-2], 24)
 		}
 	}
+	for i, access := range znet.UserAccesses {
+		if access.Subnet != "" {
+			continue
+		}
+		err := nextFreeIP(usedIPs, &cur)
+		if err != nil {
+			return err
+		}
+		usedIPs = append(usedIPs, cur)
+		ip := IPNet(znet.IPRange.IP[l-4], znet.IPRange.IP[l-3], cur, znet.IPRange.IP[l-1], 24)
+		znet.UserAccesses[i].Subnet = ip.String()
+	}
 	znet.NodesIPRange = ips
 	return nil
 }
 
+// AddUserAccess adds a named wireguard access with a new private key to the network, its subnet is assigned on deployment
+func (znet *ZNet) AddUserAccess(name string) error {
+	if name == "" {
+		return errors.New("user access name can't be empty")
+	}
+	if slices.ContainsFunc(znet.UserAccesses, func(access UserAccess) bool { return access.Name == name }) {
+		return errors.Errorf("user access %s already exists in network %s", name, znet.Name)
+	}
+
+	key, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		return errors.Wrapf(err, "failed to generate wireguard private key for user access %s", name)
+	}
+	znet.UserAccesses = append(znet.UserAccesses, UserAccess{Name: name, PrivateKey: key.String()})
+	return nil
+}
+
+// RemoveUserAccess removes a named wireguard access from the network
+func (znet *ZNet) RemoveUserAccess(name string) error {
+	i := slices.IndexFunc(znet.UserAccesses, func(access UserAccess) bool { return access.Name == name })
+	if i == -1 {
+		return errors.Errorf("user access %s doesn't exist in network %s", name, znet.Name)
+	}
+	znet.UserAccesses = slices.Delete(znet.UserAccesses, i, i+1)
+	delete(znet.UserAccessWGConfigs, name)
+	return nil
+}
+
+// UserAccessWGConfig generates the wireguard config of a user access through the network public node endpoint
+func (znet *ZNet) UserAccessWGConfig(access UserAccess, publicNodeEndpoint string) (string, error) {
+	subnet, err := gridtypes.ParseIPNet(access.Subnet)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to parse user access %s subnet", access.Name)
+	}
+	return GenerateWGConfig(
+		WgIP(subnet).IP.String(),
+		access.PrivateKey,
+		znet.Keys[znet.PublicNodeID].PublicKey().String(),
+		publicNodeEndpoint,
+		znet.IPRange.String(),
+	), nil
+}
+
 // AssignNodesWGPort assign network nodes wireguard port
 func (znet *ZNet) AssignNodesWGPort(ctx context.Context, sub subi.SubstrateExt, ncPool client.NodeClientGetter, nodes []uint32, usedPorts map[uint32][]uint16) error {
 	if usedPorts == nil {
@@ -56,4 +56,24 @@ func TestNetwork(t *testing.T) {
 			`, "", "", "", Network.IPRange.String(), ""), "\t", "")+"\t",
 		)
 	})
+
+	t.Run("test_user_accesses", func(t *testing.T) {
+		znet := Network
+		assert.NoError(t, znet.AddUserAccess("alice"))
+		assert.NoError(t, znet.AddUserAccess("ci"))
+		assert.Error(t, znet.AddUserAccess("alice"))
+		assert.Error(t, znet.AddUserAccess(""))
+		assert.NoError(t, znet.Validate())
+
+		assert.NoError(t, znet.AssignNodesIPs(znet.Nodes))
+		assert.Equal(t, "10.20.2.0/24", znet.NodesIPRange[1].String())
+		assert.Equal(t, "10.20.3.0/24", znet.UserAccesses[0].Subnet)
+		assert.Equal(t, "10.20.4.0/24", znet.UserAccesses[1].Subnet)
+		assert.NotEqual(t, znet.UserAccesses[0].PrivateKey, znet.UserAccesses[1].PrivateKey)
+
+		assert.NoError(t, znet.RemoveUserAccess("alice"))
+		assert.Error(t, znet.RemoveUserAccess("alice"))
+		assert.Len(t, znet.UserAccesses, 1)
+		assert.Equal(t, "ci", znet.UserAccesses[0].Name)
+	})
 }
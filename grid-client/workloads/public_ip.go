@@ -2,10 +2,21 @@
 package workloads
 
 import (
+	"net"
+
 	"github.com/threefoldtech/zos/pkg/gridtypes"
 	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
 )
 
+// ReservedIP is a public ipv4 reserved by a deployment contract without a vm.
+// the ip is kept by the contract while the deployment vms pinned to it are removed and recreated.
+type ReservedIP struct {
+	Name string `json:"name"`
+	// IP is the reserved ip in cidr format, it is computed on deployment if it is empty.
+	// the farm picks the ips of new contracts, so a new contract can only request the free ips of the farm if there are no other ones
+	IP string `json:"ip"`
+}
+
 // ConstructPublicIPWorkload constructs a public IP workload
 func ConstructPublicIPWorkload(workloadName string, ipv4 bool, ipv6 bool) gridtypes.Workload {
 	return gridtypes.Workload{
@@ -18,3 +29,17 @@ func ConstructPublicIPWorkload(workloadName string, ipv4 bool, ipv6 bool) gridty
 		}),
 	}
 }
+
+// ParseIPAddress parses an ip in cidr or plain format, it returns nil for invalid ips
+func ParseIPAddress(ip string) net.IP {
+	if parsed, _, err := net.ParseCIDR(ip); err == nil {
+		return parsed
+	}
+	return net.ParseIP(ip)
+}
+
+// SameIPAddress checks if two ips in cidr or plain format are the same address
+func SameIPAddress(ip1, ip2 string) bool {
+	parsed1, parsed2 := ParseIPAddress(ip1), ParseIPAddress(ip2)
+	return parsed1 != nil && parsed1.Equal(parsed2)
+}
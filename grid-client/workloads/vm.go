@@ -27,9 +27,13 @@ type VM struct {
 	Corex         bool   `json:"corex"` //TODO: Is it works ??
 	ComputedIP    string `json:"computedip"`
 	ComputedIP6   string `json:"computedip6"`
-	PlanetaryIP   string `json:"planetary_ip"`
-	MyceliumIP    string `json:"mycelium_ip"`
-	IP            string `json:"ip"`
+	// PublicIPAddress pins the vm public ipv4 to a farm ip in cidr or plain format.
+	// if it is a reserved ip of the vm deployment, the vm uses the reserved ip workload and keeps the ip when it is recreated.
+	// otherwise a new contract can only get the ip if it is the only free ip of the farm.
+	PublicIPAddress string `json:"public_ip_address"`
+	PlanetaryIP     string `json:"planetary_ip"`
+	MyceliumIP      string `json:"mycelium_ip"`
+	IP              string `json:"ip"`
 	// used to get the same mycelium ip for the vm.
 	MyceliumIPSeed []byte            `json:"mycelium_ip_seed"`
 	Description    string            `json:"description"`
@@ -86,36 +90,43 @@ func NewVMFromWorkload(wl *gridtypes.Workload, dl *gridtypes.Deployment) (VM, er
 		pubIP6 = pubIPRes.IPv6.String()
 	}
 
+	// vms that use a reserved ip of the deployment are pinned to it
+	var pinnedIP string
+	if !data.Network.PublicIP.IsEmpty() && data.Network.PublicIP.String() != publicIPName(wl.Name.String()) {
+		pinnedIP = pubIP4
+	}
+
 	var myceliumIPSeed []byte
 	if data.Network.Mycelium != nil {
 		myceliumIPSeed = data.Network.Mycelium.Seed
 	}
 
 	return VM{
-		Name:           wl.Name.String(),
-		Description:    wl.Description,
-		Flist:          data.FList,
-		FlistChecksum:  "",
-		PublicIP:       !pubIPRes.IP.Nil(),
-		ComputedIP:     pubIP4,
-		PublicIP6:      !pubIPRes.IPv6.Nil(),
-		ComputedIP6:    pubIP6,
-		Planetary:      result.PlanetaryIP != "",
-		Corex:          data.Corex,
-		PlanetaryIP:    result.PlanetaryIP,
-		MyceliumIP:     result.MyceliumIP,
-		MyceliumIPSeed: myceliumIPSeed,
-		IP:             data.Network.Interfaces[0].IP.String(),
-		CPU:            int(data.ComputeCapacity.CPU),
-		GPUs:           data.GPU,
-		Memory:         int(data.ComputeCapacity.Memory / gridtypes.Megabyte),
-		RootfsSize:     int(data.Size / gridtypes.Megabyte),
-		Entrypoint:     data.Entrypoint,
-		Mounts:         mounts(data.Mounts),
-		Zlogs:          zlogs(dl, wl.Name.String()),
-		EnvVars:        data.Env,
-		NetworkName:    string(data.Network.Interfaces[0].Network),
-		ConsoleURL:     result.ConsoleURL,
+		Name:            wl.Name.String(),
+		Description:     wl.Description,
+		Flist:           data.FList,
+		FlistChecksum:   "",
+		PublicIP:        !pubIPRes.IP.Nil(),
+		ComputedIP:      pubIP4,
+		PublicIP6:       !pubIPRes.IPv6.Nil(),
+		ComputedIP6:     pubIP6,
+		PublicIPAddress: pinnedIP,
+		Planetary:       result.PlanetaryIP != "",
+		Corex:           data.Corex,
+		PlanetaryIP:     result.PlanetaryIP,
+		MyceliumIP:      result.MyceliumIP,
+		MyceliumIPSeed:  myceliumIPSeed,
+		IP:              data.Network.Interfaces[0].IP.String(),
+		CPU:             int(data.ComputeCapacity.CPU),
+		GPUs:            data.GPU,
+		Memory:          int(data.ComputeCapacity.Memory / gridtypes.Megabyte),
+		RootfsSize:      int(data.Size / gridtypes.Megabyte),
+		Entrypoint:      data.Entrypoint,
+		Mounts:          mounts(data.Mounts),
+		Zlogs:           zlogs(dl, wl.Name.String()),
+		EnvVars:         data.Env,
+		NetworkName:     string(data.Network.Interfaces[0].Network),
+		ConsoleURL:      result.ConsoleURL,
 	}, nil
 }
 
@@ -151,16 +162,28 @@ func pubIP(dl *gridtypes.Deployment, name gridtypes.Name) (zos.PublicIPResult, e
 	return pubIPResult, nil
 }
 
+// publicIPName is the name of the public ip workload of a vm
+func publicIPName(vmName string) string {
+	return fmt.Sprintf("%sip", vmName)
+}
+
 // ZosWorkload generates zos vm workloads
 func (vm *VM) ZosWorkload() []gridtypes.Workload {
 	var workloads []gridtypes.Workload
 
-	publicIPName := ""
+	ipName := ""
 	if vm.PublicIP || vm.PublicIP6 {
-		publicIPName = fmt.Sprintf("%sip", vm.Name)
-		workloads = append(workloads, ConstructPublicIPWorkload(publicIPName, vm.PublicIP, vm.PublicIP6))
+		ipName = publicIPName(vm.Name)
+		workloads = append(workloads, ConstructPublicIPWorkload(ipName, vm.PublicIP, vm.PublicIP6))
 	}
 
+	return append(workloads, vm.machineWorkloads(ipName)...)
+}
+
+// machineWorkloads generates the zlogs and zmachine workloads of the vm attached to the given public ip workload
+func (vm *VM) machineWorkloads(ipName string) []gridtypes.Workload {
+	var workloads []gridtypes.Workload
+
 	var mounts []zos.MachineMount
 	for _, mount := range vm.Mounts {
 		mounts = append(mounts, zos.MachineMount{Name: gridtypes.Name(mount.DiskName), Mountpoint: mount.MountPoint})
@@ -189,7 +212,7 @@ func (vm *VM) ZosWorkload() []gridtypes.Workload {
 						IP:      net.ParseIP(vm.IP),
 					},
 				},
-				PublicIP:  gridtypes.Name(publicIPName),
+				PublicIP:  gridtypes.Name(ipName),
 				Planetary: vm.Planetary,
 				Mycelium:  myceliumIP,
 			},
@@ -244,6 +267,14 @@ func (vm *VM) Validate() error {
 	if len(vm.MyceliumIPSeed) != zos.MyceliumIPSeedLen && len(vm.MyceliumIPSeed) != 0 {
 		return fmt.Errorf("invalid mycelium ip seed length %d must be %d or empty", len(vm.MyceliumIPSeed), zos.MyceliumIPSeedLen)
 	}
+	if vm.PublicIPAddress != "" {
+		if !vm.PublicIP {
+			return errors.Wrap(ErrInvalidInput, "a pinned public ip address requires a public ipv4")
+		}
+		if ip := ParseIPAddress(vm.PublicIPAddress); ip == nil || ip.To4() == nil {
+			return errors.Wrapf(ErrInvalidInput, "invalid public ip address %s", vm.PublicIPAddress)
+		}
+	}
 	return nil
 }
 
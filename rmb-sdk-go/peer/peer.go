@@ -304,8 +304,8 @@ func (d *Peer) handleIncoming(incoming *types.Envelope) error {
 	}
 
 	if errResp != nil {
-		// todo: include code also
-		return fmt.Errorf(errResp.Message)
+		// the error is signed by the remote twin, so it's the remote peer that failed the request
+		return rmb.RemoteError{Code: errResp.Code, Message: errResp.Message}
 	}
 
 	var output []byte
@@ -112,8 +112,7 @@ func (d *RpcClient) CallWithSession(ctx context.Context, twin uint32, session *s
 	errResp := response.GetError()
 
 	if errResp != nil {
-		// todo: include code also
-		return fmt.Errorf(errResp.Message)
+		return rmb.RemoteError{Code: errResp.Code, Message: errResp.Message}
 	}
 
 	resp := response.GetResponse()
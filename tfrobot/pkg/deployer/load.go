@@ -215,7 +215,7 @@ func loadNodeDeployments(ctx context.Context, tfPluginClient deployer.TFPluginCl
 
 		log.Debug().Uint64("contract ID", dl.ContractID).Msg("loading deployment ")
 
-		deployment, err := workloads.NewDeploymentFromZosDeployment(dl, nodeID)
+		deployment, err := workloads.NewDeploymentFromZosDeployment(dl, nodeID, tfPluginClient.State.MetadataKey())
 		if err != nil {
 			log.Debug().Err(err).Uint64("contract ID", dl.ContractID).Msg("couldn't load ")
 			return nil, err